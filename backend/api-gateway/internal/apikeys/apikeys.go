@@ -0,0 +1,149 @@
+package apikeys
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var ErrInvalidKey = errors.New("invalid api key")
+
+// maxEntries bounds the cache, which also remembers keys that were rejected.
+const maxEntries = 10000
+
+// Verifier resolves a personal API key to the user it acts for.
+type Verifier interface {
+	Verify(ctx context.Context, key string) (*Key, error)
+}
+
+// Key is a verified API key. Permissions are the scopes of the key its user still has.
+type Key struct {
+	ID          string     `json:"id"`
+	UserID      string     `json:"user_id"`
+	Roles       []string   `json:"roles"`
+	Permissions []string   `json:"permissions"`
+	RateLimit   int        `json:"rate_limit"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+type entry struct {
+	key       *Key
+	fetchedAt time.Time
+}
+
+// Client verifies keys with auth-service and caches the answer for ttl, so a key is only sent
+// to auth-service about once per ttl. Revoked keys are caught by the revocation list in the
+// meantime.
+type Client struct {
+	url        string
+	apiKey     string
+	ttl        time.Duration
+	httpClient *http.Client
+
+	mu      sync.Mutex
+	entries map[string]entry
+}
+
+// NewClient creates a client for the verify endpoint at url. apiKey is sent as X-Internal-Key.
+func NewClient(url, apiKey string, ttl time.Duration) *Client {
+	return &Client{
+		url:        url,
+		apiKey:     apiKey,
+		ttl:        ttl,
+		httpClient: &http.Client{Timeout: 5 * time.Second},
+		entries:    map[string]entry{},
+	}
+}
+
+func (c *Client) Verify(ctx context.Context, key string) (*Key, error) {
+	// the cache is keyed by a digest so the keys themselves are not kept in memory
+	sum := sha256.Sum256([]byte(key))
+	digest := hex.EncodeToString(sum[:])
+
+	c.mu.Lock()
+	cached, ok := c.entries[digest]
+	c.mu.Unlock()
+
+	if !ok || time.Since(cached.fetchedAt) >= c.ttl {
+		verified, err := c.fetch(ctx, key)
+		if err != nil && !errors.Is(err, ErrInvalidKey) {
+			return nil, err
+		}
+
+		cached = entry{key: verified, fetchedAt: time.Now()}
+		c.mu.Lock()
+		c.prune()
+		c.entries[digest] = cached
+		c.mu.Unlock()
+	}
+
+	if cached.key == nil {
+		return nil, ErrInvalidKey
+	}
+	if cached.key.ExpiresAt != nil && !cached.key.ExpiresAt.After(time.Now()) {
+		return nil, ErrInvalidKey
+	}
+	return cached.key, nil
+}
+
+// prune drops expired entries once the cache is full, and everything if that is not enough.
+func (c *Client) prune() {
+	if len(c.entries) < maxEntries {
+		return
+	}
+
+	for digest, e := range c.entries {
+		if time.Since(e.fetchedAt) >= c.ttl {
+			delete(c.entries, digest)
+		}
+	}
+	if len(c.entries) >= maxEntries {
+		c.entries = map[string]entry{}
+	}
+}
+
+func (c *Client) fetch(ctx context.Context, key string) (*Key, error) {
+	body, err := json.Marshal(map[string]string{"key": key})
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.apiKey != "" {
+		req.Header.Set("X-Internal-Key", c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify api key: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		return nil, ErrInvalidKey
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to verify api key: status %d", resp.StatusCode)
+	}
+
+	var verified Key
+	if err := json.NewDecoder(resp.Body).Decode(&verified); err != nil {
+		return nil, fmt.Errorf("failed to decode api key: %w", err)
+	}
+	if verified.ID == "" || verified.UserID == "" {
+		return nil, errors.New("failed to decode api key: missing id")
+	}
+
+	return &verified, nil
+}
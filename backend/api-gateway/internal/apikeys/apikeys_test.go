@@ -0,0 +1,103 @@
+package apikeys
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testVerifyServer struct {
+	*httptest.Server
+	keys map[string]Key
+	hits atomic.Int32
+}
+
+func newTestVerifyServer(t *testing.T, keys map[string]Key) *testVerifyServer {
+	s := &testVerifyServer{keys: keys}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.hits.Add(1)
+		if r.Header.Get("X-Internal-Key") != "internal" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		var req struct {
+			Key string `json:"key"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		key, ok := s.keys[req.Key]
+		if !ok {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		_ = json.NewEncoder(w).Encode(key)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func TestClient_CachesVerifiedKeys(t *testing.T) {
+	server := newTestVerifyServer(t, map[string]Key{
+		"ak_1.secret": {ID: "key-1", UserID: "user-1", Permissions: []string{"users:list"}, RateLimit: 60},
+	})
+	client := NewClient(server.URL, "internal", time.Minute)
+
+	for i := 0; i < 3; i++ {
+		key, err := client.Verify(context.Background(), "ak_1.secret")
+		require.NoError(t, err)
+		assert.Equal(t, "user-1", key.UserID)
+		assert.Equal(t, []string{"users:list"}, key.Permissions)
+	}
+	assert.Equal(t, int32(1), server.hits.Load(), "the key should be verified once")
+
+	for i := 0; i < 3; i++ {
+		_, err := client.Verify(context.Background(), "ak_1.wrong")
+		assert.ErrorIs(t, err, ErrInvalidKey)
+	}
+	assert.Equal(t, int32(2), server.hits.Load(), "a rejected key should be remembered too")
+}
+
+func TestClient_ReverifiesAfterTTL(t *testing.T) {
+	server := newTestVerifyServer(t, map[string]Key{
+		"ak_1.secret": {ID: "key-1", UserID: "user-1"},
+	})
+	client := NewClient(server.URL, "internal", time.Minute)
+
+	_, err := client.Verify(context.Background(), "ak_1.secret")
+	require.NoError(t, err)
+
+	// the key is deleted in auth-service and the cached answer runs out
+	delete(server.keys, "ak_1.secret")
+	client.ttl = 0
+
+	_, err = client.Verify(context.Background(), "ak_1.secret")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestClient_RejectsExpiredKeys(t *testing.T) {
+	expired := time.Now().Add(-time.Second)
+	server := newTestVerifyServer(t, map[string]Key{
+		"ak_1.secret": {ID: "key-1", UserID: "user-1", ExpiresAt: &expired},
+	})
+	client := NewClient(server.URL, "internal", time.Minute)
+
+	_, err := client.Verify(context.Background(), "ak_1.secret")
+	assert.ErrorIs(t, err, ErrInvalidKey)
+}
+
+func TestClient_ServiceErrors(t *testing.T) {
+	server := newTestVerifyServer(t, map[string]Key{})
+	client := NewClient(server.URL, "wrong", time.Minute)
+
+	_, err := client.Verify(context.Background(), "ak_1.secret")
+	require.Error(t, err)
+	assert.NotErrorIs(t, err, ErrInvalidKey, "an unavailable auth-service is not a rejected key")
+}
@@ -1,8 +1,10 @@
 package app
 
 import (
+	"api-gateway/internal/apikeys"
 	"api-gateway/internal/cache"
 	"api-gateway/internal/config"
+	"api-gateway/internal/jwks"
 	"api-gateway/internal/logger"
 	"api-gateway/internal/router"
 	"context"
@@ -17,12 +19,27 @@ func Run() {
 	cfg := config.GetConfig()
 	logger.Init(cfg.AppEnv)
 
+	// upstream services reject identity headers that are not signed
+	if cfg.IdentitySigningKey == "" {
+		logger.Log.Fatal().Msg("IDENTITY_SIGNING_KEY is required.")
+	}
+
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
 	redisCache := cache.NewRedisCache(cfg.RedisConfig)
 	defer redisCache.Close()
 
+	var keys jwks.KeySet
+	if cfg.AuthJWKSURL != "" {
+		keys = jwks.NewClient(cfg.AuthJWKSURL, cfg.InternalAPIKey, 5*time.Minute)
+	}
+
+	var apiKeys apikeys.Verifier
+	if cfg.APIKeyVerifyURL != "" {
+		apiKeys = apikeys.NewClient(cfg.APIKeyVerifyURL, cfg.InternalAPIKey, time.Minute)
+	}
+
 	app := fiber.New(fiber.Config{
 		WriteTimeout:          10 * time.Second,
 		ReadTimeout:           10 * time.Second,
@@ -30,7 +47,7 @@ func Run() {
 		DisableStartupMessage: cfg.AppEnv == "production",
 	})
 
-	router.SetupRoutes(app, redisCache, cfg)
+	router.SetupRoutes(app, redisCache, keys, apiKeys, cfg)
 
 	serverError := make(chan error, 1)
 
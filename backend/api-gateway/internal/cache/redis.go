@@ -9,8 +9,28 @@ import (
 	"github.com/redis/go-redis/v9"
 )
 
+// Keys of the access token revocation list written by auth-service.
+const (
+	revokedTokenPrefix   = "revoked:token:"
+	revokedSessionPrefix = "revoked:session:"
+)
+
+// allowScript increments the counter and starts its window of ARGV[1] milliseconds unless one is
+// running, in one step so a counter can not be left without an expiry.
+var allowScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if redis.call('PTTL', KEYS[1]) < 0 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`)
+
 type RedisCache interface {
 	CheckRateLimit(ctx context.Context, ip string) (bool, error)
+	// CheckKeyRateLimit counts a request made with an API key against its per minute limit.
+	CheckKeyRateLimit(ctx context.Context, keyID string, limit int) (bool, error)
+	// IsTokenRevoked reports whether the access token or its whole session was revoked.
+	IsTokenRevoked(ctx context.Context, tokenID, sessionID string) (bool, error)
 	Ping(ctx context.Context) error
 	Close()
 }
@@ -28,23 +48,35 @@ func NewRedisCache(config config.RedisConfig) RedisCache {
 }
 
 func (r *redisCache) CheckRateLimit(ctx context.Context, ip string) (bool, error) {
-	key := "rate_limit:" + ip
+	return r.allow(ctx, "rate_limit:"+ip, 10, time.Minute)
+}
 
-	limit := int64(10)
-	window := time.Duration(60) * time.Second
+func (r *redisCache) CheckKeyRateLimit(ctx context.Context, keyID string, limit int) (bool, error) {
+	return r.allow(ctx, "rate_limit:api_key:"+keyID, int64(limit), time.Minute)
+}
 
-	count, err := r.cache.Incr(ctx, key).Result()
+// allow counts a request in a fixed window and reports whether it is within limit.
+func (r *redisCache) allow(ctx context.Context, key string, limit int64, window time.Duration) (bool, error) {
+	count, err := allowScript.Run(ctx, r.cache, []string{key}, window.Milliseconds()).Int64()
 	if err != nil {
 		return false, err
 	}
 
-	if count == 1 {
-		if err := r.cache.Expire(ctx, key, window).Err(); err != nil {
-			return false, err
-		}
+	return count <= limit, nil
+}
+
+func (r *redisCache) IsTokenRevoked(ctx context.Context, tokenID, sessionID string) (bool, error) {
+	keys := []string{revokedTokenPrefix + tokenID}
+	if sessionID != "" {
+		keys = append(keys, revokedSessionPrefix+sessionID)
 	}
 
-	return count <= limit, nil
+	count, err := r.cache.Exists(ctx, keys...).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
 }
 
 func (r *redisCache) Ping(ctx context.Context) error {
@@ -16,7 +16,19 @@ type Config struct {
 	ApiAuthServiceInternalURL string
 	ApiUserServiceInternalURL string
 	JWTAccessTokenSecret      string
-	RedisConfig               RedisConfig
+	// JWTAccessTokenAlg is the algorithm auth-service signs access tokens with, HS256 when empty.
+	// With an asymmetric algorithm HS256 tokens are rejected.
+	JWTAccessTokenAlg string
+	AuthJWKSURL       string
+	// APIKeyVerifyURL is the auth-service endpoint API keys are checked with, empty disables API keys
+	APIKeyVerifyURL string
+	InternalAPIKey  string
+	// RevocationFailOpen accepts access tokens when the revocation list can not be checked
+	RevocationFailOpen bool
+	// IdentitySigningKey signs the identity headers passed to upstream services, the gateway does
+	// not start without it
+	IdentitySigningKey string
+	RedisConfig        RedisConfig
 }
 
 var (
@@ -32,6 +44,12 @@ func LoadConfigFromEnv() Config {
 		ApiAuthServiceInternalURL: os.Getenv("API_AUTH_SERVICE_INTERNAL_URL"),
 		ApiUserServiceInternalURL: os.Getenv("API_USER_SERVICE_INTERNAL_URL"),
 		JWTAccessTokenSecret:      os.Getenv("JWT_ACCESS_TOKEN_SECRET"),
+		JWTAccessTokenAlg:         os.Getenv("JWT_ACCESS_TOKEN_ALG"),
+		AuthJWKSURL:               os.Getenv("AUTH_JWKS_INTERNAL_URL"),
+		APIKeyVerifyURL:           os.Getenv("API_KEY_VERIFY_INTERNAL_URL"),
+		InternalAPIKey:            os.Getenv("INTERNAL_API_KEY"),
+		RevocationFailOpen:        os.Getenv("TOKEN_REVOCATION_FAIL_MODE") == "open",
+		IdentitySigningKey:        os.Getenv("IDENTITY_SIGNING_KEY"),
 		RedisConfig: RedisConfig{
 			RedisInternalURL: os.Getenv("REDIS_INTERNAL_URL"),
 		},
@@ -13,6 +13,11 @@ func setTestEnv(t *testing.T) {
 	t.Setenv("API_AUTH_SERVICE_INTERNAL_URL", "http://auth:3001")
 	t.Setenv("API_USER_SERVICE_INTERNAL_URL", "http://user:3002")
 	t.Setenv("JWT_ACCESS_TOKEN_SECRET", "secret")
+	t.Setenv("AUTH_JWKS_INTERNAL_URL", "http://auth:3001/.well-known/jwks.json")
+	t.Setenv("API_KEY_VERIFY_INTERNAL_URL", "http://auth:3001/internal/api-keys/verify")
+	t.Setenv("INTERNAL_API_KEY", "internal")
+	t.Setenv("TOKEN_REVOCATION_FAIL_MODE", "open")
+	t.Setenv("IDENTITY_SIGNING_KEY", "identity")
 	t.Setenv("REDIS_INTERNAL_URL", "redis://localhost:6379")
 }
 
@@ -27,6 +32,11 @@ func TestLoadConfigFromEnv(t *testing.T) {
 	assert.Equal(t, "http://auth:3001", cfg.ApiAuthServiceInternalURL)
 	assert.Equal(t, "http://user:3002", cfg.ApiUserServiceInternalURL)
 	assert.Equal(t, "secret", cfg.JWTAccessTokenSecret)
+	assert.Equal(t, "http://auth:3001/.well-known/jwks.json", cfg.AuthJWKSURL)
+	assert.Equal(t, "http://auth:3001/internal/api-keys/verify", cfg.APIKeyVerifyURL)
+	assert.Equal(t, "internal", cfg.InternalAPIKey)
+	assert.True(t, cfg.RevocationFailOpen)
+	assert.Equal(t, "identity", cfg.IdentitySigningKey)
 	assert.Equal(t, "redis://localhost:6379", cfg.RedisConfig.RedisInternalURL)
 }
 
@@ -35,4 +45,5 @@ func TestLoadConfigFromEnv_Empty(t *testing.T) {
 
 	assert.Empty(t, cfg.AppEnv)
 	assert.Empty(t, cfg.ApiGatewayInternalPort)
+	assert.False(t, cfg.RevocationFailOpen, "revocation checks should fail closed by default")
 }
@@ -0,0 +1,71 @@
+package identity
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers carrying the authenticated caller to upstream services. They are only ever set by
+// the gateway, any value sent by a client is removed first.
+const (
+	HeaderUserID    = "X-User-ID"
+	HeaderRoles     = "X-User-Roles"
+	HeaderSessionID = "X-Session-ID"
+	HeaderTokenID   = "X-Token-ID"
+	HeaderClientID  = "X-Client-ID"
+	HeaderScopes    = "X-Client-Scopes"
+	HeaderAPIKey    = "X-User-API-Key"
+	HeaderTimestamp = "X-Identity-Timestamp"
+	HeaderSignature = "X-Identity-Signature"
+)
+
+var Headers = []string{
+	HeaderUserID,
+	HeaderRoles,
+	HeaderSessionID,
+	HeaderTokenID,
+	HeaderClientID,
+	HeaderScopes,
+	HeaderAPIKey,
+	HeaderTimestamp,
+	HeaderSignature,
+}
+
+// Identity is either a user, or a service account calling with a client credentials token, in
+// which case UserID is empty and ClientID and Scopes are set. A user calling with an API key has
+// the scopes of the key.
+type Identity struct {
+	UserID    string
+	Roles     []string
+	SessionID string
+	TokenID   string
+	ClientID  string
+	Scopes    []string
+	// APIKey is set when the user calls with a personal API key, which limits them to Scopes
+	APIKey bool
+}
+
+// Sign returns the signature upstream services check to make sure the identity headers were
+// set by the gateway for this very request. The format must match user-service.
+func Sign(key []byte, id Identity, timestamp time.Time, method, path string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.Join([]string{
+		"v3",
+		id.UserID,
+		strings.Join(id.Roles, ","),
+		id.SessionID,
+		id.TokenID,
+		id.ClientID,
+		strings.Join(id.Scopes, ","),
+		strconv.FormatBool(id.APIKey),
+		strconv.FormatInt(timestamp.Unix(), 10),
+		method,
+		path,
+	}, "\n")))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
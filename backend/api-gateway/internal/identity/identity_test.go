@@ -0,0 +1,51 @@
+package identity
+
+import (
+	"testing"
+	"time"
+)
+
+// signVectors pin the signature format. The same vectors are in
+// user-service/internal/identity/identity_test.go, a change to Sign must update both.
+var signVectors = []struct {
+	name      string
+	id        Identity
+	method    string
+	path      string
+	signature string
+}{
+	{
+		name:      "user",
+		id:        Identity{UserID: "42", Roles: []string{"user", "admin"}, SessionID: "session-1", TokenID: "token-1"},
+		method:    "PATCH",
+		path:      "/api/user/me?fields=all",
+		signature: "a7a38d31c450f671984dd981c52188829cf7c73094fad0e1b1e9578d35446615",
+	},
+	{
+		name:      "service account",
+		id:        Identity{TokenID: "token-2", ClientID: "reports", Scopes: []string{"users:read", "users:count"}},
+		method:    "GET",
+		path:      "/api/user/count",
+		signature: "72a4f3f6a245fddf2aa5f3c9368d811bdc79c071dcf1f1d9952f303dc550e5eb",
+	},
+	{
+		name:      "api key",
+		id:        Identity{UserID: "42", Roles: []string{"user"}, TokenID: "key-1", Scopes: []string{"users:read"}, APIKey: true},
+		method:    "GET",
+		path:      "/api/user/count",
+		signature: "a3c9d757318115331bb1a516245a68d753633631bdbe6f367365119abb47cc3e",
+	},
+}
+
+func TestSign(t *testing.T) {
+	key := []byte("identity-signing-key")
+	timestamp := time.Unix(1700000000, 0)
+
+	for _, tc := range signVectors {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Sign(key, tc.id, timestamp, tc.method, tc.path); got != tc.signature {
+				t.Errorf("Sign() = %s, want %s", got, tc.signature)
+			}
+		})
+	}
+}
@@ -0,0 +1,222 @@
+package jwks
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+)
+
+var ErrKeyNotFound = errors.New("signing key not found")
+
+// KeySet resolves the key an access token was signed with.
+type KeySet interface {
+	Key(ctx context.Context, kid string) (*Key, error)
+}
+
+// Key is a verification key published by auth-service: a public key, or the shared
+// secret of an HMAC key when the set is fetched from the internal endpoint.
+type Key struct {
+	ID        string
+	Alg       string
+	VerifyKey any
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	K   string `json:"k"`
+}
+
+// Client fetches the JWKS document and caches it for ttl.
+// An unknown kid triggers a refetch, at most once per minRefreshInterval.
+type Client struct {
+	url                string
+	apiKey             string
+	ttl                time.Duration
+	minRefreshInterval time.Duration
+	httpClient         *http.Client
+
+	mu        sync.RWMutex
+	keys      map[string]*Key
+	fetchedAt time.Time
+}
+
+// NewClient creates a client for url. apiKey is sent as X-Internal-Key, which auth-service
+// requires for its internal key set that also contains the HMAC keys.
+func NewClient(url, apiKey string, ttl time.Duration) *Client {
+	return &Client{
+		url:                url,
+		apiKey:             apiKey,
+		ttl:                ttl,
+		minRefreshInterval: 10 * time.Second,
+		httpClient:         &http.Client{Timeout: 5 * time.Second},
+		keys:               map[string]*Key{},
+	}
+}
+
+func (c *Client) Key(ctx context.Context, kid string) (*Key, error) {
+	c.mu.RLock()
+	key, ok := c.keys[kid]
+	fresh := time.Since(c.fetchedAt) < c.ttl
+	c.mu.RUnlock()
+
+	if ok && fresh {
+		return key, nil
+	}
+
+	if err := c.refresh(ctx, !fresh); err != nil {
+		// keep serving a known key if auth-service is temporarily unreachable
+		if ok {
+			return key, nil
+		}
+		return nil, err
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if key, ok := c.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, ErrKeyNotFound
+}
+
+// refresh refetches the key set once the cache has expired. Refetches for unknown kids
+// are throttled so that tokens with random kids cannot be used to flood auth-service.
+func (c *Client) refresh(ctx context.Context, expired bool) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// another request may have refreshed the set while we were waiting for the lock
+	age := time.Since(c.fetchedAt)
+	if (expired && age < c.ttl) || (!expired && age < c.minRefreshInterval) {
+		return nil
+	}
+
+	keys, err := c.fetch(ctx)
+	if err != nil {
+		return err
+	}
+
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	return nil
+}
+
+func (c *Client) fetch(ctx context.Context) (map[string]*Key, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if c.apiKey != "" {
+		req.Header.Set("X-Internal-Key", c.apiKey)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch jwks: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch jwks: status %d", resp.StatusCode)
+	}
+
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to decode jwks: %w", err)
+	}
+
+	keys := make(map[string]*Key, len(doc.Keys))
+	for _, k := range doc.Keys {
+		verifyKey, err := k.verifyKey()
+		if err != nil || k.Kid == "" {
+			// skip keys we cannot use instead of failing the whole set
+			continue
+		}
+		keys[k.Kid] = &Key{ID: k.Kid, Alg: k.Alg, VerifyKey: verifyKey}
+	}
+
+	return keys, nil
+}
+
+func (k jwk) verifyKey() (any, error) {
+	dec := base64.RawURLEncoding
+
+	switch k.Kty {
+	case "RSA":
+		n, err := dec.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := dec.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := dec.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := dec.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %s", k.Crv)
+		}
+		x, err := dec.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	case "oct":
+		// a shared secret is only usable with an HMAC algorithm, never with a public key one
+		if k.Alg != "HS256" {
+			return nil, fmt.Errorf("unsupported algorithm %s for a symmetric key", k.Alg)
+		}
+		secret, err := dec.DecodeString(k.K)
+		if err != nil {
+			return nil, err
+		}
+		if len(secret) == 0 {
+			return nil, errors.New("empty symmetric key")
+		}
+		return secret, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %s", k.Kty)
+	}
+}
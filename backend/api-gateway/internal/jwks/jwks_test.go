@@ -0,0 +1,148 @@
+package jwks
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testJWKSServer struct {
+	*httptest.Server
+	mu   sync.Mutex
+	keys []jwk
+	hits atomic.Int32
+}
+
+func newTestJWKSServer(t *testing.T) *testJWKSServer {
+	s := &testJWKSServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.hits.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": s.keys})
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *testJWKSServer) addKey(t *testing.T, kid string) *ecdsa.PrivateKey {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	enc := base64.RawURLEncoding
+	s.mu.Lock()
+	s.keys = append(s.keys, jwk{
+		Kty: "EC",
+		Kid: kid,
+		Alg: "ES256",
+		Crv: "P-256",
+		X:   enc.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		Y:   enc.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	})
+	s.mu.Unlock()
+	return key
+}
+
+func TestClient_CachesKeys(t *testing.T) {
+	server := newTestJWKSServer(t)
+	private := server.addKey(t, "key-1")
+
+	client := NewClient(server.URL, "", time.Minute)
+
+	for i := 0; i < 3; i++ {
+		key, err := client.Key(context.Background(), "key-1")
+		require.NoError(t, err)
+		assert.Equal(t, "ES256", key.Alg)
+		assert.True(t, private.PublicKey.Equal(key.VerifyKey), "public key should match the published key")
+	}
+
+	assert.Equal(t, int32(1), server.hits.Load(), "key set should be fetched once")
+}
+
+func TestClient_RefetchesOnUnknownKid(t *testing.T) {
+	server := newTestJWKSServer(t)
+	server.addKey(t, "key-1")
+
+	client := NewClient(server.URL, "", time.Hour)
+	client.minRefreshInterval = 0
+
+	_, err := client.Key(context.Background(), "key-1")
+	require.NoError(t, err)
+
+	// auth-service rotates to a new key while our cache is still fresh
+	server.addKey(t, "key-2")
+
+	key, err := client.Key(context.Background(), "key-2")
+	require.NoError(t, err)
+	assert.Equal(t, "key-2", key.ID)
+	assert.Equal(t, int32(2), server.hits.Load())
+}
+
+func TestClient_ThrottlesUnknownKid(t *testing.T) {
+	server := newTestJWKSServer(t)
+	server.addKey(t, "key-1")
+
+	client := NewClient(server.URL, "", time.Hour)
+
+	_, err := client.Key(context.Background(), "key-1")
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		_, err := client.Key(context.Background(), "random-kid")
+		assert.ErrorIs(t, err, ErrKeyNotFound)
+	}
+
+	assert.Equal(t, int32(1), server.hits.Load(), "unknown kids should not hammer auth-service")
+}
+
+func TestClient_SymmetricKeys(t *testing.T) {
+	var gotAPIKey string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotAPIKey = r.Header.Get("X-Internal-Key")
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": []jwk{
+			{Kty: "oct", Kid: "hs-1", Alg: "HS256", K: base64.RawURLEncoding.EncodeToString([]byte("secret"))},
+			// a shared secret must never be usable with an asymmetric algorithm
+			{Kty: "oct", Kid: "hs-2", Alg: "RS256", K: base64.RawURLEncoding.EncodeToString([]byte("secret"))},
+		}})
+	}))
+	t.Cleanup(server.Close)
+
+	client := NewClient(server.URL, "internal", time.Minute)
+
+	key, err := client.Key(context.Background(), "hs-1")
+	require.NoError(t, err)
+	assert.Equal(t, []byte("secret"), key.VerifyKey)
+	assert.Equal(t, "internal", gotAPIKey)
+
+	_, err = client.Key(context.Background(), "hs-2")
+	assert.ErrorIs(t, err, ErrKeyNotFound)
+}
+
+func TestClient_ServesStaleKeyWhenAuthServiceIsDown(t *testing.T) {
+	server := newTestJWKSServer(t)
+	server.addKey(t, "key-1")
+
+	client := NewClient(server.URL, "", time.Millisecond)
+
+	_, err := client.Key(context.Background(), "key-1")
+	require.NoError(t, err)
+
+	server.Close()
+	time.Sleep(5 * time.Millisecond)
+
+	key, err := client.Key(context.Background(), "key-1")
+	require.NoError(t, err)
+	assert.Equal(t, "key-1", key.ID)
+}
@@ -1,16 +1,46 @@
 package middleware
 
 import (
+	"api-gateway/internal/apikeys"
+	"api-gateway/internal/cache"
 	"api-gateway/internal/config"
+	"api-gateway/internal/identity"
+	"api-gateway/internal/jwks"
 	"api-gateway/internal/logger"
+	"errors"
+	"fmt"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func Auth(cfg config.Config) fiber.Handler {
+// Auth verifies access tokens against the auth-service keyring, looked up by the kid header.
+// Only tokens signed with cfg.JWTAccessTokenAlg are accepted, so once access tokens are signed
+// with a private key, nobody holding an HMAC secret can mint them. With HS256 the keys are only
+// known when the key set is fetched from the internal endpoint, and tokens that can not be
+// resolved by kid fall back to the shared JWT_ACCESS_TOKEN_SECRET while that secret is still
+// configured, to allow migrating to the keyring.
+// Valid tokens are then checked against the revocation list in Redis; when Redis is down
+// cfg.RevocationFailOpen decides whether they are let through. The caller is passed on to the
+// upstream service in the identity headers, signed with the identity signing key.
+// Tokens auth-service issued to OAuth clients are not accepted by the API. Tokens of service
+// accounts are, they carry a client_id claim instead of a user and are passed on with the
+// client identity headers.
+// Instead of a token, users can send a personal API key in X-API-Key when apiKeys is set.
+func Auth(cfg config.Config, keys jwks.KeySet, apiKeys apikeys.Verifier, redisCache cache.RedisCache) fiber.Handler {
+	validMethods := []string{"HS256"}
+	if cfg.JWTAccessTokenAlg != "" {
+		validMethods = []string{cfg.JWTAccessTokenAlg}
+	}
+
 	return func(c *fiber.Ctx) error {
+		if apiKey := c.Get(apiKeyHeader); apiKey != "" && apiKeys != nil {
+			return authenticateAPIKey(c, cfg, apiKeys, redisCache, apiKey)
+		}
+
 		authHeader := c.Get("Authorization")
 
 		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
@@ -25,9 +55,28 @@ func Auth(cfg config.Config) fiber.Handler {
 		tokenStr := strings.TrimPrefix(authHeader, "Bearer ")
 
 		// validate token
-		token, err := jwt.ParseWithClaims(tokenStr, &jwt.RegisteredClaims{}, func(token *jwt.Token) (any, error) {
-			return []byte(cfg.JWTAccessTokenSecret), nil
-		})
+		token, err := jwt.ParseWithClaims(tokenStr, &accessClaims{}, func(token *jwt.Token) (any, error) {
+			alg := token.Method.Alg()
+			legacySecret := alg == "HS256" && cfg.JWTAccessTokenSecret != ""
+
+			kid, _ := token.Header["kid"].(string)
+			if keys != nil && kid != "" {
+				key, err := keys.Key(c.Context(), kid)
+				switch {
+				case err == nil && key.Alg != alg:
+					return nil, fmt.Errorf("key %s is not valid for %s", kid, alg)
+				case err == nil:
+					return key.VerifyKey, nil
+				case !legacySecret:
+					return nil, err
+				}
+			}
+
+			if legacySecret {
+				return []byte(cfg.JWTAccessTokenSecret), nil
+			}
+			return nil, errors.New("token has no verifiable key id")
+		}, jwt.WithValidMethods(validMethods))
 
 		if err != nil || !token.Valid {
 			logger.Log.Warn().
@@ -39,8 +88,8 @@ func Auth(cfg config.Config) fiber.Handler {
 			return c.SendStatus(fiber.StatusUnauthorized)
 		}
 
-		_, ok := token.Claims.(*jwt.RegisteredClaims)
-		if !ok {
+		claims, ok := token.Claims.(*accessClaims)
+		if !ok || claims.ID == "" {
 			logger.Log.Warn().
 				Str("path", c.Path()).
 				Str("ip", c.IP()).
@@ -49,6 +98,172 @@ func Auth(cfg config.Config) fiber.Handler {
 			return c.SendStatus(fiber.StatusUnauthorized)
 		}
 
+		// tokens issued to an OAuth client carry it as audience and only grant their scope
+		if len(claims.Audience) > 0 {
+			logger.Log.Warn().
+				Str("path", c.Path()).
+				Str("ip", c.IP()).
+				Strs("aud", claims.Audience).
+				Msg("access token issued to an oauth client")
+
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		if status := checkRevocation(c, cfg, redisCache, claims.ID, claims.SessionID); status != 0 {
+			return c.SendStatus(status)
+		}
+
+		c.Locals(claimsLocalsKey, claims)
+		if claims.IsService() {
+			setIdentity(c, cfg, identity.Identity{
+				TokenID:  claims.ID,
+				ClientID: claims.ClientID,
+				Scopes:   strings.Fields(claims.Scope),
+			})
+		} else {
+			setIdentity(c, cfg, identity.Identity{
+				UserID:    claims.Subject,
+				Roles:     claims.Roles,
+				SessionID: claims.SessionID,
+				TokenID:   claims.ID,
+			})
+		}
+
 		return c.Next()
 	}
 }
+
+// apiKeyHeader carries a personal API key in place of the Authorization header.
+const apiKeyHeader = "X-API-Key"
+
+// authenticateAPIKey lets a request with a personal API key through as the key's user, limited
+// to the key's scopes and its rate limit. The key is not passed on to upstream services.
+func authenticateAPIKey(c *fiber.Ctx, cfg config.Config, apiKeys apikeys.Verifier, redisCache cache.RedisCache, rawKey string) error {
+	key, err := apiKeys.Verify(c.Context(), rawKey)
+	if err != nil {
+		if errors.Is(err, apikeys.ErrInvalidKey) {
+			logger.Log.Warn().
+				Str("path", c.Path()).
+				Str("ip", c.IP()).
+				Msg("invalid or expired api key")
+
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		logger.Log.Error().
+			Err(err).
+			Str("path", c.Path()).
+			Msg("failed to verify api key")
+
+		return c.SendStatus(fiber.StatusServiceUnavailable)
+	}
+
+	if status := checkRevocation(c, cfg, redisCache, key.ID, ""); status != 0 {
+		return c.SendStatus(status)
+	}
+
+	allowed, err := redisCache.CheckKeyRateLimit(c.Context(), key.ID, key.RateLimit)
+	if err != nil {
+		// the limit is what keeps a leaked key in check, it is not skipped
+		logger.Log.Error().
+			Err(err).
+			Str("path", c.Path()).
+			Str("key_id", key.ID).
+			Msg("failed to check api key rate limit")
+
+		return c.SendStatus(fiber.StatusServiceUnavailable)
+	}
+	if !allowed {
+		logger.Log.Warn().
+			Str("path", c.Path()).
+			Str("key_id", key.ID).
+			Msg("api key rate limit exceeded")
+
+		return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+			"error": "rate limit exceeded",
+		})
+	}
+
+	c.Request().Header.Del(apiKeyHeader)
+	c.Locals(claimsLocalsKey, &accessClaims{
+		Roles:       key.Roles,
+		Permissions: key.Permissions,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:      key.ID,
+			Subject: key.UserID,
+		},
+	})
+	setIdentity(c, cfg, identity.Identity{
+		UserID:  key.UserID,
+		Roles:   key.Roles,
+		TokenID: key.ID,
+		Scopes:  key.Permissions,
+		APIKey:  true,
+	})
+
+	return c.Next()
+}
+
+// checkRevocation returns the status to answer with when the token, API key or session was
+// revoked, or when the revocation list is down and cfg.RevocationFailOpen is off; 0 otherwise.
+func checkRevocation(c *fiber.Ctx, cfg config.Config, redisCache cache.RedisCache, tokenID, sessionID string) int {
+	revoked, err := redisCache.IsTokenRevoked(c.Context(), tokenID, sessionID)
+	if err != nil {
+		logger.Log.Error().
+			Err(err).
+			Str("path", c.Path()).
+			Bool("fail_open", cfg.RevocationFailOpen).
+			Msg("failed to check token revocation")
+
+		if !cfg.RevocationFailOpen {
+			return fiber.StatusServiceUnavailable
+		}
+	}
+	if revoked {
+		logger.Log.Warn().
+			Str("path", c.Path()).
+			Str("ip", c.IP()).
+			Str("jti", tokenID).
+			Msg("revoked token")
+
+		return fiber.StatusUnauthorized
+	}
+
+	return 0
+}
+
+// claimsLocalsKey stores the verified access claims for the middlewares after Auth.
+const claimsLocalsKey = "claims"
+
+// accessClaims are the claims of an auth-service access token.
+type accessClaims struct {
+	SessionID   string   `json:"sid,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"perms,omitempty"`
+	Unverified  bool     `json:"unverified,omitempty"`
+	ClientID    string   `json:"client_id,omitempty"`
+	Scope       string   `json:"scope,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// IsService reports whether the token was issued to a service account with the client
+// credentials grant rather than to a user.
+func (c *accessClaims) IsService() bool {
+	return c.ClientID != ""
+}
+
+func setIdentity(c *fiber.Ctx, cfg config.Config, id identity.Identity) {
+	header := &c.Request().Header
+
+	header.Set(identity.HeaderUserID, id.UserID)
+	header.Set(identity.HeaderRoles, strings.Join(id.Roles, ","))
+	header.Set(identity.HeaderSessionID, id.SessionID)
+	header.Set(identity.HeaderTokenID, id.TokenID)
+	header.Set(identity.HeaderClientID, id.ClientID)
+	header.Set(identity.HeaderScopes, strings.Join(id.Scopes, ","))
+	header.Set(identity.HeaderAPIKey, strconv.FormatBool(id.APIKey))
+
+	now := time.Now()
+	header.Set(identity.HeaderTimestamp, strconv.FormatInt(now.Unix(), 10))
+	header.Set(identity.HeaderSignature, identity.Sign([]byte(cfg.IdentitySigningKey), id, now, c.Method(), c.OriginalURL()))
+}
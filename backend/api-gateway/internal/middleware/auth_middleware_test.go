@@ -0,0 +1,462 @@
+package middleware
+
+import (
+	"api-gateway/internal/apikeys"
+	"api-gateway/internal/cache"
+	"api-gateway/internal/config"
+	"api-gateway/internal/identity"
+	"api-gateway/internal/jwks"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type staticKeySet map[string]*jwks.Key
+
+func (s staticKeySet) Key(_ context.Context, kid string) (*jwks.Key, error) {
+	if key, ok := s[kid]; ok {
+		return key, nil
+	}
+	return nil, jwks.ErrKeyNotFound
+}
+
+// fakeRedisCache serves the revocation list from memory, or fails every call when down.
+type fakeRedisCache struct {
+	revoked     map[string]bool
+	down        bool
+	keyRequests map[string]int
+}
+
+func (f *fakeRedisCache) CheckRateLimit(context.Context, string) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeRedisCache) CheckKeyRateLimit(_ context.Context, keyID string, limit int) (bool, error) {
+	if f.down {
+		return false, errors.New("redis is down")
+	}
+	if f.keyRequests == nil {
+		f.keyRequests = map[string]int{}
+	}
+	f.keyRequests[keyID]++
+	return f.keyRequests[keyID] <= limit, nil
+}
+
+func (f *fakeRedisCache) IsTokenRevoked(_ context.Context, tokenID, sessionID string) (bool, error) {
+	if f.down {
+		return false, errors.New("redis is down")
+	}
+	return f.revoked[tokenID] || f.revoked[sessionID], nil
+}
+
+func (f *fakeRedisCache) Ping(context.Context) error {
+	return nil
+}
+
+func (f *fakeRedisCache) Close() {}
+
+func newAuthTestApp(cfg config.Config, keys jwks.KeySet) *fiber.App {
+	return newAuthTestAppWithCache(cfg, keys, &fakeRedisCache{})
+}
+
+func newAuthTestAppWithCache(cfg config.Config, keys jwks.KeySet, redisCache cache.RedisCache) *fiber.App {
+	app := fiber.New()
+	app.Use(Auth(cfg, keys, nil, redisCache))
+	app.Get("/protected", func(c *fiber.Ctx) error {
+		return c.SendString("OK")
+	})
+	return app
+}
+
+func doAuthRequest(t *testing.T, app *fiber.App, token string) int {
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	return resp.StatusCode
+}
+
+func signToken(t *testing.T, method jwt.SigningMethod, kid string, key any) string {
+	return signTokenWithClaims(t, method, kid, key, accessClaims{
+		SessionID: "session-1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "token-1",
+			Subject:   "user-1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+}
+
+func signTokenWithClaims(t *testing.T, method jwt.SigningMethod, kid string, key any, claims accessClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	signed, err := token.SignedString(key)
+	require.NoError(t, err)
+	return signed
+}
+
+func TestAuth_JWKS(t *testing.T) {
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	other, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	keys := staticKeySet{
+		"key-1": {ID: "key-1", Alg: "ES256", VerifyKey: &private.PublicKey},
+		"hs-1":  {ID: "hs-1", Alg: "HS256", VerifyKey: []byte("secret")},
+	}
+	app := newAuthTestApp(config.Config{JWTAccessTokenAlg: "ES256", JWTAccessTokenSecret: "secret"}, keys)
+
+	testCases := []struct {
+		name       string
+		token      string
+		wantStatus int
+	}{
+		{
+			name:       "Valid ES256 token",
+			token:      signToken(t, jwt.SigningMethodES256, "key-1", private),
+			wantStatus: fiber.StatusOK,
+		},
+		{
+			name:       "Unknown kid",
+			token:      signToken(t, jwt.SigningMethodES256, "key-2", private),
+			wantStatus: fiber.StatusUnauthorized,
+		},
+		{
+			name:       "Signed by another key",
+			token:      signToken(t, jwt.SigningMethodES256, "key-1", other),
+			wantStatus: fiber.StatusUnauthorized,
+		},
+		{
+			name:       "HS256 with the shared secret",
+			token:      signToken(t, jwt.SigningMethodHS256, "", []byte("secret")),
+			wantStatus: fiber.StatusUnauthorized,
+		},
+		{
+			name:       "HS256 with a key from the key set",
+			token:      signToken(t, jwt.SigningMethodHS256, "hs-1", []byte("secret")),
+			wantStatus: fiber.StatusUnauthorized,
+		},
+		{
+			name:       "Missing token",
+			wantStatus: fiber.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.wantStatus, doAuthRequest(t, app, tc.token))
+		})
+	}
+}
+
+func TestAuth_HMACKeyring(t *testing.T) {
+	keys := staticKeySet{
+		"hs-old": {ID: "hs-old", Alg: "HS256", VerifyKey: []byte("old secret")},
+		"hs-new": {ID: "hs-new", Alg: "HS256", VerifyKey: []byte("new secret")},
+	}
+	app := newAuthTestApp(config.Config{}, keys)
+
+	// both keys verify during the rotation overlap
+	assert.Equal(t, fiber.StatusOK, doAuthRequest(t, app, signToken(t, jwt.SigningMethodHS256, "hs-old", []byte("old secret"))))
+	assert.Equal(t, fiber.StatusOK, doAuthRequest(t, app, signToken(t, jwt.SigningMethodHS256, "hs-new", []byte("new secret"))))
+	assert.Equal(t, fiber.StatusUnauthorized, doAuthRequest(t, app, signToken(t, jwt.SigningMethodHS256, "hs-new", []byte("old secret"))))
+	assert.Equal(t, fiber.StatusUnauthorized, doAuthRequest(t, app, signToken(t, jwt.SigningMethodHS256, "hs-retired", []byte("old secret"))))
+}
+
+func TestAuth_LegacySharedSecret(t *testing.T) {
+	app := newAuthTestApp(config.Config{JWTAccessTokenSecret: "secret"}, nil)
+
+	assert.Equal(t, fiber.StatusOK, doAuthRequest(t, app, signToken(t, jwt.SigningMethodHS256, "", []byte("secret"))))
+	assert.Equal(t, fiber.StatusUnauthorized, doAuthRequest(t, app, signToken(t, jwt.SigningMethodHS256, "", []byte("wrong"))))
+}
+
+func TestAuth_RejectsOAuthClientTokens(t *testing.T) {
+	keys := staticKeySet{
+		"hs-1": {ID: "hs-1", Alg: "HS256", VerifyKey: []byte("secret")},
+	}
+	app := newAuthTestApp(config.Config{}, keys)
+
+	token := signTokenWithClaims(t, jwt.SigningMethodHS256, "hs-1", []byte("secret"), accessClaims{
+		SessionID: "session-1",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "token-1",
+			Subject:   "user-1",
+			Audience:  jwt.ClaimStrings{"client-1"},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+
+	assert.Equal(t, fiber.StatusUnauthorized, doAuthRequest(t, app, token))
+}
+
+func TestAuth_RevokedTokens(t *testing.T) {
+	redisCache := &fakeRedisCache{revoked: map[string]bool{"token-revoked": true, "session-revoked": true}}
+	app := newAuthTestAppWithCache(config.Config{JWTAccessTokenSecret: "secret"}, nil, redisCache)
+
+	claims := func(jti, sid string) accessClaims {
+		return accessClaims{
+			SessionID: sid,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        jti,
+				Subject:   "user-1",
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+		}
+	}
+
+	testCases := []struct {
+		name       string
+		claims     accessClaims
+		wantStatus int
+	}{
+		{name: "Not revoked", claims: claims("token-1", "session-1"), wantStatus: fiber.StatusOK},
+		{name: "Revoked token", claims: claims("token-revoked", "session-1"), wantStatus: fiber.StatusUnauthorized},
+		{name: "Revoked session", claims: claims("token-1", "session-revoked"), wantStatus: fiber.StatusUnauthorized},
+		{name: "Token without jti", claims: claims("", "session-1"), wantStatus: fiber.StatusUnauthorized},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			token := signTokenWithClaims(t, jwt.SigningMethodHS256, "", []byte("secret"), tc.claims)
+			assert.Equal(t, tc.wantStatus, doAuthRequest(t, app, token))
+		})
+	}
+}
+
+func TestAuth_RevocationFailMode(t *testing.T) {
+	redisCache := &fakeRedisCache{down: true}
+	token := signToken(t, jwt.SigningMethodHS256, "", []byte("secret"))
+
+	closed := newAuthTestAppWithCache(config.Config{JWTAccessTokenSecret: "secret"}, nil, redisCache)
+	assert.Equal(t, fiber.StatusServiceUnavailable, doAuthRequest(t, closed, token))
+
+	open := newAuthTestAppWithCache(config.Config{JWTAccessTokenSecret: "secret", RevocationFailOpen: true}, nil, redisCache)
+	assert.Equal(t, fiber.StatusOK, doAuthRequest(t, open, token))
+}
+
+func TestAuth_PropagatesIdentity(t *testing.T) {
+	cfg := config.Config{JWTAccessTokenSecret: "secret", IdentitySigningKey: "identity"}
+
+	var got http.Header
+	app := fiber.New()
+	app.Use(StripIdentity())
+	app.Use(Auth(cfg, nil, nil, &fakeRedisCache{}))
+	app.Get("/protected", func(c *fiber.Ctx) error {
+		got = http.Header{}
+		for _, header := range identity.Headers {
+			got.Set(header, c.Get(header))
+		}
+		return c.SendString("OK")
+	})
+
+	token := signTokenWithClaims(t, jwt.SigningMethodHS256, "", []byte("secret"), accessClaims{
+		SessionID: "session-1",
+		Roles:     []string{"admin", "user"},
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "token-1",
+			Subject:   "user-1",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/protected?page=2", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	// a client trying to impersonate someone else
+	req.Header.Set(identity.HeaderUserID, "admin-1")
+	req.Header.Set(identity.HeaderRoles, "superuser")
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	assert.Equal(t, "user-1", got.Get(identity.HeaderUserID))
+	assert.Equal(t, "admin,user", got.Get(identity.HeaderRoles))
+	assert.Equal(t, "session-1", got.Get(identity.HeaderSessionID))
+	assert.Equal(t, "token-1", got.Get(identity.HeaderTokenID))
+
+	timestamp, err := strconv.ParseInt(got.Get(identity.HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	want := identity.Sign([]byte("identity"), identity.Identity{
+		UserID:    "user-1",
+		Roles:     []string{"admin", "user"},
+		SessionID: "session-1",
+		TokenID:   "token-1",
+	}, time.Unix(timestamp, 0), http.MethodGet, "/protected?page=2")
+	assert.Equal(t, want, got.Get(identity.HeaderSignature))
+}
+
+func TestAuth_PropagatesServiceIdentity(t *testing.T) {
+	cfg := config.Config{JWTAccessTokenSecret: "secret", IdentitySigningKey: "identity"}
+
+	var got http.Header
+	app := fiber.New()
+	app.Use(StripIdentity())
+	app.Use(Auth(cfg, nil, nil, &fakeRedisCache{}))
+	app.Get("/protected", func(c *fiber.Ctx) error {
+		got = http.Header{}
+		for _, header := range identity.Headers {
+			got.Set(header, c.Get(header))
+		}
+		return c.SendString("OK")
+	})
+
+	token := signTokenWithClaims(t, jwt.SigningMethodHS256, "", []byte("secret"), accessClaims{
+		ClientID: "batch-job",
+		Scope:    "users:list roles:assign",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "token-1",
+			Subject:   "batch-job",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	require.Equal(t, fiber.StatusOK, resp.StatusCode)
+
+	assert.Empty(t, got.Get(identity.HeaderUserID))
+	assert.Equal(t, "batch-job", got.Get(identity.HeaderClientID))
+	assert.Equal(t, "users:list,roles:assign", got.Get(identity.HeaderScopes))
+	assert.Equal(t, "token-1", got.Get(identity.HeaderTokenID))
+
+	timestamp, err := strconv.ParseInt(got.Get(identity.HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	want := identity.Sign([]byte("identity"), identity.Identity{
+		TokenID:  "token-1",
+		ClientID: "batch-job",
+		Scopes:   []string{"users:list", "roles:assign"},
+	}, time.Unix(timestamp, 0), http.MethodGet, "/protected")
+	assert.Equal(t, want, got.Get(identity.HeaderSignature))
+}
+
+func TestStripIdentity(t *testing.T) {
+	var userID string
+	app := fiber.New()
+	app.Use(StripIdentity())
+	app.Get("/public", func(c *fiber.Ctx) error {
+		userID = c.Get(identity.HeaderUserID)
+		return c.SendString("OK")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/public", nil)
+	req.Header.Set(identity.HeaderUserID, "admin-1")
+
+	_, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Empty(t, userID)
+}
+
+// staticAPIKeys verifies the keys it was created with.
+type staticAPIKeys map[string]*apikeys.Key
+
+func (s staticAPIKeys) Verify(_ context.Context, key string) (*apikeys.Key, error) {
+	if verified, ok := s[key]; ok {
+		return verified, nil
+	}
+	return nil, apikeys.ErrInvalidKey
+}
+
+func TestAuth_APIKeys(t *testing.T) {
+	cfg := config.Config{IdentitySigningKey: "identity"}
+	apiKeys := staticAPIKeys{
+		"ak_valid.secret":   {ID: "key-1", UserID: "user-1", Roles: []string{"user"}, Permissions: []string{"users:list"}, RateLimit: 2},
+		"ak_revoked.secret": {ID: "key-revoked", UserID: "user-1", RateLimit: 10},
+	}
+	redisCache := &fakeRedisCache{revoked: map[string]bool{"key-revoked": true}}
+
+	var got http.Header
+	app := fiber.New()
+	app.Use(StripIdentity())
+	app.Use(Auth(cfg, nil, apiKeys, redisCache))
+	app.Use(Authorize([]Rule{
+		{Path: "/protected"},
+		{Method: http.MethodGet, Path: "/admin", Permission: "roles:assign"},
+	}))
+	app.Get("/*", func(c *fiber.Ctx) error {
+		got = http.Header{}
+		for _, header := range identity.Headers {
+			got.Set(header, c.Get(header))
+		}
+		got.Set("X-API-Key", c.Get("X-API-Key"))
+		return c.SendString("OK")
+	})
+
+	doKeyRequest := func(path, key string) int {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("X-API-Key", key)
+
+		resp, err := app.Test(req)
+		require.NoError(t, err)
+		return resp.StatusCode
+	}
+
+	require.Equal(t, fiber.StatusOK, doKeyRequest("/protected", "ak_valid.secret"))
+	assert.Equal(t, "user-1", got.Get(identity.HeaderUserID))
+	assert.Equal(t, "user", got.Get(identity.HeaderRoles))
+	assert.Equal(t, "key-1", got.Get(identity.HeaderTokenID))
+	// upstream services limit the user to the scopes of the key as well
+	assert.Equal(t, "users:list", got.Get(identity.HeaderScopes))
+	assert.Equal(t, "true", got.Get(identity.HeaderAPIKey))
+	timestamp, err := strconv.ParseInt(got.Get(identity.HeaderTimestamp), 10, 64)
+	require.NoError(t, err)
+	want := identity.Sign([]byte("identity"), identity.Identity{
+		UserID:  "user-1",
+		Roles:   []string{"user"},
+		TokenID: "key-1",
+		Scopes:  []string{"users:list"},
+		APIKey:  true,
+	}, time.Unix(timestamp, 0), http.MethodGet, "/protected")
+	assert.Equal(t, want, got.Get(identity.HeaderSignature))
+	assert.Empty(t, got.Get("X-API-Key"), "the key should not reach upstream services")
+
+	assert.Equal(t, fiber.StatusForbidden, doKeyRequest("/admin", "ak_valid.secret"), "the key is limited to its scopes")
+	assert.Equal(t, fiber.StatusTooManyRequests, doKeyRequest("/protected", "ak_valid.secret"), "the key is over its rate limit")
+	assert.Equal(t, fiber.StatusUnauthorized, doKeyRequest("/protected", "ak_revoked.secret"))
+	assert.Equal(t, fiber.StatusUnauthorized, doKeyRequest("/protected", "ak_unknown.secret"))
+
+	// the rate limit is not skipped when Redis is down, even with the revocation list failing open
+	cfg.RevocationFailOpen = true
+	down := fiber.New()
+	down.Use(Auth(cfg, nil, apiKeys, &fakeRedisCache{down: true}))
+	down.Get("/protected", func(c *fiber.Ctx) error {
+		return c.SendString("OK")
+	})
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("X-API-Key", "ak_valid.secret")
+	resp, err := down.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusServiceUnavailable, resp.StatusCode)
+}
+
+func TestAuth_APIKeysDisabled(t *testing.T) {
+	app := newAuthTestApp(config.Config{JWTAccessTokenSecret: "secret"}, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/protected", nil)
+	req.Header.Set("X-API-Key", "ak_valid.secret")
+
+	resp, err := app.Test(req)
+	require.NoError(t, err)
+	assert.Equal(t, fiber.StatusUnauthorized, resp.StatusCode)
+}
@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"api-gateway/internal/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAuthorize(t *testing.T) {
+	cfg := config.Config{JWTAccessTokenSecret: "secret"}
+	rules := []Rule{
+		{Path: "/api/user/me", AllowUnverified: true},
+		{Method: http.MethodGet, Path: "/api/user/get-all", Permission: "users:list"},
+		{Method: http.MethodPut, Path: "/api/user/:id/roles", Permission: "roles:assign"},
+	}
+
+	app := fiber.New()
+	app.Use(Auth(cfg, nil, nil, &fakeRedisCache{}))
+	app.Use(Authorize(rules))
+	app.All("/*", func(c *fiber.Ctx) error {
+		return c.SendString("OK")
+	})
+
+	tokenWith := func(perms ...string) string {
+		return signTokenWithClaims(t, jwt.SigningMethodHS256, "", []byte("secret"), accessClaims{
+			SessionID:   "session-1",
+			Permissions: perms,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        "token-1",
+				Subject:   "user-1",
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+		})
+	}
+
+	unverified := signTokenWithClaims(t, jwt.SigningMethodHS256, "", []byte("secret"), accessClaims{
+		Unverified: true,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        "token-2",
+			Subject:   "user-2",
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	})
+
+	serviceWith := func(scopes string) string {
+		return signTokenWithClaims(t, jwt.SigningMethodHS256, "", []byte("secret"), accessClaims{
+			ClientID: "batch-job",
+			Scope:    scopes,
+			RegisteredClaims: jwt.RegisteredClaims{
+				ID:        "token-3",
+				Subject:   "batch-job",
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+		})
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"listing needs permission", http.MethodGet, "/api/user/get-all", tokenWith(), fiber.StatusForbidden},
+		{"listing with permission", http.MethodGet, "/api/user/get-all", tokenWith("users:list"), fiber.StatusOK},
+		{"wrong permission", http.MethodGet, "/api/user/get-all", tokenWith("roles:assign"), fiber.StatusForbidden},
+		{"path parameter", http.MethodPut, "/api/user/42/roles", tokenWith("users:list"), fiber.StatusForbidden},
+		{"path parameter with permission", http.MethodPut, "/api/user/42/roles", tokenWith("roles:assign"), fiber.StatusOK},
+		{"other case", http.MethodPut, "/api/user/42/Roles", tokenWith("users:list"), fiber.StatusForbidden},
+		{"other case with permission", http.MethodPut, "/API/User/42/ROLES", tokenWith("roles:assign"), fiber.StatusOK},
+		{"trailing slash", http.MethodGet, "/api/user/get-all/", tokenWith(), fiber.StatusForbidden},
+		{"other method", http.MethodGet, "/api/user/42/roles", tokenWith("roles:assign"), fiber.StatusForbidden},
+		{"unlisted route", http.MethodGet, "/api/user/sessions", tokenWith("users:list", "roles:assign"), fiber.StatusForbidden},
+		{"route without permission", http.MethodGet, "/api/user/me", tokenWith(), fiber.StatusOK},
+		{"unverified on an open route", http.MethodPatch, "/api/user/me", unverified, fiber.StatusOK},
+		{"unverified elsewhere", http.MethodGet, "/api/user/sessions", unverified, fiber.StatusForbidden},
+		{"unverified on a protected route", http.MethodGet, "/api/user/get-all", unverified, fiber.StatusForbidden},
+		{"service with scope", http.MethodGet, "/api/user/get-all", serviceWith("users:list"), fiber.StatusOK},
+		{"service among scopes", http.MethodPut, "/api/user/42/roles", serviceWith("users:list roles:assign"), fiber.StatusOK},
+		{"service without scope", http.MethodPut, "/api/user/42/roles", serviceWith("users:list"), fiber.StatusForbidden},
+		{"service on a route without permission", http.MethodGet, "/api/user/me", serviceWith("users:list"), fiber.StatusForbidden},
+		{"service on an unlisted route", http.MethodGet, "/api/user/sessions", serviceWith("users:list"), fiber.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, nil)
+			req.Header.Set("Authorization", "Bearer "+tc.token)
+
+			resp, err := app.Test(req)
+			require.NoError(t, err)
+			assert.Equal(t, tc.want, resp.StatusCode)
+		})
+	}
+}
@@ -11,7 +11,7 @@ func CORS(cfg config.Config) fiber.Handler {
 	return cors.New(cors.Config{
 		AllowOrigins:     cfg.ClientExternalURL,
 		AllowCredentials: true,
-		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders:     "Content-Type,Authorization",
+		AllowMethods:     "GET,POST,PUT,PATCH,DELETE,OPTIONS",
+		AllowHeaders:     "Content-Type,Authorization,Idempotency-Key",
 	})
 }
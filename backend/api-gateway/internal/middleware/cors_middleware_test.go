@@ -73,11 +73,11 @@ func TestCors_PreflightRequest(t *testing.T) {
 	assert.Equal(t, "https://example.com",
 		resp.Header.Get("Access-Control-Allow-Origin"))
 
-	assert.Equal(t, "GET,POST,PUT,DELETE,OPTIONS",
+	assert.Equal(t, "GET,POST,PUT,PATCH,DELETE,OPTIONS",
 		resp.Header.Get("Access-Control-Allow-Methods"),
 		"Should allow specified methods")
 
-	assert.Equal(t, "Content-Type,Authorization",
+	assert.Equal(t, "Content-Type,Authorization,Idempotency-Key",
 		resp.Header.Get("Access-Control-Allow-Headers"),
 		"Should allow specified headers")
 }
@@ -0,0 +1,18 @@
+package middleware
+
+import (
+	"api-gateway/internal/identity"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// StripIdentity removes identity headers sent by the client, so upstream services can trust
+// that every identity header they receive was set by the gateway.
+func StripIdentity() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		for _, header := range identity.Headers {
+			c.Request().Header.Del(header)
+		}
+		return c.Next()
+	}
+}
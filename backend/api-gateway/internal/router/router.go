@@ -1,8 +1,10 @@
 package router
 
 import (
+	"api-gateway/internal/apikeys"
 	"api-gateway/internal/cache"
 	"api-gateway/internal/config"
+	"api-gateway/internal/jwks"
 	"api-gateway/internal/logger"
 	"api-gateway/internal/middleware"
 	"context"
@@ -14,7 +16,16 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/proxy"
 )
 
-func SetupRoutes(app *fiber.App, redisCache cache.RedisCache, cfg config.Config) {
+// userRoutePermissions list every user-service endpoint the gateway proxies, anything else is
+// rejected. user-service enforces the same permissions on its side. Users who have not
+// verified their email can only see and edit their own profile.
+var userRoutePermissions = []middleware.Rule{
+	{Path: "/api/user/me", AllowUnverified: true},
+	{Method: fiber.MethodGet, Path: "/api/user/get-all", Permission: "users:list"},
+	{Method: fiber.MethodPut, Path: "/api/user/:id/roles", Permission: "roles:assign"},
+}
+
+func SetupRoutes(app *fiber.App, redisCache cache.RedisCache, keys jwks.KeySet, apiKeys apikeys.Verifier, cfg config.Config) {
 	app.Get("/health", func(c *fiber.Ctx) error {
 		logger.Log.Info().Msg("Health check passed")
 		return c.SendString("OK")
@@ -63,6 +74,12 @@ func SetupRoutes(app *fiber.App, redisCache cache.RedisCache, cfg config.Config)
 		return c.SendString("OK")
 	})
 
+	// only the gateway may tell upstream services who the caller is
+	app.Use(middleware.StripIdentity())
+
+	// public keys for verifying access tokens, served by auth-service
+	app.Get("/.well-known/jwks.json", proxyTo(cfg.ApiAuthServiceInternalURL))
+
 	auth := app.Group("/api/auth",
 		middleware.CORS(cfg),
 		middleware.RateLimit(redisCache),
@@ -71,7 +88,8 @@ func SetupRoutes(app *fiber.App, redisCache cache.RedisCache, cfg config.Config)
 
 	user := app.Group("/api/user",
 		middleware.CORS(cfg),
-		middleware.Auth(cfg),
+		middleware.Auth(cfg, keys, apiKeys, redisCache),
+		middleware.Authorize(userRoutePermissions),
 	)
 	user.All("/*", proxyTo(cfg.ApiUserServiceInternalURL))
 }
@@ -0,0 +1,55 @@
+// Command breached-corpus turns a list of breached passwords into the corpus file auth-service
+// loads from PASSWORD_BREACHED_CORPUS_PATH.
+//
+//	go run ./cmd/breached-corpus -in passwords.txt -out breached.bin
+//	go run ./cmd/breached-corpus -in pwned-passwords-sha1.txt -sha1 -out breached.bin
+package main
+
+import (
+	"auth-service/internal/passwordpolicy"
+	"flag"
+	"fmt"
+	"os"
+)
+
+func main() {
+	in := flag.String("in", "", "password list, one entry per line")
+	out := flag.String("out", "breached.bin", "corpus file to write")
+	hashed := flag.Bool("sha1", false, "the list holds hex SHA-1 hashes (HASH or HASH:COUNT) instead of passwords")
+	flag.Parse()
+
+	if *in == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if err := run(*in, *out, *hashed); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(in, out string, hashed bool) error {
+	src, err := os.Open(in)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+
+	count, err := passwordpolicy.BuildCorpus(src, dst, hashed)
+	if err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	fmt.Printf("wrote %d passwords to %s\n", count, out)
+	return nil
+}
@@ -1,10 +1,14 @@
 package app
 
 import (
+	"auth-service/internal/cache"
 	grpcClient "auth-service/internal/client/grpc"
 	"auth-service/internal/config"
 	"auth-service/internal/handler"
 	"auth-service/internal/logger"
+	"auth-service/internal/mail"
+	"auth-service/internal/middleware"
+	"auth-service/internal/passwordpolicy"
 	"auth-service/internal/repository"
 	"auth-service/internal/router"
 	"auth-service/internal/service"
@@ -36,11 +40,86 @@ func Run() {
 	}
 	defer grpcUserClient.Close()
 
+	redisCache := cache.NewRedisCache(cfg.Redis)
+	defer redisCache.Close()
+
 	tokenRepository := repository.NewTokenRepository(postgresGORM.DB, cfg)
-	tokenManager := service.NewTokenManager(cfg.JWT)
-	authService := service.NewAuthService(grpcUserClient, tokenRepository, tokenManager, cfg)
+	passwordResetRepository := repository.NewPasswordResetRepository(postgresGORM.DB, cfg)
+	emailLoginRepository := repository.NewEmailLoginRepository(postgresGORM.DB, cfg)
+	mfaRepository := repository.NewMFARepository(postgresGORM.DB, cfg)
+	webAuthnRepository := repository.NewWebAuthnRepository(postgresGORM.DB, cfg)
+	oidcRepository := repository.NewOIDCRepository(postgresGORM.DB, cfg)
+	oauthRepository := repository.NewOAuthRepository(postgresGORM.DB, cfg)
+	serviceAccountRepository := repository.NewServiceAccountRepository(postgresGORM.DB)
+	apiKeyRepository := repository.NewAPIKeyRepository(postgresGORM.DB, cfg)
+	keyRepository := repository.NewKeyRepository(postgresGORM.DB)
+	tokenManager, err := service.NewTokenManager(cfg.JWT)
+	if err != nil {
+		logger.Log.Fatal().Err(err).Msg("Failed to load JWT signing key.")
+	}
+
+	keyService := service.NewKeyService(keyRepository, tokenManager.Keyring(), cfg)
+	if err := keyService.Load(ctx); err != nil {
+		logger.Log.Fatal().Err(err).Msg("Failed to load JWT signing keys.")
+	}
+	// ID tokens are only ever signed with keys from the keyring
+	if err := keyService.EnsureKey(ctx, service.KeyPurposeIDToken, "RS256"); err != nil {
+		logger.Log.Fatal().Err(err).Msg("Failed to create the ID token signing key.")
+	}
+	// pick up keys added or promoted through another instance
+	go keyService.Watch(ctx, 30*time.Second)
+
+	mailSender, err := mail.NewSender(cfg.Mail)
+	if err != nil {
+		logger.Log.Fatal().Err(err).Msg("Failed to set up the mail sender.")
+	}
+
+	// mail that only goes to existing accounts, waited for on shutdown
+	background := service.NewBackground()
+
+	// current passwords confirming a change are throttled like logins
+	loginThrottleService := service.NewLoginThrottleService(grpcUserClient, redisCache, mailSender, background, cfg)
+
+	emailVerificationService := service.NewEmailVerificationService(grpcUserClient, mailSender, loginThrottleService, cfg)
+	emailVerificationHandler := handler.NewEmailVerificationHandler(emailVerificationService)
+
+	webAuthnService, err := service.NewWebAuthnService(grpcUserClient, webAuthnRepository, cfg)
+	if err != nil {
+		logger.Log.Fatal().Err(err).Msg("Failed to set up WebAuthn.")
+	}
+	mfaService := service.NewMFAService(grpcUserClient, mfaRepository, webAuthnService, redisCache, loginThrottleService, cfg)
+	webAuthnHandler := handler.NewWebAuthnHandler(webAuthnService, mfaService)
+	mfaHandler := handler.NewMFAHandler(mfaService)
+
+	oidcService := service.NewOIDCService(grpcUserClient, oidcRepository, cfg)
+
+	var breachedPasswords passwordpolicy.Corpus
+	if cfg.Password.PasswordBreachedCorpusPath != "" {
+		breachedPasswords, err = passwordpolicy.LoadCorpus(cfg.Password.PasswordBreachedCorpusPath)
+		if err != nil {
+			logger.Log.Fatal().Err(err).Msg("Failed to load the breached password corpus.")
+		}
+	}
+	passwordPolicy := passwordpolicy.NewPolicy(cfg.Password, breachedPasswords)
+
+	emailLoginService := service.NewEmailLoginService(grpcUserClient, emailLoginRepository, mailSender, redisCache, loginThrottleService, background, cfg)
+
+	authService := service.NewAuthService(grpcUserClient, tokenRepository, redisCache, tokenManager, emailVerificationService, mfaService, webAuthnService, oidcService, emailLoginService, loginThrottleService, passwordPolicy, cfg)
 	authHandler := handler.NewAuthHandler(authService, cfg)
 
+	oauthService := service.NewOAuthService(grpcUserClient, oauthRepository, tokenRepository, redisCache, tokenManager, cfg)
+	oauthHandler := handler.NewOAuthHandler(oauthService, tokenManager, cfg)
+
+	serviceAccountService := service.NewServiceAccountService(serviceAccountRepository, tokenManager, cfg)
+	serviceAccountHandler := handler.NewServiceAccountHandler(serviceAccountService)
+
+	apiKeyService := service.NewAPIKeyService(grpcUserClient, apiKeyRepository, redisCache, cfg)
+	apiKeyHandler := handler.NewAPIKeyHandler(apiKeyService)
+
+	passwordService := service.NewPasswordService(grpcUserClient, passwordResetRepository, authService, mailSender, passwordPolicy, loginThrottleService, background, cfg)
+	passwordHandler := handler.NewPasswordHandler(passwordService, cfg)
+	keysHandler := handler.NewKeysHandler(tokenManager, keyService)
+
 	app := fiber.New(fiber.Config{
 		ReadTimeout:           10 * time.Second,
 		WriteTimeout:          10 * time.Second,
@@ -48,7 +127,7 @@ func Run() {
 		DisableStartupMessage: cfg.AppEnv == "production",
 	})
 
-	router.SetupRoutes(app, authHandler, postgresGORM.DB, grpcUserClient)
+	router.SetupRoutes(app, authHandler, passwordHandler, emailVerificationHandler, mfaHandler, webAuthnHandler, oauthHandler, serviceAccountHandler, apiKeyHandler, keysHandler, middleware.Auth(tokenManager, redisCache, cfg), postgresGORM.DB, grpcUserClient, cfg)
 
 	serverError := make(chan error, 1)
 
@@ -78,5 +157,7 @@ func Run() {
 		logger.Log.Info().Msg("Auth Service HTTP shutdown gracefully.")
 	}
 
+	background.Wait()
+
 	logger.Log.Info().Msg("Running cleanup tasks...")
 }
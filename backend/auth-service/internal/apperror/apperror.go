@@ -1,11 +1,31 @@
 package apperror
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
 
 type AppError struct {
 	Code    int
 	Message string
 	Err     error
+	// RetryAfter is sent as the Retry-After header when set
+	RetryAfter time.Duration
+	// Fields lists the problems with single fields of the request
+	Fields []FieldError
+}
+
+// FieldError is a problem with one field of the request. Code is stable for clients, Message
+// is for people.
+type FieldError struct {
+	Field   string `json:"field"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
 }
 
 func (e *AppError) Error() string {
@@ -21,10 +41,19 @@ func BadRequest(msg string) *AppError {
 	return &AppError{Code: fiber.StatusBadRequest, Message: msg}
 }
 
+// Validation is a bad request with the problems of each field.
+func Validation(msg string, fields []FieldError) *AppError {
+	return &AppError{Code: fiber.StatusBadRequest, Message: msg, Fields: fields}
+}
+
 func Unauthorized(msg string) *AppError {
 	return &AppError{Code: fiber.StatusUnauthorized, Message: msg}
 }
 
+func Forbidden(msg string) *AppError {
+	return &AppError{Code: fiber.StatusForbidden, Message: msg}
+}
+
 func NotFound(msg string) *AppError {
 	return &AppError{Code: fiber.StatusNotFound, Message: msg}
 }
@@ -33,6 +62,10 @@ func Conflict(msg string) *AppError {
 	return &AppError{Code: fiber.StatusConflict, Message: msg}
 }
 
+func TooManyRequests(msg string, retryAfter time.Duration) *AppError {
+	return &AppError{Code: fiber.StatusTooManyRequests, Message: msg, RetryAfter: retryAfter}
+}
+
 // Server Errors
 func Internal(err error) *AppError {
 	return &AppError{
@@ -41,3 +74,46 @@ func Internal(err error) *AppError {
 		Err:     err,
 	}
 }
+
+// FromGRPC translates an error of a user-service call. NotFound, AlreadyExists and
+// InvalidArgument become 404, 409 and 400 with the message user-service sent, the field
+// violations in the details of InvalidArgument become the fields. Anything else is internal.
+func FromGRPC(err error) *AppError {
+	st, ok := status.FromError(err)
+	if !ok {
+		return Internal(err)
+	}
+
+	var appErr *AppError
+	switch st.Code() {
+	case codes.NotFound:
+		appErr = NotFound(st.Message())
+	case codes.AlreadyExists:
+		appErr = Conflict(st.Message())
+	case codes.InvalidArgument:
+		appErr = Validation(st.Message(), fieldErrors(st))
+	default:
+		return Internal(err)
+	}
+
+	appErr.Err = err
+	return appErr
+}
+
+func fieldErrors(st *status.Status) []FieldError {
+	var fields []FieldError
+	for _, detail := range st.Details() {
+		badRequest, ok := detail.(*errdetails.BadRequest)
+		if !ok {
+			continue
+		}
+		for _, violation := range badRequest.GetFieldViolations() {
+			fields = append(fields, FieldError{
+				Field:   violation.GetField(),
+				Code:    strings.ToLower(violation.GetReason()),
+				Message: violation.GetDescription(),
+			})
+		}
+	}
+	return fields
+}
@@ -0,0 +1,57 @@
+package apperror
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestFromGRPC(t *testing.T) {
+	invalid, err := status.New(codes.InvalidArgument, "display_name must be at most 100 characters").WithDetails(
+		&errdetails.ErrorInfo{Reason: "TOO_LONG", Domain: "user-service"},
+		&errdetails.BadRequest{FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+			Field:       "display_name",
+			Description: "display_name must be at most 100 characters",
+			Reason:      "TOO_LONG",
+		}}},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		err        error
+		wantCode   int
+		wantMsg    string
+		wantFields []FieldError
+	}{
+		{"not found", status.Error(codes.NotFound, "user not found"), 404, "user not found", nil},
+		{"already exists", status.Error(codes.AlreadyExists, "email is already registered"), 409, "email is already registered", nil},
+		{"invalid argument", invalid.Err(), 400, "display_name must be at most 100 characters", []FieldError{{
+			Field:   "display_name",
+			Code:    "too_long",
+			Message: "display_name must be at most 100 characters",
+		}}},
+		{"unavailable", status.Error(codes.Unavailable, "connection refused"), 500, "internal server error", nil},
+		{"not a status", errors.New("boom"), 500, "internal server error", nil},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := FromGRPC(tc.err)
+			if got.Code != tc.wantCode || got.Message != tc.wantMsg {
+				t.Errorf("FromGRPC() = %d %q, want %d %q", got.Code, got.Message, tc.wantCode, tc.wantMsg)
+			}
+			if !slices.Equal(got.Fields, tc.wantFields) {
+				t.Errorf("FromGRPC() fields = %+v, want %+v", got.Fields, tc.wantFields)
+			}
+			if !errors.Is(got, tc.err) {
+				t.Error("FromGRPC() does not wrap the gRPC error")
+			}
+		})
+	}
+}
@@ -0,0 +1,185 @@
+package cache
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/logger"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// The revocation list is shared with the gateway, which reads the same keys.
+const (
+	revokedTokenPrefix   = "revoked:token:"
+	revokedSessionPrefix = "revoked:session:"
+)
+
+// loginPrefix keys a hash per account with the failed logins and blocks, in total and per IP.
+const loginPrefix = "login:"
+
+// The login hash is updated by scripts, so concurrent failures can neither lose a longer block
+// nor let the hash expire while a block in it still applies: its TTL is only ever extended.
+var (
+	// recordLoginFailureScript increments the failures of the account (ARGV[1]) and of the ip
+	// field (ARGV[2]) and keeps the hash for at least ARGV[3] milliseconds.
+	recordLoginFailureScript = redis.NewScript(`
+local accountFailures = redis.call('HINCRBY', KEYS[1], ARGV[1], 1)
+local ipFailures = redis.call('HINCRBY', KEYS[1], ARGV[2], 1)
+if redis.call('PTTL', KEYS[1]) < tonumber(ARGV[3]) then
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+end
+return {accountFailures, ipFailures}
+`)
+
+	// blockLoginScript sets the block field (ARGV[1]) to the unix milliseconds in ARGV[2] unless
+	// it holds a later time, and keeps the hash for at least ARGV[3] milliseconds.
+	blockLoginScript = redis.NewScript(`
+local current = tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+if current < tonumber(ARGV[2]) then
+	redis.call('HSET', KEYS[1], ARGV[1], ARGV[2])
+end
+if redis.call('PTTL', KEYS[1]) < tonumber(ARGV[3]) then
+	redis.call('PEXPIRE', KEYS[1], ARGV[3])
+end
+return 0
+`)
+)
+
+type RedisCache interface {
+	// RevokeToken puts a single access token on the revocation list until it expires.
+	RevokeToken(ctx context.Context, tokenID string, ttl time.Duration) error
+	// RevokeSessions revokes every access token issued for the sessions. ttl should cover
+	// the lifetime of the longest living access token.
+	RevokeSessions(ctx context.Context, sessionIDs []string, ttl time.Duration) error
+	IsRevoked(ctx context.Context, tokenID, sessionID string) (bool, error)
+	// RecordLoginFailure counts a failed login of the account from the ip and returns the failures
+	// of the account and those from the ip. Everything recorded for the account is forgotten
+	// window after its last failure.
+	RecordLoginFailure(ctx context.Context, account, ip string, window time.Duration) (int64, int64, error)
+	// BlockLogin blocks logins of the account until the time, only from the ip if it is not empty.
+	// A longer block is kept.
+	BlockLogin(ctx context.Context, account, ip string, until time.Time) error
+	// LoginBlockedUntil returns until when logins of the account from the ip are blocked, a time in
+	// the past if they are not.
+	LoginBlockedUntil(ctx context.Context, account, ip string) (time.Time, error)
+	// ResetLogin forgets the failures and lifts the blocks of the account.
+	ResetLogin(ctx context.Context, account string) error
+	Ping(ctx context.Context) error
+	Close()
+}
+
+type redisCache struct {
+	cache *redis.Client
+}
+
+func NewRedisCache(config config.RedisConfig) RedisCache {
+	return &redisCache{
+		cache: redis.NewClient(&redis.Options{
+			Addr: config.RedisInternalURL,
+		}),
+	}
+}
+
+func (r *redisCache) RevokeToken(ctx context.Context, tokenID string, ttl time.Duration) error {
+	if tokenID == "" || ttl <= 0 {
+		return nil
+	}
+
+	return r.cache.Set(ctx, revokedTokenPrefix+tokenID, 1, ttl).Err()
+}
+
+func (r *redisCache) RevokeSessions(ctx context.Context, sessionIDs []string, ttl time.Duration) error {
+	if len(sessionIDs) == 0 {
+		return nil
+	}
+
+	pipe := r.cache.Pipeline()
+	for _, id := range sessionIDs {
+		pipe.Set(ctx, revokedSessionPrefix+id, 1, ttl)
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+func (r *redisCache) IsRevoked(ctx context.Context, tokenID, sessionID string) (bool, error) {
+	keys := []string{revokedTokenPrefix + tokenID}
+	if sessionID != "" {
+		keys = append(keys, revokedSessionPrefix+sessionID)
+	}
+
+	count, err := r.cache.Exists(ctx, keys...).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+func (r *redisCache) RecordLoginFailure(ctx context.Context, account, ip string, window time.Duration) (int64, int64, error) {
+	counts, err := recordLoginFailureScript.Run(ctx, r.cache, []string{loginPrefix + account},
+		"failures", "failures:"+ip, window.Milliseconds()).Int64Slice()
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(counts) != 2 {
+		return 0, 0, fmt.Errorf("unexpected login failure counts %v", counts)
+	}
+
+	return counts[0], counts[1], nil
+}
+
+func (r *redisCache) BlockLogin(ctx context.Context, account, ip string, until time.Time) error {
+	field := "blocked"
+	if ip != "" {
+		field = "blocked:" + ip
+	}
+
+	ttl := time.Until(until)
+	if ttl <= 0 {
+		return nil
+	}
+
+	return blockLoginScript.Run(ctx, r.cache, []string{loginPrefix + account}, field, until.UnixMilli(), ttl.Milliseconds()).Err()
+}
+
+func (r *redisCache) LoginBlockedUntil(ctx context.Context, account, ip string) (time.Time, error) {
+	values, err := r.cache.HMGet(ctx, loginPrefix+account, "blocked", "blocked:"+ip).Result()
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	var until int64
+	for _, value := range values {
+		// missing fields are nil
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		ms, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return time.Time{}, err
+		}
+		until = max(until, ms)
+	}
+
+	return time.UnixMilli(until), nil
+}
+
+func (r *redisCache) ResetLogin(ctx context.Context, account string) error {
+	return r.cache.Del(ctx, loginPrefix+account).Err()
+}
+
+func (r *redisCache) Ping(ctx context.Context) error {
+	return r.cache.Ping(ctx).Err()
+}
+
+func (r *redisCache) Close() {
+	logger.Log.Info().Msg("closing redis cache connection")
+	if err := r.cache.Close(); err != nil {
+		logger.Log.Error().Err(err).Msg("error closing redis cache connection")
+	}
+}
@@ -17,7 +17,24 @@ type UserService interface {
 	GetUserByEmail(ctx context.Context, email string) (*userpb.GetUserByEmailResponse, error)
 	GetUserByID(ctx context.Context, id string) (*userpb.GetUserByIDResponse, error)
 	CheckUserExistsByEmail(ctx context.Context, email string) (*userpb.CheckUserExistsByEmailResponse, error)
-	RegisterUser(ctx context.Context, email string, hashedPassword []byte) (*userpb.RegisterUserResponse, error)
+	// NormalizeEmail returns the form user-service makes accounts unique by, it fails with
+	// InvalidArgument for an email no account can have.
+	NormalizeEmail(ctx context.Context, email string) (*userpb.NormalizeEmailResponse, error)
+	// RegisterUser and UpdatePassword take the password as the user typed it, user-service
+	// hashes it. RegisterUser fails with AlreadyExists for a registered email, a retry with the
+	// same idempotency key gets the user of the first request with Replayed set.
+	RegisterUser(ctx context.Context, email, password, idempotencyKey string) (*userpb.RegisterUserResponse, error)
+	// DeleteUser rolls back a registration that could not be finished. user-service only deletes
+	// an unverified user, with an idempotency key only the one that registration created.
+	DeleteUser(ctx context.Context, id, idempotencyKey string) error
+	// VerifyCredentials checks a password in user-service, the hashes never leave it. It fails
+	// with NotFound for emails without an account.
+	VerifyCredentials(ctx context.Context, email, password string) (*userpb.VerifyCredentialsResponse, error)
+	UpdatePassword(ctx context.Context, id, password string) error
+	MarkEmailVerified(ctx context.Context, id, email string) (bool, error)
+	// RequestEmailChange stores email as the pending email of the user and returns it as stored,
+	// MarkEmailVerified with it makes it their email.
+	RequestEmailChange(ctx context.Context, id, email string) (string, error)
 	Ping(ctx context.Context) error
 }
 
@@ -83,13 +100,66 @@ func (u *UserClient) CheckUserExistsByEmail(ctx context.Context, email string) (
 	return resp, nil
 }
 
-func (u *UserClient) RegisterUser(ctx context.Context, email string, hashedPassword []byte) (*userpb.RegisterUserResponse, error) {
+func (u *UserClient) NormalizeEmail(ctx context.Context, email string) (*userpb.NormalizeEmailResponse, error) {
+	resp, err := u.client.NormalizeEmail(ctx, &userpb.NormalizeEmailRequest{Email: email})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (u *UserClient) RegisterUser(ctx context.Context, email, password, idempotencyKey string) (*userpb.RegisterUserResponse, error) {
 	resp, err := u.client.RegisterUser(ctx, &userpb.RegisterUserRequest{
-		Email:    email,
-		Password: string(hashedPassword),
+		Credentials:    &userpb.Credentials{Email: email, Password: password},
+		IdempotencyKey: idempotencyKey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+func (u *UserClient) DeleteUser(ctx context.Context, id, idempotencyKey string) error {
+	_, err := u.client.DeleteUser(ctx, &userpb.DeleteUserRequest{Id: id, IdempotencyKey: idempotencyKey})
+	return err
+}
+
+func (u *UserClient) VerifyCredentials(ctx context.Context, email, password string) (*userpb.VerifyCredentialsResponse, error) {
+	resp, err := u.client.VerifyCredentials(ctx, &userpb.VerifyCredentialsRequest{
+		Credentials: &userpb.Credentials{Email: email, Password: password},
 	})
 	if err != nil {
 		return nil, err
 	}
 	return resp, nil
 }
+
+func (u *UserClient) UpdatePassword(ctx context.Context, id, password string) error {
+	_, err := u.client.UpdatePassword(ctx, &userpb.UpdatePasswordRequest{
+		Id:       id,
+		Password: password,
+	})
+	return err
+}
+
+func (u *UserClient) MarkEmailVerified(ctx context.Context, id, email string) (bool, error) {
+	resp, err := u.client.MarkEmailVerified(ctx, &userpb.MarkEmailVerifiedRequest{
+		Id:    id,
+		Email: email,
+	})
+	if err != nil {
+		return false, err
+	}
+	return resp.Verified, nil
+}
+
+func (u *UserClient) RequestEmailChange(ctx context.Context, id, email string) (string, error) {
+	resp, err := u.client.RequestEmailChange(ctx, &userpb.RequestEmailChangeRequest{
+		Id:    id,
+		Email: email,
+	})
+	if err != nil {
+		return "", err
+	}
+	return resp.Email, nil
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 )
@@ -17,11 +19,163 @@ type PostgresConfig struct {
 	PostgresSSLMode  string
 }
 
+type RedisConfig struct {
+	RedisInternalURL string
+}
+
 type JWTConfig struct {
 	JWTAccessTokenSecret  string
 	JWTRefreshTokenSecret string
 	JWTAccessTokenExp     time.Duration
 	JWTRefreshTokenExp    time.Duration
+	// JWTAccessTokenAlg is HS256 (shared secret) or RS256, ES256, EdDSA (private key file)
+	JWTAccessTokenAlg            string
+	JWTAccessTokenPrivateKeyPath string
+	// RefreshTokenHashKey is the HMAC key used to hash refresh tokens before they are stored
+	RefreshTokenHashKey string
+	// KeyringEncryptionKey encrypts the private signing keys stored in the database
+	KeyringEncryptionKey string
+}
+
+type MailConfig struct {
+	// MailSender is "log" (default) or "file"
+	MailSender string
+	MailFrom   string
+	// MailFileDir is where the file sender writes messages
+	MailFileDir string
+}
+
+type PasswordConfig struct {
+	// PasswordMinLength and PasswordMaxLength bound the length in characters, bcrypt hashes at
+	// most 72 bytes either way
+	PasswordMinLength int
+	PasswordMaxLength int
+	// PasswordMinClasses is how many of lowercase letters, uppercase letters, digits and symbols
+	// a password must mix
+	PasswordMinClasses int
+	// PasswordBannedWords may not appear anywhere in a password, regardless of case
+	PasswordBannedWords []string
+	// PasswordBreachedCorpusPath is a corpus file of breached passwords, built with
+	// cmd/breached-corpus. The check is skipped when it is empty
+	PasswordBreachedCorpusPath string
+}
+
+type PasswordResetConfig struct {
+	// PasswordResetURL is the page that takes the reset token, the token is appended as ?token=
+	PasswordResetURL      string
+	PasswordResetTokenExp time.Duration
+}
+
+type EmailLoginConfig struct {
+	// EmailLoginURL is the page that takes the login link token, the token is appended as ?token=
+	EmailLoginURL string
+	// EmailLoginExp is how long the link and the code of a login email stay valid
+	EmailLoginExp time.Duration
+}
+
+// Policies for accounts that have not verified their email yet.
+const (
+	// EmailVerificationBlock refuses to sign in unverified accounts.
+	EmailVerificationBlock = "block"
+	// EmailVerificationRestrict signs them in with restricted access tokens.
+	EmailVerificationRestrict = "restrict"
+)
+
+type EmailVerificationConfig struct {
+	// EmailVerificationSecret signs the verification links
+	EmailVerificationSecret string
+	// EmailVerificationURL is the page that takes the verification token, appended as ?token=
+	EmailVerificationURL      string
+	EmailVerificationTokenExp time.Duration
+	// EmailVerificationPolicy is EmailVerificationBlock or EmailVerificationRestrict
+	EmailVerificationPolicy string
+}
+
+type MFAConfig struct {
+	// MFAEncryptionKey encrypts the TOTP secrets stored in the database
+	MFAEncryptionKey string
+	// MFAIssuer is the account issuer shown in authenticator apps
+	MFAIssuer string
+	// MFAChallengeExp is how long the second factor can be entered after the password was accepted
+	MFAChallengeExp time.Duration
+}
+
+type WebAuthnConfig struct {
+	// WebAuthnRPID is the domain passkeys are bound to, e.g. example.com
+	WebAuthnRPID          string
+	WebAuthnRPDisplayName string
+	// WebAuthnRPOrigins are the origins the browser may run the ceremonies on, e.g. https://example.com
+	WebAuthnRPOrigins []string
+	// WebAuthnCeremonyExp is how long a started registration or login can be finished
+	WebAuthnCeremonyExp time.Duration
+}
+
+// Types of identity providers. An OpenID Connect provider is found through the discovery
+// document of its issuer and vouches for the user with an ID token. A plain OAuth 2.0 provider,
+// such as GitHub, is configured with its endpoints and asked for the user at its userinfo endpoint.
+const (
+	OIDCProviderOIDC   = "oidc"
+	OIDCProviderOAuth2 = "oauth2"
+)
+
+type OIDCProviderConfig struct {
+	// Name identifies the provider in the login and callback URLs, e.g. google
+	Name         string
+	Type         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	// AuthURL, TokenURL and UserInfoURL are the endpoints of an OAuth 2.0 provider
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+	// EmailsURL lists the addresses of the user with whether they are verified, in the format of
+	// GitHub's /user/emails, for providers whose userinfo does not say
+	EmailsURL string
+}
+
+type OIDCConfig struct {
+	OIDCProviders []OIDCProviderConfig
+	// OIDCCallbackBaseURL is the public URL of the OIDC routes, the callback of a provider is
+	// <base>/<name>/callback and has to be registered with the provider
+	OIDCCallbackBaseURL string
+	// OIDCLoginRedirectURL is the page the browser is sent to after a login through a provider
+	OIDCLoginRedirectURL string
+	// OIDCStateExp is how long the login at the provider can take
+	OIDCStateExp time.Duration
+}
+
+type OAuthConfig struct {
+	// OAuthIssuer is the public URL auth-service is reached at as an OpenID Connect provider, the
+	// discovery document is served at <issuer>/.well-known/openid-configuration
+	OAuthIssuer string
+	// OAuthConsentURL is the page that asks the user to approve a client, it gets ?request_id=
+	OAuthConsentURL string
+	// OAuthConsentExp is how long the consent page can take
+	OAuthConsentExp time.Duration
+	// OAuthCodeExp is how long an authorization code can be redeemed
+	OAuthCodeExp time.Duration
+}
+
+// LoginThrottleConfig slows down password guessing against a single account.
+type LoginThrottleConfig struct {
+	// LoginBackoffAfter is how many failed logins of an account from one IP are free, each
+	// further one doubles the wait before the next try from that IP
+	LoginBackoffAfter int
+	// LoginBackoffMax caps the wait between tries from one IP
+	LoginBackoffMax time.Duration
+	// LoginLockoutThreshold is how many failed logins of an account from any IP lock it
+	LoginLockoutThreshold int
+	// LoginLockoutDuration is how long a locked account can not log in with its password
+	LoginLockoutDuration time.Duration
+}
+
+type APIKeyConfig struct {
+	// APIKeyRateLimit is the requests per minute of a key created without a rate limit
+	APIKeyRateLimit int
+	// APIKeyMaxRateLimit is the highest rate limit a user can give a key
+	APIKeyMaxRateLimit int
 }
 
 type Config struct {
@@ -32,6 +186,24 @@ type Config struct {
 	GRPCUserServiceInternalURL  string
 	Postgres                    PostgresConfig
 	JWT                         JWTConfig
+	Redis                       RedisConfig
+	Mail                        MailConfig
+	Password                    PasswordConfig
+	PasswordReset               PasswordResetConfig
+	EmailLogin                  EmailLoginConfig
+	EmailVerification           EmailVerificationConfig
+	MFA                         MFAConfig
+	WebAuthn                    WebAuthnConfig
+	OIDC                        OIDCConfig
+	OAuth                       OAuthConfig
+	APIKey                      APIKeyConfig
+	LoginThrottle               LoginThrottleConfig
+	// RevocationFailOpen accepts access tokens when the revocation list can not be checked
+	RevocationFailOpen bool
+	// AdminAPIKey protects the key management endpoints, they are disabled when it is empty
+	AdminAPIKey string
+	// InternalAPIKey lets internal services such as the gateway fetch the HMAC verification keys
+	InternalAPIKey string
 }
 
 var (
@@ -50,6 +222,223 @@ func LoadConfigFromEnv() (Config, error) {
 		return Config{}, fmt.Errorf("failed to parse JWT_REFRESH_TOKEN_EXPIRATION: %w", err)
 	}
 
+	refreshTokenHashKey := os.Getenv("REFRESH_TOKEN_HASH_KEY")
+	if refreshTokenHashKey == "" {
+		return Config{}, fmt.Errorf("REFRESH_TOKEN_HASH_KEY is required")
+	}
+
+	keyringEncryptionKey := os.Getenv("JWT_KEYRING_ENCRYPTION_KEY")
+	if keyringEncryptionKey == "" {
+		return Config{}, fmt.Errorf("JWT_KEYRING_ENCRYPTION_KEY is required")
+	}
+
+	passwordMinLength := 8
+	if v := os.Getenv("PASSWORD_MIN_LENGTH"); v != "" {
+		passwordMinLength, err = strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse PASSWORD_MIN_LENGTH: %w", err)
+		}
+	}
+
+	passwordMaxLength := 64
+	if v := os.Getenv("PASSWORD_MAX_LENGTH"); v != "" {
+		passwordMaxLength, err = strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse PASSWORD_MAX_LENGTH: %w", err)
+		}
+	}
+
+	passwordMinClasses := 1
+	if v := os.Getenv("PASSWORD_MIN_CHARACTER_CLASSES"); v != "" {
+		passwordMinClasses, err = strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse PASSWORD_MIN_CHARACTER_CLASSES: %w", err)
+		}
+	}
+
+	passwordBannedWords := []string{}
+	for _, word := range strings.Split(os.Getenv("PASSWORD_BANNED_WORDS"), ",") {
+		if word = strings.TrimSpace(word); word != "" {
+			passwordBannedWords = append(passwordBannedWords, word)
+		}
+	}
+
+	passwordResetExp := 30 * time.Minute
+	if v := os.Getenv("PASSWORD_RESET_TOKEN_EXPIRATION"); v != "" {
+		passwordResetExp, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse PASSWORD_RESET_TOKEN_EXPIRATION: %w", err)
+		}
+	}
+
+	emailLoginExp := 10 * time.Minute
+	if v := os.Getenv("EMAIL_LOGIN_EXPIRATION"); v != "" {
+		emailLoginExp, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse EMAIL_LOGIN_EXPIRATION: %w", err)
+		}
+	}
+
+	emailVerificationSecret := os.Getenv("EMAIL_VERIFICATION_SECRET")
+	if emailVerificationSecret == "" {
+		return Config{}, fmt.Errorf("EMAIL_VERIFICATION_SECRET is required")
+	}
+
+	emailVerificationExp := 24 * time.Hour
+	if v := os.Getenv("EMAIL_VERIFICATION_TOKEN_EXPIRATION"); v != "" {
+		emailVerificationExp, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse EMAIL_VERIFICATION_TOKEN_EXPIRATION: %w", err)
+		}
+	}
+
+	emailVerificationPolicy := os.Getenv("EMAIL_VERIFICATION_POLICY")
+	switch emailVerificationPolicy {
+	case "":
+		emailVerificationPolicy = EmailVerificationRestrict
+	case EmailVerificationBlock, EmailVerificationRestrict:
+	default:
+		return Config{}, fmt.Errorf("EMAIL_VERIFICATION_POLICY must be %s or %s", EmailVerificationBlock, EmailVerificationRestrict)
+	}
+
+	mfaEncryptionKey := os.Getenv("MFA_ENCRYPTION_KEY")
+	if mfaEncryptionKey == "" {
+		return Config{}, fmt.Errorf("MFA_ENCRYPTION_KEY is required")
+	}
+
+	mfaIssuer := os.Getenv("MFA_ISSUER")
+	if mfaIssuer == "" {
+		mfaIssuer = "go-jwt-auth"
+	}
+
+	mfaChallengeExp := 5 * time.Minute
+	if v := os.Getenv("MFA_CHALLENGE_EXPIRATION"); v != "" {
+		mfaChallengeExp, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse MFA_CHALLENGE_EXPIRATION: %w", err)
+		}
+	}
+
+	webAuthnRPID := os.Getenv("WEBAUTHN_RP_ID")
+	if webAuthnRPID == "" {
+		webAuthnRPID = "localhost"
+	}
+
+	webAuthnRPDisplayName := os.Getenv("WEBAUTHN_RP_DISPLAY_NAME")
+	if webAuthnRPDisplayName == "" {
+		webAuthnRPDisplayName = "go-jwt-auth"
+	}
+
+	webAuthnRPOrigins := []string{"http://localhost"}
+	if v := os.Getenv("WEBAUTHN_RP_ORIGINS"); v != "" {
+		webAuthnRPOrigins = strings.Split(v, ",")
+	}
+
+	webAuthnCeremonyExp := 5 * time.Minute
+	if v := os.Getenv("WEBAUTHN_CEREMONY_EXPIRATION"); v != "" {
+		webAuthnCeremonyExp, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse WEBAUTHN_CEREMONY_EXPIRATION: %w", err)
+		}
+	}
+
+	oidcProviders, err := loadOIDCProviders(os.Getenv("OIDC_PROVIDERS"))
+	if err != nil {
+		return Config{}, err
+	}
+
+	oidcCallbackBaseURL := os.Getenv("OIDC_CALLBACK_BASE_URL")
+	if oidcCallbackBaseURL == "" {
+		oidcCallbackBaseURL = "http://localhost/api/auth/oidc"
+	}
+
+	oidcLoginRedirectURL := os.Getenv("OIDC_LOGIN_REDIRECT_URL")
+	if oidcLoginRedirectURL == "" {
+		oidcLoginRedirectURL = "http://localhost/"
+	}
+
+	oidcStateExp := 10 * time.Minute
+	if v := os.Getenv("OIDC_STATE_EXPIRATION"); v != "" {
+		oidcStateExp, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse OIDC_STATE_EXPIRATION: %w", err)
+		}
+	}
+
+	oauthIssuer := os.Getenv("OAUTH_ISSUER")
+	if oauthIssuer == "" {
+		oauthIssuer = "http://localhost/api/auth"
+	}
+
+	oauthConsentURL := os.Getenv("OAUTH_CONSENT_URL")
+	if oauthConsentURL == "" {
+		oauthConsentURL = "http://localhost/oauth/consent"
+	}
+
+	oauthConsentExp := 10 * time.Minute
+	if v := os.Getenv("OAUTH_CONSENT_EXPIRATION"); v != "" {
+		oauthConsentExp, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse OAUTH_CONSENT_EXPIRATION: %w", err)
+		}
+	}
+
+	oauthCodeExp := time.Minute
+	if v := os.Getenv("OAUTH_AUTHORIZATION_CODE_EXPIRATION"); v != "" {
+		oauthCodeExp, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse OAUTH_AUTHORIZATION_CODE_EXPIRATION: %w", err)
+		}
+	}
+
+	loginBackoffAfter := 3
+	if v := os.Getenv("LOGIN_BACKOFF_AFTER"); v != "" {
+		loginBackoffAfter, err = strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse LOGIN_BACKOFF_AFTER: %w", err)
+		}
+	}
+
+	loginBackoffMax := 5 * time.Minute
+	if v := os.Getenv("LOGIN_BACKOFF_MAX"); v != "" {
+		loginBackoffMax, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse LOGIN_BACKOFF_MAX: %w", err)
+		}
+	}
+
+	loginLockoutThreshold := 10
+	if v := os.Getenv("LOGIN_LOCKOUT_THRESHOLD"); v != "" {
+		loginLockoutThreshold, err = strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse LOGIN_LOCKOUT_THRESHOLD: %w", err)
+		}
+	}
+
+	loginLockoutDuration := 15 * time.Minute
+	if v := os.Getenv("LOGIN_LOCKOUT_DURATION"); v != "" {
+		loginLockoutDuration, err = time.ParseDuration(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse LOGIN_LOCKOUT_DURATION: %w", err)
+		}
+	}
+
+	apiKeyRateLimit := 60
+	if v := os.Getenv("API_KEY_RATE_LIMIT"); v != "" {
+		apiKeyRateLimit, err = strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse API_KEY_RATE_LIMIT: %w", err)
+		}
+	}
+
+	apiKeyMaxRateLimit := 600
+	if v := os.Getenv("API_KEY_MAX_RATE_LIMIT"); v != "" {
+		apiKeyMaxRateLimit, err = strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse API_KEY_MAX_RATE_LIMIT: %w", err)
+		}
+	}
+
 	return Config{
 		AppEnv:                      os.Getenv("APP_ENV"),
 		ApiAuthServiceInternalPort:  os.Getenv("API_AUTH_SERVICE_INTERNAL_PORT"),
@@ -65,14 +454,138 @@ func LoadConfigFromEnv() (Config, error) {
 			PostgresSSLMode:  os.Getenv("DB_AUTH_POSTGRES_SSLMODE"),
 		},
 		JWT: JWTConfig{
-			JWTAccessTokenSecret:  os.Getenv("JWT_ACCESS_TOKEN_SECRET"),
-			JWTRefreshTokenSecret: os.Getenv("JWT_REFRESH_TOKEN_SECRET"),
-			JWTAccessTokenExp:     accessExp,
-			JWTRefreshTokenExp:    expRefresh,
+			JWTAccessTokenSecret:         os.Getenv("JWT_ACCESS_TOKEN_SECRET"),
+			JWTRefreshTokenSecret:        os.Getenv("JWT_REFRESH_TOKEN_SECRET"),
+			JWTAccessTokenExp:            accessExp,
+			JWTRefreshTokenExp:           expRefresh,
+			JWTAccessTokenAlg:            os.Getenv("JWT_ACCESS_TOKEN_ALG"),
+			JWTAccessTokenPrivateKeyPath: os.Getenv("JWT_ACCESS_TOKEN_PRIVATE_KEY_PATH"),
+			RefreshTokenHashKey:          refreshTokenHashKey,
+			KeyringEncryptionKey:         keyringEncryptionKey,
+		},
+		Redis: RedisConfig{
+			RedisInternalURL: os.Getenv("REDIS_INTERNAL_URL"),
+		},
+		Mail: MailConfig{
+			MailSender:  os.Getenv("MAIL_SENDER"),
+			MailFrom:    os.Getenv("MAIL_FROM"),
+			MailFileDir: os.Getenv("MAIL_FILE_DIR"),
+		},
+		Password: PasswordConfig{
+			PasswordMinLength:          passwordMinLength,
+			PasswordMaxLength:          passwordMaxLength,
+			PasswordMinClasses:         passwordMinClasses,
+			PasswordBannedWords:        passwordBannedWords,
+			PasswordBreachedCorpusPath: os.Getenv("PASSWORD_BREACHED_CORPUS_PATH"),
+		},
+		PasswordReset: PasswordResetConfig{
+			PasswordResetURL:      os.Getenv("PASSWORD_RESET_URL"),
+			PasswordResetTokenExp: passwordResetExp,
+		},
+		EmailLogin: EmailLoginConfig{
+			EmailLoginURL: os.Getenv("EMAIL_LOGIN_URL"),
+			EmailLoginExp: emailLoginExp,
+		},
+		EmailVerification: EmailVerificationConfig{
+			EmailVerificationSecret:   emailVerificationSecret,
+			EmailVerificationURL:      os.Getenv("EMAIL_VERIFICATION_URL"),
+			EmailVerificationTokenExp: emailVerificationExp,
+			EmailVerificationPolicy:   emailVerificationPolicy,
+		},
+		MFA: MFAConfig{
+			MFAEncryptionKey: mfaEncryptionKey,
+			MFAIssuer:        mfaIssuer,
+			MFAChallengeExp:  mfaChallengeExp,
 		},
+		WebAuthn: WebAuthnConfig{
+			WebAuthnRPID:          webAuthnRPID,
+			WebAuthnRPDisplayName: webAuthnRPDisplayName,
+			WebAuthnRPOrigins:     webAuthnRPOrigins,
+			WebAuthnCeremonyExp:   webAuthnCeremonyExp,
+		},
+		OIDC: OIDCConfig{
+			OIDCProviders:        oidcProviders,
+			OIDCCallbackBaseURL:  strings.TrimSuffix(oidcCallbackBaseURL, "/"),
+			OIDCLoginRedirectURL: oidcLoginRedirectURL,
+			OIDCStateExp:         oidcStateExp,
+		},
+		OAuth: OAuthConfig{
+			OAuthIssuer:     strings.TrimSuffix(oauthIssuer, "/"),
+			OAuthConsentURL: oauthConsentURL,
+			OAuthConsentExp: oauthConsentExp,
+			OAuthCodeExp:    oauthCodeExp,
+		},
+		APIKey: APIKeyConfig{
+			APIKeyRateLimit:    apiKeyRateLimit,
+			APIKeyMaxRateLimit: apiKeyMaxRateLimit,
+		},
+		LoginThrottle: LoginThrottleConfig{
+			LoginBackoffAfter:     loginBackoffAfter,
+			LoginBackoffMax:       loginBackoffMax,
+			LoginLockoutThreshold: loginLockoutThreshold,
+			LoginLockoutDuration:  loginLockoutDuration,
+		},
+		RevocationFailOpen: os.Getenv("TOKEN_REVOCATION_FAIL_MODE") == "open",
+		AdminAPIKey:        os.Getenv("ADMIN_API_KEY"),
+		InternalAPIKey:     os.Getenv("INTERNAL_API_KEY"),
 	}, err
 }
 
+// loadOIDCProviders reads the providers named in the comma separated list, each from its own
+// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET and OIDC_<NAME>_SCOPES.
+func loadOIDCProviders(names string) ([]OIDCProviderConfig, error) {
+	var providers []OIDCProviderConfig
+
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		for _, r := range name {
+			if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+				return nil, fmt.Errorf("OIDC provider name %q may only contain letters and digits", name)
+			}
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		provider := OIDCProviderConfig{
+			Name:         name,
+			Type:         strings.ToLower(os.Getenv(prefix + "TYPE")),
+			Issuer:       os.Getenv(prefix + "ISSUER"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			AuthURL:      os.Getenv(prefix + "AUTH_URL"),
+			TokenURL:     os.Getenv(prefix + "TOKEN_URL"),
+			UserInfoURL:  os.Getenv(prefix + "USERINFO_URL"),
+			EmailsURL:    os.Getenv(prefix + "EMAILS_URL"),
+		}
+
+		switch provider.Type {
+		case "", OIDCProviderOIDC:
+			provider.Type = OIDCProviderOIDC
+			provider.Scopes = []string{"openid", "email", "profile"}
+			if provider.Issuer == "" || provider.ClientID == "" {
+				return nil, fmt.Errorf("%sISSUER and %sCLIENT_ID are required", prefix, prefix)
+			}
+		case OIDCProviderOAuth2:
+			if provider.AuthURL == "" || provider.TokenURL == "" || provider.UserInfoURL == "" || provider.ClientID == "" {
+				return nil, fmt.Errorf("%sAUTH_URL, %sTOKEN_URL, %sUSERINFO_URL and %sCLIENT_ID are required", prefix, prefix, prefix, prefix)
+			}
+		default:
+			return nil, fmt.Errorf("%sTYPE must be %s or %s", prefix, OIDCProviderOIDC, OIDCProviderOAuth2)
+		}
+
+		// space separated, like the scope parameter of OAuth 2.0
+		if v := os.Getenv(prefix + "SCOPES"); v != "" {
+			provider.Scopes = strings.Fields(v)
+		}
+
+		providers = append(providers, provider)
+	}
+
+	return providers, nil
+}
+
 func GetConfig() Config {
 	once.Do(func() {
 		var err error
@@ -1,11 +1,138 @@
 package dto
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type RegisterRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	DeviceName string `json:"device_name"`
 }
 
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	DeviceName string `json:"device_name"`
+}
+
+type CreateSigningKeyRequest struct {
+	Purpose     string     `json:"purpose"`
+	Algorithm   string     `json:"algorithm"`
+	ActivatesAt *time.Time `json:"activates_at"`
+}
+
+type UpdateSigningKeyRequest struct {
+	State       string     `json:"state"`
+	ActivatesAt *time.Time `json:"activates_at"`
+}
+
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password"`
+}
+
+type ForgotPasswordRequest struct {
+	Email string `json:"email"`
+}
+
+type ResetPasswordRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+type ResendVerificationRequest struct {
+	Email string `json:"email"`
+}
+
+type ChangeEmailRequest struct {
+	CurrentPassword string `json:"current_password"`
+	NewEmail        string `json:"new_email"`
+}
+
+type VerifyMFARequest struct {
+	MFAToken string `json:"mfa_token"`
+	Code     string `json:"code"`
+}
+
+type TOTPCodeRequest struct {
+	Code string `json:"code"`
+}
+
+type BeginMFAWebAuthnRequest struct {
+	MFAToken string `json:"mfa_token"`
+}
+
+// Credential is the PublicKeyCredential returned by navigator.credentials.create() or .get(),
+// serialized with toJSON().
+type VerifyMFAWebAuthnRequest struct {
+	MFAToken   string          `json:"mfa_token"`
+	CeremonyID string          `json:"ceremony_id"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+// ReauthenticationRequest proves the caller is the user, with the current password or a TOTP or
+// recovery code.
+type ReauthenticationRequest struct {
+	CurrentPassword string `json:"current_password"`
+	Code            string `json:"code"`
+}
+
+type FinishPasskeyRegistrationRequest struct {
+	CeremonyID string          `json:"ceremony_id"`
+	Name       string          `json:"name"`
+	Credential json.RawMessage `json:"credential"`
+}
+
+type EmailLoginRequest struct {
+	Email string `json:"email"`
+}
+
+// VerifyEmailLoginRequest redeems a login email with the token of its link, or with the login id
+// and the code.
+type VerifyEmailLoginRequest struct {
+	Token      string `json:"token"`
+	LoginID    string `json:"login_id"`
+	Code       string `json:"code"`
+	DeviceName string `json:"device_name"`
+}
+
+type FinishPasskeyLoginRequest struct {
+	CeremonyID string          `json:"ceremony_id"`
+	Credential json.RawMessage `json:"credential"`
+	DeviceName string          `json:"device_name"`
+}
+
+type CreateOAuthClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Scopes       []string `json:"scopes"`
+	// Public clients, like single page and mobile apps, can not keep a secret
+	Public bool `json:"public"`
+}
+
+type CreateServiceAccountRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// RateLimit is in requests per minute, zero takes the default
+	RateLimit int        `json:"rate_limit"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type UpdateAPIKeyRequest struct {
+	Name string `json:"name"`
+}
+
+type VerifyAPIKeyRequest struct {
+	Key string `json:"key"`
 }
@@ -0,0 +1,24 @@
+package entity
+
+import "time"
+
+// APIKey is a personal key a user scripts against the API with instead of an access token.
+// The key is shown once; Prefix finds the row and only the hash of the rest is stored.
+type APIKey struct {
+	ID      string `gorm:"type:text;primaryKey" json:"id"`
+	UserID  string `gorm:"type:integer;not null;index" json:"user_id"`
+	Name    string `gorm:"type:text;not null" json:"name"`
+	Prefix  string `gorm:"type:text;unique;not null" json:"prefix"`
+	KeyHash string `gorm:"type:text;not null" json:"-"`
+	// Scopes is a space separated list of the user's permissions the key may use
+	Scopes string `gorm:"type:text;not null;default:''" json:"scopes"`
+	// RateLimit is the number of requests per minute the gateway lets through for the key
+	RateLimit  int        `gorm:"type:integer;not null" json:"rate_limit"`
+	ExpiresAt  *time.Time `gorm:"type:timestamp" json:"expires_at"`
+	CreatedAt  time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoCreateTime" json:"created_at"`
+	LastUsedAt *time.Time `gorm:"type:timestamp" json:"last_used_at"`
+}
+
+func (APIKey) TableName() string {
+	return "api_keys"
+}
@@ -0,0 +1,23 @@
+package entity
+
+import "time"
+
+// EmailLoginChallenge is a passwordless login sent by email. The link and the code redeem the
+// same challenge, whichever comes first. LoginHash identifies the challenge when the code is
+// entered, and redeeming it proves the user owns Email.
+type EmailLoginChallenge struct {
+	ID        int        `gorm:"type:serial;primaryKey;autoIncrement" json:"id"`
+	UserID    string     `gorm:"type:integer;not null;index" json:"user_id"`
+	Email     string     `gorm:"type:text;not null" json:"email"`
+	LoginHash string     `gorm:"type:text;unique;not null" json:"-"`
+	LinkHash  string     `gorm:"type:text;unique;not null" json:"-"`
+	CodeHash  string     `gorm:"type:text;not null" json:"-"`
+	Attempts  int        `gorm:"type:integer;not null;default:0" json:"attempts"`
+	ExpiresAt time.Time  `gorm:"type:timestamp;not null" json:"expires_at"`
+	UsedAt    *time.Time `gorm:"type:timestamp" json:"used_at"`
+	CreatedAt time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoCreateTime" json:"created_at"`
+}
+
+func (EmailLoginChallenge) TableName() string {
+	return "email_login_challenges"
+}
@@ -0,0 +1,36 @@
+package entity
+
+import "time"
+
+// Identity links an account at an external identity provider to a user.
+type Identity struct {
+	ID       int    `gorm:"type:serial;primaryKey;autoIncrement" json:"id"`
+	Provider string `gorm:"type:text;not null;uniqueIndex:idx_identities_provider_subject" json:"provider"`
+	// Subject is the provider's stable id of the account, the sub claim of its ID tokens
+	Subject string `gorm:"type:text;not null;uniqueIndex:idx_identities_provider_subject" json:"-"`
+	UserID  string `gorm:"type:integer;not null;index" json:"user_id"`
+	// Email is the address the provider reported on the last login
+	Email       string     `gorm:"type:text" json:"email"`
+	CreatedAt   time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoCreateTime" json:"created_at"`
+	LastLoginAt *time.Time `gorm:"type:timestamp" json:"last_login_at"`
+}
+
+func (Identity) TableName() string {
+	return "identities"
+}
+
+// OIDCState keeps the server side state of a login while the browser is at the provider.
+type OIDCState struct {
+	ID        int    `gorm:"type:serial;primaryKey;autoIncrement" json:"id"`
+	StateHash string `gorm:"type:text;unique;not null" json:"-"`
+	Provider  string `gorm:"type:text;not null" json:"provider"`
+	Nonce     string `gorm:"type:text;not null" json:"-"`
+	// CodeVerifier is the PKCE secret, only useful together with the code sent to the browser
+	CodeVerifier string    `gorm:"type:text;not null" json:"-"`
+	ExpiresAt    time.Time `gorm:"type:timestamp;not null" json:"expires_at"`
+	CreatedAt    time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoCreateTime" json:"created_at"`
+}
+
+func (OIDCState) TableName() string {
+	return "oidc_states"
+}
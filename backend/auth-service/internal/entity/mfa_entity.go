@@ -0,0 +1,49 @@
+package entity
+
+import "time"
+
+// TOTPFactor is a user's authenticator app. It only counts once ConfirmedAt is set.
+type TOTPFactor struct {
+	UserID string `gorm:"type:integer;primaryKey" json:"user_id"`
+	// Secret is sealed with MFA_ENCRYPTION_KEY
+	Secret string `gorm:"type:text;not null" json:"-"`
+	// LastUsedStep is the time step of the last accepted code, so a code can not be replayed
+	LastUsedStep int64      `gorm:"type:bigint;not null;default:0" json:"-"`
+	ConfirmedAt  *time.Time `gorm:"type:timestamp" json:"confirmed_at"`
+	CreatedAt    time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoCreateTime" json:"created_at"`
+}
+
+func (TOTPFactor) TableName() string {
+	return "mfa_totp"
+}
+
+type RecoveryCode struct {
+	ID        int        `gorm:"type:serial;primaryKey;autoIncrement" json:"id"`
+	UserID    string     `gorm:"type:integer;not null;index" json:"user_id"`
+	CodeHash  string     `gorm:"type:text;unique;not null" json:"-"`
+	UsedAt    *time.Time `gorm:"type:timestamp" json:"used_at"`
+	CreatedAt time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoCreateTime" json:"created_at"`
+}
+
+func (RecoveryCode) TableName() string {
+	return "mfa_recovery_codes"
+}
+
+// MFAChallenge is a login that passed the password check and waits for the second factor.
+// It keeps the device details so the session can be created once the code is verified.
+type MFAChallenge struct {
+	ID          int        `gorm:"type:serial;primaryKey;autoIncrement" json:"id"`
+	UserID      string     `gorm:"type:integer;not null" json:"user_id"`
+	TokenHash   string     `gorm:"type:text;unique;not null" json:"-"`
+	DeviceLabel string     `gorm:"type:text" json:"device_label"`
+	UserAgent   string     `gorm:"type:text" json:"user_agent"`
+	IP          string     `gorm:"type:text" json:"ip"`
+	Attempts    int        `gorm:"type:integer;not null;default:0" json:"attempts"`
+	ExpiresAt   time.Time  `gorm:"type:timestamp;not null" json:"expires_at"`
+	UsedAt      *time.Time `gorm:"type:timestamp" json:"used_at"`
+	CreatedAt   time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoCreateTime" json:"created_at"`
+}
+
+func (MFAChallenge) TableName() string {
+	return "mfa_challenges"
+}
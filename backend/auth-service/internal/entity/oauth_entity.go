@@ -0,0 +1,45 @@
+package entity
+
+import "time"
+
+// OAuthClient is an app registered to sign its users in through auth-service.
+type OAuthClient struct {
+	ID   string `gorm:"type:text;primaryKey" json:"id"`
+	Name string `gorm:"type:text;not null" json:"name"`
+	// SecretHash is empty for public clients, which authenticate with PKCE only
+	SecretHash string `gorm:"type:text" json:"-"`
+	// RedirectURIs and Scopes are space separated, redirect URIs are matched exactly
+	RedirectURIs string    `gorm:"column:redirect_uris;type:text;not null" json:"redirect_uris"`
+	Scopes       string    `gorm:"type:text;not null" json:"scopes"`
+	CreatedAt    time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoCreateTime" json:"created_at"`
+}
+
+func (OAuthClient) TableName() string {
+	return "oauth_clients"
+}
+
+// OAuthAuthorization is an authorization request of a client. It waits for the user's consent
+// under RequestHash, then holds the authorization code under CodeHash until it is redeemed.
+type OAuthAuthorization struct {
+	ID            int     `gorm:"type:serial;primaryKey;autoIncrement" json:"id"`
+	RequestHash   string  `gorm:"type:text;unique;not null" json:"-"`
+	CodeHash      *string `gorm:"type:text;unique" json:"-"`
+	ClientID      string  `gorm:"type:text;not null" json:"client_id"`
+	RedirectURI   string  `gorm:"type:text;not null" json:"redirect_uri"`
+	Scope         string  `gorm:"type:text;not null" json:"scope"`
+	State         string  `gorm:"type:text" json:"-"`
+	Nonce         string  `gorm:"type:text" json:"-"`
+	CodeChallenge string  `gorm:"type:text;not null" json:"-"`
+	// UserID and AuthTime are set when the user approves the request
+	UserID   *string    `gorm:"type:integer" json:"user_id"`
+	AuthTime *time.Time `gorm:"type:timestamp" json:"auth_time"`
+	// SessionID is the session opened when the code was redeemed, revoked if the code is replayed
+	SessionID *string    `gorm:"type:uuid" json:"-"`
+	ExpiresAt time.Time  `gorm:"type:timestamp;not null" json:"expires_at"`
+	UsedAt    *time.Time `gorm:"type:timestamp" json:"used_at"`
+	CreatedAt time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoCreateTime" json:"created_at"`
+}
+
+func (OAuthAuthorization) TableName() string {
+	return "oauth_authorizations"
+}
@@ -0,0 +1,16 @@
+package entity
+
+import "time"
+
+type PasswordResetToken struct {
+	ID        int        `gorm:"type:serial;primaryKey;autoIncrement" json:"id"`
+	UserID    string     `gorm:"type:integer;not null;index" json:"user_id"`
+	TokenHash string     `gorm:"type:text;unique;not null;" json:"-"`
+	ExpiresAt time.Time  `gorm:"type:timestamp;not null" json:"expires_at"`
+	UsedAt    *time.Time `gorm:"type:timestamp" json:"used_at"`
+	CreatedAt time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoCreateTime" json:"created_at"`
+}
+
+func (PasswordResetToken) TableName() string {
+	return "password_reset_tokens"
+}
@@ -3,11 +3,14 @@ package entity
 import "time"
 
 type RefreshToken struct {
-	ID        int       `gorm:"type:serial;primaryKey;autoIncrement" json:"id"`
-	UserID    string    `gorm:"type:integer;unique;not null;" json:"user_id"`
-	Token     string    `gorm:"type:text;unique;not null;" json:"token"`
-	ExpiresAt time.Time `gorm:"type:timestamp;not null" json:"expires_at"`
-	CreatedAt time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoCreateTime" json:"created_at"`
+	ID        int        `gorm:"type:serial;primaryKey;autoIncrement" json:"id"`
+	SessionID string     `gorm:"type:uuid;not null;index" json:"session_id"`
+	ParentID  *int       `gorm:"type:integer" json:"parent_id"`
+	UserID    string     `gorm:"type:integer;not null;" json:"user_id"`
+	TokenHash string     `gorm:"type:text;unique;not null;" json:"-"`
+	ExpiresAt time.Time  `gorm:"type:timestamp;not null" json:"expires_at"`
+	UsedAt    *time.Time `gorm:"type:timestamp" json:"used_at"`
+	CreatedAt time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoCreateTime" json:"created_at"`
 }
 
 func (RefreshToken) TableName() string {
@@ -0,0 +1,19 @@
+package entity
+
+import "time"
+
+// ServiceAccount is a client that calls the APIs on its own behalf with the client credentials
+// grant, such as a batch job. Its tokens carry Scopes instead of a user's permissions.
+type ServiceAccount struct {
+	ID         string    `gorm:"type:text;primaryKey" json:"id"`
+	Name       string    `gorm:"type:text;not null" json:"name"`
+	SecretHash string    `gorm:"type:text;not null" json:"-"`
+	Scopes     string    `gorm:"type:text;not null" json:"scopes"`
+	CreatedAt  time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoCreateTime" json:"created_at"`
+	// LastUsedAt is the last time a token was issued to the account
+	LastUsedAt *time.Time `gorm:"type:timestamp" json:"last_used_at"`
+}
+
+func (ServiceAccount) TableName() string {
+	return "service_accounts"
+}
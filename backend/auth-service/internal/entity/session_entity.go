@@ -0,0 +1,19 @@
+package entity
+
+import "time"
+
+type Session struct {
+	ID          string     `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID      string     `gorm:"type:integer;not null;index" json:"user_id"`
+	DeviceLabel string     `gorm:"type:text" json:"device_label"`
+	UserAgent   string     `gorm:"type:text" json:"user_agent"`
+	IP          string     `gorm:"type:text" json:"ip"`
+	CreatedAt   time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoCreateTime" json:"created_at"`
+	LastUsedAt  time.Time  `gorm:"type:timestamp;not null" json:"last_used_at"`
+	ExpiresAt   time.Time  `gorm:"type:timestamp;not null" json:"expires_at"`
+	RevokedAt   *time.Time `gorm:"type:timestamp" json:"revoked_at"`
+}
+
+func (Session) TableName() string {
+	return "sessions"
+}
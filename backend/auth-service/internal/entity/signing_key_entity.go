@@ -0,0 +1,18 @@
+package entity
+
+import "time"
+
+type SigningKey struct {
+	ID          string    `gorm:"type:text;primaryKey" json:"id"`
+	Purpose     string    `gorm:"type:text;primaryKey" json:"purpose"`
+	Algorithm   string    `gorm:"type:text;not null" json:"algorithm"`
+	KeyMaterial string    `gorm:"type:text;not null" json:"-"`
+	State       string    `gorm:"type:text;not null" json:"state"`
+	ActivatesAt time.Time `gorm:"type:timestamp;not null" json:"activates_at"`
+	CreatedAt   time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoCreateTime" json:"created_at"`
+	UpdatedAt   time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoUpdateTime" json:"updated_at"`
+}
+
+func (SigningKey) TableName() string {
+	return "signing_keys"
+}
@@ -0,0 +1,44 @@
+package entity
+
+import "time"
+
+// WebAuthnCredential is a passkey or security key registered by a user.
+type WebAuthnCredential struct {
+	ID     int    `gorm:"type:serial;primaryKey;autoIncrement" json:"id"`
+	UserID string `gorm:"type:integer;not null;index" json:"user_id"`
+	// CredentialID is the base64url encoded id the authenticator assigned to the credential
+	CredentialID    string `gorm:"type:text;unique;not null" json:"-"`
+	PublicKey       []byte `gorm:"type:bytea;not null" json:"-"`
+	AttestationType string `gorm:"type:text" json:"-"`
+	AAGUID          []byte `gorm:"column:aaguid;type:bytea" json:"-"`
+	// SignCount only grows, a lower value means the authenticator may have been cloned
+	SignCount int64 `gorm:"type:bigint;not null;default:0" json:"-"`
+	// Transports is a comma separated list such as "internal,hybrid"
+	Transports     string     `gorm:"type:text" json:"-"`
+	UserVerified   bool       `gorm:"not null;default:false" json:"-"`
+	BackupEligible bool       `gorm:"not null;default:false" json:"-"`
+	BackupState    bool       `gorm:"not null;default:false" json:"-"`
+	Name           string     `gorm:"type:text" json:"name"`
+	CreatedAt      time.Time  `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoCreateTime" json:"created_at"`
+	LastUsedAt     *time.Time `gorm:"type:timestamp" json:"last_used_at"`
+}
+
+func (WebAuthnCredential) TableName() string {
+	return "webauthn_credentials"
+}
+
+// WebAuthnCeremony keeps the server side state between the begin and finish steps of a
+// registration or login.
+type WebAuthnCeremony struct {
+	ID        int    `gorm:"type:serial;primaryKey;autoIncrement" json:"id"`
+	TokenHash string `gorm:"type:text;unique;not null" json:"-"`
+	Purpose   string `gorm:"type:text;not null" json:"purpose"`
+	// Data is the JSON encoded session data of the library, including the challenge
+	Data      string    `gorm:"type:text;not null" json:"-"`
+	ExpiresAt time.Time `gorm:"type:timestamp;not null" json:"expires_at"`
+	CreatedAt time.Time `gorm:"type:timestamp;default:CURRENT_TIMESTAMP;autoCreateTime" json:"created_at"`
+}
+
+func (WebAuthnCeremony) TableName() string {
+	return "webauthn_ceremonies"
+}
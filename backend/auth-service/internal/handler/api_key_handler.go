@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"auth-service/internal/dto"
+	"auth-service/internal/entity"
+	"auth-service/internal/logger"
+	"auth-service/internal/service"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type APIKeyHandler interface {
+	ListAPIKeys(c *fiber.Ctx) error
+	CreateAPIKey(c *fiber.Ctx) error
+	UpdateAPIKey(c *fiber.Ctx) error
+	DeleteAPIKey(c *fiber.Ctx) error
+
+	VerifyAPIKey(c *fiber.Ctx) error
+}
+
+type apiKeyHandler struct {
+	service service.APIKeyService
+}
+
+func NewAPIKeyHandler(service service.APIKeyService) APIKeyHandler {
+	return &apiKeyHandler{
+		service: service,
+	}
+}
+
+func (h *apiKeyHandler) ListAPIKeys(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+
+	keys, err := h.service.ListAPIKeys(c.Context(), userID)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	resp := make([]dto.APIKeyResponse, 0, len(keys))
+	for _, key := range keys {
+		resp = append(resp, apiKeyResponse(key, ""))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+// CreateAPIKey creates a key for the current user. The key is only part of this response.
+func (h *apiKeyHandler) CreateAPIKey(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+
+	var req dto.CreateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Log.Error().Err(err).Msg("failed to parse request body")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	key, rawKey, err := h.service.CreateAPIKey(c.Context(), userID, service.APIKeyRequest{
+		Name:      req.Name,
+		Scopes:    req.Scopes,
+		RateLimit: req.RateLimit,
+		ExpiresAt: req.ExpiresAt,
+	})
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusCreated).JSON(apiKeyResponse(key, rawKey))
+}
+
+// UpdateAPIKey changes the label of a key.
+func (h *apiKeyHandler) UpdateAPIKey(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+
+	var req dto.UpdateAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Log.Error().Err(err).Msg("failed to parse request body")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	key, err := h.service.RenameAPIKey(c.Context(), userID, c.Params("id"), req.Name)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(apiKeyResponse(key, ""))
+}
+
+func (h *apiKeyHandler) DeleteAPIKey(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+
+	if err := h.service.RevokeAPIKey(c.Context(), userID, c.Params("id")); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "api key revoked",
+	})
+}
+
+// VerifyAPIKey resolves a key for the gateway.
+func (h *apiKeyHandler) VerifyAPIKey(c *fiber.Ctx) error {
+	var req dto.VerifyAPIKeyRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Log.Error().Err(err).Msg("failed to parse request body")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	principal, err := h.service.VerifyAPIKey(c.Context(), req.Key)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusOK).JSON(dto.VerifiedAPIKeyResponse{
+		ID:          principal.KeyID,
+		UserID:      principal.UserID,
+		Roles:       principal.Roles,
+		Permissions: principal.Permissions,
+		RateLimit:   principal.RateLimit,
+		ExpiresAt:   principal.ExpiresAt,
+	})
+}
+
+func apiKeyResponse(key *entity.APIKey, rawKey string) dto.APIKeyResponse {
+	return dto.APIKeyResponse{
+		ID:         key.ID,
+		Key:        rawKey,
+		Name:       key.Name,
+		Prefix:     key.Prefix,
+		Scopes:     strings.Fields(key.Scopes),
+		RateLimit:  key.RateLimit,
+		ExpiresAt:  key.ExpiresAt,
+		CreatedAt:  key.CreatedAt,
+		LastUsedAt: key.LastUsedAt,
+	}
+}
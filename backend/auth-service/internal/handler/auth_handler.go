@@ -7,16 +7,36 @@ import (
 	"auth-service/internal/logger"
 	"auth-service/internal/service"
 	"errors"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
 )
 
+// oidcStateCookie binds a login at an identity provider to the browser that started it.
+const oidcStateCookie = "oidc_state"
+
 type AuthHandler interface {
 	Register(c *fiber.Ctx) error
 	Login(c *fiber.Ctx) error
+	VerifyMFA(c *fiber.Ctx) error
+	BeginMFAWebAuthn(c *fiber.Ctx) error
+	VerifyMFAWebAuthn(c *fiber.Ctx) error
+	BeginPasskeyLogin(c *fiber.Ctx) error
+	FinishPasskeyLogin(c *fiber.Ctx) error
+	OIDCProviders(c *fiber.Ctx) error
+	BeginOIDCLogin(c *fiber.Ctx) error
+	OIDCCallback(c *fiber.Ctx) error
+	RequestEmailLogin(c *fiber.Ctx) error
+	VerifyEmailLogin(c *fiber.Ctx) error
 	Refresh(c *fiber.Ctx) error
 	Logout(c *fiber.Ctx) error
+
+	ListSessions(c *fiber.Ctx) error
+	RevokeSession(c *fiber.Ctx) error
+	RevokeUserSessions(c *fiber.Ctx) error
+	UnlockUser(c *fiber.Ctx) error
 }
 
 type authHandler struct {
@@ -41,9 +61,28 @@ func (h *authHandler) Register(c *fiber.Ctx) error {
 		})
 	}
 
-	result, err := h.service.Register(c.Context(), req.Email, req.Password)
+	result, err := h.service.Register(c.Context(), req.Email, req.Password, c.Get("Idempotency-Key"), h.sessionMeta(c, req.DeviceName))
 	if err != nil {
-		return h.handleError(c, err)
+		return handleError(c, err)
+	}
+
+	// a retried registration is a login, the account may have a second factor by now
+	if result.MFARequired {
+		return c.Status(fiber.StatusOK).JSON(dto.MFARequiredResponse{
+			MFARequired: true,
+			MFAToken:    result.MFAToken,
+			MFAMethods:  result.MFAMethods,
+		})
+	}
+
+	if result.VerificationRequired {
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message": "check your email to verify your account before logging in",
+			"user": dto.UserResponse{
+				ID:    result.UserID,
+				Email: result.Email,
+			},
+		})
 	}
 
 	h.setRefreshTokenCookie(c, result.RefreshToken)
@@ -66,9 +105,42 @@ func (h *authHandler) Login(c *fiber.Ctx) error {
 		})
 	}
 
-	result, err := h.service.Login(c.Context(), req.Email, req.Password)
+	result, err := h.service.Login(c.Context(), req.Email, req.Password, h.sessionMeta(c, req.DeviceName))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	if result.MFARequired {
+		return c.Status(fiber.StatusOK).JSON(dto.MFARequiredResponse{
+			MFARequired: true,
+			MFAToken:    result.MFAToken,
+			MFAMethods:  result.MFAMethods,
+		})
+	}
+
+	h.setRefreshTokenCookie(c, result.RefreshToken)
+	return c.Status(fiber.StatusOK).JSON(dto.AuthResponse{
+		AccessToken: result.AccessToken,
+		User: dto.UserResponse{
+			ID:    result.UserID,
+			Email: result.Email,
+		},
+	})
+}
+
+// VerifyMFA exchanges the token returned by Login and a TOTP or recovery code for the tokens.
+func (h *authHandler) VerifyMFA(c *fiber.Ctx) error {
+	var req dto.VerifyMFARequest
+
+	if err := c.BodyParser(&req); err != nil || req.MFAToken == "" || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	result, err := h.service.VerifyMFA(c.Context(), req.MFAToken, req.Code)
 	if err != nil {
-		return h.handleError(c, err)
+		return handleError(c, err)
 	}
 
 	h.setRefreshTokenCookie(c, result.RefreshToken)
@@ -81,6 +153,243 @@ func (h *authHandler) Login(c *fiber.Ctx) error {
 	})
 }
 
+func (h *authHandler) BeginMFAWebAuthn(c *fiber.Ctx) error {
+	var req dto.BeginMFAWebAuthnRequest
+
+	if err := c.BodyParser(&req); err != nil || req.MFAToken == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	options, err := h.service.BeginMFAWebAuthn(c.Context(), req.MFAToken)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(dto.WebAuthnOptionsResponse{
+		CeremonyID: options.CeremonyID,
+		Options:    options.Options,
+	})
+}
+
+// VerifyMFAWebAuthn exchanges the token returned by Login and a passkey assertion for the tokens.
+func (h *authHandler) VerifyMFAWebAuthn(c *fiber.Ctx) error {
+	var req dto.VerifyMFAWebAuthnRequest
+
+	if err := c.BodyParser(&req); err != nil || req.MFAToken == "" || req.CeremonyID == "" || len(req.Credential) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	result, err := h.service.VerifyMFAWebAuthn(c.Context(), req.MFAToken, req.CeremonyID, req.Credential)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	h.setRefreshTokenCookie(c, result.RefreshToken)
+	return c.Status(fiber.StatusOK).JSON(dto.AuthResponse{
+		AccessToken: result.AccessToken,
+		User: dto.UserResponse{
+			ID:    result.UserID,
+			Email: result.Email,
+		},
+	})
+}
+
+func (h *authHandler) BeginPasskeyLogin(c *fiber.Ctx) error {
+	options, err := h.service.BeginPasskeyLogin(c.Context())
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(dto.WebAuthnOptionsResponse{
+		CeremonyID: options.CeremonyID,
+		Options:    options.Options,
+	})
+}
+
+func (h *authHandler) FinishPasskeyLogin(c *fiber.Ctx) error {
+	var req dto.FinishPasskeyLoginRequest
+
+	if err := c.BodyParser(&req); err != nil || req.CeremonyID == "" || len(req.Credential) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	result, err := h.service.FinishPasskeyLogin(c.Context(), req.CeremonyID, req.Credential, h.sessionMeta(c, req.DeviceName))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	h.setRefreshTokenCookie(c, result.RefreshToken)
+	return c.Status(fiber.StatusOK).JSON(dto.AuthResponse{
+		AccessToken: result.AccessToken,
+		User: dto.UserResponse{
+			ID:    result.UserID,
+			Email: result.Email,
+		},
+	})
+}
+
+func (h *authHandler) OIDCProviders(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(dto.OIDCProvidersResponse{
+		Providers: h.service.OIDCProviders(),
+	})
+}
+
+// BeginOIDCLogin redirects the browser to the login page of the identity provider.
+func (h *authHandler) BeginOIDCLogin(c *fiber.Ctx) error {
+	authorization, err := h.service.BeginOIDCLogin(c.Context(), c.Params("provider"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Value:    authorization.State,
+		Expires:  time.Now().Add(h.cfg.OIDC.OIDCStateExp),
+		HTTPOnly: true,
+		Path:     "/api/auth/oidc",
+		Secure:   h.cfg.AppEnv == "production",
+		// the provider sends the browser back with a cross-site top level navigation
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+	return c.Redirect(authorization.URL, fiber.StatusFound)
+}
+
+// OIDCCallback completes the login the provider sent the browser back from. The browser ends up
+// on the login redirect page either way: signed in through the refresh token cookie, with the
+// MFA token in the fragment when a second factor is required, or with an error in the query.
+func (h *authHandler) OIDCCallback(c *fiber.Ctx) error {
+	state := c.Query("state")
+	cookieState := c.Cookies(oidcStateCookie)
+	c.Cookie(&fiber.Cookie{
+		Name:     oidcStateCookie,
+		Path:     "/api/auth/oidc",
+		MaxAge:   -1,
+		Expires:  time.Unix(0, 0),
+		HTTPOnly: true,
+		Secure:   h.cfg.AppEnv == "production",
+		SameSite: fiber.CookieSameSiteLaxMode,
+	})
+
+	// the user denied the login at the provider, or the provider failed
+	if providerError := c.Query("error"); providerError != "" {
+		return h.redirectAfterOIDCLogin(c, url.Values{"error": {providerError}}, nil)
+	}
+
+	if state == "" || state != cookieState {
+		return h.redirectAfterOIDCLogin(c, url.Values{"error": {"invalid login state"}}, nil)
+	}
+
+	result, err := h.service.FinishOIDCLogin(c.Context(), c.Params("provider"), state, c.Query("code"), h.sessionMeta(c, ""))
+	if err != nil {
+		message := "internal server error"
+		var appErr *apperror.AppError
+		if errors.As(err, &appErr) && appErr.Code != fiber.StatusInternalServerError {
+			message = appErr.Message
+		} else {
+			logger.Log.Error().Err(err).Msg("oidc login failed")
+		}
+		return h.redirectAfterOIDCLogin(c, url.Values{"error": {message}}, nil)
+	}
+
+	if result.MFARequired {
+		// the fragment is not sent to servers or written to their logs
+		return h.redirectAfterOIDCLogin(c, nil, url.Values{
+			"mfa_token":   {result.MFAToken},
+			"mfa_methods": {strings.Join(result.MFAMethods, ",")},
+		})
+	}
+
+	h.setRefreshTokenCookie(c, result.RefreshToken)
+	return h.redirectAfterOIDCLogin(c, nil, nil)
+}
+
+// RequestEmailLogin mails a login link and code. The response is the same whether the account
+// exists or not.
+func (h *authHandler) RequestEmailLogin(c *fiber.Ctx) error {
+	var req dto.EmailLoginRequest
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	loginID, err := h.service.RequestEmailLogin(c.Context(), req.Email)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(dto.EmailLoginResponse{
+		LoginID: loginID,
+		Message: "if the account exists, a login email has been sent",
+	})
+}
+
+// VerifyEmailLogin signs in with the token of a login link or with a login id and code.
+func (h *authHandler) VerifyEmailLogin(c *fiber.Ctx) error {
+	var req dto.VerifyEmailLoginRequest
+	if err := c.BodyParser(&req); err != nil || (req.Token == "" && (req.LoginID == "" || req.Code == "")) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	var result *service.AuthResult
+	var err error
+	if req.Token != "" {
+		result, err = h.service.FinishEmailLoginLink(c.Context(), req.Token, h.sessionMeta(c, req.DeviceName))
+	} else {
+		result, err = h.service.FinishEmailLoginCode(c.Context(), req.LoginID, req.Code, h.sessionMeta(c, req.DeviceName))
+	}
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	if result.MFARequired {
+		return c.Status(fiber.StatusOK).JSON(dto.MFARequiredResponse{
+			MFARequired: true,
+			MFAToken:    result.MFAToken,
+			MFAMethods:  result.MFAMethods,
+		})
+	}
+
+	h.setRefreshTokenCookie(c, result.RefreshToken)
+	return c.Status(fiber.StatusOK).JSON(dto.AuthResponse{
+		AccessToken: result.AccessToken,
+		User: dto.UserResponse{
+			ID:    result.UserID,
+			Email: result.Email,
+		},
+	})
+}
+
+func (h *authHandler) redirectAfterOIDCLogin(c *fiber.Ctx, query, fragment url.Values) error {
+	target, err := url.Parse(h.cfg.OIDC.OIDCLoginRedirectURL)
+	if err != nil {
+		return handleError(c, apperror.Internal(err))
+	}
+
+	if query != nil {
+		values := target.Query()
+		for key, value := range query {
+			values[key] = value
+		}
+		target.RawQuery = values.Encode()
+	}
+	location := target.String()
+	if fragment != nil {
+		target.Fragment = ""
+		location = target.String() + "#" + fragment.Encode()
+	}
+
+	return c.Redirect(location, fiber.StatusFound)
+}
+
 func (h *authHandler) Refresh(c *fiber.Ctx) error {
 	cookie := c.Cookies("refresh_token")
 	if cookie == "" {
@@ -92,7 +401,7 @@ func (h *authHandler) Refresh(c *fiber.Ctx) error {
 
 	result, err := h.service.Refresh(c.Context(), cookie)
 	if err != nil {
-		return h.handleError(c, err)
+		return handleError(c, err)
 	}
 
 	h.setRefreshTokenCookie(c, result.RefreshToken)
@@ -107,19 +416,95 @@ func (h *authHandler) Refresh(c *fiber.Ctx) error {
 
 func (h *authHandler) Logout(c *fiber.Ctx) error {
 	cookie := c.Cookies("refresh_token")
+	accessToken := strings.TrimPrefix(c.Get(fiber.HeaderAuthorization), "Bearer ")
 
-	if cookie != "" {
-		_ = h.service.Logout(c.Context(), cookie)
+	if cookie != "" || accessToken != "" {
+		_ = h.service.Logout(c.Context(), cookie, accessToken)
 	}
 
 	logger.Log.Info().Msg("user logged out")
 
-	h.removeRefreshTokenCookie(c)
+	removeRefreshTokenCookie(c, h.cfg)
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"message": "successfully logged out",
 	})
 }
 
+func (h *authHandler) ListSessions(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+
+	sessions, err := h.service.ListSessions(c.Context(), userID)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	resp := make([]dto.SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		resp = append(resp, dto.SessionResponse{
+			ID:          s.ID,
+			DeviceLabel: s.DeviceLabel,
+			UserAgent:   s.UserAgent,
+			IP:          s.IP,
+			CreatedAt:   s.CreatedAt,
+			LastUsedAt:  s.LastUsedAt,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (h *authHandler) RevokeSession(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+
+	if err := h.service.RevokeSession(c.Context(), userID, c.Params("id")); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "session revoked",
+	})
+}
+
+// RevokeUserSessions is the admin revoke: it signs a user out of every session.
+func (h *authHandler) RevokeUserSessions(c *fiber.Ctx) error {
+	if err := h.service.RevokeAllSessions(c.Context(), c.Params("id")); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "sessions revoked",
+	})
+}
+
+// UnlockUser is the admin unlock: it lifts the lockout of a user after failed logins.
+func (h *authHandler) UnlockUser(c *fiber.Ctx) error {
+	if err := h.service.UnlockLogin(c.Context(), c.Params("id")); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "user unlocked",
+	})
+}
+
+// clientIP returns the address of the client that sent the request.
+func clientIP(c *fiber.Ctx) string {
+	// the gateway sits behind nginx, which forwards the original client address
+	if ip := c.Get("X-Real-IP"); ip != "" {
+		return ip
+	}
+	return c.IP()
+}
+
+// sessionMeta collects the device details stored with a new session.
+func (h *authHandler) sessionMeta(c *fiber.Ctx, deviceName string) service.SessionMeta {
+	return service.SessionMeta{
+		DeviceLabel: deviceName,
+		UserAgent:   c.Get(fiber.HeaderUserAgent),
+		IP:          clientIP(c),
+	}
+}
+
 func (h *authHandler) setRefreshTokenCookie(c *fiber.Ctx, refreshToken string) {
 	c.Cookie(&fiber.Cookie{
 		Name:     "refresh_token",
@@ -132,7 +517,7 @@ func (h *authHandler) setRefreshTokenCookie(c *fiber.Ctx, refreshToken string) {
 	})
 }
 
-func (h *authHandler) removeRefreshTokenCookie(c *fiber.Ctx) {
+func removeRefreshTokenCookie(c *fiber.Ctx, cfg config.Config) {
 	c.Cookie(&fiber.Cookie{
 		Name:     "refresh_token",
 		Value:    "",
@@ -140,27 +525,7 @@ func (h *authHandler) removeRefreshTokenCookie(c *fiber.Ctx) {
 		MaxAge:   -1,
 		Expires:  time.Unix(0, 0),
 		HTTPOnly: true,
-		Secure:   h.cfg.AppEnv == "production",
+		Secure:   cfg.AppEnv == "production",
 		SameSite: fiber.CookieSameSiteLaxMode,
 	})
 }
-
-func (h *authHandler) handleError(c *fiber.Ctx, err error) error {
-	var appErr *apperror.AppError
-	if errors.As(err, &appErr) {
-		// if got internal server error log the original error
-		if appErr.Code == 500 && appErr.Err != nil {
-			logger.Log.Error().Err(appErr.Err).Msg("internal server error")
-		}
-		// return the client error message without the original error
-		return c.Status(appErr.Code).JSON(fiber.Map{
-			"error": appErr.Message,
-		})
-	}
-
-	// if the error is not an AppError
-	logger.Log.Error().Err(err).Msg("unexpected error")
-	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-		"error": "internal server error",
-	})
-}
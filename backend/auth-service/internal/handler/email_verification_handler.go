@@ -0,0 +1,80 @@
+package handler
+
+import (
+	"auth-service/internal/dto"
+	"auth-service/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type EmailVerificationHandler interface {
+	Verify(c *fiber.Ctx) error
+	Resend(c *fiber.Ctx) error
+	ChangeEmail(c *fiber.Ctx) error
+}
+
+type emailVerificationHandler struct {
+	service service.EmailVerificationService
+}
+
+func NewEmailVerificationHandler(service service.EmailVerificationService) EmailVerificationHandler {
+	return &emailVerificationHandler{
+		service: service,
+	}
+}
+
+// Verify confirms the email. Tokens issued before stay restricted until they are refreshed.
+func (h *emailVerificationHandler) Verify(c *fiber.Ctx) error {
+	var req dto.VerifyEmailRequest
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	if err := h.service.Verify(c.Context(), req.Token); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "email verified",
+	})
+}
+
+func (h *emailVerificationHandler) Resend(c *fiber.Ctx) error {
+	var req dto.ResendVerificationRequest
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	if err := h.service.Resend(c.Context(), req.Email); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "if the account exists and is not verified yet, a verification email has been sent",
+	})
+}
+
+// ChangeEmail sends a verification link to the new email, the account keeps its email until the
+// link is followed.
+func (h *emailVerificationHandler) ChangeEmail(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+
+	var req dto.ChangeEmailRequest
+	if err := c.BodyParser(&req); err != nil || req.CurrentPassword == "" || req.NewEmail == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	if err := h.service.RequestEmailChange(c.Context(), userID, req.CurrentPassword, req.NewEmail, clientIP(c)); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "a verification email has been sent to the new address",
+	})
+}
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"auth-service/internal/apperror"
+	"auth-service/internal/logger"
+	"errors"
+	"math"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// handleError writes an AppError as a JSON response and hides internal errors from the client.
+func handleError(c *fiber.Ctx, err error) error {
+	var appErr *apperror.AppError
+	if errors.As(err, &appErr) {
+		// if got internal server error log the original error
+		if appErr.Code == 500 && appErr.Err != nil {
+			logger.Log.Error().Err(appErr.Err).Msg("internal server error")
+		}
+		if appErr.RetryAfter > 0 {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(appErr.RetryAfter.Seconds()))))
+		}
+		// return the client error message without the original error
+		body := fiber.Map{
+			"error": appErr.Message,
+		}
+		if len(appErr.Fields) > 0 {
+			body["fields"] = appErr.Fields
+		}
+		return c.Status(appErr.Code).JSON(body)
+	}
+
+	// if the error is not an AppError
+	logger.Log.Error().Err(err).Msg("unexpected error")
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"error": "internal server error",
+	})
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"auth-service/internal/dto"
+	"auth-service/internal/entity"
+	"auth-service/internal/logger"
+	"auth-service/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type KeysHandler interface {
+	JWKS(c *fiber.Ctx) error
+	InternalJWKS(c *fiber.Ctx) error
+
+	ListKeys(c *fiber.Ctx) error
+	CreateKey(c *fiber.Ctx) error
+	UpdateKey(c *fiber.Ctx) error
+}
+
+type keysHandler struct {
+	tokenManager service.TokenManager
+	keyService   service.KeyService
+}
+
+func NewKeysHandler(tokenManager service.TokenManager, keyService service.KeyService) KeysHandler {
+	return &keysHandler{
+		tokenManager: tokenManager,
+		keyService:   keyService,
+	}
+}
+
+// JWKS publishes the public keys access tokens are signed with.
+func (h *keysHandler) JWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.Status(fiber.StatusOK).JSON(h.tokenManager.JWKS())
+}
+
+// InternalJWKS also serves the shared HMAC access keys, for the gateway only.
+func (h *keysHandler) InternalJWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusOK).JSON(h.tokenManager.InternalJWKS())
+}
+
+func (h *keysHandler) ListKeys(c *fiber.Ctx) error {
+	keys, err := h.keyService.ListKeys(c.Context())
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	resp := make([]dto.SigningKeyResponse, 0, len(keys))
+	for _, k := range keys {
+		resp = append(resp, signingKeyResponse(k))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+func (h *keysHandler) CreateKey(c *fiber.Ctx) error {
+	var req dto.CreateSigningKeyRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		logger.Log.Error().Err(err).Msg("failed to parse request body")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	key, err := h.keyService.CreateKey(c.Context(), service.KeyPurpose(req.Purpose), req.Algorithm, req.ActivatesAt)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(signingKeyResponse(key))
+}
+
+// UpdateKey promotes, demotes or retires a key.
+func (h *keysHandler) UpdateKey(c *fiber.Ctx) error {
+	var req dto.UpdateSigningKeyRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		logger.Log.Error().Err(err).Msg("failed to parse request body")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	purpose := service.KeyPurpose(c.Params("purpose"))
+	state := service.KeyState(req.State)
+
+	if err := h.keyService.SetKeyState(c.Context(), purpose, c.Params("kid"), state, req.ActivatesAt); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "signing key updated",
+	})
+}
+
+func signingKeyResponse(k *entity.SigningKey) dto.SigningKeyResponse {
+	return dto.SigningKeyResponse{
+		ID:          k.ID,
+		Purpose:     k.Purpose,
+		Algorithm:   k.Algorithm,
+		State:       k.State,
+		ActivatesAt: k.ActivatesAt,
+		CreatedAt:   k.CreatedAt,
+	}
+}
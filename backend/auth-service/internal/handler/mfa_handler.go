@@ -0,0 +1,78 @@
+package handler
+
+import (
+	"auth-service/internal/dto"
+	"auth-service/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type MFAHandler interface {
+	EnrollTOTP(c *fiber.Ctx) error
+	ConfirmTOTP(c *fiber.Ctx) error
+	DisableTOTP(c *fiber.Ctx) error
+}
+
+type mfaHandler struct {
+	service service.MFAService
+}
+
+func NewMFAHandler(service service.MFAService) MFAHandler {
+	return &mfaHandler{
+		service: service,
+	}
+}
+
+// EnrollTOTP starts the setup. Calling it again before confirming replaces the secret.
+func (h *mfaHandler) EnrollTOTP(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+
+	enrollment, err := h.service.EnrollTOTP(c.Context(), userID)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(dto.TOTPEnrollmentResponse{
+		Secret: enrollment.Secret,
+		URI:    enrollment.URI,
+	})
+}
+
+func (h *mfaHandler) ConfirmTOTP(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+
+	var req dto.TOTPCodeRequest
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	codes, err := h.service.ConfirmTOTP(c.Context(), userID, req.Code)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(dto.RecoveryCodesResponse{
+		RecoveryCodes: codes,
+	})
+}
+
+func (h *mfaHandler) DisableTOTP(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+
+	var req dto.TOTPCodeRequest
+	if err := c.BodyParser(&req); err != nil || req.Code == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	if err := h.service.DisableTOTP(c.Context(), userID, req.Code); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "two-factor authentication disabled",
+	})
+}
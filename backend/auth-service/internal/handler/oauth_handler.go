@@ -0,0 +1,299 @@
+package handler
+
+import (
+	"auth-service/internal/apperror"
+	"auth-service/internal/config"
+	"auth-service/internal/dto"
+	"auth-service/internal/entity"
+	"auth-service/internal/logger"
+	"auth-service/internal/service"
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type OAuthHandler interface {
+	Discovery(c *fiber.Ctx) error
+	JWKS(c *fiber.Ctx) error
+	Authorize(c *fiber.Ctx) error
+	GetConsent(c *fiber.Ctx) error
+	Approve(c *fiber.Ctx) error
+	Deny(c *fiber.Ctx) error
+	Token(c *fiber.Ctx) error
+	UserInfo(c *fiber.Ctx) error
+
+	ListClients(c *fiber.Ctx) error
+	CreateClient(c *fiber.Ctx) error
+	DeleteClient(c *fiber.Ctx) error
+}
+
+type oauthHandler struct {
+	service      service.OAuthService
+	tokenManager service.TokenManager
+	cfg          config.Config
+}
+
+func NewOAuthHandler(service service.OAuthService, tokenManager service.TokenManager, cfg config.Config) OAuthHandler {
+	return &oauthHandler{
+		service:      service,
+		tokenManager: tokenManager,
+		cfg:          cfg,
+	}
+}
+
+// Discovery serves the OpenID Connect discovery document, the endpoints are relative to the
+// issuer the provider is reached at through the gateway.
+func (h *oauthHandler) Discovery(c *fiber.Ctx) error {
+	issuer := h.cfg.OAuth.OAuthIssuer
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.Status(fiber.StatusOK).JSON(dto.OpenIDConfigurationResponse{
+		Issuer:                            issuer,
+		AuthorizationEndpoint:             issuer + "/oauth2/authorize",
+		TokenEndpoint:                     issuer + "/oauth2/token",
+		UserInfoEndpoint:                  issuer + "/oauth2/userinfo",
+		JWKSURI:                           issuer + "/oauth2/jwks",
+		ScopesSupported:                   service.OAuthScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{"RS256", "ES256", "EdDSA"},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"iss", "sub", "aud", "exp", "iat", "auth_time", "nonce", "sid", "email", "email_verified"},
+		AuthorizationResponseIssParameter: true,
+	})
+}
+
+// JWKS publishes the keys ID tokens are signed with.
+func (h *oauthHandler) JWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.Status(fiber.StatusOK).JSON(h.tokenManager.IDTokenJWKS())
+}
+
+// Authorize is where clients send the user to sign in. The browser is sent on to the consent
+// page, or back to the client with an error. An unknown client or redirect URI is answered
+// here, as the redirect URI can not be trusted.
+func (h *oauthHandler) Authorize(c *fiber.Ctx) error {
+	location, err := h.service.Authorize(c.Context(), service.OAuthAuthorizeRequest{
+		ResponseType:        c.Query("response_type"),
+		ClientID:            c.Query("client_id"),
+		RedirectURI:         c.Query("redirect_uri"),
+		Scope:               c.Query("scope"),
+		State:               c.Query("state"),
+		Nonce:               c.Query("nonce"),
+		CodeChallenge:       c.Query("code_challenge"),
+		CodeChallengeMethod: c.Query("code_challenge_method"),
+	})
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Redirect(location, fiber.StatusFound)
+}
+
+func (h *oauthHandler) GetConsent(c *fiber.Ctx) error {
+	consent, err := h.service.GetConsent(c.Context(), c.Params("id"))
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(dto.OAuthConsentResponse{
+		ClientID:   consent.ClientID,
+		ClientName: consent.ClientName,
+		Scopes:     consent.Scopes,
+		ExpiresAt:  consent.ExpiresAt,
+	})
+}
+
+func (h *oauthHandler) Approve(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+	sessionID, _ := c.Locals("sessionID").(string)
+
+	location, err := h.service.Approve(c.Context(), c.Params("id"), userID, sessionID)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(dto.OAuthRedirectResponse{RedirectURL: location})
+}
+
+func (h *oauthHandler) Deny(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+	sessionID, _ := c.Locals("sessionID").(string)
+
+	location, err := h.service.Deny(c.Context(), c.Params("id"), userID, sessionID)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(dto.OAuthRedirectResponse{RedirectURL: location})
+}
+
+// Token is called by the client's backend, or by public clients directly, to redeem a code.
+// Clients authenticate with HTTP Basic or with client_id and client_secret in the form.
+func (h *oauthHandler) Token(c *fiber.Ctx) error {
+	// responses carry tokens and must not be cached (RFC 6749 section 5.1)
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderPragma, "no-cache")
+
+	clientID, clientSecret := c.FormValue("client_id"), c.FormValue("client_secret")
+	basicAuth := false
+	if id, secret, ok := basicCredentials(c.Get(fiber.HeaderAuthorization)); ok {
+		clientID, clientSecret, basicAuth = id, secret, true
+	}
+
+	tokens, err := h.service.Token(c.Context(), service.OAuthTokenRequest{
+		GrantType:    c.FormValue("grant_type"),
+		Code:         c.FormValue("code"),
+		RedirectURI:  c.FormValue("redirect_uri"),
+		CodeVerifier: c.FormValue("code_verifier"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+	})
+	if err != nil {
+		return handleOAuthError(c, err, basicAuth)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(dto.OAuthTokenResponse{
+		AccessToken: tokens.AccessToken,
+		IDToken:     tokens.IDToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   tokens.ExpiresIn,
+		Scope:       tokens.Scope,
+	})
+}
+
+// UserInfo returns the claims of the user an OAuth client access token was issued for.
+func (h *oauthHandler) UserInfo(c *fiber.Ctx) error {
+	authHeader := c.Get(fiber.HeaderAuthorization)
+	if !strings.HasPrefix(authHeader, "Bearer ") {
+		c.Set(fiber.HeaderWWWAuthenticate, `Bearer`)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"error": "access token not found",
+		})
+	}
+
+	info, err := h.service.UserInfo(c.Context(), strings.TrimPrefix(authHeader, "Bearer "))
+	if err != nil {
+		var appErr *apperror.AppError
+		if errors.As(err, &appErr) && appErr.Code == fiber.StatusUnauthorized {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+		} else if errors.As(err, &appErr) && appErr.Code == fiber.StatusForbidden {
+			c.Set(fiber.HeaderWWWAuthenticate, `Bearer error="insufficient_scope", scope="openid"`)
+		}
+		return handleError(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusOK).JSON(dto.OAuthUserInfoResponse{
+		Subject:       info.Subject,
+		Email:         info.Email,
+		EmailVerified: info.EmailVerified,
+	})
+}
+
+func (h *oauthHandler) ListClients(c *fiber.Ctx) error {
+	clients, err := h.service.ListClients(c.Context())
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	resp := make([]dto.OAuthClientResponse, 0, len(clients))
+	for _, client := range clients {
+		resp = append(resp, oauthClientResponse(client, ""))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+// CreateClient registers a client. The secret is only part of this response.
+func (h *oauthHandler) CreateClient(c *fiber.Ctx) error {
+	var req dto.CreateOAuthClientRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		logger.Log.Error().Err(err).Msg("failed to parse request body")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	client, secret, err := h.service.CreateClient(c.Context(), req.Name, req.RedirectURIs, req.Scopes, req.Public)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusCreated).JSON(oauthClientResponse(client, secret))
+}
+
+func (h *oauthHandler) DeleteClient(c *fiber.Ctx) error {
+	if err := h.service.DeleteClient(c.Context(), c.Params("id")); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "client deleted",
+	})
+}
+
+// handleOAuthError writes an *service.OAuthError in the format of RFC 6749 section 5.2, other
+// errors like handleError.
+func handleOAuthError(c *fiber.Ctx, err error, basicAuth bool) error {
+	var oauthErr *service.OAuthError
+	if !errors.As(err, &oauthErr) {
+		return handleError(c, err)
+	}
+
+	if oauthErr.Status == fiber.StatusUnauthorized && basicAuth {
+		c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="oauth2"`)
+	}
+	return c.Status(oauthErr.Status).JSON(fiber.Map{
+		"error":             oauthErr.Code,
+		"error_description": oauthErr.Description,
+	})
+}
+
+// basicCredentials reads client_secret_basic credentials, which are form encoded before they
+// are put in the header (RFC 6749 section 2.3.1).
+func basicCredentials(header string) (string, string, bool) {
+	encoded, ok := strings.CutPrefix(header, "Basic ")
+	if !ok {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+	rawID, rawSecret, ok := strings.Cut(string(decoded), ":")
+	if !ok {
+		return "", "", false
+	}
+
+	clientID, err := url.QueryUnescape(rawID)
+	if err != nil {
+		return "", "", false
+	}
+	clientSecret, err := url.QueryUnescape(rawSecret)
+	if err != nil {
+		return "", "", false
+	}
+
+	return clientID, clientSecret, true
+}
+
+func oauthClientResponse(client *entity.OAuthClient, secret string) dto.OAuthClientResponse {
+	return dto.OAuthClientResponse{
+		ID:           client.ID,
+		ClientSecret: secret,
+		Name:         client.Name,
+		RedirectURIs: strings.Fields(client.RedirectURIs),
+		Scopes:       strings.Fields(client.Scopes),
+		Public:       client.SecretHash == "",
+		CreatedAt:    client.CreatedAt,
+	}
+}
@@ -0,0 +1,85 @@
+package handler
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/dto"
+	"auth-service/internal/logger"
+	"auth-service/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type PasswordHandler interface {
+	ChangePassword(c *fiber.Ctx) error
+	ForgotPassword(c *fiber.Ctx) error
+	ResetPassword(c *fiber.Ctx) error
+}
+
+type passwordHandler struct {
+	service service.PasswordService
+	cfg     config.Config
+}
+
+func NewPasswordHandler(service service.PasswordService, cfg config.Config) PasswordHandler {
+	return &passwordHandler{
+		service: service,
+		cfg:     cfg,
+	}
+}
+
+// ChangePassword signs the user out everywhere, including the current session.
+func (h *passwordHandler) ChangePassword(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+
+	var req dto.ChangePasswordRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Log.Error().Err(err).Msg("failed to parse request body")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	if err := h.service.ChangePassword(c.Context(), userID, req.CurrentPassword, req.NewPassword, clientIP(c)); err != nil {
+		return handleError(c, err)
+	}
+
+	removeRefreshTokenCookie(c, h.cfg)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "password changed, please log in again",
+	})
+}
+
+func (h *passwordHandler) ForgotPassword(c *fiber.Ctx) error {
+	var req dto.ForgotPasswordRequest
+	if err := c.BodyParser(&req); err != nil || req.Email == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	if err := h.service.ForgotPassword(c.Context(), req.Email); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "if the account exists, a password reset email has been sent",
+	})
+}
+
+func (h *passwordHandler) ResetPassword(c *fiber.Ctx) error {
+	var req dto.ResetPasswordRequest
+	if err := c.BodyParser(&req); err != nil || req.Token == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	if err := h.service.ResetPassword(c.Context(), req.Token, req.NewPassword); err != nil {
+		return handleError(c, err)
+	}
+
+	removeRefreshTokenCookie(c, h.cfg)
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "password reset, please log in again",
+	})
+}
@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"auth-service/internal/dto"
+	"auth-service/internal/entity"
+	"auth-service/internal/logger"
+	"auth-service/internal/service"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type ServiceAccountHandler interface {
+	Token(c *fiber.Ctx) error
+
+	ListServiceAccounts(c *fiber.Ctx) error
+	CreateServiceAccount(c *fiber.Ctx) error
+	DeleteServiceAccount(c *fiber.Ctx) error
+}
+
+type serviceAccountHandler struct {
+	service service.ServiceAccountService
+}
+
+func NewServiceAccountHandler(service service.ServiceAccountService) ServiceAccountHandler {
+	return &serviceAccountHandler{
+		service: service,
+	}
+}
+
+// Token issues an access token to a service account with the client credentials grant. The
+// account authenticates with HTTP Basic or with client_id and client_secret in the form.
+func (h *serviceAccountHandler) Token(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	c.Set(fiber.HeaderPragma, "no-cache")
+
+	clientID, clientSecret := c.FormValue("client_id"), c.FormValue("client_secret")
+	basicAuth := false
+	if id, secret, ok := basicCredentials(c.Get(fiber.HeaderAuthorization)); ok {
+		clientID, clientSecret, basicAuth = id, secret, true
+	}
+
+	token, err := h.service.IssueToken(c.Context(), c.FormValue("grant_type"), clientID, clientSecret, c.FormValue("scope"))
+	if err != nil {
+		return handleOAuthError(c, err, basicAuth)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(dto.OAuthTokenResponse{
+		AccessToken: token.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   token.ExpiresIn,
+		Scope:       token.Scope,
+	})
+}
+
+func (h *serviceAccountHandler) ListServiceAccounts(c *fiber.Ctx) error {
+	accounts, err := h.service.ListServiceAccounts(c.Context())
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	resp := make([]dto.ServiceAccountResponse, 0, len(accounts))
+	for _, account := range accounts {
+		resp = append(resp, serviceAccountResponse(account, ""))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+// CreateServiceAccount registers a service account. The secret is only part of this response.
+func (h *serviceAccountHandler) CreateServiceAccount(c *fiber.Ctx) error {
+	var req dto.CreateServiceAccountRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		logger.Log.Error().Err(err).Msg("failed to parse request body")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	account, secret, err := h.service.CreateServiceAccount(c.Context(), req.Name, req.Scopes)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+	return c.Status(fiber.StatusCreated).JSON(serviceAccountResponse(account, secret))
+}
+
+func (h *serviceAccountHandler) DeleteServiceAccount(c *fiber.Ctx) error {
+	if err := h.service.DeleteServiceAccount(c.Context(), c.Params("id")); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "service account deleted",
+	})
+}
+
+func serviceAccountResponse(account *entity.ServiceAccount, secret string) dto.ServiceAccountResponse {
+	return dto.ServiceAccountResponse{
+		ID:           account.ID,
+		ClientSecret: secret,
+		Name:         account.Name,
+		Scopes:       strings.Fields(account.Scopes),
+		CreatedAt:    account.CreatedAt,
+		LastUsedAt:   account.LastUsedAt,
+	}
+}
@@ -0,0 +1,128 @@
+package handler
+
+import (
+	"auth-service/internal/dto"
+	"auth-service/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type WebAuthnHandler interface {
+	BeginRegistration(c *fiber.Ctx) error
+	FinishRegistration(c *fiber.Ctx) error
+	ListCredentials(c *fiber.Ctx) error
+	DeleteCredential(c *fiber.Ctx) error
+}
+
+type webAuthnHandler struct {
+	service service.WebAuthnService
+	mfa     service.MFAService
+}
+
+func NewWebAuthnHandler(service service.WebAuthnService, mfa service.MFAService) WebAuthnHandler {
+	return &webAuthnHandler{
+		service: service,
+		mfa:     mfa,
+	}
+}
+
+// BeginRegistration needs the current password or a TOTP code, a stolen access token alone can
+// not add a passkey that signs in on its own.
+func (h *webAuthnHandler) BeginRegistration(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+
+	var req dto.ReauthenticationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	if err := h.mfa.Reauthenticate(c.Context(), userID, req.CurrentPassword, req.Code, clientIP(c)); err != nil {
+		return handleError(c, err)
+	}
+
+	options, err := h.service.BeginRegistration(c.Context(), userID)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(dto.WebAuthnOptionsResponse{
+		CeremonyID: options.CeremonyID,
+		Options:    options.Options,
+	})
+}
+
+func (h *webAuthnHandler) FinishRegistration(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+
+	var req dto.FinishPasskeyRegistrationRequest
+	if err := c.BodyParser(&req); err != nil || req.CeremonyID == "" || len(req.Credential) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	credential, err := h.service.FinishRegistration(c.Context(), userID, req.CeremonyID, req.Name, req.Credential)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(dto.PasskeyResponse{
+		ID:         credential.ID,
+		Name:       credential.Name,
+		CreatedAt:  credential.CreatedAt,
+		LastUsedAt: credential.LastUsedAt,
+	})
+}
+
+func (h *webAuthnHandler) ListCredentials(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+
+	credentials, err := h.service.ListCredentials(c.Context(), userID)
+	if err != nil {
+		return handleError(c, err)
+	}
+
+	resp := make([]dto.PasskeyResponse, 0, len(credentials))
+	for _, credential := range credentials {
+		resp = append(resp, dto.PasskeyResponse{
+			ID:         credential.ID,
+			Name:       credential.Name,
+			CreatedAt:  credential.CreatedAt,
+			LastUsedAt: credential.LastUsedAt,
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(resp)
+}
+
+// DeleteCredential needs the current password or a TOTP code like BeginRegistration, a passkey
+// can be the second factor that protects the account.
+func (h *webAuthnHandler) DeleteCredential(c *fiber.Ctx) error {
+	userID, _ := c.Locals("userID").(string)
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid passkey id",
+		})
+	}
+
+	var req dto.ReauthenticationRequest
+	if err := c.BodyParser(&req); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+	if err := h.mfa.Reauthenticate(c.Context(), userID, req.CurrentPassword, req.Code, clientIP(c)); err != nil {
+		return handleError(c, err)
+	}
+
+	if err := h.service.DeleteCredential(c.Context(), userID, id); err != nil {
+		return handleError(c, err)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"message": "passkey deleted",
+	})
+}
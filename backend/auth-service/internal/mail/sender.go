@@ -0,0 +1,96 @@
+package mail
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/logger"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Message is a plain text email.
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Sender delivers emails. Implementations for real mail providers can be plugged in next to
+// the log and file senders used for local development.
+type Sender interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// NewSender returns the sender selected by MAIL_SENDER.
+func NewSender(cfg config.MailConfig) (Sender, error) {
+	switch cfg.MailSender {
+	case "", "log":
+		return NewLogSender(), nil
+	case "file":
+		return NewFileSender(cfg.MailFileDir, cfg.MailFrom)
+	default:
+		return nil, fmt.Errorf("unknown MAIL_SENDER %q", cfg.MailSender)
+	}
+}
+
+type logSender struct{}
+
+// NewLogSender writes every message to the log, including links with secret tokens,
+// so it must only be used in development.
+func NewLogSender() Sender {
+	return logSender{}
+}
+
+func (logSender) Send(_ context.Context, msg Message) error {
+	logger.Log.Info().
+		Str("to", msg.To).
+		Str("subject", msg.Subject).
+		Str("body", msg.Body).
+		Msg("email")
+
+	return nil
+}
+
+type fileSender struct {
+	dir  string
+	from string
+}
+
+// NewFileSender writes every message as an .eml file to dir.
+func NewFileSender(dir, from string) (Sender, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("MAIL_FILE_DIR is required for the file sender")
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+
+	return &fileSender{dir: dir, from: from}, nil
+}
+
+func (s *fileSender) Send(_ context.Context, msg Message) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(s.from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405"), uuid.NewString())
+	if err := os.WriteFile(filepath.Join(s.dir, name), []byte(b.String()), 0o600); err != nil {
+		return fmt.Errorf("failed to write email: %w", err)
+	}
+
+	return nil
+}
+
+// headerValue keeps a value on one line, so it can not add headers of its own.
+func headerValue(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"auth-service/internal/logger"
+	"crypto/subtle"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// APIKey only lets requests through that carry key in the given header.
+// The routes behind it are disabled when key is empty.
+func APIKey(header, key string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if key == "" {
+			return c.SendStatus(fiber.StatusNotFound)
+		}
+
+		if subtle.ConstantTimeCompare([]byte(c.Get(header)), []byte(key)) != 1 {
+			logger.Log.Warn().
+				Str("path", c.Path()).
+				Str("ip", c.IP()).
+				Msg("invalid api key")
+
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "invalid api key",
+			})
+		}
+
+		return c.Next()
+	}
+}
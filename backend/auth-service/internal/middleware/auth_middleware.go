@@ -0,0 +1,80 @@
+package middleware
+
+import (
+	"auth-service/internal/cache"
+	"auth-service/internal/config"
+	"auth-service/internal/logger"
+	"auth-service/internal/service"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Auth validates the Bearer access token, checks it against the revocation list and stores
+// its subject in c.Locals("userID") and its session in c.Locals("sessionID").
+func Auth(tokenManager service.TokenManager, redisCache cache.RedisCache, cfg config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		authHeader := c.Get("Authorization")
+
+		if authHeader == "" || !strings.HasPrefix(authHeader, "Bearer ") {
+			logger.Log.Warn().
+				Str("path", c.Path()).
+				Msg("access token not found")
+
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "access token not found",
+			})
+		}
+
+		claims, err := tokenManager.ValidateAccessToken(strings.TrimPrefix(authHeader, "Bearer "))
+		if err != nil {
+			logger.Log.Warn().
+				Err(err).
+				Str("path", c.Path()).
+				Msg("invalid or expired token")
+
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "invalid or expired token",
+			})
+		}
+
+		// tokens issued to an OAuth client are only good for the userinfo endpoint, and service
+		// accounts have no user to act as
+		if len(claims.Audience) > 0 || claims.ClientID != "" {
+			logger.Log.Warn().
+				Str("path", c.Path()).
+				Strs("aud", claims.Audience).
+				Str("client_id", claims.ClientID).
+				Msg("access token not issued to a user")
+
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "invalid or expired token",
+			})
+		}
+
+		revoked, err := redisCache.IsRevoked(c.Context(), claims.ID, claims.SessionID)
+		if err != nil {
+			logger.Log.Error().Err(err).Msg("error checking token revocation")
+
+			if !cfg.RevocationFailOpen {
+				return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{
+					"error": "service unavailable",
+				})
+			}
+		}
+		if revoked {
+			logger.Log.Warn().
+				Str("path", c.Path()).
+				Str("jti", claims.ID).
+				Msg("revoked token")
+
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "invalid or expired token",
+			})
+		}
+
+		c.Locals("userID", claims.Subject)
+		c.Locals("sessionID", claims.SessionID)
+		return c.Next()
+	}
+}
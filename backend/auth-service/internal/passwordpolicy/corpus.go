@@ -0,0 +1,106 @@
+package passwordpolicy
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Corpus is a set of breached passwords.
+type Corpus interface {
+	Contains(password string) bool
+}
+
+// hashCorpus is a sorted list of the first 8 bytes of the SHA-1 of each password. 8 bytes per
+// password keeps large lists in memory, and collisions between different passwords are too
+// rare to matter.
+type hashCorpus struct {
+	prefixes []uint64
+}
+
+// LoadCorpus reads a corpus file written by BuildCorpus: the big-endian 8 byte SHA-1 prefixes of
+// the passwords in ascending order, without a header.
+func LoadCorpus(path string) (Corpus, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read breached password corpus: %w", err)
+	}
+	if len(data)%8 != 0 {
+		return nil, fmt.Errorf("breached password corpus %s is not a list of 8 byte hashes", path)
+	}
+
+	prefixes := make([]uint64, len(data)/8)
+	for i := range prefixes {
+		prefixes[i] = binary.BigEndian.Uint64(data[i*8:])
+	}
+	if !slices.IsSorted(prefixes) {
+		return nil, fmt.Errorf("breached password corpus %s is not sorted", path)
+	}
+
+	return &hashCorpus{prefixes: prefixes}, nil
+}
+
+func (c *hashCorpus) Contains(password string) bool {
+	_, found := slices.BinarySearch(c.prefixes, hashPrefix(password))
+	return found
+}
+
+func hashPrefix(password string) uint64 {
+	sum := sha1.Sum([]byte(password))
+	return binary.BigEndian.Uint64(sum[:8])
+}
+
+// BuildCorpus writes the corpus of a password list to w and returns how many distinct
+// passwords it holds. The list has one entry per line, either the password itself or, with
+// hashed set, its hex SHA-1 as in the Pwned Passwords downloads, where a ":count" suffix is
+// ignored.
+func BuildCorpus(r io.Reader, w io.Writer, hashed bool) (int, error) {
+	prefixes := []uint64{}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		entry := strings.TrimSuffix(scanner.Text(), "\r")
+		if entry == "" {
+			continue
+		}
+
+		if !hashed {
+			prefixes = append(prefixes, hashPrefix(entry))
+			continue
+		}
+
+		hash, _, _ := strings.Cut(entry, ":")
+		sum, err := hex.DecodeString(strings.TrimSpace(hash))
+		if err != nil || len(sum) != sha1.Size {
+			return 0, fmt.Errorf("line %d is not a SHA-1 hash", line)
+		}
+		prefixes = append(prefixes, binary.BigEndian.Uint64(sum[:8]))
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, fmt.Errorf("failed to read password list: %w", err)
+	}
+
+	slices.Sort(prefixes)
+	prefixes = slices.Compact(prefixes)
+
+	out := bufio.NewWriter(w)
+	buf := make([]byte, 8)
+	for _, prefix := range prefixes {
+		binary.BigEndian.PutUint64(buf, prefix)
+		if _, err := out.Write(buf); err != nil {
+			return 0, fmt.Errorf("failed to write corpus: %w", err)
+		}
+	}
+	if err := out.Flush(); err != nil {
+		return 0, fmt.Errorf("failed to write corpus: %w", err)
+	}
+
+	return len(prefixes), nil
+}
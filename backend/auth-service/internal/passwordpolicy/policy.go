@@ -0,0 +1,163 @@
+package passwordpolicy
+
+import (
+	"auth-service/internal/config"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// MaxBytes is the longest password bcrypt can hash.
+const MaxBytes = 72
+
+// minSimilarLength is the shortest part of the email that a password may not contain, shorter
+// ones match too many passwords by chance.
+const minSimilarLength = 4
+
+// Violation is a rule a password breaks. Code is stable for clients, Message is for people.
+type Violation struct {
+	Code    string
+	Message string
+}
+
+// Policy decides which passwords users can choose.
+type Policy interface {
+	// Validate returns every rule the password breaks, none when it is acceptable. email is the
+	// account the password is for and may be empty.
+	Validate(password, email string) []Violation
+}
+
+type policy struct {
+	minLength   int
+	maxLength   int
+	minClasses  int
+	bannedWords []string
+	breached    Corpus
+}
+
+// NewPolicy builds the policy from the config. breached may be nil to skip the breached
+// password check.
+func NewPolicy(cfg config.PasswordConfig, breached Corpus) Policy {
+	bannedWords := make([]string, len(cfg.PasswordBannedWords))
+	for i, word := range cfg.PasswordBannedWords {
+		bannedWords[i] = strings.ToLower(word)
+	}
+
+	return &policy{
+		minLength:   max(cfg.PasswordMinLength, 1),
+		maxLength:   cfg.PasswordMaxLength,
+		minClasses:  cfg.PasswordMinClasses,
+		bannedWords: bannedWords,
+		breached:    breached,
+	}
+}
+
+func (p *policy) Validate(password, email string) []Violation {
+	if password == "" {
+		return []Violation{{Code: "required", Message: "password is required"}}
+	}
+
+	violations := []Violation{}
+
+	length := utf8.RuneCountInString(password)
+	switch {
+	case length < p.minLength:
+		violations = append(violations, Violation{
+			Code:    "too_short",
+			Message: fmt.Sprintf("password must be at least %d characters long", p.minLength),
+		})
+	case p.maxLength > 0 && length > p.maxLength:
+		violations = append(violations, Violation{
+			Code:    "too_long",
+			Message: fmt.Sprintf("password must be at most %d characters long", p.maxLength),
+		})
+	case len(password) > MaxBytes:
+		violations = append(violations, Violation{
+			Code:    "too_long",
+			Message: fmt.Sprintf("password must be at most %d bytes long", MaxBytes),
+		})
+	}
+
+	if classes := characterClasses(password); classes < p.minClasses {
+		violations = append(violations, Violation{
+			Code: "character_classes",
+			Message: fmt.Sprintf("password must mix at least %d of lowercase letters, uppercase letters, digits and symbols",
+				p.minClasses),
+		})
+	}
+
+	lower := strings.ToLower(password)
+	for _, word := range p.bannedWords {
+		if strings.Contains(lower, word) {
+			violations = append(violations, Violation{
+				Code:    "banned_word",
+				Message: "password must not contain " + word,
+			})
+			break
+		}
+	}
+
+	if similarToEmail(lower, strings.ToLower(strings.TrimSpace(email))) {
+		violations = append(violations, Violation{
+			Code:    "similar_to_email",
+			Message: "password must not be based on the email",
+		})
+	}
+
+	if p.breached != nil && p.breached.Contains(password) {
+		violations = append(violations, Violation{
+			Code:    "breached",
+			Message: "password appears in a list of breached passwords, choose another one",
+		})
+	}
+
+	return violations
+}
+
+// characterClasses counts which of lowercase letters, uppercase letters, digits and everything
+// else the password uses.
+func characterClasses(password string) int {
+	var lower, upper, digit, other bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	classes := 0
+	for _, used := range []bool{lower, upper, digit, other} {
+		if used {
+			classes++
+		}
+	}
+	return classes
+}
+
+// similarToEmail reports whether the password contains the email, its name or domain, or is
+// contained in it. Both are lowercase.
+func similarToEmail(password, email string) bool {
+	if email == "" {
+		return false
+	}
+	if strings.Contains(email, password) {
+		return true
+	}
+
+	name, domain, _ := strings.Cut(email, "@")
+	domainName, _, _ := strings.Cut(domain, ".")
+	for _, part := range []string{email, name, domainName} {
+		if len(part) >= minSimilarLength && strings.Contains(password, part) {
+			return true
+		}
+	}
+
+	return false
+}
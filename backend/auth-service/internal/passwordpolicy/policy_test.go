@@ -0,0 +1,134 @@
+package passwordpolicy
+
+import (
+	"auth-service/internal/config"
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func codes(violations []Violation) []string {
+	result := []string{}
+	for _, violation := range violations {
+		result = append(result, violation.Code)
+	}
+	return result
+}
+
+func TestPolicy_Validate(t *testing.T) {
+	corpus := buildTestCorpus(t, "correct horse battery\n")
+	policy := NewPolicy(config.PasswordConfig{
+		PasswordMinLength:   10,
+		PasswordMaxLength:   64,
+		PasswordMinClasses:  2,
+		PasswordBannedWords: []string{"Acme"},
+	}, corpus)
+
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{"acceptable", "quiet-lantern-42", nil},
+		{"empty", "", []string{"required"}},
+		{"too short", "ab1-", []string{"too_short"}},
+		{"too long", strings.Repeat("ab1-", 17), []string{"too_long"}},
+		{"too many bytes", strings.Repeat("ö1", 30), []string{"too_long"}},
+		{"one character class", "quietlantern", []string{"character_classes"}},
+		{"banned word in any case", "my-ACME-login-1", []string{"banned_word"}},
+		{"email name", "jane.doe-2024", []string{"similar_to_email"}},
+		{"email domain", "example!2024", []string{"similar_to_email"}},
+		{"breached", "correct horse battery", []string{"breached"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := codes(policy.Validate(tc.password, "Jane.Doe@example.com"))
+			if !slices.Equal(got, append([]string{}, tc.want...)) {
+				t.Errorf("Validate(%q) = %v, want %v", tc.password, got, tc.want)
+			}
+		})
+	}
+
+	// every rule a password breaks is reported
+	got := codes(policy.Validate("acme", "acme@example.com"))
+	if !slices.Equal(got, []string{"too_short", "character_classes", "banned_word", "similar_to_email"}) {
+		t.Errorf("Validate() = %v, want every broken rule", got)
+	}
+}
+
+func TestCorpus_BuildAndLoad(t *testing.T) {
+	t.Run("passwords", func(t *testing.T) {
+		corpus := buildTestCorpus(t, "123456\r\npassword\n\npassword\nqwerty\n")
+
+		for _, password := range []string{"123456", "password", "qwerty"} {
+			if !corpus.Contains(password) {
+				t.Errorf("Contains(%q) = false, want true", password)
+			}
+		}
+		if corpus.Contains("quiet-lantern-42") {
+			t.Error("Contains() = true for a password that is not in the list")
+		}
+	})
+
+	t.Run("sha1 hashes", func(t *testing.T) {
+		// SHA-1 of "password", in the format of the Pwned Passwords downloads
+		list := "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:10434004\n"
+
+		var buf bytes.Buffer
+		count, err := BuildCorpus(strings.NewReader(list), &buf, true)
+		if err != nil || count != 1 {
+			t.Fatalf("BuildCorpus() = %d, %v, want one password", count, err)
+		}
+		corpus := loadTestCorpus(t, buf.Bytes())
+		if !corpus.Contains("password") {
+			t.Error("Contains(\"password\") = false, want true")
+		}
+
+		_, err = BuildCorpus(strings.NewReader("not a hash\n"), &bytes.Buffer{}, true)
+		if err == nil {
+			t.Error("BuildCorpus() accepted a line that is not a hash")
+		}
+	})
+
+	t.Run("invalid files", func(t *testing.T) {
+		for name, data := range map[string][]byte{
+			"truncated": {1, 2, 3},
+			"unsorted":  {0, 0, 0, 0, 0, 0, 0, 2, 0, 0, 0, 0, 0, 0, 0, 1},
+		} {
+			path := filepath.Join(t.TempDir(), name)
+			if err := os.WriteFile(path, data, 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadCorpus(path); err == nil {
+				t.Errorf("LoadCorpus() accepted a %s file", name)
+			}
+		}
+	})
+}
+
+func buildTestCorpus(t *testing.T, list string) Corpus {
+	t.Helper()
+
+	var buf bytes.Buffer
+	if _, err := BuildCorpus(strings.NewReader(list), &buf, false); err != nil {
+		t.Fatalf("BuildCorpus() error: %v", err)
+	}
+	return loadTestCorpus(t, buf.Bytes())
+}
+
+func loadTestCorpus(t *testing.T, data []byte) Corpus {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "breached.bin")
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	corpus, err := LoadCorpus(path)
+	if err != nil {
+		t.Fatalf("LoadCorpus() error: %v", err)
+	}
+	return corpus
+}
@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrAPIKeyNotFound = errors.New("api key not found")
+
+type APIKeyRepository interface {
+	ListAPIKeys(ctx context.Context, userID string) ([]*entity.APIKey, error)
+	// CreateAPIKey stores the key with the hash of secret.
+	CreateAPIKey(ctx context.Context, key *entity.APIKey, secret string) error
+	// FindAPIKey returns the key with the prefix if secret matches it, expired or not.
+	FindAPIKey(ctx context.Context, prefix, secret string) (*entity.APIKey, error)
+	RenameAPIKey(ctx context.Context, userID, id, name string) (*entity.APIKey, error)
+	DeleteAPIKey(ctx context.Context, userID, id string) error
+	// TouchAPIKey records that the key was used.
+	TouchAPIKey(ctx context.Context, id string) error
+}
+
+type apiKeyRepository struct {
+	db  *gorm.DB
+	cfg config.Config
+}
+
+func NewAPIKeyRepository(db *gorm.DB, cfg config.Config) APIKeyRepository {
+	return &apiKeyRepository{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+func (r *apiKeyRepository) ListAPIKeys(ctx context.Context, userID string) ([]*entity.APIKey, error) {
+	keys := []*entity.APIKey{}
+
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&keys).Error; err != nil {
+		return nil, fmt.Errorf("failed to list api keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (r *apiKeyRepository) CreateAPIKey(ctx context.Context, key *entity.APIKey, secret string) error {
+	key.KeyHash = hashToken(r.cfg.JWT.RefreshTokenHashKey, secret)
+
+	if err := r.db.WithContext(ctx).Create(key).Error; err != nil {
+		return fmt.Errorf("failed to create api key: %w", err)
+	}
+
+	return nil
+}
+
+func (r *apiKeyRepository) FindAPIKey(ctx context.Context, prefix, secret string) (*entity.APIKey, error) {
+	var key entity.APIKey
+
+	err := r.db.WithContext(ctx).
+		Where("prefix = ? AND key_hash = ?", prefix, hashToken(r.cfg.JWT.RefreshTokenHashKey, secret)).
+		First(&key).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("failed to find api key: %w", err)
+	}
+
+	return &key, nil
+}
+
+func (r *apiKeyRepository) RenameAPIKey(ctx context.Context, userID, id, name string) (*entity.APIKey, error) {
+	var key entity.APIKey
+
+	err := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).First(&key).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAPIKeyNotFound
+		}
+		return nil, fmt.Errorf("failed to get api key: %w", err)
+	}
+
+	if err := r.db.WithContext(ctx).Model(&key).Update("name", name).Error; err != nil {
+		return nil, fmt.Errorf("failed to rename api key: %w", err)
+	}
+
+	return &key, nil
+}
+
+func (r *apiKeyRepository) DeleteAPIKey(ctx context.Context, userID, id string) error {
+	result := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&entity.APIKey{})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete api key: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrAPIKeyNotFound
+	}
+
+	return nil
+}
+
+func (r *apiKeyRepository) TouchAPIKey(ctx context.Context, id string) error {
+	err := r.db.WithContext(ctx).
+		Model(&entity.APIKey{}).
+		Where("id = ?", id).
+		Update("last_used_at", time.Now()).Error
+
+	if err != nil {
+		return fmt.Errorf("failed to touch api key: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package repository
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrEmailLoginNotFound = errors.New("email login not found")
+
+type EmailLoginRepository interface {
+	// CreateChallenge stores the hashes of the login id, link token and code of a new challenge
+	// and invalidates the unused challenges of the user.
+	CreateChallenge(ctx context.Context, challenge *entity.EmailLoginChallenge, loginID, linkToken, code string) error
+	// ConsumeLink marks the unused, unexpired challenge of the link token as used and returns it.
+	ConsumeLink(ctx context.Context, linkToken string) (*entity.EmailLoginChallenge, error)
+	// ClaimCodeAttempt counts an attempt against an unused, unexpired challenge that has
+	// attempts left and returns it.
+	ClaimCodeAttempt(ctx context.Context, loginID string, maxAttempts int) (*entity.EmailLoginChallenge, error)
+	// ConsumeCode marks the unused, unexpired challenge as used if the code matches it and
+	// reports whether it did.
+	ConsumeCode(ctx context.Context, loginID, code string) (bool, error)
+}
+
+type emailLoginRepository struct {
+	db  *gorm.DB
+	cfg config.Config
+}
+
+func NewEmailLoginRepository(db *gorm.DB, cfg config.Config) EmailLoginRepository {
+	return &emailLoginRepository{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+func (r *emailLoginRepository) CreateChallenge(ctx context.Context, challenge *entity.EmailLoginChallenge, loginID, linkToken, code string) error {
+	challenge.LoginHash = hashToken(r.cfg.JWT.RefreshTokenHashKey, loginID)
+	challenge.LinkHash = hashToken(r.cfg.JWT.RefreshTokenHashKey, linkToken)
+	challenge.CodeHash = r.hashCode(loginID, code)
+
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&entity.EmailLoginChallenge{}).
+			Where("user_id = ? AND used_at IS NULL", challenge.UserID).
+			Update("used_at", time.Now()).Error
+		if err != nil {
+			return fmt.Errorf("failed to invalidate email logins: %w", err)
+		}
+
+		if err := tx.Create(challenge).Error; err != nil {
+			return fmt.Errorf("failed to save email login: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (r *emailLoginRepository) ConsumeLink(ctx context.Context, linkToken string) (*entity.EmailLoginChallenge, error) {
+	var consumed []entity.EmailLoginChallenge
+
+	// a single conditional update, so a link can not be used twice by concurrent requests
+	result := r.db.WithContext(ctx).
+		Model(&consumed).
+		Clauses(clause.Returning{}).
+		Where("link_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(r.cfg.JWT.RefreshTokenHashKey, linkToken), time.Now()).
+		Update("used_at", time.Now())
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to consume email login link: %w", result.Error)
+	}
+	if len(consumed) == 0 {
+		return nil, ErrEmailLoginNotFound
+	}
+
+	return &consumed[0], nil
+}
+
+func (r *emailLoginRepository) ClaimCodeAttempt(ctx context.Context, loginID string, maxAttempts int) (*entity.EmailLoginChallenge, error) {
+	var claimed []entity.EmailLoginChallenge
+
+	// the attempt is counted before the code is checked, so parallel guesses can not exceed the limit
+	result := r.db.WithContext(ctx).
+		Model(&claimed).
+		Clauses(clause.Returning{}).
+		Where("login_hash = ? AND used_at IS NULL AND expires_at > ? AND attempts < ?",
+			hashToken(r.cfg.JWT.RefreshTokenHashKey, loginID), time.Now(), maxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to claim email login: %w", result.Error)
+	}
+	if len(claimed) == 0 {
+		return nil, ErrEmailLoginNotFound
+	}
+
+	return &claimed[0], nil
+}
+
+func (r *emailLoginRepository) ConsumeCode(ctx context.Context, loginID, code string) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&entity.EmailLoginChallenge{}).
+		Where("login_hash = ? AND code_hash = ? AND used_at IS NULL AND expires_at > ?",
+			hashToken(r.cfg.JWT.RefreshTokenHashKey, loginID), r.hashCode(loginID, code), time.Now()).
+		Update("used_at", time.Now())
+
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to consume email login code: %w", result.Error)
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// hashCode includes the login id, the codes are too short to be hashed on their own.
+func (r *emailLoginRepository) hashCode(loginID, code string) string {
+	return hashToken(r.cfg.JWT.RefreshTokenHashKey, loginID+":"+code)
+}
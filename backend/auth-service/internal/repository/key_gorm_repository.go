@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"auth-service/internal/entity"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrSigningKeyNotFound = errors.New("signing key not found")
+
+type KeyRepository interface {
+	ListKeys(ctx context.Context) ([]*entity.SigningKey, error)
+	// CreateKey stores the key unless a key with the same purpose and id already exists.
+	CreateKey(ctx context.Context, key *entity.SigningKey) error
+	// UpdateKeyState changes the state of a key; a nil activatesAt leaves the activation time as is.
+	UpdateKeyState(ctx context.Context, purpose, id, state string, activatesAt *time.Time) error
+}
+
+type keyRepository struct {
+	db *gorm.DB
+}
+
+func NewKeyRepository(db *gorm.DB) KeyRepository {
+	return &keyRepository{
+		db: db,
+	}
+}
+
+func (r *keyRepository) ListKeys(ctx context.Context) ([]*entity.SigningKey, error) {
+	keys := []*entity.SigningKey{}
+	result := r.db.WithContext(ctx).
+		Order("activates_at DESC").
+		Find(&keys)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list signing keys: %w", result.Error)
+	}
+
+	return keys, nil
+}
+
+func (r *keyRepository) CreateKey(ctx context.Context, key *entity.SigningKey) error {
+	// several instances may seed the same configured key on startup
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(key)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to create signing key: %w", result.Error)
+	}
+
+	return nil
+}
+
+func (r *keyRepository) UpdateKeyState(ctx context.Context, purpose, id, state string, activatesAt *time.Time) error {
+	updates := map[string]any{
+		"state":      state,
+		"updated_at": time.Now(),
+	}
+	if activatesAt != nil {
+		updates["activates_at"] = *activatesAt
+	}
+
+	result := r.db.WithContext(ctx).
+		Model(&entity.SigningKey{}).
+		Where("purpose = ? AND id = ?", purpose, id).
+		Updates(updates)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to update signing key: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrSigningKeyNotFound
+	}
+
+	return nil
+}
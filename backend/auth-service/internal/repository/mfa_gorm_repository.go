@@ -0,0 +1,237 @@
+package repository
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrTOTPNotFound         = errors.New("totp factor not found")
+	ErrMFAChallengeNotFound = errors.New("mfa challenge not found")
+)
+
+type MFARepository interface {
+	GetTOTP(ctx context.Context, userID string) (*entity.TOTPFactor, error)
+	// SaveTOTP stores a new unconfirmed secret for the user, replacing an earlier unconfirmed one.
+	// A confirmed factor is left untouched.
+	SaveTOTP(ctx context.Context, userID, secret string) error
+	// ConfirmTOTP enables the factor and replaces the user's recovery codes. It reports false
+	// when there is no unconfirmed factor to confirm.
+	ConfirmTOTP(ctx context.Context, userID string, step int64, recoveryCodes []string) (bool, error)
+	// UseTOTPStep records a successful code. It reports false when a code of this or a later
+	// time step was already used, so every code works only once.
+	UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error)
+	// DeleteTOTP removes the factor and the recovery codes.
+	DeleteTOTP(ctx context.Context, userID string) error
+	// UseRecoveryCode marks an unused recovery code as used and reports whether there was one.
+	UseRecoveryCode(ctx context.Context, userID, code string) (bool, error)
+
+	CreateChallenge(ctx context.Context, token string, challenge *entity.MFAChallenge) error
+	// GetChallenge returns an unused, unexpired challenge that has attempts left without counting one.
+	GetChallenge(ctx context.Context, token string, maxAttempts int) (*entity.MFAChallenge, error)
+	// ClaimChallengeAttempt counts an attempt against an unused, unexpired challenge that has
+	// attempts left and returns it.
+	ClaimChallengeAttempt(ctx context.Context, token string, maxAttempts int) (*entity.MFAChallenge, error)
+	// ConsumeChallenge marks the challenge as used and reports false if it already was.
+	ConsumeChallenge(ctx context.Context, id int) (bool, error)
+}
+
+type mfaRepository struct {
+	db  *gorm.DB
+	cfg config.Config
+}
+
+func NewMFARepository(db *gorm.DB, cfg config.Config) MFARepository {
+	return &mfaRepository{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+func (r *mfaRepository) GetTOTP(ctx context.Context, userID string) (*entity.TOTPFactor, error) {
+	var factor entity.TOTPFactor
+
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).First(&factor).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrTOTPNotFound
+		}
+		return nil, fmt.Errorf("failed to get totp factor: %w", err)
+	}
+
+	return &factor, nil
+}
+
+func (r *mfaRepository) SaveTOTP(ctx context.Context, userID, secret string) error {
+	factor := entity.TOTPFactor{
+		UserID: userID,
+		Secret: secret,
+	}
+
+	err := r.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.Assignments(map[string]any{"secret": secret, "last_used_step": 0, "created_at": time.Now()}),
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "mfa_totp.confirmed_at IS NULL"}}},
+	}).Create(&factor).Error
+	if err != nil {
+		return fmt.Errorf("failed to save totp factor: %w", err)
+	}
+
+	return nil
+}
+
+func (r *mfaRepository) ConfirmTOTP(ctx context.Context, userID string, step int64, recoveryCodes []string) (bool, error) {
+	confirmed := false
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&entity.TOTPFactor{}).
+			Where("user_id = ? AND confirmed_at IS NULL", userID).
+			Updates(map[string]any{"confirmed_at": time.Now(), "last_used_step": step})
+		if result.Error != nil {
+			return fmt.Errorf("failed to confirm totp factor: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return nil
+		}
+
+		if err := r.replaceRecoveryCodes(tx, userID, recoveryCodes); err != nil {
+			return err
+		}
+
+		confirmed = true
+		return nil
+	})
+
+	return confirmed, err
+}
+
+func (r *mfaRepository) replaceRecoveryCodes(tx *gorm.DB, userID string, codes []string) error {
+	if err := tx.Where("user_id = ?", userID).Delete(&entity.RecoveryCode{}).Error; err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+
+	rows := make([]entity.RecoveryCode, 0, len(codes))
+	for _, code := range codes {
+		rows = append(rows, entity.RecoveryCode{
+			UserID:   userID,
+			CodeHash: r.hashRecoveryCode(userID, code),
+		})
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return fmt.Errorf("failed to save recovery codes: %w", err)
+	}
+
+	return nil
+}
+
+func (r *mfaRepository) UseTOTPStep(ctx context.Context, userID string, step int64) (bool, error) {
+	// a single conditional update, so the same code can not be accepted by concurrent requests
+	result := r.db.WithContext(ctx).
+		Model(&entity.TOTPFactor{}).
+		Where("user_id = ? AND confirmed_at IS NOT NULL AND last_used_step < ?", userID, step).
+		Update("last_used_step", step)
+
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to update totp factor: %w", result.Error)
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+func (r *mfaRepository) DeleteTOTP(ctx context.Context, userID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&entity.RecoveryCode{}).Error; err != nil {
+			return fmt.Errorf("failed to delete recovery codes: %w", err)
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&entity.TOTPFactor{}).Error; err != nil {
+			return fmt.Errorf("failed to delete totp factor: %w", err)
+		}
+		return nil
+	})
+}
+
+func (r *mfaRepository) UseRecoveryCode(ctx context.Context, userID, code string) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&entity.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, r.hashRecoveryCode(userID, code)).
+		Update("used_at", time.Now())
+
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", result.Error)
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+func (r *mfaRepository) CreateChallenge(ctx context.Context, token string, challenge *entity.MFAChallenge) error {
+	challenge.TokenHash = hashToken(r.cfg.JWT.RefreshTokenHashKey, token)
+
+	if err := r.db.WithContext(ctx).Create(challenge).Error; err != nil {
+		return fmt.Errorf("failed to save mfa challenge: %w", err)
+	}
+
+	return nil
+}
+
+func (r *mfaRepository) GetChallenge(ctx context.Context, token string, maxAttempts int) (*entity.MFAChallenge, error) {
+	var challenge entity.MFAChallenge
+
+	err := r.db.WithContext(ctx).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ? AND attempts < ?",
+			hashToken(r.cfg.JWT.RefreshTokenHashKey, token), time.Now(), maxAttempts).
+		First(&challenge).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrMFAChallengeNotFound
+		}
+		return nil, fmt.Errorf("failed to get mfa challenge: %w", err)
+	}
+
+	return &challenge, nil
+}
+
+func (r *mfaRepository) ClaimChallengeAttempt(ctx context.Context, token string, maxAttempts int) (*entity.MFAChallenge, error) {
+	var claimed []entity.MFAChallenge
+
+	// the attempt is counted before the code is checked, so parallel guesses can not exceed the limit
+	result := r.db.WithContext(ctx).
+		Model(&claimed).
+		Clauses(clause.Returning{}).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ? AND attempts < ?",
+			hashToken(r.cfg.JWT.RefreshTokenHashKey, token), time.Now(), maxAttempts).
+		Update("attempts", gorm.Expr("attempts + 1"))
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to claim mfa challenge: %w", result.Error)
+	}
+	if len(claimed) == 0 {
+		return nil, ErrMFAChallengeNotFound
+	}
+
+	return &claimed[0], nil
+}
+
+func (r *mfaRepository) ConsumeChallenge(ctx context.Context, id int) (bool, error) {
+	result := r.db.WithContext(ctx).
+		Model(&entity.MFAChallenge{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to consume mfa challenge: %w", result.Error)
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+// hashRecoveryCode includes the user id so equal codes of different users do not collide.
+func (r *mfaRepository) hashRecoveryCode(userID, code string) string {
+	return hashToken(r.cfg.JWT.RefreshTokenHashKey, userID+":"+code)
+}
@@ -0,0 +1,221 @@
+package repository
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrOAuthClientNotFound  = errors.New("oauth client not found")
+	ErrOAuthRequestNotFound = errors.New("oauth authorization request not found")
+	ErrOAuthCodeNotFound    = errors.New("oauth authorization code not found")
+	ErrOAuthCodeReused      = errors.New("oauth authorization code already used")
+)
+
+type OAuthRepository interface {
+	ListClients(ctx context.Context) ([]*entity.OAuthClient, error)
+	GetClient(ctx context.Context, clientID string) (*entity.OAuthClient, error)
+	CreateClient(ctx context.Context, client *entity.OAuthClient) error
+	DeleteClient(ctx context.Context, clientID string) error
+
+	// CreateAuthorization stores an authorization request until the user decides on it.
+	CreateAuthorization(ctx context.Context, requestID string, authorization *entity.OAuthAuthorization) error
+	// GetAuthorizationRequest returns the request if it is still waiting for the user.
+	GetAuthorizationRequest(ctx context.Context, requestID string) (*entity.OAuthAuthorization, error)
+	// ApproveAuthorization attaches the user and the authorization code to a pending request, so a
+	// request can only be approved once.
+	ApproveAuthorization(ctx context.Context, requestID, userID, code string, authTime time.Time) (*entity.OAuthAuthorization, error)
+	// DenyAuthorization removes a pending request and returns it.
+	DenyAuthorization(ctx context.Context, requestID string) (*entity.OAuthAuthorization, error)
+	// ConsumeCode marks an unexpired code as used and returns its authorization.
+	// If the code was already used, the stored row is returned together with ErrOAuthCodeReused.
+	ConsumeCode(ctx context.Context, code string) (*entity.OAuthAuthorization, error)
+	// SetAuthorizationSession records the session opened with the code.
+	SetAuthorizationSession(ctx context.Context, id int, sessionID string) error
+}
+
+type oauthRepository struct {
+	db  *gorm.DB
+	cfg config.Config
+}
+
+func NewOAuthRepository(db *gorm.DB, cfg config.Config) OAuthRepository {
+	return &oauthRepository{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+func (r *oauthRepository) ListClients(ctx context.Context) ([]*entity.OAuthClient, error) {
+	clients := []*entity.OAuthClient{}
+
+	if err := r.db.WithContext(ctx).Order("created_at").Find(&clients).Error; err != nil {
+		return nil, fmt.Errorf("failed to list oauth clients: %w", err)
+	}
+
+	return clients, nil
+}
+
+func (r *oauthRepository) GetClient(ctx context.Context, clientID string) (*entity.OAuthClient, error) {
+	var client entity.OAuthClient
+
+	err := r.db.WithContext(ctx).Where("id = ?", clientID).First(&client).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOAuthClientNotFound
+		}
+		return nil, fmt.Errorf("failed to get oauth client: %w", err)
+	}
+
+	return &client, nil
+}
+
+func (r *oauthRepository) CreateClient(ctx context.Context, client *entity.OAuthClient) error {
+	if err := r.db.WithContext(ctx).Create(client).Error; err != nil {
+		return fmt.Errorf("failed to create oauth client: %w", err)
+	}
+
+	return nil
+}
+
+func (r *oauthRepository) DeleteClient(ctx context.Context, clientID string) error {
+	result := r.db.WithContext(ctx).Where("id = ?", clientID).Delete(&entity.OAuthClient{})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete oauth client: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrOAuthClientNotFound
+	}
+
+	return nil
+}
+
+func (r *oauthRepository) CreateAuthorization(ctx context.Context, requestID string, authorization *entity.OAuthAuthorization) error {
+	authorization.RequestHash = hashToken(r.cfg.JWT.RefreshTokenHashKey, requestID)
+
+	if err := r.db.WithContext(ctx).Create(authorization).Error; err != nil {
+		return fmt.Errorf("failed to create oauth authorization: %w", err)
+	}
+
+	return nil
+}
+
+func (r *oauthRepository) GetAuthorizationRequest(ctx context.Context, requestID string) (*entity.OAuthAuthorization, error) {
+	var authorization entity.OAuthAuthorization
+
+	err := r.db.WithContext(ctx).
+		Where("request_hash = ? AND user_id IS NULL AND expires_at > ?", hashToken(r.cfg.JWT.RefreshTokenHashKey, requestID), time.Now()).
+		First(&authorization).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrOAuthRequestNotFound
+		}
+		return nil, fmt.Errorf("failed to get oauth authorization request: %w", err)
+	}
+
+	return &authorization, nil
+}
+
+func (r *oauthRepository) ApproveAuthorization(ctx context.Context, requestID, userID, code string, authTime time.Time) (*entity.OAuthAuthorization, error) {
+	var approved []entity.OAuthAuthorization
+
+	// a single conditional update, so concurrent approvals can not issue two codes
+	result := r.db.WithContext(ctx).
+		Model(&approved).
+		Clauses(clause.Returning{}).
+		Where("request_hash = ? AND user_id IS NULL AND expires_at > ?", hashToken(r.cfg.JWT.RefreshTokenHashKey, requestID), time.Now()).
+		Updates(map[string]any{
+			"user_id":    userID,
+			"code_hash":  hashToken(r.cfg.JWT.RefreshTokenHashKey, code),
+			"auth_time":  authTime,
+			"expires_at": time.Now().Add(r.cfg.OAuth.OAuthCodeExp),
+		})
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to approve oauth authorization: %w", result.Error)
+	}
+	if len(approved) == 0 {
+		return nil, ErrOAuthRequestNotFound
+	}
+
+	return &approved[0], nil
+}
+
+func (r *oauthRepository) DenyAuthorization(ctx context.Context, requestID string) (*entity.OAuthAuthorization, error) {
+	var denied []entity.OAuthAuthorization
+
+	result := r.db.WithContext(ctx).
+		Clauses(clause.Returning{}).
+		Where("request_hash = ? AND user_id IS NULL AND expires_at > ?", hashToken(r.cfg.JWT.RefreshTokenHashKey, requestID), time.Now()).
+		Delete(&denied)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to deny oauth authorization: %w", result.Error)
+	}
+	if len(denied) == 0 {
+		return nil, ErrOAuthRequestNotFound
+	}
+
+	return &denied[0], nil
+}
+
+func (r *oauthRepository) ConsumeCode(ctx context.Context, code string) (*entity.OAuthAuthorization, error) {
+	authorization := &entity.OAuthAuthorization{}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("code_hash = ?", hashToken(r.cfg.JWT.RefreshTokenHashKey, code)).
+			First(authorization)
+
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return ErrOAuthCodeNotFound
+			}
+			return fmt.Errorf("failed to get oauth authorization code: %w", result.Error)
+		}
+
+		if authorization.UsedAt != nil {
+			return ErrOAuthCodeReused
+		}
+		if !authorization.ExpiresAt.After(time.Now()) {
+			return ErrOAuthCodeNotFound
+		}
+
+		if err := tx.Model(authorization).Update("used_at", time.Now()).Error; err != nil {
+			return fmt.Errorf("failed to consume oauth authorization code: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		if errors.Is(err, ErrOAuthCodeReused) {
+			return authorization, err
+		}
+		return nil, err
+	}
+
+	return authorization, nil
+}
+
+func (r *oauthRepository) SetAuthorizationSession(ctx context.Context, id int, sessionID string) error {
+	err := r.db.WithContext(ctx).
+		Model(&entity.OAuthAuthorization{}).
+		Where("id = ?", id).
+		Update("session_id", sessionID).Error
+
+	if err != nil {
+		return fmt.Errorf("failed to set oauth authorization session: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,116 @@
+package repository
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrIdentityNotFound  = errors.New("identity not found")
+	ErrIdentityExists    = errors.New("identity already linked")
+	ErrOIDCStateNotFound = errors.New("oidc state not found")
+)
+
+type OIDCRepository interface {
+	GetIdentity(ctx context.Context, provider, subject string) (*entity.Identity, error)
+	CreateIdentity(ctx context.Context, identity *entity.Identity) error
+	// TouchIdentity records a login and the email the provider reported with it.
+	TouchIdentity(ctx context.Context, id int, email string) error
+
+	SaveState(ctx context.Context, state string, oidcState *entity.OIDCState) error
+	// ConsumeState removes an unexpired state of the provider and returns it, so every
+	// authorization response can be redeemed only once.
+	ConsumeState(ctx context.Context, state, provider string) (*entity.OIDCState, error)
+}
+
+type oidcRepository struct {
+	db  *gorm.DB
+	cfg config.Config
+}
+
+func NewOIDCRepository(db *gorm.DB, cfg config.Config) OIDCRepository {
+	return &oidcRepository{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+func (r *oidcRepository) GetIdentity(ctx context.Context, provider, subject string) (*entity.Identity, error) {
+	var identity entity.Identity
+
+	err := r.db.WithContext(ctx).Where("provider = ? AND subject = ?", provider, subject).First(&identity).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrIdentityNotFound
+		}
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+
+	return &identity, nil
+}
+
+func (r *oidcRepository) CreateIdentity(ctx context.Context, identity *entity.Identity) error {
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "provider"}, {Name: "subject"}}, DoNothing: true}).
+		Create(identity)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to create identity: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrIdentityExists
+	}
+
+	return nil
+}
+
+func (r *oidcRepository) TouchIdentity(ctx context.Context, id int, email string) error {
+	err := r.db.WithContext(ctx).
+		Model(&entity.Identity{}).
+		Where("id = ?", id).
+		Updates(map[string]any{
+			"email":         email,
+			"last_login_at": time.Now(),
+		}).Error
+
+	if err != nil {
+		return fmt.Errorf("failed to touch identity: %w", err)
+	}
+
+	return nil
+}
+
+func (r *oidcRepository) SaveState(ctx context.Context, state string, oidcState *entity.OIDCState) error {
+	oidcState.StateHash = hashToken(r.cfg.JWT.RefreshTokenHashKey, state)
+
+	if err := r.db.WithContext(ctx).Create(oidcState).Error; err != nil {
+		return fmt.Errorf("failed to save oidc state: %w", err)
+	}
+
+	return nil
+}
+
+func (r *oidcRepository) ConsumeState(ctx context.Context, state, provider string) (*entity.OIDCState, error) {
+	var consumed []entity.OIDCState
+
+	result := r.db.WithContext(ctx).
+		Clauses(clause.Returning{}).
+		Where("state_hash = ? AND provider = ? AND expires_at > ?", hashToken(r.cfg.JWT.RefreshTokenHashKey, state), provider, time.Now()).
+		Delete(&consumed)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to consume oidc state: %w", result.Error)
+	}
+	if len(consumed) == 0 {
+		return nil, ErrOIDCStateNotFound
+	}
+
+	return &consumed[0], nil
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var ErrPasswordResetTokenNotFound = errors.New("password reset token not found")
+
+type PasswordResetRepository interface {
+	// CreateResetToken stores a new reset token for the user and invalidates the ones issued before.
+	CreateResetToken(ctx context.Context, userID, token string, ttl time.Duration) error
+	// FindResetToken returns the user id of an unused, unexpired token without using it up.
+	FindResetToken(ctx context.Context, token string) (string, error)
+	// ConsumeResetToken marks an unused, unexpired token as used and returns its user id.
+	ConsumeResetToken(ctx context.Context, token string) (string, error)
+}
+
+type passwordResetRepository struct {
+	db  *gorm.DB
+	cfg config.Config
+}
+
+func NewPasswordResetRepository(db *gorm.DB, cfg config.Config) PasswordResetRepository {
+	return &passwordResetRepository{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+func (r *passwordResetRepository) CreateResetToken(ctx context.Context, userID, token string, ttl time.Duration) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&entity.PasswordResetToken{}).
+			Where("user_id = ? AND used_at IS NULL", userID).
+			Update("used_at", time.Now()).Error
+		if err != nil {
+			return fmt.Errorf("failed to invalidate password reset tokens: %w", err)
+		}
+
+		resetToken := entity.PasswordResetToken{
+			UserID:    userID,
+			TokenHash: hashToken(r.cfg.JWT.RefreshTokenHashKey, token),
+			ExpiresAt: time.Now().Add(ttl),
+		}
+		if err := tx.Create(&resetToken).Error; err != nil {
+			return fmt.Errorf("failed to save password reset token: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (r *passwordResetRepository) FindResetToken(ctx context.Context, token string) (string, error) {
+	var resetToken entity.PasswordResetToken
+
+	err := r.db.WithContext(ctx).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(r.cfg.JWT.RefreshTokenHashKey, token), time.Now()).
+		First(&resetToken).Error
+
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return "", ErrPasswordResetTokenNotFound
+		}
+		return "", fmt.Errorf("failed to find password reset token: %w", err)
+	}
+
+	return resetToken.UserID, nil
+}
+
+func (r *passwordResetRepository) ConsumeResetToken(ctx context.Context, token string) (string, error) {
+	var consumed []entity.PasswordResetToken
+
+	// a single conditional update, so a token can not be used twice by concurrent requests
+	result := r.db.WithContext(ctx).
+		Model(&consumed).
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "user_id"}}}).
+		Where("token_hash = ? AND used_at IS NULL AND expires_at > ?", hashToken(r.cfg.JWT.RefreshTokenHashKey, token), time.Now()).
+		Update("used_at", time.Now())
+
+	if result.Error != nil {
+		return "", fmt.Errorf("failed to consume password reset token: %w", result.Error)
+	}
+	if len(consumed) == 0 {
+		return "", ErrPasswordResetTokenNotFound
+	}
+
+	return consumed[0].UserID, nil
+}
@@ -0,0 +1,90 @@
+package repository
+
+import (
+	"auth-service/internal/entity"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+var ErrServiceAccountNotFound = errors.New("service account not found")
+
+type ServiceAccountRepository interface {
+	ListServiceAccounts(ctx context.Context) ([]*entity.ServiceAccount, error)
+	GetServiceAccount(ctx context.Context, id string) (*entity.ServiceAccount, error)
+	CreateServiceAccount(ctx context.Context, account *entity.ServiceAccount) error
+	DeleteServiceAccount(ctx context.Context, id string) error
+	// TouchServiceAccount records that a token was issued to the account.
+	TouchServiceAccount(ctx context.Context, id string) error
+}
+
+type serviceAccountRepository struct {
+	db *gorm.DB
+}
+
+func NewServiceAccountRepository(db *gorm.DB) ServiceAccountRepository {
+	return &serviceAccountRepository{
+		db: db,
+	}
+}
+
+func (r *serviceAccountRepository) ListServiceAccounts(ctx context.Context) ([]*entity.ServiceAccount, error) {
+	accounts := []*entity.ServiceAccount{}
+
+	if err := r.db.WithContext(ctx).Order("created_at").Find(&accounts).Error; err != nil {
+		return nil, fmt.Errorf("failed to list service accounts: %w", err)
+	}
+
+	return accounts, nil
+}
+
+func (r *serviceAccountRepository) GetServiceAccount(ctx context.Context, id string) (*entity.ServiceAccount, error) {
+	var account entity.ServiceAccount
+
+	err := r.db.WithContext(ctx).Where("id = ?", id).First(&account).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrServiceAccountNotFound
+		}
+		return nil, fmt.Errorf("failed to get service account: %w", err)
+	}
+
+	return &account, nil
+}
+
+func (r *serviceAccountRepository) CreateServiceAccount(ctx context.Context, account *entity.ServiceAccount) error {
+	if err := r.db.WithContext(ctx).Create(account).Error; err != nil {
+		return fmt.Errorf("failed to create service account: %w", err)
+	}
+
+	return nil
+}
+
+func (r *serviceAccountRepository) DeleteServiceAccount(ctx context.Context, id string) error {
+	result := r.db.WithContext(ctx).Where("id = ?", id).Delete(&entity.ServiceAccount{})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete service account: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrServiceAccountNotFound
+	}
+
+	return nil
+}
+
+func (r *serviceAccountRepository) TouchServiceAccount(ctx context.Context, id string) error {
+	err := r.db.WithContext(ctx).
+		Model(&entity.ServiceAccount{}).
+		Where("id = ?", id).
+		Update("last_used_at", time.Now()).Error
+
+	if err != nil {
+		return fmt.Errorf("failed to touch service account: %w", err)
+	}
+
+	return nil
+}
@@ -4,16 +4,37 @@ import (
 	"auth-service/internal/config"
 	"auth-service/internal/entity"
 	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"time"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrSessionNotFound      = errors.New("session not found")
+	ErrRefreshTokenNotFound = errors.New("refresh token not found")
+	ErrRefreshTokenReused   = errors.New("refresh token already used")
 )
 
 type TokenRepository interface {
-	SaveRefreshToken(ctx context.Context, userID string, refreshToken string) error
-	RemoveRefreshToken(ctx context.Context, refreshToken string) error
-	IsRefreshTokenExists(ctx context.Context, refreshToken string) (bool, error)
+	SaveRefreshToken(ctx context.Context, sessionID, userID, refreshToken string, parentID *int) error
+	ConsumeRefreshToken(ctx context.Context, refreshToken string) (*entity.RefreshToken, error)
+	RevokeTokenFamily(ctx context.Context, sessionID string) error
+
+	CreateSession(ctx context.Context, session *entity.Session) error
+	GetSessionByRefreshToken(ctx context.Context, refreshToken string) (*entity.Session, error)
+	GetSession(ctx context.Context, sessionID string) (*entity.Session, error)
+	ListSessions(ctx context.Context, userID string) ([]*entity.Session, error)
+	TouchSession(ctx context.Context, sessionID string) error
+	RevokeSession(ctx context.Context, userID, sessionID string) error
+	// RevokeAllSessions revokes every live session of the user and returns their ids.
+	RevokeAllSessions(ctx context.Context, userID string) ([]string, error)
 }
 
 type tokenRepository struct {
@@ -28,10 +49,24 @@ func NewTokenRepository(db *gorm.DB, cfg config.Config) TokenRepository {
 	}
 }
 
-func (r *tokenRepository) SaveRefreshToken(ctx context.Context, userID string, refreshToken string) error {
+func (r *tokenRepository) hashToken(refreshToken string) string {
+	return hashToken(r.cfg.JWT.RefreshTokenHashKey, refreshToken)
+}
+
+// hashToken returns the keyed hash under which a token is stored and looked up,
+// so a leaked table does not contain usable credentials.
+func hashToken(key, token string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (r *tokenRepository) SaveRefreshToken(ctx context.Context, sessionID, userID, refreshToken string, parentID *int) error {
 	token := entity.RefreshToken{
+		SessionID: sessionID,
+		ParentID:  parentID,
 		UserID:    userID,
-		Token:     refreshToken,
+		TokenHash: r.hashToken(refreshToken),
 		ExpiresAt: time.Now().Add(r.cfg.JWT.JWTRefreshTokenExp),
 	}
 
@@ -43,22 +78,198 @@ func (r *tokenRepository) SaveRefreshToken(ctx context.Context, userID string, r
 	return nil
 }
 
-func (r *tokenRepository) RemoveRefreshToken(ctx context.Context, refreshToken string) error {
-	result := r.db.WithContext(ctx).Where("token = ?", refreshToken).Delete(&entity.RefreshToken{})
+// ConsumeRefreshToken marks the token as used and returns it.
+// If the token was already used, the stored row is returned together with ErrRefreshTokenReused.
+func (r *tokenRepository) ConsumeRefreshToken(ctx context.Context, refreshToken string) (*entity.RefreshToken, error) {
+	token := &entity.RefreshToken{}
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", r.hashToken(refreshToken)).
+			First(token)
+
+		if result.Error != nil {
+			if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+				return ErrRefreshTokenNotFound
+			}
+			return fmt.Errorf("failed to get refresh token: %w", result.Error)
+		}
+
+		if token.UsedAt != nil {
+			return ErrRefreshTokenReused
+		}
+
+		now := time.Now()
+		if err := tx.Model(token).Update("used_at", now).Error; err != nil {
+			return fmt.Errorf("failed to consume refresh token: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenReused) {
+			return token, err
+		}
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// RevokeTokenFamily revokes the session and every refresh token of its lineage.
+func (r *tokenRepository) RevokeTokenFamily(ctx context.Context, sessionID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&entity.Session{}).
+			Where("id = ? AND revoked_at IS NULL", sessionID).
+			Update("revoked_at", time.Now())
+
+		if result.Error != nil {
+			return fmt.Errorf("failed to revoke session: %w", result.Error)
+		}
+
+		if err := tx.Where("session_id = ?", sessionID).Delete(&entity.RefreshToken{}).Error; err != nil {
+			return fmt.Errorf("failed to remove session refresh tokens: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (r *tokenRepository) CreateSession(ctx context.Context, session *entity.Session) error {
+	now := time.Now()
+
+	if session.ID == "" {
+		session.ID = uuid.NewString()
+	}
+	session.LastUsedAt = now
+	session.ExpiresAt = now.Add(r.cfg.JWT.JWTRefreshTokenExp)
+
+	result := r.db.WithContext(ctx).Create(session)
 	if result.Error != nil {
-		return fmt.Errorf("failed to remove refresh token: %w", result.Error)
+		return fmt.Errorf("failed to create session: %w", result.Error)
 	}
 
 	return nil
 }
 
-func (r *tokenRepository) IsRefreshTokenExists(ctx context.Context, refreshToken string) (bool, error) {
-	var count int64
-	result := r.db.WithContext(ctx).Model(&entity.RefreshToken{}).Where("token = ?", refreshToken).Count(&count)
+// GetSessionByRefreshToken returns the live session the given unused refresh token belongs to.
+func (r *tokenRepository) GetSessionByRefreshToken(ctx context.Context, refreshToken string) (*entity.Session, error) {
+	session := &entity.Session{}
+	result := r.db.WithContext(ctx).
+		Joins("JOIN refresh_tokens ON refresh_tokens.session_id = sessions.id").
+		Where("refresh_tokens.token_hash = ? AND refresh_tokens.used_at IS NULL", r.hashToken(refreshToken)).
+		Where("sessions.revoked_at IS NULL AND sessions.expires_at > ?", time.Now()).
+		First(session)
 
 	if result.Error != nil {
-		return false, fmt.Errorf("failed to check refresh token existence: %w", result.Error)
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to get session by refresh token: %w", result.Error)
+	}
+
+	return session, nil
+}
+
+// GetSession returns the session if it is neither revoked nor expired.
+func (r *tokenRepository) GetSession(ctx context.Context, sessionID string) (*entity.Session, error) {
+	session := &entity.Session{}
+	result := r.db.WithContext(ctx).
+		Where("id = ? AND revoked_at IS NULL AND expires_at > ?", sessionID, time.Now()).
+		First(session)
+
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, fmt.Errorf("failed to get session: %w", result.Error)
+	}
+
+	return session, nil
+}
+
+func (r *tokenRepository) ListSessions(ctx context.Context, userID string) ([]*entity.Session, error) {
+	sessions := []*entity.Session{}
+	result := r.db.WithContext(ctx).
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_used_at DESC").
+		Find(&sessions)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", result.Error)
+	}
+
+	return sessions, nil
+}
+
+// TouchSession marks the session as used now and extends it by the refresh token lifetime.
+func (r *tokenRepository) TouchSession(ctx context.Context, sessionID string) error {
+	now := time.Now()
+	result := r.db.WithContext(ctx).
+		Model(&entity.Session{}).
+		Where("id = ?", sessionID).
+		Updates(map[string]any{
+			"last_used_at": now,
+			"expires_at":   now.Add(r.cfg.JWT.JWTRefreshTokenExp),
+		})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to touch session: %w", result.Error)
+	}
+
+	return nil
+}
+
+func (r *tokenRepository) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&entity.Session{}).
+			Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+			Update("revoked_at", time.Now())
+
+		if result.Error != nil {
+			return fmt.Errorf("failed to revoke session: %w", result.Error)
+		}
+		if result.RowsAffected == 0 {
+			return ErrSessionNotFound
+		}
+
+		if err := tx.Where("session_id = ?", sessionID).Delete(&entity.RefreshToken{}).Error; err != nil {
+			return fmt.Errorf("failed to remove session refresh tokens: %w", err)
+		}
+
+		return nil
+	})
+}
+
+func (r *tokenRepository) RevokeAllSessions(ctx context.Context, userID string) ([]string, error) {
+	var sessionIDs []string
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var sessions []entity.Session
+		result := tx.Model(&sessions).
+			Clauses(clause.Returning{Columns: []clause.Column{{Name: "id"}}}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", time.Now())
+
+		if result.Error != nil {
+			return fmt.Errorf("failed to revoke sessions: %w", result.Error)
+		}
+
+		for _, s := range sessions {
+			sessionIDs = append(sessionIDs, s.ID)
+		}
+
+		if err := tx.Where("user_id = ?", userID).Delete(&entity.RefreshToken{}).Error; err != nil {
+			return fmt.Errorf("failed to remove refresh tokens: %w", err)
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return nil, err
 	}
 
-	return count > 0, nil
+	return sessionIDs, nil
 }
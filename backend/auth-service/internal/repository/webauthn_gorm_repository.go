@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrWebAuthnCredentialNotFound = errors.New("webauthn credential not found")
+	ErrWebAuthnCredentialExists   = errors.New("webauthn credential already registered")
+	ErrWebAuthnCeremonyNotFound   = errors.New("webauthn ceremony not found")
+)
+
+type WebAuthnRepository interface {
+	ListCredentials(ctx context.Context, userID string) ([]entity.WebAuthnCredential, error)
+	CreateCredential(ctx context.Context, credential *entity.WebAuthnCredential) error
+	// UpdateSignCount stores the counter of a successful assertion. It reports false if another
+	// assertion already moved the counter to this value or past it.
+	UpdateSignCount(ctx context.Context, id int, signCount uint32, backupState bool) (bool, error)
+	DeleteCredential(ctx context.Context, userID string, id int) error
+
+	SaveCeremony(ctx context.Context, token string, ceremony *entity.WebAuthnCeremony) error
+	// ConsumeCeremony removes an unexpired ceremony of the purpose and returns it, so every
+	// challenge can be answered only once.
+	ConsumeCeremony(ctx context.Context, token, purpose string) (*entity.WebAuthnCeremony, error)
+}
+
+type webAuthnRepository struct {
+	db  *gorm.DB
+	cfg config.Config
+}
+
+func NewWebAuthnRepository(db *gorm.DB, cfg config.Config) WebAuthnRepository {
+	return &webAuthnRepository{
+		db:  db,
+		cfg: cfg,
+	}
+}
+
+func (r *webAuthnRepository) ListCredentials(ctx context.Context, userID string) ([]entity.WebAuthnCredential, error) {
+	var credentials []entity.WebAuthnCredential
+
+	err := r.db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&credentials).Error
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webauthn credentials: %w", err)
+	}
+
+	return credentials, nil
+}
+
+func (r *webAuthnRepository) CreateCredential(ctx context.Context, credential *entity.WebAuthnCredential) error {
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{Columns: []clause.Column{{Name: "credential_id"}}, DoNothing: true}).
+		Create(credential)
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to create webauthn credential: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrWebAuthnCredentialExists
+	}
+
+	return nil
+}
+
+func (r *webAuthnRepository) UpdateSignCount(ctx context.Context, id int, signCount uint32, backupState bool) (bool, error) {
+	// authenticators that do not implement the counter always report 0
+	result := r.db.WithContext(ctx).
+		Model(&entity.WebAuthnCredential{}).
+		Where("id = ? AND (sign_count < ? OR (sign_count = 0 AND ? = 0))", id, signCount, signCount).
+		Updates(map[string]any{
+			"sign_count":   signCount,
+			"backup_state": backupState,
+			"last_used_at": time.Now(),
+		})
+
+	if result.Error != nil {
+		return false, fmt.Errorf("failed to update webauthn credential: %w", result.Error)
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+func (r *webAuthnRepository) DeleteCredential(ctx context.Context, userID string, id int) error {
+	result := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&entity.WebAuthnCredential{})
+
+	if result.Error != nil {
+		return fmt.Errorf("failed to delete webauthn credential: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrWebAuthnCredentialNotFound
+	}
+
+	return nil
+}
+
+func (r *webAuthnRepository) SaveCeremony(ctx context.Context, token string, ceremony *entity.WebAuthnCeremony) error {
+	ceremony.TokenHash = hashToken(r.cfg.JWT.RefreshTokenHashKey, token)
+
+	if err := r.db.WithContext(ctx).Create(ceremony).Error; err != nil {
+		return fmt.Errorf("failed to save webauthn ceremony: %w", err)
+	}
+
+	return nil
+}
+
+func (r *webAuthnRepository) ConsumeCeremony(ctx context.Context, token, purpose string) (*entity.WebAuthnCeremony, error) {
+	var consumed []entity.WebAuthnCeremony
+
+	result := r.db.WithContext(ctx).
+		Clauses(clause.Returning{}).
+		Where("token_hash = ? AND purpose = ? AND expires_at > ?", hashToken(r.cfg.JWT.RefreshTokenHashKey, token), purpose, time.Now()).
+		Delete(&consumed)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("failed to consume webauthn ceremony: %w", result.Error)
+	}
+	if len(consumed) == 0 {
+		return nil, ErrWebAuthnCeremonyNotFound
+	}
+
+	return &consumed[0], nil
+}
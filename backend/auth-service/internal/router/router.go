@@ -2,8 +2,10 @@ package router
 
 import (
 	grpcClient "auth-service/internal/client/grpc"
+	"auth-service/internal/config"
 	"auth-service/internal/handler"
 	"auth-service/internal/logger"
+	"auth-service/internal/middleware"
 	"context"
 	"net/http"
 	"time"
@@ -15,8 +17,18 @@ import (
 func SetupRoutes(
 	app *fiber.App,
 	handlers handler.AuthHandler,
+	passwordHandler handler.PasswordHandler,
+	emailVerificationHandler handler.EmailVerificationHandler,
+	mfaHandler handler.MFAHandler,
+	webAuthnHandler handler.WebAuthnHandler,
+	oauthHandler handler.OAuthHandler,
+	serviceAccountHandler handler.ServiceAccountHandler,
+	apiKeyHandler handler.APIKeyHandler,
+	keysHandler handler.KeysHandler,
+	authMiddleware fiber.Handler,
 	db *gorm.DB,
 	grpcUserClient grpcClient.UserService,
+	cfg config.Config,
 ) {
 	app.Get("/health", func(c *fiber.Ctx) error {
 		logger.Log.Info().Msg("Health check passed")
@@ -52,6 +64,25 @@ func SetupRoutes(
 		return c.Redirect("/swagger/index.html")
 	})
 
+	app.Get("/.well-known/jwks.json", keysHandler.JWKS)
+
+	// not routed by the gateway, reachable from the internal network only
+	app.Get("/internal/keys", middleware.APIKey("X-Internal-Key", cfg.InternalAPIKey), keysHandler.InternalJWKS)
+	app.Post("/internal/api-keys/verify", middleware.APIKey("X-Internal-Key", cfg.InternalAPIKey), apiKeyHandler.VerifyAPIKey)
+
+	admin := app.Group("/admin", middleware.APIKey("X-Admin-Key", cfg.AdminAPIKey))
+	admin.Get("/keys", keysHandler.ListKeys)
+	admin.Post("/keys", keysHandler.CreateKey)
+	admin.Patch("/keys/:purpose/:kid", keysHandler.UpdateKey)
+	admin.Delete("/users/:id/sessions", handlers.RevokeUserSessions)
+	admin.Post("/users/:id/unlock", handlers.UnlockUser)
+	admin.Get("/oauth/clients", oauthHandler.ListClients)
+	admin.Post("/oauth/clients", oauthHandler.CreateClient)
+	admin.Delete("/oauth/clients/:id", oauthHandler.DeleteClient)
+	admin.Get("/service-accounts", serviceAccountHandler.ListServiceAccounts)
+	admin.Post("/service-accounts", serviceAccountHandler.CreateServiceAccount)
+	admin.Delete("/service-accounts/:id", serviceAccountHandler.DeleteServiceAccount)
+
 	api := app.Group("/api")
 	auth := api.Group("/auth")
 
@@ -59,4 +90,62 @@ func SetupRoutes(
 	auth.Post("/login", handlers.Login)
 	auth.Get("/refresh", handlers.Refresh)
 	auth.Post("/logout", handlers.Logout)
+	// client credentials grant for service accounts
+	auth.Post("/token", serviceAccountHandler.Token)
+
+	password := auth.Group("/password")
+	password.Post("/change", authMiddleware, passwordHandler.ChangePassword)
+	password.Post("/forgot", passwordHandler.ForgotPassword)
+	password.Post("/reset", passwordHandler.ResetPassword)
+
+	email := auth.Group("/email")
+	email.Post("/verify", emailVerificationHandler.Verify)
+	email.Post("/resend", emailVerificationHandler.Resend)
+	email.Post("/change", authMiddleware, emailVerificationHandler.ChangeEmail)
+	// passwordless login with a link or a code sent by email
+	email.Post("/login", handlers.RequestEmailLogin)
+	email.Post("/login/verify", handlers.VerifyEmailLogin)
+
+	mfa := auth.Group("/mfa")
+	mfa.Post("/verify", handlers.VerifyMFA)
+	mfa.Post("/webauthn/begin", handlers.BeginMFAWebAuthn)
+	mfa.Post("/webauthn/verify", handlers.VerifyMFAWebAuthn)
+	mfa.Post("/totp/enroll", authMiddleware, mfaHandler.EnrollTOTP)
+	mfa.Post("/totp/confirm", authMiddleware, mfaHandler.ConfirmTOTP)
+	mfa.Post("/totp/disable", authMiddleware, mfaHandler.DisableTOTP)
+
+	passkeys := auth.Group("/passkeys")
+	passkeys.Post("/login/begin", handlers.BeginPasskeyLogin)
+	passkeys.Post("/login/finish", handlers.FinishPasskeyLogin)
+	passkeys.Post("/register/begin", authMiddleware, webAuthnHandler.BeginRegistration)
+	passkeys.Post("/register/finish", authMiddleware, webAuthnHandler.FinishRegistration)
+	passkeys.Get("/", authMiddleware, webAuthnHandler.ListCredentials)
+	passkeys.Delete("/:id", authMiddleware, webAuthnHandler.DeleteCredential)
+
+	oidc := auth.Group("/oidc")
+	oidc.Get("/providers", handlers.OIDCProviders)
+	oidc.Get("/:provider/login", handlers.BeginOIDCLogin)
+	oidc.Get("/:provider/callback", handlers.OIDCCallback)
+
+	// auth-service as an OpenID Connect provider for other apps, the issuer is /api/auth
+	auth.Get("/.well-known/openid-configuration", oauthHandler.Discovery)
+	oauth2 := auth.Group("/oauth2")
+	oauth2.Get("/jwks", oauthHandler.JWKS)
+	oauth2.Get("/authorize", oauthHandler.Authorize)
+	oauth2.Post("/token", oauthHandler.Token)
+	oauth2.Get("/userinfo", oauthHandler.UserInfo)
+	oauth2.Post("/userinfo", oauthHandler.UserInfo)
+	oauth2.Get("/requests/:id", authMiddleware, oauthHandler.GetConsent)
+	oauth2.Post("/requests/:id/approve", authMiddleware, oauthHandler.Approve)
+	oauth2.Post("/requests/:id/deny", authMiddleware, oauthHandler.Deny)
+
+	apiKeys := auth.Group("/api-keys", authMiddleware)
+	apiKeys.Get("/", apiKeyHandler.ListAPIKeys)
+	apiKeys.Post("/", apiKeyHandler.CreateAPIKey)
+	apiKeys.Patch("/:id", apiKeyHandler.UpdateAPIKey)
+	apiKeys.Delete("/:id", apiKeyHandler.DeleteAPIKey)
+
+	sessions := auth.Group("/sessions", authMiddleware)
+	sessions.Get("/", handlers.ListSessions)
+	sessions.Delete("/:id", handlers.RevokeSession)
 }
@@ -0,0 +1,258 @@
+package service
+
+import (
+	"auth-service/internal/apperror"
+	"auth-service/internal/cache"
+	grpcClient "auth-service/internal/client/grpc"
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"auth-service/internal/logger"
+	"auth-service/internal/repository"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// apiKeyMarker starts every API key, so leaked keys are easy to recognize. A key is
+// ak_<prefix>.<secret>.
+const apiKeyMarker = "ak_"
+
+// apiKeyRevocationTTL keeps a revoked key on the revocation list for longer than the gateway
+// caches a verified key.
+const apiKeyRevocationTTL = 10 * time.Minute
+
+// APIKeyRequest describes a key to create. A zero RateLimit takes the configured default and a
+// nil ExpiresAt never expires.
+type APIKeyRequest struct {
+	Name      string
+	Scopes    []string
+	RateLimit int
+	ExpiresAt *time.Time
+}
+
+// APIKeyPrincipal is who a verified key acts for. Permissions are the scopes of the key the
+// user still has.
+type APIKeyPrincipal struct {
+	KeyID       string
+	UserID      string
+	Roles       []string
+	Permissions []string
+	RateLimit   int
+	ExpiresAt   *time.Time
+}
+
+// APIKeyService manages the personal API keys of users, which the gateway accepts in place of
+// an access token. A key can only be scoped to permissions its user has.
+type APIKeyService interface {
+	ListAPIKeys(ctx context.Context, userID string) ([]*entity.APIKey, error)
+	// CreateAPIKey returns the new key, which is not stored and can not be shown again.
+	CreateAPIKey(ctx context.Context, userID string, req APIKeyRequest) (*entity.APIKey, string, error)
+	RenameAPIKey(ctx context.Context, userID, id, name string) (*entity.APIKey, error)
+	RevokeAPIKey(ctx context.Context, userID, id string) error
+	// VerifyAPIKey is called by the gateway for each key it has not seen recently.
+	VerifyAPIKey(ctx context.Context, key string) (*APIKeyPrincipal, error)
+}
+
+type apiKeyService struct {
+	grpcUserClient grpcClient.UserService
+	repo           repository.APIKeyRepository
+	redisCache     cache.RedisCache
+	cfg            config.Config
+}
+
+func NewAPIKeyService(grpcUserClient grpcClient.UserService, repo repository.APIKeyRepository, redisCache cache.RedisCache, cfg config.Config) APIKeyService {
+	return &apiKeyService{
+		grpcUserClient: grpcUserClient,
+		repo:           repo,
+		redisCache:     redisCache,
+		cfg:            cfg,
+	}
+}
+
+func (s *apiKeyService) ListAPIKeys(ctx context.Context, userID string) ([]*entity.APIKey, error) {
+	keys, err := s.repo.ListAPIKeys(ctx, userID)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error listing api keys")
+		return nil, apperror.Internal(err)
+	}
+
+	return keys, nil
+}
+
+func (s *apiKeyService) CreateAPIKey(ctx context.Context, userID string, req APIKeyRequest) (*entity.APIKey, string, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, "", apperror.BadRequest("name is required")
+	}
+
+	rateLimit := req.RateLimit
+	if rateLimit == 0 {
+		rateLimit = s.cfg.APIKey.APIKeyRateLimit
+	}
+	if rateLimit < 0 || rateLimit > s.cfg.APIKey.APIKeyMaxRateLimit {
+		return nil, "", apperror.BadRequest(fmt.Sprintf("rate limit must be between 1 and %d requests per minute", s.cfg.APIKey.APIKeyMaxRateLimit))
+	}
+
+	if req.ExpiresAt != nil && !req.ExpiresAt.After(time.Now()) {
+		return nil, "", apperror.BadRequest("expiry must be in the future")
+	}
+
+	userResp, err := s.grpcUserClient.GetUserByID(ctx, userID)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error gRPC get user by ID")
+		return nil, "", apperror.FromGRPC(err)
+	}
+	user := userResp.User
+	if !user.EmailVerified {
+		return nil, "", apperror.Forbidden("email not verified")
+	}
+
+	scopes := slices.Compact(slices.Sorted(slices.Values(req.Scopes)))
+	for _, scope := range scopes {
+		if !slices.Contains(user.Permissions, scope) {
+			return nil, "", apperror.Forbidden("the permission " + scope + " is not granted to you")
+		}
+	}
+
+	prefixBytes := make([]byte, 6)
+	if _, err := rand.Read(prefixBytes); err != nil {
+		logger.Log.Error().Err(err).Msg("error generating api key prefix")
+		return nil, "", apperror.Internal(err)
+	}
+	prefix := hex.EncodeToString(prefixBytes)
+
+	secret, err := newResetToken()
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error generating api key")
+		return nil, "", apperror.Internal(err)
+	}
+
+	key := &entity.APIKey{
+		ID:        uuid.NewString(),
+		UserID:    userID,
+		Name:      name,
+		Prefix:    prefix,
+		Scopes:    strings.Join(scopes, " "),
+		RateLimit: rateLimit,
+		ExpiresAt: req.ExpiresAt,
+	}
+	if err := s.repo.CreateAPIKey(ctx, key, secret); err != nil {
+		logger.Log.Error().Err(err).Msg("error creating api key")
+		return nil, "", apperror.Internal(err)
+	}
+
+	logger.Log.Info().
+		Str("event", "api_key_created").
+		Str("user_id", userID).
+		Str("key_id", key.ID).
+		Str("scopes", key.Scopes).
+		Msg("security event: api key created")
+
+	return key, apiKeyMarker + prefix + "." + secret, nil
+}
+
+func (s *apiKeyService) RenameAPIKey(ctx context.Context, userID, id, name string) (*entity.APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, apperror.BadRequest("name is required")
+	}
+
+	key, err := s.repo.RenameAPIKey(ctx, userID, id, name)
+	if err != nil {
+		if errors.Is(err, repository.ErrAPIKeyNotFound) {
+			return nil, apperror.NotFound("api key not found")
+		}
+		logger.Log.Error().Err(err).Msg("error renaming api key")
+		return nil, apperror.Internal(err)
+	}
+
+	return key, nil
+}
+
+// RevokeAPIKey deletes the key and puts it on the revocation list, so the gateway stops
+// accepting it right away instead of when its cached verification runs out.
+func (s *apiKeyService) RevokeAPIKey(ctx context.Context, userID, id string) error {
+	if err := s.repo.DeleteAPIKey(ctx, userID, id); err != nil {
+		if errors.Is(err, repository.ErrAPIKeyNotFound) {
+			return apperror.NotFound("api key not found")
+		}
+		logger.Log.Error().Err(err).Msg("error deleting api key")
+		return apperror.Internal(err)
+	}
+
+	if err := s.redisCache.RevokeToken(ctx, id, apiKeyRevocationTTL); err != nil {
+		logger.Log.Error().Err(err).Msg("error revoking api key")
+	}
+
+	logger.Log.Info().
+		Str("event", "api_key_revoked").
+		Str("user_id", userID).
+		Str("key_id", id).
+		Msg("security event: api key revoked")
+
+	return nil
+}
+
+func (s *apiKeyService) VerifyAPIKey(ctx context.Context, rawKey string) (*APIKeyPrincipal, error) {
+	prefix, secret, ok := strings.Cut(strings.TrimPrefix(rawKey, apiKeyMarker), ".")
+	if !strings.HasPrefix(rawKey, apiKeyMarker) || !ok || prefix == "" || secret == "" {
+		return nil, apperror.Unauthorized("invalid api key")
+	}
+
+	key, err := s.repo.FindAPIKey(ctx, prefix, secret)
+	if err != nil {
+		if errors.Is(err, repository.ErrAPIKeyNotFound) {
+			logger.Log.Warn().
+				Str("event", "api_key_rejected").
+				Str("prefix", prefix).
+				Msg("security event: unknown api key")
+			return nil, apperror.Unauthorized("invalid api key")
+		}
+		logger.Log.Error().Err(err).Msg("error finding api key")
+		return nil, apperror.Internal(err)
+	}
+
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(time.Now()) {
+		return nil, apperror.Unauthorized("api key expired")
+	}
+
+	userResp, err := s.grpcUserClient.GetUserByID(ctx, key.UserID)
+	if err != nil {
+		if st, ok := status.FromError(err); ok && st.Code() == codes.NotFound {
+			return nil, apperror.Unauthorized("invalid api key")
+		}
+		logger.Log.Error().Err(err).Msg("error gRPC get user by ID")
+		return nil, apperror.FromGRPC(err)
+	}
+	user := userResp.User
+
+	// the user may have lost a permission since the key was created
+	permissions := []string{}
+	for _, scope := range strings.Fields(key.Scopes) {
+		if slices.Contains(user.Permissions, scope) {
+			permissions = append(permissions, scope)
+		}
+	}
+
+	if err := s.repo.TouchAPIKey(ctx, key.ID); err != nil {
+		logger.Log.Error().Err(err).Msg("error touching api key")
+	}
+
+	return &APIKeyPrincipal{
+		KeyID:       key.ID,
+		UserID:      key.UserID,
+		Roles:       user.Roles,
+		Permissions: permissions,
+		RateLimit:   key.RateLimit,
+		ExpiresAt:   key.ExpiresAt,
+	}, nil
+}
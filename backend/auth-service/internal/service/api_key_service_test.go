@@ -0,0 +1,243 @@
+package service
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"auth-service/internal/repository"
+	"context"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeAPIKeyRepository keeps keys in memory with the raw secret in place of its hash.
+type fakeAPIKeyRepository struct {
+	mu   sync.Mutex
+	keys map[string]*entity.APIKey
+}
+
+func newFakeAPIKeyRepository() *fakeAPIKeyRepository {
+	return &fakeAPIKeyRepository{keys: map[string]*entity.APIKey{}}
+}
+
+func (r *fakeAPIKeyRepository) ListAPIKeys(_ context.Context, userID string) ([]*entity.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := []*entity.APIKey{}
+	for _, key := range r.keys {
+		if key.UserID == userID {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+func (r *fakeAPIKeyRepository) CreateAPIKey(_ context.Context, key *entity.APIKey, secret string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key.KeyHash = secret
+	key.CreatedAt = time.Now()
+	copied := *key
+	r.keys[key.ID] = &copied
+	return nil
+}
+
+func (r *fakeAPIKeyRepository) FindAPIKey(_ context.Context, prefix, secret string) (*entity.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, key := range r.keys {
+		if key.Prefix == prefix && key.KeyHash == secret {
+			copied := *key
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrAPIKeyNotFound
+}
+
+func (r *fakeAPIKeyRepository) RenameAPIKey(_ context.Context, userID, id, name string) (*entity.APIKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok || key.UserID != userID {
+		return nil, repository.ErrAPIKeyNotFound
+	}
+	key.Name = name
+	copied := *key
+	return &copied, nil
+}
+
+func (r *fakeAPIKeyRepository) DeleteAPIKey(_ context.Context, userID, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key, ok := r.keys[id]
+	if !ok || key.UserID != userID {
+		return repository.ErrAPIKeyNotFound
+	}
+	delete(r.keys, id)
+	return nil
+}
+
+func (r *fakeAPIKeyRepository) TouchAPIKey(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if key, ok := r.keys[id]; ok {
+		now := time.Now()
+		key.LastUsedAt = &now
+	}
+	return nil
+}
+
+func newTestAPIKeyService(t *testing.T) (APIKeyService, *fakeUserClient, *fakeAPIKeyRepository, *fakeRedisCache, string) {
+	t.Helper()
+
+	users := newFakeUserClient()
+	repo := newFakeAPIKeyRepository()
+	revoked := newFakeRedisCache()
+	cfg := config.Config{
+		APIKey: config.APIKeyConfig{APIKeyRateLimit: 60, APIKeyMaxRateLimit: 600},
+	}
+
+	registerTestUser(t, users, "scripts@example.com", "password")
+	resp, _ := users.GetUserByEmail(context.Background(), "scripts@example.com")
+	users.users[resp.User.Id].Permissions = []string{"users:list", "roles:assign"}
+
+	return NewAPIKeyService(users, repo, revoked, cfg), users, repo, revoked, resp.User.Id
+}
+
+func TestAPIKeyService_CreateAndVerify(t *testing.T) {
+	svc, users, repo, _, userID := newTestAPIKeyService(t)
+	ctx := context.Background()
+
+	key, rawKey, err := svc.CreateAPIKey(ctx, userID, APIKeyRequest{Name: " CI ", Scopes: []string{"users:list", "roles:assign"}})
+	if err != nil {
+		t.Fatalf("CreateAPIKey() error: %v", err)
+	}
+	if !strings.HasPrefix(rawKey, "ak_"+key.Prefix+".") || strings.Contains(key.KeyHash, rawKey) {
+		t.Fatalf("CreateAPIKey() key = %q, want ak_<prefix>.<secret> and only the secret's hash stored", rawKey)
+	}
+	if key.Name != "CI" || key.RateLimit != 60 || key.Scopes != "roles:assign users:list" {
+		t.Errorf("CreateAPIKey() = %+v, want the trimmed name, the default rate limit and sorted scopes", key)
+	}
+
+	principal, err := svc.VerifyAPIKey(ctx, rawKey)
+	if err != nil {
+		t.Fatalf("VerifyAPIKey() error: %v", err)
+	}
+	if principal.KeyID != key.ID || principal.UserID != userID || principal.RateLimit != 60 ||
+		strings.Join(principal.Permissions, " ") != "roles:assign users:list" {
+		t.Errorf("VerifyAPIKey() = %+v, want the key's user, rate limit and scopes", principal)
+	}
+	if stored, _ := repo.ListAPIKeys(ctx, userID); stored[0].LastUsedAt == nil {
+		t.Error("VerifyAPIKey() should record when the key was last used")
+	}
+
+	// a permission the user lost is no longer granted through the key
+	users.users[userID].Permissions = []string{"users:list"}
+	principal, err = svc.VerifyAPIKey(ctx, rawKey)
+	if err != nil {
+		t.Fatalf("VerifyAPIKey() error: %v", err)
+	}
+	if strings.Join(principal.Permissions, " ") != "users:list" {
+		t.Errorf("VerifyAPIKey() permissions = %v, want only the ones the user still has", principal.Permissions)
+	}
+
+	renamed, err := svc.RenameAPIKey(ctx, userID, key.ID, "Deploy")
+	if err != nil || renamed.Name != "Deploy" {
+		t.Fatalf("RenameAPIKey() = %+v, %v, want the new name", renamed, err)
+	}
+}
+
+func TestAPIKeyService_VerifyRejectsInvalidKeys(t *testing.T) {
+	svc, _, repo, _, userID := newTestAPIKeyService(t)
+	ctx := context.Background()
+
+	_, rawKey, err := svc.CreateAPIKey(ctx, userID, APIKeyRequest{Name: "CI"})
+	if err != nil {
+		t.Fatalf("CreateAPIKey() error: %v", err)
+	}
+	prefix, _, _ := strings.Cut(rawKey, ".")
+
+	for name, key := range map[string]string{
+		"empty":        "",
+		"no marker":    strings.TrimPrefix(rawKey, "ak_"),
+		"wrong secret": prefix + ".wrong",
+		"no secret":    prefix,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := svc.VerifyAPIKey(ctx, key)
+			assertUnauthorized(t, err)
+		})
+	}
+
+	expiresAt := time.Now().Add(time.Hour)
+	key, rawKey, err := svc.CreateAPIKey(ctx, userID, APIKeyRequest{Name: "Expiring", ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatalf("CreateAPIKey() error: %v", err)
+	}
+	past := time.Now().Add(-time.Minute)
+	repo.keys[key.ID].ExpiresAt = &past
+
+	_, err = svc.VerifyAPIKey(ctx, rawKey)
+	assertUnauthorized(t, err)
+}
+
+func TestAPIKeyService_CreateValidatesRequest(t *testing.T) {
+	svc, users, _, _, userID := newTestAPIKeyService(t)
+	ctx := context.Background()
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name string
+		req  APIKeyRequest
+		want int
+	}{
+		{"no name", APIKeyRequest{Name: " "}, http.StatusBadRequest},
+		{"negative rate limit", APIKeyRequest{Name: "CI", RateLimit: -1}, http.StatusBadRequest},
+		{"rate limit above the maximum", APIKeyRequest{Name: "CI", RateLimit: 601}, http.StatusBadRequest},
+		{"expired", APIKeyRequest{Name: "CI", ExpiresAt: &past}, http.StatusBadRequest},
+		{"permission the user does not have", APIKeyRequest{Name: "CI", Scopes: []string{"users:delete"}}, http.StatusForbidden},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, _, err := svc.CreateAPIKey(ctx, userID, tc.req)
+			assertAppError(t, err, tc.want)
+		})
+	}
+
+	users.users[userID].EmailVerified = false
+	_, _, err := svc.CreateAPIKey(ctx, userID, APIKeyRequest{Name: "CI"})
+	assertAppError(t, err, http.StatusForbidden)
+}
+
+func TestAPIKeyService_Revoke(t *testing.T) {
+	svc, users, _, revoked, userID := newTestAPIKeyService(t)
+	ctx := context.Background()
+
+	key, rawKey, err := svc.CreateAPIKey(ctx, userID, APIKeyRequest{Name: "CI"})
+	if err != nil {
+		t.Fatalf("CreateAPIKey() error: %v", err)
+	}
+
+	registerTestUser(t, users, "other@example.com", "password")
+	other, _ := users.GetUserByEmail(ctx, "other@example.com")
+	err = svc.RevokeAPIKey(ctx, other.User.Id, key.ID)
+	assertAppError(t, err, http.StatusNotFound)
+
+	if err := svc.RevokeAPIKey(ctx, userID, key.ID); err != nil {
+		t.Fatalf("RevokeAPIKey() error: %v", err)
+	}
+	if !revoked.tokens[key.ID] {
+		t.Error("RevokeAPIKey() should put the key on the revocation list for the gateway")
+	}
+
+	_, err = svc.VerifyAPIKey(ctx, rawKey)
+	assertUnauthorized(t, err)
+}
@@ -2,94 +2,397 @@ package service
 
 import (
 	"auth-service/internal/apperror"
+	"auth-service/internal/cache"
 	grpcClient "auth-service/internal/client/grpc"
 	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	userpb "auth-service/internal/genproto/user/v1"
 	"auth-service/internal/logger"
+	"auth-service/internal/passwordpolicy"
 	"auth-service/internal/repository"
 	"context"
+	"errors"
+	"fmt"
+	"net/mail"
+	"time"
 
-	"golang.org/x/crypto/bcrypt"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
+const (
+	maxIdempotencyKeyLength = 255
+	// rollbackTimeout bounds deleting a user whose registration failed
+	rollbackTimeout = 5 * time.Second
+)
+
 type AuthResult struct {
 	AccessToken  string
 	RefreshToken string
+	SessionID    string
 	UserID       string
 	Email        string
+	// VerificationRequired is set instead of tokens when unverified accounts can not sign in
+	VerificationRequired bool
+	// MFARequired is set instead of tokens when the password was accepted but the second factor
+	// is still missing. MFAToken is exchanged for the tokens through VerifyMFA or VerifyMFAWebAuthn,
+	// MFAMethods lists the factors the user can use.
+	MFARequired bool
+	MFAToken    string
+	MFAMethods  []string
+}
+
+// SessionMeta describes the device a session is opened from.
+type SessionMeta struct {
+	DeviceLabel string
+	UserAgent   string
+	IP          string
 }
 
 type AuthService interface {
-	Register(ctx context.Context, email, password string) (*AuthResult, error)
-	Login(ctx context.Context, email, password string) (*AuthResult, error)
+	// Register creates the account and signs the user in. A request retried with the same
+	// idempotency key signs in to the account the first one created, the user is deleted again if
+	// the sign in fails.
+	Register(ctx context.Context, email, password, idempotencyKey string, meta SessionMeta) (*AuthResult, error)
+	Login(ctx context.Context, email, password string, meta SessionMeta) (*AuthResult, error)
+	// VerifyMFA completes a login that returned MFARequired.
+	VerifyMFA(ctx context.Context, mfaToken, code string) (*AuthResult, error)
+	BeginMFAWebAuthn(ctx context.Context, mfaToken string) (*WebAuthnOptions, error)
+	// VerifyMFAWebAuthn completes a login that returned MFARequired with a passkey.
+	VerifyMFAWebAuthn(ctx context.Context, mfaToken, ceremonyID string, response []byte) (*AuthResult, error)
+	BeginPasskeyLogin(ctx context.Context) (*WebAuthnOptions, error)
+	// FinishPasskeyLogin signs in without a password. A passkey already proves possession and
+	// user verification, so no second factor is asked for.
+	FinishPasskeyLogin(ctx context.Context, ceremonyID string, response []byte, meta SessionMeta) (*AuthResult, error)
+	OIDCProviders() []string
+	BeginOIDCLogin(ctx context.Context, provider string) (*OIDCAuthorization, error)
+	// FinishOIDCLogin signs in with the identity returned by the provider. The provider stands in
+	// for the password, a second factor is still asked for if the user has one.
+	FinishOIDCLogin(ctx context.Context, provider, state, code string, meta SessionMeta) (*AuthResult, error)
+	// RequestEmailLogin mails a login link and code and returns the login id the code is entered
+	// with. It does not tell whether the account exists.
+	RequestEmailLogin(ctx context.Context, email string) (string, error)
+	// FinishEmailLoginLink and FinishEmailLoginCode sign in with a login email. The email stands
+	// in for the password, a second factor is still asked for if the user has one.
+	FinishEmailLoginLink(ctx context.Context, token string, meta SessionMeta) (*AuthResult, error)
+	FinishEmailLoginCode(ctx context.Context, loginID, code string, meta SessionMeta) (*AuthResult, error)
 	Refresh(ctx context.Context, refreshToken string) (*AuthResult, error)
-	Logout(ctx context.Context, refreshToken string) error
+	// Logout ends the session of the refresh token. The access token, if given, is revoked
+	// as well, which also ends its session when there is no refresh token.
+	Logout(ctx context.Context, refreshToken, accessToken string) error
+
+	ListSessions(ctx context.Context, userID string) ([]*entity.Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID string) error
+	RevokeAllSessions(ctx context.Context, userID string) error
+	// UnlockLogin lifts the lockout after failed logins, for admins.
+	UnlockLogin(ctx context.Context, userID string) error
 }
 
 type authService struct {
-	grpcUserClient grpcClient.UserService
-	tokenRepo      repository.TokenRepository
-	tokenManager   TokenManager
-	cfg            config.Config
+	grpcUserClient    grpcClient.UserService
+	tokenRepo         repository.TokenRepository
+	redisCache        cache.RedisCache
+	tokenManager      TokenManager
+	emailVerification EmailVerificationService
+	mfaService        MFAService
+	webAuthnService   WebAuthnService
+	oidcService       OIDCService
+	emailLogin        EmailLoginService
+	loginThrottle     LoginThrottleService
+	passwordPolicy    passwordpolicy.Policy
+	cfg               config.Config
 }
 
 func NewAuthService(
 	grpcUserClient grpcClient.UserService,
 	tokenRepo repository.TokenRepository,
+	redisCache cache.RedisCache,
 	tokenManager TokenManager,
+	emailVerification EmailVerificationService,
+	mfaService MFAService,
+	webAuthnService WebAuthnService,
+	oidcService OIDCService,
+	emailLogin EmailLoginService,
+	loginThrottle LoginThrottleService,
+	passwordPolicy passwordpolicy.Policy,
 	cfg config.Config,
 ) AuthService {
 	return &authService{
-		grpcUserClient: grpcUserClient,
-		tokenRepo:      tokenRepo,
-		tokenManager:   tokenManager,
-		cfg:            cfg,
+		grpcUserClient:    grpcUserClient,
+		tokenRepo:         tokenRepo,
+		redisCache:        redisCache,
+		tokenManager:      tokenManager,
+		emailVerification: emailVerification,
+		mfaService:        mfaService,
+		webAuthnService:   webAuthnService,
+		oidcService:       oidcService,
+		emailLogin:        emailLogin,
+		loginThrottle:     loginThrottle,
+		passwordPolicy:    passwordPolicy,
+		cfg:               cfg,
 	}
 }
 
-func (s *authService) Register(ctx context.Context, email, password string) (*AuthResult, error) {
-	exists, err := s.grpcUserClient.CheckUserExistsByEmail(ctx, email)
+func (s *authService) Register(ctx context.Context, email, password, idempotencyKey string, meta SessionMeta) (*AuthResult, error) {
+	if len(idempotencyKey) > maxIdempotencyKeyLength {
+		return nil, apperror.BadRequest(fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLength))
+	}
+
+	fields := []apperror.FieldError{}
+	if address, err := mail.ParseAddress(email); err != nil || address.Address != email {
+		fields = append(fields, apperror.FieldError{
+			Field:   "email",
+			Code:    "invalid",
+			Message: "email must be a valid address",
+		})
+	}
+	fields = append(fields, passwordFieldErrors(s.passwordPolicy, "password", password, email)...)
+	if len(fields) > 0 {
+		return nil, apperror.Validation("invalid registration", fields)
+	}
+
+	// user-service answers AlreadyExists for a registered email, also to the loser of a race
+	userResp, err := s.grpcUserClient.RegisterUser(ctx, email, password, idempotencyKey)
 	if err != nil {
-		logger.Log.Error().Err(err).Msg("error checking user existence")
-		return nil, apperror.Internal(err)
+		if st, ok := status.FromError(err); !ok || st.Code() != codes.AlreadyExists {
+			logger.Log.Error().Err(err).Msg("error gRPC register user")
+		}
+		return nil, apperror.FromGRPC(err)
 	}
-	if exists.Exists {
-		return nil, apperror.Conflict("user already exists")
+
+	if userResp.Replayed {
+		// user-service checked the password, the earlier request already sent the email
+		return s.registered(ctx, userResp.Id, meta)
 	}
 
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	result, err := s.registered(ctx, userResp.Id, meta)
 	if err != nil {
-		logger.Log.Error().Err(err).Msg("error hashing password")
-		return nil, apperror.Internal(err)
+		rollbackRegistration(ctx, s.grpcUserClient, userResp.Id, idempotencyKey)
+		return nil, err
+	}
+
+	// the account exists either way, the link can be sent again through Resend
+	if err := s.emailVerification.SendVerification(ctx, result.UserID, result.Email); err != nil {
+		logger.Log.Error().Err(err).Msg("error sending verification email")
 	}
 
-	userResp, err := s.grpcUserClient.RegisterUser(ctx, email, hashedPassword)
+	return result, nil
+}
+
+// registered signs in a user who just registered, unless the email has to be verified first.
+func (s *authService) registered(ctx context.Context, userID string, meta SessionMeta) (*AuthResult, error) {
+	// the user-service assigns the initial roles on registration
+	user, err := s.grpcUserClient.GetUserByID(ctx, userID)
 	if err != nil {
-		logger.Log.Error().Err(err).Msg("error gRPC register user")
-		return nil, apperror.Internal(err)
+		logger.Log.Error().Err(err).Msg("error gRPC get user by ID")
+		return nil, apperror.FromGRPC(err)
+	}
+
+	if s.verificationBlocks(user.User) {
+		return &AuthResult{
+			UserID:               user.User.Id,
+			Email:                user.User.Email,
+			VerificationRequired: true,
+		}, nil
+	}
+
+	return s.secondFactorOrSession(ctx, user.User, meta)
+}
+
+// rollbackRegistration deletes a user whose registration failed after user-service created them,
+// so the email can be registered again. It runs even if the request was cancelled.
+func rollbackRegistration(ctx context.Context, users grpcClient.UserService, userID, idempotencyKey string) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), rollbackTimeout)
+	defer cancel()
+
+	if err := users.DeleteUser(ctx, userID, idempotencyKey); err != nil {
+		logger.Log.Error().Err(err).Str("user_id", userID).Msg("error rolling back registration, the user has to be deleted by hand")
+		return
 	}
 
-	return s.createSession(ctx, userResp.Id, email)
+	logger.Log.Warn().
+		Str("event", "registration_rolled_back").
+		Str("user_id", userID).
+		Msg("registration rolled back")
 }
 
-func (s *authService) Login(ctx context.Context, email, password string) (*AuthResult, error) {
-	userResp, err := s.grpcUserClient.GetUserByEmail(ctx, email)
+func (s *authService) Login(ctx context.Context, email, password string, meta SessionMeta) (*AuthResult, error) {
+	if err := s.loginThrottle.Check(ctx, email, meta.IP); err != nil {
+		return nil, err
+	}
+
+	// user-service answers unknown emails as slowly as wrong passwords
+	credentials, err := s.grpcUserClient.VerifyCredentials(ctx, email, password)
 	if err != nil {
-		logger.Log.Error().Err(err).Msg("error gRPC get user by email")
+		logger.Log.Error().Err(err).Msg("error gRPC verify credentials")
 		if st, ok := status.FromError(err); ok && st.Code() == codes.NotFound {
 			// do not show "user not found" to the client for security reasons
+			s.loginThrottle.Failure(ctx, email, meta.IP, nil)
 			return nil, apperror.Unauthorized("invalid email or password")
 		}
-		return nil, apperror.Internal(err)
+		return nil, apperror.FromGRPC(err)
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(userResp.User.Password), []byte(password))
-	if err != nil {
+	if !credentials.Valid {
+		s.loginThrottle.Failure(ctx, email, meta.IP, credentials.User)
 		return nil, apperror.Unauthorized("invalid email or password")
 	}
 
-	return s.createSession(ctx, userResp.User.Id, email)
+	// only checked after the password, so it does not reveal which emails are registered
+	if s.verificationBlocks(credentials.User) {
+		return nil, apperror.Forbidden("email not verified")
+	}
+
+	result, err := s.secondFactorOrSession(ctx, credentials.User, meta)
+	if err != nil {
+		return nil, err
+	}
+	// the failures are only forgotten once the user is signed in, not on the password alone
+	if !result.MFARequired {
+		s.loginThrottle.Success(ctx, email)
+	}
+	return result, nil
+}
+
+func (s *authService) VerifyMFA(ctx context.Context, mfaToken, code string) (*AuthResult, error) {
+	userID, meta, err := s.mfaService.VerifyChallenge(ctx, mfaToken, code)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.completeLogin(ctx, userID, meta)
+}
+
+func (s *authService) BeginMFAWebAuthn(ctx context.Context, mfaToken string) (*WebAuthnOptions, error) {
+	return s.mfaService.BeginWebAuthnChallenge(ctx, mfaToken)
+}
+
+func (s *authService) VerifyMFAWebAuthn(ctx context.Context, mfaToken, ceremonyID string, response []byte) (*AuthResult, error) {
+	userID, meta, err := s.mfaService.VerifyWebAuthnChallenge(ctx, mfaToken, ceremonyID, response)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.completeLogin(ctx, userID, meta)
+}
+
+func (s *authService) BeginPasskeyLogin(ctx context.Context) (*WebAuthnOptions, error) {
+	return s.webAuthnService.BeginLogin(ctx)
+}
+
+func (s *authService) FinishPasskeyLogin(ctx context.Context, ceremonyID string, response []byte, meta SessionMeta) (*AuthResult, error) {
+	userID, err := s.webAuthnService.FinishLogin(ctx, ceremonyID, response)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.completeLogin(ctx, userID, meta)
+}
+
+func (s *authService) OIDCProviders() []string {
+	return s.oidcService.Providers()
+}
+
+func (s *authService) BeginOIDCLogin(ctx context.Context, provider string) (*OIDCAuthorization, error) {
+	return s.oidcService.Begin(ctx, provider)
+}
+
+func (s *authService) FinishOIDCLogin(ctx context.Context, provider, state, code string, meta SessionMeta) (*AuthResult, error) {
+	userID, err := s.oidcService.Finish(ctx, provider, state, code)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.firstFactorPassed(ctx, userID, meta)
+}
+
+func (s *authService) RequestEmailLogin(ctx context.Context, email string) (string, error) {
+	return s.emailLogin.Request(ctx, email)
+}
+
+func (s *authService) FinishEmailLoginLink(ctx context.Context, token string, meta SessionMeta) (*AuthResult, error) {
+	userID, err := s.emailLogin.VerifyLink(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.firstFactorPassed(ctx, userID, meta)
+}
+
+func (s *authService) FinishEmailLoginCode(ctx context.Context, loginID, code string, meta SessionMeta) (*AuthResult, error) {
+	userID, err := s.emailLogin.VerifyCode(ctx, loginID, code, meta.IP)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.firstFactorPassed(ctx, userID, meta)
+}
+
+// firstFactorPassed continues a login that passed the first factor some other way than with the
+// password.
+func (s *authService) firstFactorPassed(ctx context.Context, userID string, meta SessionMeta) (*AuthResult, error) {
+	userResp, err := s.grpcUserClient.GetUserByID(ctx, userID)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error gRPC get user by ID")
+		if st, ok := status.FromError(err); ok && st.Code() == codes.NotFound {
+			return nil, apperror.Unauthorized("invalid credentials")
+		}
+		return nil, apperror.FromGRPC(err)
+	}
+
+	if s.verificationBlocks(userResp.User) {
+		return nil, apperror.Forbidden("email not verified")
+	}
+
+	return s.secondFactorOrSession(ctx, userResp.User, meta)
+}
+
+// secondFactorOrSession starts the second factor challenge for a user who passed the first
+// factor, or opens the session right away when the user has no second factor.
+func (s *authService) secondFactorOrSession(ctx context.Context, user *userpb.User, meta SessionMeta) (*AuthResult, error) {
+	mfaMethods, err := s.mfaService.Methods(ctx, user.Id)
+	if err != nil {
+		return nil, err
+	}
+	if len(mfaMethods) > 0 {
+		mfaToken, err := s.mfaService.StartChallenge(ctx, user.Id, meta)
+		if err != nil {
+			return nil, err
+		}
+
+		return &AuthResult{
+			UserID:      user.Id,
+			Email:       user.Email,
+			MFARequired: true,
+			MFAToken:    mfaToken,
+			MFAMethods:  mfaMethods,
+		}, nil
+	}
+
+	return s.createSession(ctx, user, meta)
+}
+
+// completeLogin opens a session for a user who passed every factor.
+func (s *authService) completeLogin(ctx context.Context, userID string, meta SessionMeta) (*AuthResult, error) {
+	userResp, err := s.grpcUserClient.GetUserByID(ctx, userID)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error gRPC get user by ID")
+		if st, ok := status.FromError(err); ok && st.Code() == codes.NotFound {
+			return nil, apperror.Unauthorized("invalid credentials")
+		}
+		return nil, apperror.FromGRPC(err)
+	}
+
+	if s.verificationBlocks(userResp.User) {
+		return nil, apperror.Forbidden("email not verified")
+	}
+
+	result, err := s.createSession(ctx, userResp.User, meta)
+	if err != nil {
+		return nil, err
+	}
+	s.loginThrottle.Success(ctx, userResp.User.Email)
+	return result, nil
 }
 
 func (s *authService) Refresh(ctx context.Context, refreshToken string) (*AuthResult, error) {
@@ -102,7 +405,7 @@ func (s *authService) Refresh(ctx context.Context, refreshToken string) (*AuthRe
 	userID := claims.Subject
 
 	// Verify user exists
-	_, err = s.grpcUserClient.GetUserByID(ctx, userID)
+	userResp, err := s.grpcUserClient.GetUserByID(ctx, userID)
 	if err != nil {
 		logger.Log.Error().Err(err).Msg("error gRPC get user by ID")
 
@@ -114,37 +417,198 @@ func (s *authService) Refresh(ctx context.Context, refreshToken string) (*AuthRe
 		return nil, apperror.Unauthorized("invalid or expired refresh token")
 	}
 
-	isExists, err := s.tokenRepo.IsRefreshTokenExists(ctx, refreshToken)
+	token, err := s.tokenRepo.ConsumeRefreshToken(ctx, refreshToken)
 	if err != nil {
-		logger.Log.Error().Err(err).Msg("error checking refresh token existence")
-		return nil, apperror.Internal(err)
+		switch {
+		case errors.Is(err, repository.ErrRefreshTokenReused):
+			// an already rotated token was presented again: assume it was stolen and kill the whole family
+			logger.Log.Warn().
+				Str("event", "refresh_token_reuse").
+				Str("user_id", token.UserID).
+				Str("session_id", token.SessionID).
+				Int("token_id", token.ID).
+				Msg("security event: refresh token reuse detected, revoking token family")
+
+			if err := s.tokenRepo.RevokeTokenFamily(ctx, token.SessionID); err != nil {
+				logger.Log.Error().Err(err).Msg("error revoking token family")
+				return nil, apperror.Internal(err)
+			}
+			s.revokeAccessTokens(ctx, token.SessionID)
+			return nil, apperror.Unauthorized("invalid or expired refresh token")
+		case errors.Is(err, repository.ErrRefreshTokenNotFound):
+			return nil, apperror.Unauthorized("invalid or expired refresh token")
+		default:
+			logger.Log.Error().Err(err).Msg("error consuming refresh token")
+			return nil, apperror.Internal(err)
+		}
 	}
 
-	if !isExists {
+	if token.UserID != userID {
 		return nil, apperror.Unauthorized("invalid or expired refresh token")
 	}
 
-	err = s.tokenRepo.RemoveRefreshToken(ctx, refreshToken)
+	// the policy may have changed to block since the session was created
+	if s.verificationBlocks(userResp.User) {
+		return nil, apperror.Forbidden("email not verified")
+	}
+
+	session, err := s.tokenRepo.GetSession(ctx, token.SessionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrSessionNotFound) {
+			return nil, apperror.Unauthorized("invalid or expired refresh token")
+		}
+		logger.Log.Error().Err(err).Msg("error getting session")
+		return nil, apperror.Internal(err)
+	}
+
+	err = s.tokenRepo.TouchSession(ctx, session.ID)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error touching session")
+		return nil, apperror.Internal(err)
+	}
+
+	return s.issueTokens(ctx, session.ID, userResp.User, &token.ID)
+}
+
+func (s *authService) Logout(ctx context.Context, refreshToken, accessToken string) error {
+	var userID, sessionID string
+
+	if accessToken != "" {
+		if claims, err := s.tokenManager.ValidateAccessToken(accessToken); err == nil {
+			ttl := s.cfg.JWT.JWTAccessTokenExp
+			if claims.ExpiresAt != nil {
+				ttl = time.Until(claims.ExpiresAt.Time)
+			}
+
+			// tokens issued before session ids were added can only be revoked one by one
+			if err := s.redisCache.RevokeToken(ctx, claims.ID, ttl); err != nil {
+				logger.Log.Error().Err(err).Msg("error revoking access token")
+			}
+			userID, sessionID = claims.Subject, claims.SessionID
+		}
+	}
+
+	if refreshToken != "" {
+		session, err := s.tokenRepo.GetSessionByRefreshToken(ctx, refreshToken)
+		if err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+			return err
+		}
+		if session != nil {
+			userID, sessionID = session.UserID, session.ID
+		}
+	}
+
+	if sessionID == "" {
+		return nil
+	}
+
+	err := s.tokenRepo.RevokeSession(ctx, userID, sessionID)
+	if err != nil && !errors.Is(err, repository.ErrSessionNotFound) {
+		return err
+	}
+
+	s.revokeAccessTokens(ctx, sessionID)
+	return nil
+}
+
+func (s *authService) ListSessions(ctx context.Context, userID string) ([]*entity.Session, error) {
+	sessions, err := s.tokenRepo.ListSessions(ctx, userID)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error listing sessions")
+		return nil, apperror.Internal(err)
+	}
+
+	return sessions, nil
+}
+
+func (s *authService) RevokeSession(ctx context.Context, userID, sessionID string) error {
+	err := s.tokenRepo.RevokeSession(ctx, userID, sessionID)
+	if err != nil {
+		if errors.Is(err, repository.ErrSessionNotFound) {
+			return apperror.NotFound("session not found")
+		}
+		logger.Log.Error().Err(err).Msg("error revoking session")
+		return apperror.Internal(err)
+	}
+
+	s.revokeAccessTokens(ctx, sessionID)
+	return nil
+}
+
+func (s *authService) UnlockLogin(ctx context.Context, userID string) error {
+	return s.loginThrottle.Unlock(ctx, userID)
+}
+
+// RevokeAllSessions signs the user out everywhere, e.g. after an admin revoke.
+func (s *authService) RevokeAllSessions(ctx context.Context, userID string) error {
+	sessionIDs, err := s.tokenRepo.RevokeAllSessions(ctx, userID)
 	if err != nil {
-		logger.Log.Error().Err(err).Msg("removing old refresh token failed")
+		logger.Log.Error().Err(err).Msg("error revoking sessions")
+		return apperror.Internal(err)
+	}
+
+	s.revokeAccessTokens(ctx, sessionIDs...)
+	return nil
+}
+
+// revokeAccessTokens puts the sessions on the revocation list so the gateway stops accepting
+// their access tokens right away. The sessions are already revoked in the database, so if
+// Redis is unavailable their access tokens only live until they expire.
+func (s *authService) revokeAccessTokens(ctx context.Context, sessionIDs ...string) {
+	if err := s.redisCache.RevokeSessions(ctx, sessionIDs, s.cfg.JWT.JWTAccessTokenExp); err != nil {
+		logger.Log.Error().
+			Err(err).
+			Strs("session_ids", sessionIDs).
+			Msg("error adding sessions to the revocation list")
+	}
+}
+
+func (s *authService) createSession(ctx context.Context, user *userpb.User, meta SessionMeta) (*AuthResult, error) {
+	session := &entity.Session{
+		UserID:      user.Id,
+		DeviceLabel: meta.DeviceLabel,
+		UserAgent:   meta.UserAgent,
+		IP:          meta.IP,
+	}
+
+	err := s.tokenRepo.CreateSession(ctx, session)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error creating session")
 		return nil, apperror.Internal(err)
 	}
 
-	return s.createSession(ctx, userID, refreshToken)
+	return s.issueTokens(ctx, session.ID, user, nil)
 }
 
-func (s *authService) Logout(ctx context.Context, refreshToken string) error {
-	return s.tokenRepo.RemoveRefreshToken(ctx, refreshToken)
+// verificationBlocks reports whether the user may not sign in until their email is verified.
+func (s *authService) verificationBlocks(user *userpb.User) bool {
+	return !user.EmailVerified && s.cfg.EmailVerification.EmailVerificationPolicy == config.EmailVerificationBlock
 }
 
-func (s *authService) createSession(ctx context.Context, userID, email string) (*AuthResult, error) {
-	accessToken, refreshToken, err := s.tokenManager.GenerateTokens(userID)
+// issueTokens generates a new token pair and records the refresh token in the session lineage.
+// The access token carries the user's current roles, or none and the unverified claim while the
+// email is not verified. parentID is the id of the refresh token being rotated, nil for a
+// fresh session.
+func (s *authService) issueTokens(ctx context.Context, sessionID string, user *userpb.User, parentID *int) (*AuthResult, error) {
+	userID := user.Id
+
+	principal := Principal{
+		UserID:      userID,
+		SessionID:   sessionID,
+		Roles:       user.Roles,
+		Permissions: user.Permissions,
+	}
+	if !user.EmailVerified {
+		principal = Principal{UserID: userID, SessionID: sessionID, Unverified: true}
+	}
+
+	accessToken, refreshToken, err := s.tokenManager.GenerateTokens(principal)
 	if err != nil {
 		logger.Log.Error().Err(err).Msg("error generating tokens")
 		return nil, apperror.Internal(err)
 	}
 
-	err = s.tokenRepo.SaveRefreshToken(ctx, userID, refreshToken)
+	err = s.tokenRepo.SaveRefreshToken(ctx, sessionID, userID, refreshToken, parentID)
 	if err != nil {
 		logger.Log.Error().Err(err).Msg("error saving refresh token")
 		return nil, apperror.Internal(err)
@@ -153,7 +617,8 @@ func (s *authService) createSession(ctx context.Context, userID, email string) (
 	return &AuthResult{
 		AccessToken:  accessToken,
 		RefreshToken: refreshToken,
+		SessionID:    sessionID,
 		UserID:       userID,
-		Email:        email,
+		Email:        user.Email,
 	}, nil
 }
@@ -0,0 +1,832 @@
+package service
+
+import (
+	"auth-service/internal/apperror"
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	userpb "auth-service/internal/genproto/user/v1"
+	"auth-service/internal/passwordpolicy"
+	"auth-service/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeUserClient is an in-memory stand-in for the user-service gRPC client. Like user-service it
+// keeps the passwords to itself, in plain text as there is nothing to protect.
+type fakeUserClient struct {
+	mu        sync.Mutex
+	users     map[string]*userpb.User
+	passwords map[string]string
+	// keys maps registration idempotency keys to the user they created
+	keys map[string]string
+	// pending maps users to the email they asked to change to
+	pending map[string]string
+	nextID  int
+}
+
+func newFakeUserClient() *fakeUserClient {
+	return &fakeUserClient{users: map[string]*userpb.User{}, passwords: map[string]string{}, keys: map[string]string{}, pending: map[string]string{}}
+}
+
+func (f *fakeUserClient) GetUserByEmail(_ context.Context, email string) (*userpb.GetUserByEmailResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, u := range f.users {
+		if fakeNormalizeEmail(u.Email) == fakeNormalizeEmail(email) {
+			return &userpb.GetUserByEmailResponse{User: u}, nil
+		}
+	}
+	return nil, status.Error(codes.NotFound, "user not found")
+}
+
+func (f *fakeUserClient) GetUserByID(_ context.Context, id string) (*userpb.GetUserByIDResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.users[id]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "user not found")
+	}
+	return &userpb.GetUserByIDResponse{User: &userpb.User{Id: u.Id, Email: u.Email, Roles: u.Roles, Permissions: u.Permissions, EmailVerified: u.EmailVerified}}, nil
+}
+
+func (f *fakeUserClient) CheckUserExistsByEmail(ctx context.Context, email string) (*userpb.CheckUserExistsByEmailResponse, error) {
+	_, err := f.GetUserByEmail(ctx, email)
+	return &userpb.CheckUserExistsByEmailResponse{Exists: err == nil}, nil
+}
+
+// NormalizeEmail normalizes like user-service with EMAIL_PROVIDER_RULES, as far as the tests
+// need it: lowercase, and Gmail without dots and tags.
+func (f *fakeUserClient) NormalizeEmail(_ context.Context, email string) (*userpb.NormalizeEmailResponse, error) {
+	if !strings.Contains(email, "@") {
+		return nil, status.Error(codes.InvalidArgument, "email must be a valid address")
+	}
+	return &userpb.NormalizeEmailResponse{EmailNormalized: fakeNormalizeEmail(email)}, nil
+}
+
+func fakeNormalizeEmail(email string) string {
+	local, domain, _ := strings.Cut(strings.ToLower(strings.TrimSpace(email)), "@")
+	if domain == "gmail.com" {
+		local, _, _ = strings.Cut(local, "+")
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	return local + "@" + domain
+}
+
+func (f *fakeUserClient) RegisterUser(_ context.Context, email, password, idempotencyKey string) (*userpb.RegisterUserResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if id, ok := f.keys[idempotencyKey]; ok && idempotencyKey != "" {
+		if f.users[id].Email != email || f.passwords[id] != password {
+			return nil, status.Error(codes.InvalidArgument, "idempotency key belongs to another registration")
+		}
+		return &userpb.RegisterUserResponse{Id: id, Replayed: true}, nil
+	}
+	for _, u := range f.users {
+		if fakeNormalizeEmail(u.Email) == fakeNormalizeEmail(email) {
+			return nil, status.Error(codes.AlreadyExists, "user already exists")
+		}
+	}
+
+	f.nextID++
+	id := strconv.Itoa(f.nextID)
+	f.users[id] = &userpb.User{Id: id, Email: email, Roles: []string{"user"}}
+	f.passwords[id] = password
+	if idempotencyKey != "" {
+		f.keys[idempotencyKey] = id
+	}
+	return &userpb.RegisterUserResponse{Id: id}, nil
+}
+
+func (f *fakeUserClient) DeleteUser(_ context.Context, id, idempotencyKey string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	user, ok := f.users[id]
+	if !ok || user.EmailVerified || (idempotencyKey != "" && f.keys[idempotencyKey] != id) {
+		return status.Error(codes.NotFound, "user not found")
+	}
+	delete(f.users, id)
+	delete(f.passwords, id)
+	for key, userID := range f.keys {
+		if userID == id {
+			delete(f.keys, key)
+		}
+	}
+	return nil
+}
+
+func (f *fakeUserClient) VerifyCredentials(ctx context.Context, email, password string) (*userpb.VerifyCredentialsResponse, error) {
+	resp, err := f.GetUserByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return &userpb.VerifyCredentialsResponse{Valid: f.passwords[resp.User.Id] == password, User: resp.User}, nil
+}
+
+func (f *fakeUserClient) UpdatePassword(_ context.Context, id, password string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.users[id]; !ok {
+		return status.Error(codes.NotFound, "user not found")
+	}
+	f.passwords[id] = password
+	return nil
+}
+
+func (f *fakeUserClient) MarkEmailVerified(_ context.Context, id, email string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	u, ok := f.users[id]
+	if !ok {
+		return false, status.Error(codes.NotFound, "user not found")
+	}
+	if u.Email != email {
+		if f.pending[id] != email {
+			return false, nil
+		}
+		u.Email = email
+		delete(f.pending, id)
+	}
+	u.EmailVerified = true
+	return true, nil
+}
+
+func (f *fakeUserClient) RequestEmailChange(_ context.Context, id, email string) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.users[id]; !ok {
+		return "", status.Error(codes.NotFound, "user not found")
+	}
+	for _, u := range f.users {
+		if fakeNormalizeEmail(u.Email) == fakeNormalizeEmail(email) {
+			return "", status.Error(codes.AlreadyExists, "email is taken")
+		}
+	}
+	f.pending[id] = email
+	return email, nil
+}
+
+func (f *fakeUserClient) Ping(context.Context) error {
+	return nil
+}
+
+// fakeTokenRepository mirrors the semantics of tokenRepository without a database.
+type fakeTokenRepository struct {
+	mu       sync.Mutex
+	sessions map[string]*entity.Session
+	tokens   map[string]*entity.RefreshToken
+	nextID   int
+	// createSessionErr makes CreateSession fail
+	createSessionErr error
+}
+
+func newFakeTokenRepository() *fakeTokenRepository {
+	return &fakeTokenRepository{
+		sessions: map[string]*entity.Session{},
+		tokens:   map[string]*entity.RefreshToken{},
+	}
+}
+
+func (r *fakeTokenRepository) SaveRefreshToken(_ context.Context, sessionID, userID, refreshToken string, parentID *int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	r.tokens[refreshToken] = &entity.RefreshToken{
+		ID:        r.nextID,
+		SessionID: sessionID,
+		ParentID:  parentID,
+		UserID:    userID,
+		TokenHash: refreshToken,
+		ExpiresAt: time.Now().Add(time.Hour),
+	}
+	return nil
+}
+
+func (r *fakeTokenRepository) ConsumeRefreshToken(_ context.Context, refreshToken string) (*entity.RefreshToken, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tokens[refreshToken]
+	if !ok {
+		return nil, repository.ErrRefreshTokenNotFound
+	}
+	if t.UsedAt != nil {
+		return t, repository.ErrRefreshTokenReused
+	}
+
+	now := time.Now()
+	t.UsedAt = &now
+	return t, nil
+}
+
+func (r *fakeTokenRepository) RevokeTokenFamily(_ context.Context, sessionID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.revokeLocked(sessionID)
+	return nil
+}
+
+func (r *fakeTokenRepository) CreateSession(_ context.Context, session *entity.Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.createSessionErr != nil {
+		return r.createSessionErr
+	}
+	session.ID = fmt.Sprintf("session-%d", len(r.sessions)+1)
+	session.ExpiresAt = time.Now().Add(time.Hour)
+	r.sessions[session.ID] = session
+	return nil
+}
+
+func (r *fakeTokenRepository) GetSessionByRefreshToken(ctx context.Context, refreshToken string) (*entity.Session, error) {
+	r.mu.Lock()
+	t, ok := r.tokens[refreshToken]
+	r.mu.Unlock()
+
+	if !ok || t.UsedAt != nil {
+		return nil, repository.ErrSessionNotFound
+	}
+	return r.GetSession(ctx, t.SessionID)
+}
+
+func (r *fakeTokenRepository) GetSession(_ context.Context, sessionID string) (*entity.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[sessionID]
+	if !ok || s.RevokedAt != nil {
+		return nil, repository.ErrSessionNotFound
+	}
+	return s, nil
+}
+
+func (r *fakeTokenRepository) ListSessions(_ context.Context, userID string) ([]*entity.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var sessions []*entity.Session
+	for _, s := range r.sessions {
+		if s.UserID == userID && s.RevokedAt == nil {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions, nil
+}
+
+func (r *fakeTokenRepository) TouchSession(_ context.Context, sessionID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if s, ok := r.sessions[sessionID]; ok {
+		s.LastUsedAt = time.Now()
+	}
+	return nil
+}
+
+func (r *fakeTokenRepository) RevokeSession(_ context.Context, userID, sessionID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	s, ok := r.sessions[sessionID]
+	if !ok || s.UserID != userID || s.RevokedAt != nil {
+		return repository.ErrSessionNotFound
+	}
+	r.revokeLocked(sessionID)
+	return nil
+}
+
+func (r *fakeTokenRepository) RevokeAllSessions(_ context.Context, userID string) ([]string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ids []string
+	for id, s := range r.sessions {
+		if s.UserID == userID && s.RevokedAt == nil {
+			r.revokeLocked(id)
+			ids = append(ids, id)
+		}
+	}
+	return ids, nil
+}
+
+func (r *fakeTokenRepository) revokeLocked(sessionID string) {
+	now := time.Now()
+	if s, ok := r.sessions[sessionID]; ok && s.RevokedAt == nil {
+		s.RevokedAt = &now
+	}
+	for k, t := range r.tokens {
+		if t.SessionID == sessionID {
+			delete(r.tokens, k)
+		}
+	}
+}
+
+// fakeRedisCache is an in-memory revocation list.
+type fakeRedisCache struct {
+	mu       sync.Mutex
+	tokens   map[string]bool
+	sessions map[string]bool
+	logins   map[string]*fakeLoginRecord
+}
+
+// fakeLoginRecord is the failed logins of an account. The blocks are keyed by IP, with the
+// lockout of the whole account under "".
+type fakeLoginRecord struct {
+	failures   int64
+	ipFailures map[string]int64
+	blocked    map[string]time.Time
+}
+
+func newFakeRedisCache() *fakeRedisCache {
+	return &fakeRedisCache{tokens: map[string]bool{}, sessions: map[string]bool{}, logins: map[string]*fakeLoginRecord{}}
+}
+
+func (f *fakeRedisCache) RevokeToken(_ context.Context, tokenID string, _ time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.tokens[tokenID] = true
+	return nil
+}
+
+func (f *fakeRedisCache) RevokeSessions(_ context.Context, sessionIDs []string, _ time.Duration) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, id := range sessionIDs {
+		f.sessions[id] = true
+	}
+	return nil
+}
+
+func (f *fakeRedisCache) IsRevoked(_ context.Context, tokenID, sessionID string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.tokens[tokenID] || f.sessions[sessionID], nil
+}
+
+func (f *fakeRedisCache) login(account string) *fakeLoginRecord {
+	record, ok := f.logins[account]
+	if !ok {
+		record = &fakeLoginRecord{ipFailures: map[string]int64{}, blocked: map[string]time.Time{}}
+		f.logins[account] = record
+	}
+	return record
+}
+
+func (f *fakeRedisCache) RecordLoginFailure(_ context.Context, account, ip string, _ time.Duration) (int64, int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	record := f.login(account)
+	record.failures++
+	record.ipFailures[ip]++
+	return record.failures, record.ipFailures[ip], nil
+}
+
+func (f *fakeRedisCache) BlockLogin(_ context.Context, account, ip string, until time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	record := f.login(account)
+	if until.After(record.blocked[ip]) {
+		record.blocked[ip] = until
+	}
+	return nil
+}
+
+func (f *fakeRedisCache) LoginBlockedUntil(_ context.Context, account, ip string) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	record := f.login(account)
+	until := record.blocked[""]
+	if record.blocked[ip].After(until) {
+		until = record.blocked[ip]
+	}
+	return until, nil
+}
+
+func (f *fakeRedisCache) ResetLogin(_ context.Context, account string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.logins, account)
+	return nil
+}
+
+func (f *fakeRedisCache) Ping(context.Context) error {
+	return nil
+}
+
+func (f *fakeRedisCache) Close() {}
+
+func newTestAuthService(t *testing.T) (AuthService, *fakeUserClient, *fakeTokenRepository, *fakeRedisCache) {
+	t.Helper()
+
+	svc, users, tokens, revoked, _ := newTestAuthServiceWithPolicy(t, config.EmailVerificationRestrict)
+	return svc, users, tokens, revoked
+}
+
+func newTestAuthServiceWithPolicy(t *testing.T, policy string) (AuthService, *fakeUserClient, *fakeTokenRepository, *fakeRedisCache, *fakeMailSender) {
+	t.Helper()
+
+	mgr, _ := newTestManager()
+	users := newFakeUserClient()
+	tokens := newFakeTokenRepository()
+	revoked := newFakeRedisCache()
+	sender := &fakeMailSender{}
+
+	cfg := config.Config{
+		Password: config.PasswordConfig{
+			PasswordMinLength:  8,
+			PasswordMaxLength:  64,
+			PasswordMinClasses: 1,
+		},
+		EmailVerification: config.EmailVerificationConfig{
+			EmailVerificationSecret:   "verification-secret",
+			EmailVerificationURL:      "https://example.com/verify-email",
+			EmailVerificationTokenExp: time.Hour,
+			EmailVerificationPolicy:   policy,
+		},
+		EmailLogin: config.EmailLoginConfig{
+			EmailLoginURL: "https://example.com/login/email",
+			EmailLoginExp: 10 * time.Minute,
+		},
+		LoginThrottle: config.LoginThrottleConfig{
+			LoginBackoffAfter:     3,
+			LoginBackoffMax:       5 * time.Minute,
+			LoginLockoutThreshold: 10,
+			LoginLockoutDuration:  15 * time.Minute,
+		},
+		WebAuthn: testWebAuthnConfig(),
+	}
+	throttle := newTestLoginThrottleService(users, revoked, sender, cfg)
+	verification := NewEmailVerificationService(users, sender, throttle, cfg)
+	webAuthn := newTestWebAuthnService(t, users, cfg)
+	mfa := NewMFAService(users, newFakeMFARepository(), webAuthn, revoked, throttle, cfg)
+	oidc := NewOIDCService(users, newFakeOIDCRepository(), cfg)
+	emailLogin := newTestEmailLoginService(users, sender, revoked, throttle, cfg)
+
+	return NewAuthService(users, tokens, revoked, mgr, verification, mfa, webAuthn, oidc, emailLogin, throttle, passwordpolicy.NewPolicy(cfg.Password, nil), cfg), users, tokens, revoked, sender
+}
+
+func registerTestUser(t *testing.T, users *fakeUserClient, email, password string) {
+	t.Helper()
+
+	resp, err := users.RegisterUser(context.Background(), email, password, "")
+	if err != nil {
+		t.Fatalf("RegisterUser() error: %v", err)
+	}
+	users.users[resp.Id].EmailVerified = true
+}
+
+func assertUnauthorized(t *testing.T, err error) {
+	t.Helper()
+	assertAppError(t, err, 401)
+}
+
+func assertAppError(t *testing.T, err error, code int) {
+	t.Helper()
+
+	var appErr *apperror.AppError
+	if !errors.As(err, &appErr) || appErr.Code != code {
+		t.Fatalf("expected %d app error, got %v", code, err)
+	}
+}
+
+// assertFieldErrors checks for a 400 app error that names exactly the fields and codes.
+func assertFieldErrors(t *testing.T, err error, want ...apperror.FieldError) {
+	t.Helper()
+	assertAppError(t, err, 400)
+
+	var appErr *apperror.AppError
+	errors.As(err, &appErr)
+	got := []apperror.FieldError{}
+	for _, field := range appErr.Fields {
+		got = append(got, apperror.FieldError{Field: field.Field, Code: field.Code})
+	}
+	if !slices.Equal(got, want) {
+		t.Fatalf("field errors = %+v, want %+v", appErr.Fields, want)
+	}
+}
+
+func TestAuthService_RegisterValidation(t *testing.T) {
+	svc, users, _, _ := newTestAuthService(t)
+	ctx := context.Background()
+
+	_, err := svc.Register(ctx, "not an email", "short", "", SessionMeta{})
+	assertFieldErrors(t, err,
+		apperror.FieldError{Field: "email", Code: "invalid"},
+		apperror.FieldError{Field: "password", Code: "too_short"})
+
+	_, err = svc.Register(ctx, "Jane <jane@example.com>", "quiet-lantern", "", SessionMeta{})
+	assertFieldErrors(t, err, apperror.FieldError{Field: "email", Code: "invalid"})
+
+	_, err = svc.Register(ctx, "jane@example.com", "jane-2024!", "", SessionMeta{})
+	assertFieldErrors(t, err, apperror.FieldError{Field: "password", Code: "similar_to_email"})
+
+	if len(users.users) != 0 {
+		t.Fatalf("Register() created %d users from invalid input", len(users.users))
+	}
+	if _, err := svc.Register(ctx, "jane@example.com", "quiet-lantern", "", SessionMeta{}); err != nil {
+		t.Fatalf("Register() error: %v", err)
+	}
+}
+
+func TestAuthService_RegisterTakenEmail(t *testing.T) {
+	svc, users, _, _ := newTestAuthService(t)
+	ctx := context.Background()
+	registerTestUser(t, users, "taken@example.com", "password")
+
+	_, err := svc.Register(ctx, "taken@example.com", "another-password", "", SessionMeta{})
+	assertAppError(t, err, 409)
+}
+
+func TestAuthService_RegisterIdempotencyKey(t *testing.T) {
+	svc, users, _, _ := newTestAuthService(t)
+	ctx := context.Background()
+
+	first, err := svc.Register(ctx, "retry@example.com", "password", "key-1", SessionMeta{})
+	if err != nil {
+		t.Fatalf("Register() error: %v", err)
+	}
+
+	// the response got lost, the client sends the same request again
+	retry, err := svc.Register(ctx, "retry@example.com", "password", "key-1", SessionMeta{})
+	if err != nil {
+		t.Fatalf("Register() retry error: %v", err)
+	}
+	if retry.UserID != first.UserID || retry.AccessToken == "" {
+		t.Fatalf("Register() retry = user %q, want a session for %q", retry.UserID, first.UserID)
+	}
+	if len(users.users) != 1 {
+		t.Fatalf("Register() retry created %d users, want 1", len(users.users))
+	}
+
+	// the key does not stand in for the password
+	_, err = svc.Register(ctx, "retry@example.com", "other-password", "key-1", SessionMeta{})
+	assertAppError(t, err, 400)
+	_, err = svc.Register(ctx, "retry@example.com", "password", "key-2", SessionMeta{})
+	assertAppError(t, err, 409)
+
+	_, err = svc.Register(ctx, "retry@example.com", "password", strings.Repeat("k", 256), SessionMeta{})
+	assertAppError(t, err, 400)
+}
+
+func TestAuthService_RegisterRollsBack(t *testing.T) {
+	svc, users, tokens, _ := newTestAuthService(t)
+	ctx := context.Background()
+
+	tokens.createSessionErr = errors.New("database is down")
+	_, err := svc.Register(ctx, "rollback@example.com", "password", "key-1", SessionMeta{})
+	assertAppError(t, err, 500)
+
+	if len(users.users) != 0 {
+		t.Fatalf("Register() left %d users behind after a failed session", len(users.users))
+	}
+
+	// the email and the key can be used again
+	tokens.createSessionErr = nil
+	if _, err := svc.Register(ctx, "rollback@example.com", "password", "key-1", SessionMeta{}); err != nil {
+		t.Fatalf("Register() after the rollback error: %v", err)
+	}
+}
+
+func TestAuthService_MultipleSessions(t *testing.T) {
+	svc, users, tokens, _ := newTestAuthService(t)
+	ctx := context.Background()
+	registerTestUser(t, users, "multi@example.com", "password")
+
+	laptop, err := svc.Login(ctx, "multi@example.com", "password", SessionMeta{DeviceLabel: "laptop"})
+	if err != nil {
+		t.Fatalf("Login() laptop error: %v", err)
+	}
+	phone, err := svc.Login(ctx, "multi@example.com", "password", SessionMeta{DeviceLabel: "phone"})
+	if err != nil {
+		t.Fatalf("Login() phone error: %v", err)
+	}
+
+	if laptop.SessionID == phone.SessionID {
+		t.Fatal("Login() reused the same session for two devices")
+	}
+
+	sessions, _ := tokens.ListSessions(ctx, laptop.UserID)
+	if len(sessions) != 2 {
+		t.Fatalf("ListSessions() = %d sessions, want 2", len(sessions))
+	}
+
+	// logging out on the phone keeps the laptop signed in
+	if err := svc.Logout(ctx, phone.RefreshToken, ""); err != nil {
+		t.Fatalf("Logout() error: %v", err)
+	}
+	if _, err := svc.Refresh(ctx, laptop.RefreshToken); err != nil {
+		t.Fatalf("Refresh() laptop after phone logout error: %v", err)
+	}
+	if _, err := svc.Refresh(ctx, phone.RefreshToken); err == nil {
+		t.Fatal("Refresh() phone after logout should fail")
+	}
+}
+
+func TestAuthService_Refresh_Rotation(t *testing.T) {
+	svc, users, tokens, _ := newTestAuthService(t)
+	ctx := context.Background()
+	registerTestUser(t, users, "rotate@example.com", "password")
+
+	first, err := svc.Login(ctx, "rotate@example.com", "password", SessionMeta{})
+	if err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+
+	second, err := svc.Refresh(ctx, first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() error: %v", err)
+	}
+
+	if second.SessionID != first.SessionID {
+		t.Errorf("Refresh() session = %v, want %v", second.SessionID, first.SessionID)
+	}
+	if second.Email != "rotate@example.com" {
+		t.Errorf("Refresh() email = %v, want rotate@example.com", second.Email)
+	}
+
+	parent := tokens.tokens[first.RefreshToken]
+	child := tokens.tokens[second.RefreshToken]
+	if child.ParentID == nil || *child.ParentID != parent.ID {
+		t.Errorf("Refresh() new token parent = %v, want %v", child.ParentID, parent.ID)
+	}
+}
+
+func TestAuthService_Refresh_ReuseRevokesFamily(t *testing.T) {
+	svc, users, tokens, _ := newTestAuthService(t)
+	ctx := context.Background()
+	registerTestUser(t, users, "replay@example.com", "password")
+
+	stolen, err := svc.Login(ctx, "replay@example.com", "password", SessionMeta{DeviceLabel: "victim"})
+	if err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+	other, err := svc.Login(ctx, "replay@example.com", "password", SessionMeta{DeviceLabel: "other"})
+	if err != nil {
+		t.Fatalf("Login() other error: %v", err)
+	}
+
+	// the legitimate client rotates its token
+	rotated, err := svc.Refresh(ctx, stolen.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() error: %v", err)
+	}
+
+	// the attacker replays the already consumed token
+	_, err = svc.Refresh(ctx, stolen.RefreshToken)
+	assertUnauthorized(t, err)
+
+	if _, err := tokens.GetSession(ctx, stolen.SessionID); !errors.Is(err, repository.ErrSessionNotFound) {
+		t.Errorf("session should be revoked after replay, got err = %v", err)
+	}
+
+	// the token issued to the legitimate client is part of the family and dies too
+	_, err = svc.Refresh(ctx, rotated.RefreshToken)
+	assertUnauthorized(t, err)
+
+	// sessions on other devices are not affected
+	if _, err := svc.Refresh(ctx, other.RefreshToken); err != nil {
+		t.Errorf("Refresh() on unrelated session error: %v", err)
+	}
+}
+
+func TestAuthService_LogoutRevokesAccessTokens(t *testing.T) {
+	svc, users, _, revoked := newTestAuthService(t)
+	ctx := context.Background()
+	registerTestUser(t, users, "logout@example.com", "password")
+
+	laptop, err := svc.Login(ctx, "logout@example.com", "password", SessionMeta{DeviceLabel: "laptop"})
+	if err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+	phone, err := svc.Login(ctx, "logout@example.com", "password", SessionMeta{DeviceLabel: "phone"})
+	if err != nil {
+		t.Fatalf("Login() phone error: %v", err)
+	}
+
+	if err := svc.Logout(ctx, laptop.RefreshToken, laptop.AccessToken); err != nil {
+		t.Fatalf("Logout() error: %v", err)
+	}
+
+	mgr, _ := newTestManager()
+	laptopClaims, _ := mgr.ValidateAccessToken(laptop.AccessToken)
+	phoneClaims, _ := mgr.ValidateAccessToken(phone.AccessToken)
+
+	if !revoked.tokens[laptopClaims.ID] || !revoked.sessions[laptop.SessionID] {
+		t.Error("Logout() did not put the access token and its session on the revocation list")
+	}
+	if ok, _ := revoked.IsRevoked(ctx, phoneClaims.ID, phoneClaims.SessionID); ok {
+		t.Error("Logout() revoked the access token of another session")
+	}
+}
+
+func TestAuthService_LogoutWithAccessTokenOnly(t *testing.T) {
+	svc, users, tokens, revoked := newTestAuthService(t)
+	ctx := context.Background()
+	registerTestUser(t, users, "nocookie@example.com", "password")
+
+	result, err := svc.Login(ctx, "nocookie@example.com", "password", SessionMeta{})
+	if err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+
+	// the refresh cookie is gone, the session is found through the sid claim
+	if err := svc.Logout(ctx, "", result.AccessToken); err != nil {
+		t.Fatalf("Logout() error: %v", err)
+	}
+
+	if _, err := tokens.GetSession(ctx, result.SessionID); !errors.Is(err, repository.ErrSessionNotFound) {
+		t.Errorf("Logout() did not revoke the session, err = %v", err)
+	}
+	if !revoked.sessions[result.SessionID] {
+		t.Error("Logout() did not put the session on the revocation list")
+	}
+}
+
+func TestAuthService_RevokeAllSessions(t *testing.T) {
+	svc, users, _, revoked := newTestAuthService(t)
+	ctx := context.Background()
+	registerTestUser(t, users, "admin-revoke@example.com", "password")
+
+	first, _ := svc.Login(ctx, "admin-revoke@example.com", "password", SessionMeta{})
+	second, _ := svc.Login(ctx, "admin-revoke@example.com", "password", SessionMeta{})
+
+	if err := svc.RevokeAllSessions(ctx, first.UserID); err != nil {
+		t.Fatalf("RevokeAllSessions() error: %v", err)
+	}
+
+	for _, result := range []*AuthResult{first, second} {
+		if !revoked.sessions[result.SessionID] {
+			t.Errorf("session %s is not on the revocation list", result.SessionID)
+		}
+		if _, err := svc.Refresh(ctx, result.RefreshToken); err == nil {
+			t.Error("Refresh() succeeded after all sessions were revoked")
+		}
+	}
+}
+
+func TestAuthService_TokensCarryRoles(t *testing.T) {
+	svc, users, _, _ := newTestAuthService(t)
+	ctx := context.Background()
+
+	registered, err := svc.Register(ctx, "roles@example.com", "password", "", SessionMeta{})
+	if err != nil {
+		t.Fatalf("Register() error: %v", err)
+	}
+
+	claims, err := svc.(*authService).tokenManager.ValidateAccessToken(registered.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken() error: %v", err)
+	}
+	// roles only count once the email is verified
+	if !claims.Unverified || len(claims.Roles) != 0 || len(claims.Permissions) != 0 {
+		t.Fatalf("Register() claims unverified = %v roles = %v perms = %v, want a restricted token", claims.Unverified, claims.Roles, claims.Permissions)
+	}
+
+	// verifying and a role granted later show up once the token is refreshed
+	user := users.users[registered.UserID]
+	user.EmailVerified = true
+	user.Roles = []string{"admin", "user"}
+	user.Permissions = []string{"roles:assign", "users:list"}
+
+	refreshed, err := svc.Refresh(ctx, registered.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() error: %v", err)
+	}
+
+	claims, err = svc.(*authService).tokenManager.ValidateAccessToken(refreshed.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken() error: %v", err)
+	}
+	if claims.Unverified || !slices.Equal(claims.Roles, user.Roles) || !slices.Equal(claims.Permissions, user.Permissions) {
+		t.Fatalf("Refresh() claims roles = %v perms = %v, want %v %v", claims.Roles, claims.Permissions, user.Roles, user.Permissions)
+	}
+}
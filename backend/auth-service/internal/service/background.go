@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// backgroundTimeout bounds work started by a request that has already been answered.
+const backgroundTimeout = 30 * time.Second
+
+// Background runs work a response must not wait for, such as the mail that only goes to
+// accounts that exist, so the response time does not reveal whether they do.
+type Background struct {
+	wg sync.WaitGroup
+}
+
+func NewBackground() *Background {
+	return &Background{}
+}
+
+// Go runs fn with the values of ctx but not its cancellation, the request ends before fn does.
+func (b *Background) Go(ctx context.Context, fn func(ctx context.Context)) {
+	ctx = context.WithoutCancel(ctx)
+	b.wg.Go(func() {
+		ctx, cancel := context.WithTimeout(ctx, backgroundTimeout)
+		defer cancel()
+		fn(ctx)
+	})
+}
+
+// Wait blocks until the work started so far is done, on shutdown once no requests come in.
+func (b *Background) Wait() {
+	b.wg.Wait()
+}
@@ -0,0 +1,276 @@
+package service
+
+import (
+	"auth-service/internal/apperror"
+	"auth-service/internal/cache"
+	grpcClient "auth-service/internal/client/grpc"
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"auth-service/internal/logger"
+	"auth-service/internal/mail"
+	"auth-service/internal/repository"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// maxEmailLoginAttempts is how many codes can be tried against one login email.
+	maxEmailLoginAttempts = 5
+	// maxEmailLoginFailures is how many wrong codes a user can enter across login emails before
+	// codes are refused for emailLoginLockout, so requesting new emails does not buy more guesses
+	maxEmailLoginFailures = 10
+	emailLoginLockout     = time.Hour
+	// maxEmailLoginRequests is how many login emails an address can be sent within
+	// emailLoginRequestWindow of the last request
+	maxEmailLoginRequests   = 5
+	emailLoginRequestWindow = time.Hour
+	// the prefixes keep the counts apart from the failed logins with the password
+	emailLoginThrottlePrefix = "email_login:"
+	emailLoginRequestPrefix  = "email_login_request:"
+)
+
+// EmailLoginService signs users in without a password. A login email carries a single-use link
+// and a 6-digit code, either of which redeems it. Redeeming it proves the user owns the address,
+// so it also verifies the email.
+type EmailLoginService interface {
+	// Request mails a login link and code and returns the login id the code is entered with.
+	// It returns a login id for unknown emails as well and sends the email in the background, so
+	// neither the response nor its timing tell who has an account.
+	Request(ctx context.Context, email string) (string, error)
+	// VerifyLink redeems the token of a login link and returns the user id.
+	VerifyLink(ctx context.Context, token string) (string, error)
+	// VerifyCode redeems the code of a login email entered from the ip and returns the user id.
+	VerifyCode(ctx context.Context, loginID, code, ip string) (string, error)
+}
+
+type emailLoginService struct {
+	grpcUserClient grpcClient.UserService
+	repo           repository.EmailLoginRepository
+	mailSender     mail.Sender
+	redisCache     cache.RedisCache
+	loginThrottle  LoginThrottleService
+	background     *Background
+	cfg            config.Config
+}
+
+func NewEmailLoginService(grpcUserClient grpcClient.UserService, repo repository.EmailLoginRepository, mailSender mail.Sender, redisCache cache.RedisCache, loginThrottle LoginThrottleService, background *Background, cfg config.Config) EmailLoginService {
+	return &emailLoginService{
+		grpcUserClient: grpcUserClient,
+		repo:           repo,
+		mailSender:     mailSender,
+		redisCache:     redisCache,
+		loginThrottle:  loginThrottle,
+		background:     background,
+		cfg:            cfg,
+	}
+}
+
+func (s *emailLoginService) Request(ctx context.Context, email string) (string, error) {
+	// counted by address whether it has an account or not, so the limit does not tell either
+	requests, _, err := s.redisCache.RecordLoginFailure(ctx, emailLoginRequestPrefix+s.loginThrottle.Account(ctx, email), "", emailLoginRequestWindow)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error counting email login requests")
+	} else if requests > maxEmailLoginRequests {
+		return "", apperror.TooManyRequests("too many login emails requested, try again later", emailLoginRequestWindow)
+	}
+
+	loginID, err := newResetToken()
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error generating email login id")
+		return "", apperror.Internal(err)
+	}
+
+	s.background.Go(ctx, func(ctx context.Context) {
+		s.sendLoginEmail(ctx, email, loginID)
+	})
+
+	return loginID, nil
+}
+
+// sendLoginEmail creates the challenge for loginID and mails it, if an account has the email.
+func (s *emailLoginService) sendLoginEmail(ctx context.Context, email, loginID string) {
+	userResp, err := s.grpcUserClient.GetUserByEmail(ctx, email)
+	if err != nil {
+		// for unknown emails the login id leads nowhere
+		if st, ok := status.FromError(err); !ok || st.Code() != codes.NotFound {
+			logger.Log.Error().Err(err).Msg("error gRPC get user by email")
+		}
+		return
+	}
+	user := userResp.User
+
+	linkToken, err := newResetToken()
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error generating email login token")
+		return
+	}
+	code, err := newEmailLoginCode()
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error generating email login code")
+		return
+	}
+
+	challenge := &entity.EmailLoginChallenge{
+		UserID:    user.Id,
+		Email:     user.Email,
+		ExpiresAt: time.Now().Add(s.cfg.EmailLogin.EmailLoginExp),
+	}
+	if err := s.repo.CreateChallenge(ctx, challenge, loginID, linkToken, code); err != nil {
+		logger.Log.Error().Err(err).Msg("error saving email login")
+		return
+	}
+
+	link, err := tokenLink(s.cfg.EmailLogin.EmailLoginURL, linkToken)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error building email login link")
+		return
+	}
+
+	err = s.mailSender.Send(ctx, mail.Message{
+		To:      user.Email,
+		Subject: "Your sign-in code",
+		Body: fmt.Sprintf("Someone asked to sign in to your account.\n\n"+
+			"Enter this code within %s:\n%s\n\n"+
+			"Or open this link to sign in:\n%s\n\n"+
+			"If it was not you, ignore this email, nobody can sign in without it.\n",
+			s.cfg.EmailLogin.EmailLoginExp, code, link),
+	})
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error sending email login")
+		return
+	}
+
+	logger.Log.Info().
+		Str("event", "email_login_requested").
+		Str("user_id", user.Id).
+		Msg("security event: login email sent")
+}
+
+func (s *emailLoginService) VerifyLink(ctx context.Context, token string) (string, error) {
+	challenge, err := s.repo.ConsumeLink(ctx, token)
+	if err != nil {
+		if errors.Is(err, repository.ErrEmailLoginNotFound) {
+			return "", apperror.Unauthorized("invalid or expired login link")
+		}
+		logger.Log.Error().Err(err).Msg("error consuming email login link")
+		return "", apperror.Internal(err)
+	}
+
+	return s.complete(ctx, challenge)
+}
+
+func (s *emailLoginService) VerifyCode(ctx context.Context, loginID, code, ip string) (string, error) {
+	challenge, err := s.repo.ClaimCodeAttempt(ctx, loginID, maxEmailLoginAttempts)
+	if err != nil {
+		if errors.Is(err, repository.ErrEmailLoginNotFound) {
+			return "", apperror.Unauthorized("invalid or expired code")
+		}
+		logger.Log.Error().Err(err).Msg("error claiming email login")
+		return "", apperror.Internal(err)
+	}
+	if err := s.checkThrottle(ctx, challenge.UserID); err != nil {
+		return "", err
+	}
+
+	consumed, err := s.repo.ConsumeCode(ctx, loginID, code)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error consuming email login code")
+		return "", apperror.Internal(err)
+	}
+	if !consumed {
+		logger.Log.Warn().
+			Str("event", "email_login_failed").
+			Str("user_id", challenge.UserID).
+			Int("attempt", challenge.Attempts).
+			Msg("security event: invalid email login code")
+		s.recordFailure(ctx, challenge, ip)
+		return "", apperror.Unauthorized("invalid or expired code")
+	}
+
+	if err := s.redisCache.ResetLogin(ctx, emailLoginThrottlePrefix+challenge.UserID); err != nil {
+		logger.Log.Error().Err(err).Msg("error resetting email login throttle")
+	}
+
+	return s.complete(ctx, challenge)
+}
+
+// checkThrottle refuses codes of a user who got too many wrong.
+func (s *emailLoginService) checkThrottle(ctx context.Context, userID string) error {
+	until, err := s.redisCache.LoginBlockedUntil(ctx, emailLoginThrottlePrefix+userID, "")
+	if err != nil {
+		// the attempts per login email still apply
+		logger.Log.Error().Err(err).Msg("error checking email login throttle")
+		return nil
+	}
+
+	if wait := time.Until(until); wait > 0 {
+		return apperror.TooManyRequests("too many invalid codes, try again later", wait)
+	}
+	return nil
+}
+
+// recordFailure counts a wrong code for the challenge and locks the codes of its user for
+// emailLoginLockout once there were maxEmailLoginFailures. It also counts as a failed login,
+// towards locking the account.
+func (s *emailLoginService) recordFailure(ctx context.Context, challenge *entity.EmailLoginChallenge, ip string) {
+	if userResp, err := s.grpcUserClient.GetUserByID(ctx, challenge.UserID); err != nil {
+		logger.Log.Error().Err(err).Msg("error gRPC get user by ID")
+	} else {
+		s.loginThrottle.Failure(ctx, challenge.Email, ip, userResp.User)
+	}
+
+	userID := challenge.UserID
+	failures, _, err := s.redisCache.RecordLoginFailure(ctx, emailLoginThrottlePrefix+userID, ip, loginFailureWindow)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error recording email login failure")
+		return
+	}
+	if failures < maxEmailLoginFailures {
+		return
+	}
+
+	if err := s.redisCache.BlockLogin(ctx, emailLoginThrottlePrefix+userID, "", time.Now().Add(emailLoginLockout)); err != nil {
+		logger.Log.Error().Err(err).Msg("error blocking email login")
+		return
+	}
+
+	logger.Log.Warn().
+		Str("event", "email_login_locked").
+		Str("user_id", userID).
+		Int64("failures", failures).
+		Msg("security event: email login codes locked after invalid codes")
+}
+
+// complete verifies the email the challenge was sent to, which fails if the user changed it
+// since.
+func (s *emailLoginService) complete(ctx context.Context, challenge *entity.EmailLoginChallenge) (string, error) {
+	verified, err := s.grpcUserClient.MarkEmailVerified(ctx, challenge.UserID, challenge.Email)
+	if err != nil {
+		if st, ok := status.FromError(err); ok && st.Code() == codes.NotFound {
+			return "", apperror.Unauthorized("invalid credentials")
+		}
+		logger.Log.Error().Err(err).Msg("error gRPC mark email verified")
+		return "", apperror.FromGRPC(err)
+	}
+	if !verified {
+		return "", apperror.Unauthorized("invalid credentials")
+	}
+
+	return challenge.UserID, nil
+}
+
+// newEmailLoginCode returns a uniformly random 6-digit code.
+func newEmailLoginCode() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
+}
@@ -0,0 +1,311 @@
+package service
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"auth-service/internal/repository"
+	"context"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeEmailLoginRepository keeps challenges in memory by login id, with the raw link token and
+// code in place of their hashes.
+type fakeEmailLoginRepository struct {
+	mu         sync.Mutex
+	nextID     int
+	challenges map[string]*entity.EmailLoginChallenge
+}
+
+func newFakeEmailLoginRepository() *fakeEmailLoginRepository {
+	return &fakeEmailLoginRepository{challenges: map[string]*entity.EmailLoginChallenge{}}
+}
+
+func (r *fakeEmailLoginRepository) CreateChallenge(_ context.Context, challenge *entity.EmailLoginChallenge, loginID, linkToken, code string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, existing := range r.challenges {
+		if existing.UserID == challenge.UserID && existing.UsedAt == nil {
+			existing.UsedAt = &now
+		}
+	}
+
+	r.nextID++
+	challenge.ID = r.nextID
+	challenge.LoginHash = loginID
+	challenge.LinkHash = linkToken
+	challenge.CodeHash = code
+	copied := *challenge
+	r.challenges[loginID] = &copied
+	return nil
+}
+
+func (r *fakeEmailLoginRepository) ConsumeLink(_ context.Context, linkToken string) (*entity.EmailLoginChallenge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, challenge := range r.challenges {
+		if challenge.LinkHash == linkToken && challenge.UsedAt == nil && time.Now().Before(challenge.ExpiresAt) {
+			now := time.Now()
+			challenge.UsedAt = &now
+			copied := *challenge
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrEmailLoginNotFound
+}
+
+func (r *fakeEmailLoginRepository) ClaimCodeAttempt(_ context.Context, loginID string, maxAttempts int) (*entity.EmailLoginChallenge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	challenge, ok := r.challenges[loginID]
+	if !ok || challenge.UsedAt != nil || !time.Now().Before(challenge.ExpiresAt) || challenge.Attempts >= maxAttempts {
+		return nil, repository.ErrEmailLoginNotFound
+	}
+	challenge.Attempts++
+	copied := *challenge
+	return &copied, nil
+}
+
+func (r *fakeEmailLoginRepository) ConsumeCode(_ context.Context, loginID, code string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	challenge, ok := r.challenges[loginID]
+	if !ok || challenge.CodeHash != code || challenge.UsedAt != nil || !time.Now().Before(challenge.ExpiresAt) {
+		return false, nil
+	}
+	now := time.Now()
+	challenge.UsedAt = &now
+	return true, nil
+}
+
+// newTestEmailLoginService returns a service whose Request returns once the email is sent, so
+// tests can read it.
+func newTestEmailLoginService(users *fakeUserClient, sender *fakeMailSender, redisCache *fakeRedisCache, throttle LoginThrottleService, cfg config.Config) EmailLoginService {
+	background := NewBackground()
+	return waitingEmailLoginService{NewEmailLoginService(users, newFakeEmailLoginRepository(), sender, redisCache, throttle, background, cfg), background}
+}
+
+type waitingEmailLoginService struct {
+	EmailLoginService
+	background *Background
+}
+
+func (s waitingEmailLoginService) Request(ctx context.Context, email string) (string, error) {
+	defer s.background.Wait()
+	return s.EmailLoginService.Request(ctx, email)
+}
+
+var emailLoginCodePattern = regexp.MustCompile(`\n(\d{6})\n`)
+
+func codeFromMail(t *testing.T, sender *fakeMailSender) string {
+	t.Helper()
+
+	if len(sender.sent) == 0 {
+		t.Fatal("no email was sent")
+	}
+	body := sender.sent[len(sender.sent)-1].Body
+
+	match := emailLoginCodePattern.FindStringSubmatch(body)
+	if match == nil {
+		t.Fatalf("email has no code: %q", body)
+	}
+	return match[1]
+}
+
+func TestEmailLoginService_Code(t *testing.T) {
+	auth, users, _, _, sender := newTestAuthServiceWithPolicy(t, config.EmailVerificationBlock)
+	ctx := context.Background()
+	registerTestUser(t, users, "magic@example.com", "password")
+	user, _ := users.GetUserByEmail(ctx, "magic@example.com")
+	users.users[user.User.Id].EmailVerified = false
+
+	loginID, err := auth.RequestEmailLogin(ctx, "magic@example.com")
+	if err != nil {
+		t.Fatalf("RequestEmailLogin() error: %v", err)
+	}
+	if to := sender.sent[0].To; to != "magic@example.com" {
+		t.Fatalf("RequestEmailLogin() mailed %q, want magic@example.com", to)
+	}
+	code := codeFromMail(t, sender)
+
+	wrong := "000000"
+	if code == wrong {
+		wrong = "111111"
+	}
+	_, err = auth.FinishEmailLoginCode(ctx, loginID, wrong, SessionMeta{})
+	assertUnauthorized(t, err)
+
+	result, err := auth.FinishEmailLoginCode(ctx, loginID, code, SessionMeta{})
+	if err != nil {
+		t.Fatalf("FinishEmailLoginCode() error: %v", err)
+	}
+	if result.AccessToken == "" || result.RefreshToken == "" || result.UserID != user.User.Id {
+		t.Fatalf("FinishEmailLoginCode() = %+v, want a session for the user", result)
+	}
+	if !users.users[user.User.Id].EmailVerified {
+		t.Error("FinishEmailLoginCode() should verify the email the code was sent to")
+	}
+
+	// the code is single-use and the link of the same email is spent with it
+	_, err = auth.FinishEmailLoginCode(ctx, loginID, code, SessionMeta{})
+	assertUnauthorized(t, err)
+	_, err = auth.FinishEmailLoginLink(ctx, tokenFromMail(t, sender), SessionMeta{})
+	assertUnauthorized(t, err)
+}
+
+func TestEmailLoginService_Link(t *testing.T) {
+	auth, users, _, _, sender := newTestAuthServiceWithPolicy(t, config.EmailVerificationBlock)
+	ctx := context.Background()
+	registerTestUser(t, users, "link@example.com", "password")
+
+	_, _ = auth.RequestEmailLogin(ctx, "link@example.com")
+	first := tokenFromMail(t, sender)
+	loginID, _ := auth.RequestEmailLogin(ctx, "link@example.com")
+	second := tokenFromMail(t, sender)
+
+	// a new request invalidates the previous email
+	_, err := auth.FinishEmailLoginLink(ctx, first, SessionMeta{})
+	assertUnauthorized(t, err)
+
+	result, err := auth.FinishEmailLoginLink(ctx, second, SessionMeta{})
+	if err != nil {
+		t.Fatalf("FinishEmailLoginLink() error: %v", err)
+	}
+	if result.AccessToken == "" || result.Email != "link@example.com" {
+		t.Fatalf("FinishEmailLoginLink() = %+v, want a session", result)
+	}
+
+	_, err = auth.FinishEmailLoginLink(ctx, second, SessionMeta{})
+	assertUnauthorized(t, err)
+	_, err = auth.FinishEmailLoginCode(ctx, loginID, codeFromMail(t, sender), SessionMeta{})
+	assertUnauthorized(t, err)
+}
+
+func TestEmailLoginService_Rules(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("unknown email sends nothing", func(t *testing.T) {
+		auth, _, _, _, sender := newTestAuthServiceWithPolicy(t, config.EmailVerificationBlock)
+
+		loginID, err := auth.RequestEmailLogin(ctx, "nobody@example.com")
+		if err != nil {
+			t.Fatalf("RequestEmailLogin() error: %v", err)
+		}
+		if loginID == "" {
+			t.Fatal("RequestEmailLogin() should return a login id for unknown emails as well")
+		}
+		if len(sender.sent) != 0 {
+			t.Fatalf("RequestEmailLogin() sent %d emails for an unknown account", len(sender.sent))
+		}
+
+		_, err = auth.FinishEmailLoginCode(ctx, loginID, "123456", SessionMeta{})
+		assertUnauthorized(t, err)
+	})
+
+	t.Run("attempts are limited", func(t *testing.T) {
+		auth, users, _, _, sender := newTestAuthServiceWithPolicy(t, config.EmailVerificationBlock)
+		registerTestUser(t, users, "guess@example.com", "password")
+
+		loginID, _ := auth.RequestEmailLogin(ctx, "guess@example.com")
+		code := codeFromMail(t, sender)
+
+		for i := 0; i < maxEmailLoginAttempts; i++ {
+			_, err := auth.FinishEmailLoginCode(ctx, loginID, "wrong", SessionMeta{})
+			assertUnauthorized(t, err)
+		}
+
+		_, err := auth.FinishEmailLoginCode(ctx, loginID, code, SessionMeta{})
+		assertUnauthorized(t, err)
+	})
+
+	t.Run("failures count across login emails", func(t *testing.T) {
+		auth, users, _, _, sender := newTestAuthServiceWithPolicy(t, config.EmailVerificationBlock)
+		registerTestUser(t, users, "persistent@example.com", "password")
+
+		// a new login email does not bring fresh guesses
+		for i := 0; i < maxEmailLoginFailures/maxEmailLoginAttempts; i++ {
+			loginID, _ := auth.RequestEmailLogin(ctx, "persistent@example.com")
+			for j := 0; j < maxEmailLoginAttempts; j++ {
+				_, err := auth.FinishEmailLoginCode(ctx, loginID, "wrong", SessionMeta{})
+				assertUnauthorized(t, err)
+			}
+		}
+
+		loginID, _ := auth.RequestEmailLogin(ctx, "persistent@example.com")
+		_, err := auth.FinishEmailLoginCode(ctx, loginID, codeFromMail(t, sender), SessionMeta{})
+		assertAppError(t, err, 429)
+	})
+
+	t.Run("requests are limited per address", func(t *testing.T) {
+		auth, users, _, _, sender := newTestAuthServiceWithPolicy(t, config.EmailVerificationBlock)
+		registerTestUser(t, users, "in.box@gmail.com", "password")
+
+		for _, email := range []string{"in.box@gmail.com", "nobody@gmail.com"} {
+			for i := 0; i < maxEmailLoginRequests; i++ {
+				if _, err := auth.RequestEmailLogin(ctx, email); err != nil {
+					t.Fatalf("RequestEmailLogin(%s) error: %v", email, err)
+				}
+			}
+			// unknown emails are limited alike, the limit must not tell who has an account. Every
+			// spelling user-service treats as the address shares the limit
+			local, domain, _ := strings.Cut(email, "@")
+			_, err := auth.RequestEmailLogin(ctx, " "+strings.ToUpper(local)+"+more@"+domain)
+			assertAppError(t, err, 429)
+		}
+		if len(sender.sent) != maxEmailLoginRequests {
+			t.Errorf("sent %d emails, want %d", len(sender.sent), maxEmailLoginRequests)
+		}
+	})
+
+	t.Run("known email does not wait for the mail", func(t *testing.T) {
+		users := newFakeUserClient()
+		registerTestUser(t, users, "slow@example.com", "password")
+		sender := &fakeMailSender{hold: make(chan struct{})}
+		background := NewBackground()
+		cfg := config.Config{
+			EmailLogin: config.EmailLoginConfig{EmailLoginURL: "https://example.com/login/email", EmailLoginExp: time.Minute},
+		}
+		redisCache := newFakeRedisCache()
+		emailLogin := NewEmailLoginService(users, newFakeEmailLoginRepository(), sender, redisCache, NewLoginThrottleService(users, redisCache, sender, background, cfg), background, cfg)
+
+		done := make(chan error, 1)
+		go func() {
+			_, err := emailLogin.Request(ctx, "slow@example.com")
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("Request() error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Request() waited for the mail to be sent")
+		}
+
+		close(sender.hold)
+		background.Wait()
+		if len(sender.sent) != 1 || sender.sent[0].To != "slow@example.com" {
+			t.Errorf("sent %v, want the login email to slow@example.com", sender.sent)
+		}
+	})
+
+	t.Run("changed email", func(t *testing.T) {
+		auth, users, _, _, sender := newTestAuthServiceWithPolicy(t, config.EmailVerificationBlock)
+		registerTestUser(t, users, "old@example.com", "password")
+		user, _ := users.GetUserByEmail(ctx, "old@example.com")
+
+		_, _ = auth.RequestEmailLogin(ctx, "old@example.com")
+		users.users[user.User.Id].Email = "new@example.com"
+
+		_, err := auth.FinishEmailLoginLink(ctx, tokenFromMail(t, sender), SessionMeta{})
+		assertUnauthorized(t, err)
+	})
+}
@@ -0,0 +1,195 @@
+package service
+
+import (
+	"auth-service/internal/apperror"
+	grpcClient "auth-service/internal/client/grpc"
+	"auth-service/internal/config"
+	"auth-service/internal/logger"
+	"auth-service/internal/mail"
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// emailVerificationAudience keeps verification tokens from being accepted anywhere else.
+const emailVerificationAudience = "email_verification"
+
+// EmailVerificationService proves that a user owns the email they registered with.
+type EmailVerificationService interface {
+	// SendVerification mails the user a signed link that verifies email.
+	SendVerification(ctx context.Context, userID, email string) error
+	Verify(ctx context.Context, token string) error
+	// Resend mails a new link. Like ForgotPassword it succeeds for unknown and already
+	// verified accounts, so it does not reveal either.
+	Resend(ctx context.Context, email string) error
+	// RequestEmailChange checks the password of the user and mails newEmail a link that makes it
+	// their email through Verify. The current email stays until then and is told about the change.
+	RequestEmailChange(ctx context.Context, userID, password, newEmail, ip string) error
+}
+
+// verificationClaims bind the token to the address it was sent to, so a link for an old
+// email can not verify a new one.
+type verificationClaims struct {
+	Email string `json:"email"`
+	jwt.RegisteredClaims
+}
+
+type emailVerificationService struct {
+	grpcUserClient grpcClient.UserService
+	mailSender     mail.Sender
+	loginThrottle  LoginThrottleService
+	cfg            config.Config
+}
+
+func NewEmailVerificationService(grpcUserClient grpcClient.UserService, mailSender mail.Sender, loginThrottle LoginThrottleService, cfg config.Config) EmailVerificationService {
+	return &emailVerificationService{
+		grpcUserClient: grpcUserClient,
+		mailSender:     mailSender,
+		loginThrottle:  loginThrottle,
+		cfg:            cfg,
+	}
+}
+
+func (s *emailVerificationService) SendVerification(ctx context.Context, userID, email string) error {
+	ttl := s.cfg.EmailVerification.EmailVerificationTokenExp
+
+	link, err := s.verificationLink(userID, email)
+	if err != nil {
+		return err
+	}
+
+	return s.mailSender.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Welcome! Open this link within %s to verify your email:\n%s\n\n"+
+			"If you did not create an account, ignore this email.\n", ttl, link),
+	})
+}
+
+// verificationLink signs a token for the email of the user into the verification URL.
+func (s *emailVerificationService) verificationLink(userID, email string) (string, error) {
+	ttl := s.cfg.EmailVerification.EmailVerificationTokenExp
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, verificationClaims{
+		Email: email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   userID,
+			Audience:  jwt.ClaimStrings{emailVerificationAudience},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}).SignedString([]byte(s.cfg.EmailVerification.EmailVerificationSecret))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign verification token: %w", err)
+	}
+
+	link, err := tokenLink(s.cfg.EmailVerification.EmailVerificationURL, token)
+	if err != nil {
+		return "", fmt.Errorf("failed to build verification link: %w", err)
+	}
+	return link, nil
+}
+
+func (s *emailVerificationService) Verify(ctx context.Context, token string) error {
+	claims := &verificationClaims{}
+	_, err := jwt.ParseWithClaims(token, claims, func(*jwt.Token) (any, error) {
+		return []byte(s.cfg.EmailVerification.EmailVerificationSecret), nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithAudience(emailVerificationAudience),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil || claims.Subject == "" || claims.Email == "" {
+		return apperror.BadRequest("invalid or expired verification token")
+	}
+
+	verified, err := s.grpcUserClient.MarkEmailVerified(ctx, claims.Subject, claims.Email)
+	if err != nil {
+		if st, ok := status.FromError(err); ok && st.Code() == codes.NotFound {
+			return apperror.BadRequest("invalid or expired verification token")
+		}
+		logger.Log.Error().Err(err).Msg("error gRPC mark email verified")
+		return apperror.FromGRPC(err)
+	}
+	if !verified {
+		// the user changed their email, or asked for another one, after the link was sent
+		return apperror.BadRequest("invalid or expired verification token")
+	}
+
+	return nil
+}
+
+func (s *emailVerificationService) Resend(ctx context.Context, email string) error {
+	userResp, err := s.grpcUserClient.GetUserByEmail(ctx, email)
+	if err != nil {
+		if st, ok := status.FromError(err); ok && st.Code() == codes.NotFound {
+			return nil
+		}
+		logger.Log.Error().Err(err).Msg("error gRPC get user by email")
+		return apperror.FromGRPC(err)
+	}
+	if userResp.User.EmailVerified {
+		return nil
+	}
+
+	if err := s.SendVerification(ctx, userResp.User.Id, userResp.User.Email); err != nil {
+		logger.Log.Error().Err(err).Msg("error sending verification email")
+	}
+
+	return nil
+}
+
+func (s *emailVerificationService) RequestEmailChange(ctx context.Context, userID, password, newEmail, ip string) error {
+	userResp, err := s.grpcUserClient.GetUserByID(ctx, userID)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error gRPC get user by ID")
+		return apperror.FromGRPC(err)
+	}
+	if err := s.loginThrottle.VerifyPassword(ctx, userResp.User, password, ip); err != nil {
+		return err
+	}
+
+	email, err := s.grpcUserClient.RequestEmailChange(ctx, userID, newEmail)
+	if err != nil {
+		return apperror.FromGRPC(err)
+	}
+
+	link, err := s.verificationLink(userID, email)
+	if err != nil {
+		return apperror.Internal(err)
+	}
+	ttl := s.cfg.EmailVerification.EmailVerificationTokenExp
+	if err := s.mailSender.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Confirm your new email",
+		Body: fmt.Sprintf("Open this link within %s to make this your account email:\n%s\n\n"+
+			"If you did not ask for this, ignore this email.\n", ttl, link),
+	}); err != nil {
+		logger.Log.Error().Err(err).Msg("error sending email change verification")
+		return apperror.Internal(err)
+	}
+
+	// the old address learns about the change in case the password was stolen
+	if err := s.mailSender.Send(ctx, mail.Message{
+		To:      userResp.User.Email,
+		Subject: "Your email is being changed",
+		Body: fmt.Sprintf("Someone asked to change the email of your account to %s. It changes "+
+			"once the link sent there is opened.\n\n"+
+			"If this was not you, reset your password.\n", email),
+	}); err != nil {
+		logger.Log.Error().Err(err).Msg("error sending email change notice")
+	}
+
+	logger.Log.Info().
+		Str("event", "email_change_requested").
+		Str("user_id", userID).
+		Msg("email change requested")
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"auth-service/internal/config"
+	"context"
+	"testing"
+)
+
+func TestEmailVerification_RestrictPolicy(t *testing.T) {
+	svc, users, _, _, sender := newTestAuthServiceWithPolicy(t, config.EmailVerificationRestrict)
+	ctx := context.Background()
+	mgr, _ := newTestManager()
+
+	registered, err := svc.Register(ctx, "restrict@example.com", "password", "", SessionMeta{})
+	if err != nil {
+		t.Fatalf("Register() error: %v", err)
+	}
+	if registered.AccessToken == "" {
+		t.Fatal("Register() issued no tokens under the restrict policy")
+	}
+
+	claims, _ := mgr.ValidateAccessToken(registered.AccessToken)
+	if !claims.Unverified {
+		t.Fatal("Register() access token is not marked unverified")
+	}
+
+	verification := svc.(*authService).emailVerification
+	if err := verification.Verify(ctx, tokenFromMail(t, sender)); err != nil {
+		t.Fatalf("Verify() error: %v", err)
+	}
+	if !users.users[registered.UserID].EmailVerified {
+		t.Fatal("Verify() did not mark the email verified")
+	}
+
+	refreshed, err := svc.Refresh(ctx, registered.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh() error: %v", err)
+	}
+	claims, _ = mgr.ValidateAccessToken(refreshed.AccessToken)
+	if claims.Unverified {
+		t.Fatal("Refresh() after verifying still issued a restricted token")
+	}
+}
+
+func TestEmailVerification_BlockPolicy(t *testing.T) {
+	svc, _, _, _, sender := newTestAuthServiceWithPolicy(t, config.EmailVerificationBlock)
+	ctx := context.Background()
+
+	registered, err := svc.Register(ctx, "block@example.com", "password", "", SessionMeta{})
+	if err != nil {
+		t.Fatalf("Register() error: %v", err)
+	}
+	if !registered.VerificationRequired || registered.AccessToken != "" || registered.RefreshToken != "" {
+		t.Fatalf("Register() = %+v, want no tokens until the email is verified", registered)
+	}
+
+	_, err = svc.Login(ctx, "block@example.com", "password", SessionMeta{})
+	assertAppError(t, err, 403)
+
+	// a wrong password is reported as such, not as an unverified account
+	_, err = svc.Login(ctx, "block@example.com", "wrong-password", SessionMeta{})
+	assertUnauthorized(t, err)
+
+	if err := svc.(*authService).emailVerification.Verify(ctx, tokenFromMail(t, sender)); err != nil {
+		t.Fatalf("Verify() error: %v", err)
+	}
+	if _, err := svc.Login(ctx, "block@example.com", "password", SessionMeta{}); err != nil {
+		t.Fatalf("Login() after verifying error: %v", err)
+	}
+}
+
+func TestEmailVerification_InvalidTokens(t *testing.T) {
+	svc, users, _, _, sender := newTestAuthServiceWithPolicy(t, config.EmailVerificationRestrict)
+	ctx := context.Background()
+	verification := svc.(*authService).emailVerification
+
+	registered, err := svc.Register(ctx, "invalid@example.com", "password", "", SessionMeta{})
+	if err != nil {
+		t.Fatalf("Register() error: %v", err)
+	}
+	token := tokenFromMail(t, sender)
+
+	mgr, _ := newTestManager()
+	accessToken, _ := mgr.GenerateAccessToken(Principal{UserID: registered.UserID})
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"garbage", "not-a-token"},
+		{"tampered", token + "x"},
+		{"access token", accessToken},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			assertAppError(t, verification.Verify(ctx, tc.token), 400)
+		})
+	}
+
+	t.Run("email changed after the link was sent", func(t *testing.T) {
+		users.users[registered.UserID].Email = "changed@example.com"
+		defer func() { users.users[registered.UserID].Email = "invalid@example.com" }()
+
+		assertAppError(t, verification.Verify(ctx, token), 400)
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		expired := NewEmailVerificationService(users, sender, svc.(*authService).loginThrottle, config.Config{
+			EmailVerification: config.EmailVerificationConfig{
+				EmailVerificationSecret:   "verification-secret",
+				EmailVerificationTokenExp: -1,
+			},
+		})
+		if err := expired.SendVerification(ctx, registered.UserID, "invalid@example.com"); err != nil {
+			t.Fatalf("SendVerification() error: %v", err)
+		}
+
+		assertAppError(t, verification.Verify(ctx, tokenFromMail(t, sender)), 400)
+	})
+}
+
+func TestEmailVerification_Resend(t *testing.T) {
+	svc, users, _, _, sender := newTestAuthServiceWithPolicy(t, config.EmailVerificationRestrict)
+	ctx := context.Background()
+	verification := svc.(*authService).emailVerification
+
+	if _, err := svc.Register(ctx, "resend@example.com", "password", "", SessionMeta{}); err != nil {
+		t.Fatalf("Register() error: %v", err)
+	}
+	registerTestUser(t, users, "verified@example.com", "password")
+	sent := len(sender.sent)
+
+	for _, email := range []string{"nobody@example.com", "verified@example.com"} {
+		if err := verification.Resend(ctx, email); err != nil {
+			t.Fatalf("Resend(%s) error: %v", email, err)
+		}
+	}
+	if len(sender.sent) != sent {
+		t.Fatal("Resend() mailed an unknown or already verified account")
+	}
+
+	if err := verification.Resend(ctx, "resend@example.com"); err != nil {
+		t.Fatalf("Resend() error: %v", err)
+	}
+	if len(sender.sent) != sent+1 || sender.sent[sent].To != "resend@example.com" {
+		t.Fatal("Resend() did not mail the unverified account")
+	}
+}
+
+func TestEmailVerification_RequestEmailChange(t *testing.T) {
+	svc, users, _, _, sender := newTestAuthServiceWithPolicy(t, config.EmailVerificationRestrict)
+	ctx := context.Background()
+	verification := svc.(*authService).emailVerification
+
+	registerTestUser(t, users, "old@example.com", "password")
+	registerTestUser(t, users, "taken@example.com", "password")
+	old, _ := users.GetUserByEmail(ctx, "old@example.com")
+	id := old.User.Id
+
+	assertAppError(t, verification.RequestEmailChange(ctx, id, "wrong-password", "new@example.com", ""), 400)
+	assertAppError(t, verification.RequestEmailChange(ctx, id, "password", "taken@example.com", ""), 409)
+	if len(sender.sent) != 0 {
+		t.Fatal("RequestEmailChange() mailed a rejected change")
+	}
+
+	if err := verification.RequestEmailChange(ctx, id, "password", "new@example.com", ""); err != nil {
+		t.Fatalf("RequestEmailChange() error: %v", err)
+	}
+	if len(sender.sent) != 2 || sender.sent[0].To != "new@example.com" || sender.sent[1].To != "old@example.com" {
+		t.Fatalf("RequestEmailChange() sent %+v, want a link to the new and a notice to the old email", sender.sent)
+	}
+	if users.users[id].Email != "old@example.com" {
+		t.Fatal("RequestEmailChange() changed the email before it was verified")
+	}
+
+	// the notice carries no link, only the mail to the new address can make the change
+	token := tokenFromMail(t, &fakeMailSender{sent: sender.sent[:1]})
+	if err := verification.Verify(ctx, token); err != nil {
+		t.Fatalf("Verify() error: %v", err)
+	}
+	if u := users.users[id]; u.Email != "new@example.com" || !u.EmailVerified {
+		t.Fatalf("Verify() user = %+v, want the new email verified", u)
+	}
+
+	// a second use of the link finds the email already verified, not a pending change
+	if err := verification.Verify(ctx, token); err != nil {
+		t.Fatalf("Verify() again error: %v", err)
+	}
+	if _, err := svc.Login(ctx, "new@example.com", "password", SessionMeta{}); err != nil {
+		t.Fatalf("Login() with the new email error: %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+package service
+
+import (
+	"auth-service/internal/apperror"
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"auth-service/internal/logger"
+	"auth-service/internal/repository"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// KeyService persists the keyring so keys can be added, promoted and retired at runtime
+// and are shared by every auth-service instance.
+type KeyService interface {
+	// Load reads the keys from the database into the keyring. Keys from the config that are
+	// not stored yet are added first, so changing a configured secret starts a rotation
+	// instead of invalidating every issued token.
+	Load(ctx context.Context) error
+	// Watch reloads the keyring every interval until ctx is done.
+	Watch(ctx context.Context, interval time.Duration)
+
+	ListKeys(ctx context.Context) ([]*entity.SigningKey, error)
+	CreateKey(ctx context.Context, purpose KeyPurpose, alg string, activatesAt *time.Time) (*entity.SigningKey, error)
+	// EnsureKey creates a key with the algorithm when the purpose has none that can sign.
+	EnsureKey(ctx context.Context, purpose KeyPurpose, alg string) error
+	SetKeyState(ctx context.Context, purpose KeyPurpose, kid string, state KeyState, activatesAt *time.Time) error
+}
+
+type keyService struct {
+	keyRepo    repository.KeyRepository
+	keyring    *Keyring
+	configKeys []*RingKey
+	accessAlg  string
+	box        secretBox
+}
+
+func NewKeyService(keyRepo repository.KeyRepository, keyring *Keyring, cfg config.Config) KeyService {
+	return &keyService{
+		keyRepo:    keyRepo,
+		keyring:    keyring,
+		configKeys: keyring.Keys(),
+		accessAlg:  accessTokenAlg(cfg.JWT),
+		box:        newSecretBox(cfg.JWT.KeyringEncryptionKey),
+	}
+}
+
+func (s *keyService) Load(ctx context.Context) error {
+	stored, err := s.keyRepo.ListKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, k := range s.configKeys {
+		known := slices.ContainsFunc(stored, func(row *entity.SigningKey) bool {
+			return row.Purpose == string(k.Purpose) && row.ID == k.ID
+		})
+		if known {
+			continue
+		}
+
+		row, err := s.newRow(k.SigningKey, k.Purpose, time.Now())
+		if err != nil {
+			return err
+		}
+		if err := s.keyRepo.CreateKey(ctx, row); err != nil {
+			return err
+		}
+
+		logger.Log.Info().
+			Str("kid", row.ID).
+			Str("purpose", row.Purpose).
+			Msg("configured signing key added to the keyring")
+
+		stored = append(stored, row)
+	}
+
+	keys := make([]*RingKey, 0, len(stored))
+	for _, row := range stored {
+		key, err := s.open(row)
+		if err != nil {
+			return fmt.Errorf("failed to load signing key %s: %w", row.ID, err)
+		}
+		keys = append(keys, key)
+	}
+
+	// refuse a key set that cannot sign, the current keyring stays in use
+	ring := NewKeyring(keys...)
+	for _, purpose := range []KeyPurpose{KeyPurposeAccess, KeyPurposeRefresh} {
+		if _, err := ring.Signer(purpose, time.Now()); err != nil {
+			return fmt.Errorf("%s keys: %w", purpose, err)
+		}
+	}
+
+	s.keyring.Replace(keys)
+	return nil
+}
+
+func (s *keyService) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Load(ctx); err != nil && ctx.Err() == nil {
+				logger.Log.Error().Err(err).Msg("error reloading signing keys")
+			}
+		}
+	}
+}
+
+func (s *keyService) ListKeys(ctx context.Context) ([]*entity.SigningKey, error) {
+	keys, err := s.keyRepo.ListKeys(ctx)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error listing signing keys")
+		return nil, apperror.Internal(err)
+	}
+
+	return keys, nil
+}
+
+func (s *keyService) CreateKey(ctx context.Context, purpose KeyPurpose, alg string, activatesAt *time.Time) (*entity.SigningKey, error) {
+	if !purpose.Valid() {
+		return nil, apperror.BadRequest("invalid key purpose")
+	}
+	if !slices.Contains(supportedAlgs, alg) {
+		return nil, apperror.BadRequest("unsupported signing algorithm")
+	}
+	// ID tokens are verified by other apps through the published keys
+	if purpose == KeyPurposeIDToken && alg == "HS256" {
+		return nil, apperror.BadRequest("id token keys must be asymmetric")
+	}
+	// the gateway only accepts access tokens signed with the configured algorithm
+	if purpose == KeyPurposeAccess && alg != s.accessAlg {
+		return nil, apperror.BadRequest("access keys must use " + s.accessAlg)
+	}
+
+	key, err := GenerateSigningKey(alg)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error generating signing key")
+		return nil, apperror.Internal(err)
+	}
+
+	activation := time.Now()
+	if activatesAt != nil {
+		activation = *activatesAt
+	}
+
+	row, err := s.newRow(key, purpose, activation)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error sealing signing key")
+		return nil, apperror.Internal(err)
+	}
+
+	if err := s.keyRepo.CreateKey(ctx, row); err != nil {
+		logger.Log.Error().Err(err).Msg("error saving signing key")
+		return nil, apperror.Internal(err)
+	}
+
+	if err := s.Load(ctx); err != nil {
+		logger.Log.Error().Err(err).Msg("error reloading signing keys")
+		return nil, apperror.Internal(err)
+	}
+
+	logger.Log.Info().
+		Str("kid", row.ID).
+		Str("purpose", row.Purpose).
+		Time("activates_at", row.ActivatesAt).
+		Msg("signing key created")
+
+	return row, nil
+}
+
+func (s *keyService) EnsureKey(ctx context.Context, purpose KeyPurpose, alg string) error {
+	if _, err := s.keyring.Signer(purpose, time.Now()); err == nil {
+		return nil
+	}
+
+	_, err := s.CreateKey(ctx, purpose, alg, nil)
+	return err
+}
+
+// SetKeyState moves a key between states. Promoting a key to active without an activation
+// time makes it the signer right away. The last key able to sign for a purpose can not be
+// demoted or retired.
+func (s *keyService) SetKeyState(ctx context.Context, purpose KeyPurpose, kid string, state KeyState, activatesAt *time.Time) error {
+	if !state.Valid() {
+		return apperror.BadRequest("invalid key state")
+	}
+
+	keys, err := s.keyRepo.ListKeys(ctx)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error listing signing keys")
+		return apperror.Internal(err)
+	}
+
+	idx := slices.IndexFunc(keys, func(k *entity.SigningKey) bool {
+		return k.Purpose == string(purpose) && k.ID == kid
+	})
+	if idx == -1 {
+		return apperror.NotFound("signing key not found")
+	}
+	target := keys[idx]
+
+	now := time.Now()
+	if state == KeyStateActive && target.State != string(KeyStateActive) && activatesAt == nil {
+		activatesAt = &now
+	}
+
+	if state != KeyStateActive && canSign(target, now) {
+		other := slices.ContainsFunc(keys, func(k *entity.SigningKey) bool {
+			return k != target && k.Purpose == target.Purpose && canSign(k, now)
+		})
+		if !other {
+			return apperror.Conflict("cannot deactivate the only active signing key")
+		}
+	}
+
+	if err := s.keyRepo.UpdateKeyState(ctx, string(purpose), kid, string(state), activatesAt); err != nil {
+		if errors.Is(err, repository.ErrSigningKeyNotFound) {
+			return apperror.NotFound("signing key not found")
+		}
+		logger.Log.Error().Err(err).Msg("error updating signing key")
+		return apperror.Internal(err)
+	}
+
+	if err := s.Load(ctx); err != nil {
+		logger.Log.Error().Err(err).Msg("error reloading signing keys")
+		return apperror.Internal(err)
+	}
+
+	logger.Log.Info().
+		Str("kid", kid).
+		Str("purpose", string(purpose)).
+		Str("state", string(state)).
+		Msg("signing key state changed")
+
+	return nil
+}
+
+func canSign(k *entity.SigningKey, now time.Time) bool {
+	return k.State == string(KeyStateActive) && !k.ActivatesAt.After(now)
+}
+
+func (s *keyService) newRow(key *SigningKey, purpose KeyPurpose, activatesAt time.Time) (*entity.SigningKey, error) {
+	material, err := MarshalSigningKey(key)
+	if err != nil {
+		return nil, err
+	}
+
+	row := &entity.SigningKey{
+		ID:          key.ID,
+		Purpose:     string(purpose),
+		Algorithm:   key.Method.Alg(),
+		State:       string(KeyStateActive),
+		ActivatesAt: activatesAt,
+	}
+
+	// the purpose and id are authenticated, so a sealed key can not be moved to another row
+	row.KeyMaterial, err = s.box.seal(material, sealAD(row))
+	if err != nil {
+		return nil, err
+	}
+
+	return row, nil
+}
+
+func (s *keyService) open(row *entity.SigningKey) (*RingKey, error) {
+	material, err := s.box.open(row.KeyMaterial, sealAD(row))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt key, check JWT_KEYRING_ENCRYPTION_KEY: %w", err)
+	}
+
+	key, err := UnmarshalSigningKey(row.Algorithm, material)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RingKey{
+		SigningKey:  key,
+		Purpose:     KeyPurpose(row.Purpose),
+		State:       KeyState(row.State),
+		ActivatesAt: row.ActivatesAt,
+	}, nil
+}
+
+func sealAD(row *entity.SigningKey) []byte {
+	return []byte(row.Purpose + "/" + row.ID)
+}
@@ -0,0 +1,172 @@
+package service
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"auth-service/internal/repository"
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeKeyRepository keeps signing keys in memory.
+type fakeKeyRepository struct {
+	mu   sync.Mutex
+	keys []*entity.SigningKey
+}
+
+func (r *fakeKeyRepository) ListKeys(context.Context) ([]*entity.SigningKey, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	keys := make([]*entity.SigningKey, 0, len(r.keys))
+	for _, k := range r.keys {
+		copied := *k
+		keys = append(keys, &copied)
+	}
+	return keys, nil
+}
+
+func (r *fakeKeyRepository) CreateKey(_ context.Context, key *entity.SigningKey) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.keys {
+		if k.Purpose == key.Purpose && k.ID == key.ID {
+			return nil
+		}
+	}
+	copied := *key
+	r.keys = append(r.keys, &copied)
+	return nil
+}
+
+func (r *fakeKeyRepository) UpdateKeyState(_ context.Context, purpose, id, state string, activatesAt *time.Time) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, k := range r.keys {
+		if k.Purpose == purpose && k.ID == id {
+			k.State = state
+			if activatesAt != nil {
+				k.ActivatesAt = *activatesAt
+			}
+			return nil
+		}
+	}
+	return repository.ErrSigningKeyNotFound
+}
+
+func newTestKeyService(t *testing.T, repo *fakeKeyRepository, jwt config.JWTConfig) (KeyService, TokenManager) {
+	t.Helper()
+
+	mgr, err := NewTokenManager(jwt)
+	if err != nil {
+		t.Fatalf("NewTokenManager() error: %v", err)
+	}
+
+	svc := NewKeyService(repo, mgr.Keyring(), config.Config{JWT: config.JWTConfig{KeyringEncryptionKey: "keyring_key"}})
+	if err := svc.Load(context.Background()); err != nil {
+		t.Fatalf("Load() error: %v", err)
+	}
+	return svc, mgr
+}
+
+func TestKeyService_LoadSeedsConfiguredKeys(t *testing.T) {
+	repo := &fakeKeyRepository{}
+	_, cfg := newTestManager()
+	_, first := newTestKeyService(t, repo, cfg)
+
+	if len(repo.keys) != 2 {
+		t.Fatalf("Load() stored %d keys, want access and refresh", len(repo.keys))
+	}
+	for _, k := range repo.keys {
+		if k.KeyMaterial == "" || k.KeyMaterial == cfg.JWTAccessTokenSecret || k.KeyMaterial == cfg.JWTRefreshTokenSecret {
+			t.Errorf("key %s material is not sealed", k.ID)
+		}
+	}
+
+	token, _ := first.GenerateAccessToken(Principal{UserID: "user-1", SessionID: "session-1"})
+
+	// a new access secret in the config is added next to the stored one instead of replacing it
+	rotated := cfg
+	rotated.JWTAccessTokenSecret = "secret_access_rotated"
+	_, second := newTestKeyService(t, repo, rotated)
+
+	if len(repo.keys) != 3 {
+		t.Fatalf("Load() stored %d keys after config change, want 3", len(repo.keys))
+	}
+	if _, err := second.ValidateAccessToken(token); err != nil {
+		t.Errorf("ValidateAccessToken() with the previous secret error: %v", err)
+	}
+
+	newToken, _ := second.GenerateAccessToken(Principal{UserID: "user-1", SessionID: "session-1"})
+	if _, err := validateHS256(newToken, []byte(rotated.JWTAccessTokenSecret)); err != nil {
+		t.Errorf("new tokens are not signed with the configured secret: %v", err)
+	}
+}
+
+func TestKeyService_CreateAndRetireKey(t *testing.T) {
+	ctx := context.Background()
+	repo := &fakeKeyRepository{}
+	_, cfg := newTestManager()
+	svc, mgr := newTestKeyService(t, repo, cfg)
+
+	oldToken, _ := mgr.GenerateAccessToken(Principal{UserID: "user-1", SessionID: "session-1"})
+	oldKid := tokenKid(t, oldToken)
+
+	created, err := svc.CreateKey(ctx, KeyPurposeAccess, "HS256", nil)
+	if err != nil {
+		t.Fatalf("CreateKey() error: %v", err)
+	}
+
+	newToken, _ := mgr.GenerateAccessToken(Principal{UserID: "user-1", SessionID: "session-1"})
+	if kid := tokenKid(t, newToken); kid != created.ID {
+		t.Errorf("token kid = %v, want the created key %v", kid, created.ID)
+	}
+	if n := len(mgr.InternalJWKS().Keys); n != 2 {
+		t.Errorf("InternalJWKS() returned %d keys, want the old and the created key", n)
+	}
+
+	if err := svc.SetKeyState(ctx, KeyPurposeAccess, oldKid, KeyStateVerifyOnly, nil); err != nil {
+		t.Fatalf("SetKeyState() verify_only error: %v", err)
+	}
+	if _, err := mgr.ValidateAccessToken(oldToken); err != nil {
+		t.Errorf("ValidateAccessToken() with verify-only key error: %v", err)
+	}
+
+	if err := svc.SetKeyState(ctx, KeyPurposeAccess, oldKid, KeyStateRetired, nil); err != nil {
+		t.Fatalf("SetKeyState() retired error: %v", err)
+	}
+	if _, err := mgr.ValidateAccessToken(oldToken); err == nil {
+		t.Error("ValidateAccessToken() accepted a token signed with a retired key")
+	}
+
+	// the keyring must always be able to sign
+	err = svc.SetKeyState(ctx, KeyPurposeAccess, created.ID, KeyStateRetired, nil)
+	assertAppError(t, err, 409)
+
+	err = svc.SetKeyState(ctx, KeyPurposeAccess, "missing", KeyStateRetired, nil)
+	assertAppError(t, err, 404)
+
+	_, err = svc.CreateKey(ctx, KeyPurposeAccess, "none", nil)
+	assertAppError(t, err, 400)
+
+	// the gateway would reject tokens of an algorithm other than the configured one
+	_, err = svc.CreateKey(ctx, KeyPurposeAccess, "EdDSA", nil)
+	assertAppError(t, err, 400)
+}
+
+func TestKeyService_LoadRejectsWrongEncryptionKey(t *testing.T) {
+	repo := &fakeKeyRepository{}
+	_, cfg := newTestManager()
+	newTestKeyService(t, repo, cfg)
+
+	mgr, _ := NewTokenManager(cfg)
+	svc := NewKeyService(repo, mgr.Keyring(), config.Config{JWT: config.JWTConfig{KeyringEncryptionKey: "other"}})
+
+	if err := svc.Load(context.Background()); err == nil {
+		t.Error("Load() decrypted keys with the wrong encryption key")
+	}
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func tokenKid(t *testing.T, token string) string {
+	t.Helper()
+
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, &jwt.RegisteredClaims{})
+	if err != nil {
+		t.Fatalf("ParseUnverified() error: %v", err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+func TestKeyring_Signer(t *testing.T) {
+	now := time.Now()
+	old := &RingKey{SigningKey: NewHMACSigningKey([]byte("old")), Purpose: KeyPurposeAccess, State: KeyStateActive, ActivatesAt: now.Add(-time.Hour)}
+	current := &RingKey{SigningKey: NewHMACSigningKey([]byte("current")), Purpose: KeyPurposeAccess, State: KeyStateActive, ActivatesAt: now.Add(-time.Minute)}
+	scheduled := &RingKey{SigningKey: NewHMACSigningKey([]byte("next")), Purpose: KeyPurposeAccess, State: KeyStateActive, ActivatesAt: now.Add(time.Hour)}
+	refresh := &RingKey{SigningKey: NewHMACSigningKey([]byte("refresh")), Purpose: KeyPurposeRefresh, State: KeyStateActive, ActivatesAt: now}
+
+	ring := NewKeyring(old, current, scheduled, refresh)
+
+	signer, err := ring.Signer(KeyPurposeAccess, now)
+	if err != nil || signer != current {
+		t.Fatalf("Signer() = %v, %v, want the latest activated key", signer, err)
+	}
+
+	// the scheduled key takes over once its activation time has passed
+	if signer, _ := ring.Signer(KeyPurposeAccess, now.Add(2*time.Hour)); signer != scheduled {
+		t.Errorf("Signer() after activation = %v, want the scheduled key", signer.ID)
+	}
+
+	// scheduled keys verify right away so they can be published before they sign
+	if _, ok := ring.Verifier(KeyPurposeAccess, scheduled.ID); !ok {
+		t.Error("Verifier() did not return the scheduled key")
+	}
+	if _, ok := ring.Verifier(KeyPurposeAccess, refresh.ID); ok {
+		t.Error("Verifier() returned a key of another purpose")
+	}
+
+	ring.Replace([]*RingKey{refresh})
+	if _, err := ring.Signer(KeyPurposeAccess, now); err != ErrNoSigningKey {
+		t.Errorf("Signer() without access keys error = %v, want ErrNoSigningKey", err)
+	}
+}
+
+func TestManager_KeyRotation(t *testing.T) {
+	mgr, _ := newTestManager()
+	ring := mgr.Keyring()
+
+	before, err := mgr.GenerateAccessToken(Principal{UserID: "user-1", SessionID: "session-1"})
+	if err != nil {
+		t.Fatalf("GenerateAccessToken() error: %v", err)
+	}
+	oldKid := tokenKid(t, before)
+	if oldKid == "" {
+		t.Fatal("GenerateAccessToken() did not set a kid header")
+	}
+
+	newKey, _ := GenerateSigningKey("ES256")
+	keys := ring.Keys()
+	for _, k := range keys {
+		if k.ID == oldKid {
+			k.State = KeyStateVerifyOnly
+		}
+	}
+	ring.Replace(append(keys, &RingKey{SigningKey: newKey, Purpose: KeyPurposeAccess, State: KeyStateActive, ActivatesAt: time.Now()}))
+
+	after, err := mgr.GenerateAccessToken(Principal{UserID: "user-1", SessionID: "session-1"})
+	if err != nil {
+		t.Fatalf("GenerateAccessToken() after rotation error: %v", err)
+	}
+	if kid := tokenKid(t, after); kid != newKey.ID {
+		t.Errorf("token kid after rotation = %v, want %v", kid, newKey.ID)
+	}
+
+	// tokens issued before the rotation stay valid during the overlap window
+	for _, token := range []string{before, after} {
+		if _, err := mgr.ValidateAccessToken(token); err != nil {
+			t.Errorf("ValidateAccessToken() error: %v", err)
+		}
+	}
+
+	// the shared secret never shows up in the public JWKS, only in the internal one
+	if n := len(mgr.JWKS().Keys); n != 1 {
+		t.Errorf("JWKS() returned %d keys, want 1", n)
+	}
+	if n := len(mgr.InternalJWKS().Keys); n != 2 {
+		t.Errorf("InternalJWKS() returned %d keys, want 2", n)
+	}
+
+	for _, k := range keys {
+		if k.ID == oldKid {
+			k.State = KeyStateRetired
+		}
+	}
+	if _, err := mgr.ValidateAccessToken(before); err == nil {
+		t.Error("ValidateAccessToken() accepted a token signed with a retired key")
+	}
+}
+
+func TestManager_ValidateAccessToken_WithoutKid(t *testing.T) {
+	mgr, cfg := newTestManager()
+
+	// tokens issued before key ids were introduced have no kid header
+	legacy, _ := signHS256("user-1", time.Minute, []byte(cfg.JWTAccessTokenSecret))
+	if _, err := mgr.ValidateAccessToken(legacy); err != nil {
+		t.Errorf("ValidateAccessToken() without kid error: %v", err)
+	}
+
+	forged, _ := signHS256("user-1", time.Minute, []byte("other secret"))
+	if _, err := mgr.ValidateAccessToken(forged); err == nil {
+		t.Error("ValidateAccessToken() accepted a token signed with an unknown secret")
+	}
+}
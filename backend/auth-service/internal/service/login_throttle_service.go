@@ -0,0 +1,198 @@
+package service
+
+import (
+	"auth-service/internal/apperror"
+	"auth-service/internal/cache"
+	grpcClient "auth-service/internal/client/grpc"
+	"auth-service/internal/config"
+	userpb "auth-service/internal/genproto/user/v1"
+	"auth-service/internal/logger"
+	"auth-service/internal/mail"
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// loginFailureWindow is how long failed logins of an account are remembered after the last one.
+const loginFailureWindow = 24 * time.Hour
+
+// loginBackoffBase is the wait after the first failed login from an IP that is not free.
+const loginBackoffBase = time.Second
+
+// LoginThrottleService slows down password guessing against an account. Failed logins from one
+// IP back off exponentially, and too many from any IP lock the account for a while. Failures
+// are counted by the email as user-service normalizes it, so every spelling of an address shares
+// them and emails without an account are throttled exactly like the others.
+type LoginThrottleService interface {
+	// Account is the key failed logins of the email are counted under.
+	Account(ctx context.Context, email string) string
+	// Check refuses a login of the email from the ip while the account is locked or the ip has to
+	// wait.
+	Check(ctx context.Context, email, ip string) error
+	// Failure records a wrong password, or a wrong code of a later step of the login, for the
+	// email from the ip. user is nil when no account has the email.
+	Failure(ctx context.Context, email, ip string, user *userpb.User)
+	// Success forgets the failed logins of the email, once the user is signed in.
+	Success(ctx context.Context, email string)
+	// VerifyPassword checks the current password a signed-in user confirms a change with. Wrong
+	// ones count as failed logins of the account, so a stolen session cannot guess it unthrottled.
+	VerifyPassword(ctx context.Context, user *userpb.User, password, ip string) error
+	// Unlock lifts the lockout and the waits of the user's account.
+	Unlock(ctx context.Context, userID string) error
+}
+
+type loginThrottleService struct {
+	grpcUserClient grpcClient.UserService
+	redisCache     cache.RedisCache
+	mailSender     mail.Sender
+	background     *Background
+	cfg            config.Config
+}
+
+func NewLoginThrottleService(grpcUserClient grpcClient.UserService, redisCache cache.RedisCache, mailSender mail.Sender, background *Background, cfg config.Config) LoginThrottleService {
+	return &loginThrottleService{
+		grpcUserClient: grpcUserClient,
+		redisCache:     redisCache,
+		mailSender:     mailSender,
+		background:     background,
+		cfg:            cfg,
+	}
+}
+
+func (s *loginThrottleService) Check(ctx context.Context, email, ip string) error {
+	until, err := s.redisCache.LoginBlockedUntil(ctx, s.Account(ctx, email), ip)
+	if err != nil {
+		// the password is still checked, a redis outage should not lock everyone out
+		logger.Log.Error().Err(err).Msg("error checking login throttle")
+		return nil
+	}
+
+	if wait := time.Until(until); wait > 0 {
+		return apperror.TooManyRequests("too many failed login attempts, try again later", wait)
+	}
+
+	return nil
+}
+
+func (s *loginThrottleService) Failure(ctx context.Context, email, ip string, user *userpb.User) {
+	cfg := s.cfg.LoginThrottle
+	account := s.Account(ctx, email)
+
+	accountFailures, ipFailures, err := s.redisCache.RecordLoginFailure(ctx, account, ip, loginFailureWindow)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error recording failed login")
+		return
+	}
+
+	if extra := ipFailures - int64(cfg.LoginBackoffAfter); extra > 0 {
+		wait := cfg.LoginBackoffMax
+		// doubles with every further failure until it reaches the maximum
+		if extra <= 30 {
+			wait = min(loginBackoffBase<<(extra-1), cfg.LoginBackoffMax)
+		}
+		if err := s.redisCache.BlockLogin(ctx, account, ip, time.Now().Add(wait)); err != nil {
+			logger.Log.Error().Err(err).Msg("error blocking login")
+		}
+	}
+
+	if accountFailures < int64(cfg.LoginLockoutThreshold) {
+		return
+	}
+
+	// every failure past the threshold renews the lockout
+	if err := s.redisCache.BlockLogin(ctx, account, "", time.Now().Add(cfg.LoginLockoutDuration)); err != nil {
+		logger.Log.Error().Err(err).Msg("error locking account")
+		return
+	}
+
+	if accountFailures != int64(cfg.LoginLockoutThreshold) || user == nil {
+		return
+	}
+
+	logger.Log.Warn().
+		Str("event", "account_locked").
+		Str("user_id", user.Id).
+		Str("ip", ip).
+		Int64("failures", accountFailures).
+		Msg("security event: account locked after failed logins")
+
+	// only accounts that exist get it, the failed login must not wait for it
+	s.background.Go(ctx, func(ctx context.Context) {
+		err := s.mailSender.Send(ctx, mail.Message{
+			To:      user.Email,
+			Subject: "Sign-in to your account was locked",
+			Body: fmt.Sprintf("There were %d failed attempts to sign in to your account with a wrong password or code, "+
+				"the last one from %s.\n\n"+
+				"Signing in with the password is locked for %s. If it was not you, change your password "+
+				"once you can sign in again.\n",
+				accountFailures, ip, cfg.LoginLockoutDuration),
+		})
+		if err != nil {
+			logger.Log.Error().Err(err).Msg("error sending account locked email")
+		}
+	})
+}
+
+func (s *loginThrottleService) Success(ctx context.Context, email string) {
+	if err := s.redisCache.ResetLogin(ctx, s.Account(ctx, email)); err != nil {
+		logger.Log.Error().Err(err).Msg("error resetting login throttle")
+	}
+}
+
+func (s *loginThrottleService) VerifyPassword(ctx context.Context, user *userpb.User, password, ip string) error {
+	if err := s.Check(ctx, user.Email, ip); err != nil {
+		return err
+	}
+
+	credentials, err := s.grpcUserClient.VerifyCredentials(ctx, user.Email, password)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error gRPC verify credentials")
+		return apperror.FromGRPC(err)
+	}
+	if !credentials.Valid {
+		s.Failure(ctx, user.Email, ip, user)
+		return apperror.BadRequest("current password is incorrect")
+	}
+
+	return nil
+}
+
+func (s *loginThrottleService) Unlock(ctx context.Context, userID string) error {
+	userResp, err := s.grpcUserClient.GetUserByID(ctx, userID)
+	if err != nil {
+		if st, ok := status.FromError(err); ok && st.Code() == codes.NotFound {
+			return apperror.NotFound("user not found")
+		}
+		logger.Log.Error().Err(err).Msg("error gRPC get user by ID")
+		return apperror.FromGRPC(err)
+	}
+
+	// logins with any spelling of the email counted under this key
+	if err := s.redisCache.ResetLogin(ctx, s.Account(ctx, userResp.User.Email)); err != nil {
+		logger.Log.Error().Err(err).Msg("error resetting login throttle")
+		return apperror.Internal(err)
+	}
+
+	logger.Log.Info().
+		Str("event", "account_unlocked").
+		Str("user_id", userID).
+		Msg("security event: account unlocked by an admin")
+
+	return nil
+}
+
+func (s *loginThrottleService) Account(ctx context.Context, email string) string {
+	resp, err := s.grpcUserClient.NormalizeEmail(ctx, email)
+	if err != nil {
+		// no account can have an invalid email, and while user-service is down no login succeeds
+		if st, ok := status.FromError(err); !ok || st.Code() != codes.InvalidArgument {
+			logger.Log.Error().Err(err).Msg("error gRPC normalize email")
+		}
+		return strings.ToLower(strings.TrimSpace(email))
+	}
+	return resp.EmailNormalized
+}
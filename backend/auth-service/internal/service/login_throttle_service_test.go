@@ -0,0 +1,270 @@
+package service
+
+import (
+	"auth-service/internal/apperror"
+	"auth-service/internal/config"
+	userpb "auth-service/internal/genproto/user/v1"
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+)
+
+func assertThrottled(t *testing.T, err error) {
+	t.Helper()
+
+	var appErr *apperror.AppError
+	if !errors.As(err, &appErr) || appErr.Code != http.StatusTooManyRequests || appErr.RetryAfter <= 0 {
+		t.Fatalf("expected 429 app error with a retry after, got %v", err)
+	}
+}
+
+func newTestLoginThrottleService(users *fakeUserClient, redisCache *fakeRedisCache, sender *fakeMailSender, cfg config.Config) LoginThrottleService {
+	background := NewBackground()
+	return waitingLoginThrottleService{NewLoginThrottleService(users, redisCache, sender, background, cfg), background}
+}
+
+// waitingLoginThrottleService returns from a failure once the lockout mail is sent, so tests can
+// read it.
+type waitingLoginThrottleService struct {
+	LoginThrottleService
+	background *Background
+}
+
+func (s waitingLoginThrottleService) Failure(ctx context.Context, email, ip string, user *userpb.User) {
+	defer s.background.Wait()
+	s.LoginThrottleService.Failure(ctx, email, ip, user)
+}
+
+func (s waitingLoginThrottleService) VerifyPassword(ctx context.Context, user *userpb.User, password, ip string) error {
+	defer s.background.Wait()
+	return s.LoginThrottleService.VerifyPassword(ctx, user, password, ip)
+}
+
+func TestLoginThrottleService_BacksOffPerIP(t *testing.T) {
+	auth, users, _, _, _ := newTestAuthServiceWithPolicy(t, config.EmailVerificationBlock)
+	ctx := context.Background()
+	registerTestUser(t, users, "guess@example.com", "password")
+	attacker := SessionMeta{IP: "203.0.113.1"}
+
+	// the first failures from an IP are free
+	for i := 0; i < 4; i++ {
+		_, err := auth.Login(ctx, "guess@example.com", "wrong", attacker)
+		assertUnauthorized(t, err)
+	}
+
+	// then the IP has to wait, even with the right password and another spelling of the email
+	_, err := auth.Login(ctx, "Guess@Example.com", "password", attacker)
+	assertThrottled(t, err)
+
+	// other IPs are not slowed down, and a successful login forgets the failures
+	if _, err := auth.Login(ctx, "guess@example.com", "password", SessionMeta{IP: "198.51.100.7"}); err != nil {
+		t.Fatalf("Login() from another IP error: %v", err)
+	}
+	_, err = auth.Login(ctx, "guess@example.com", "wrong", attacker)
+	assertUnauthorized(t, err)
+}
+
+func TestLoginThrottleService_LocksAccount(t *testing.T) {
+	auth, users, _, _, sender := newTestAuthServiceWithPolicy(t, config.EmailVerificationBlock)
+	ctx := context.Background()
+	registerTestUser(t, users, "target@example.com", "password")
+	user, _ := users.GetUserByEmail(ctx, "target@example.com")
+
+	// a distributed attack, every IP stays below the backoff
+	for i := 0; i < 10; i++ {
+		_, err := auth.Login(ctx, "target@example.com", "wrong", SessionMeta{IP: fmt.Sprintf("203.0.113.%d", i)})
+		assertUnauthorized(t, err)
+	}
+
+	_, err := auth.Login(ctx, "target@example.com", "password", SessionMeta{IP: "198.51.100.7"})
+	assertThrottled(t, err)
+
+	if len(sender.sent) != 1 || sender.sent[0].To != "target@example.com" {
+		t.Fatalf("sent %+v, want one lockout notice to the user", sender.sent)
+	}
+
+	if err := auth.UnlockLogin(ctx, user.User.Id); err != nil {
+		t.Fatalf("UnlockLogin() error: %v", err)
+	}
+	if _, err := auth.Login(ctx, "target@example.com", "password", SessionMeta{IP: "198.51.100.7"}); err != nil {
+		t.Fatalf("Login() after unlock error: %v", err)
+	}
+
+	err = auth.UnlockLogin(ctx, "999")
+	assertAppError(t, err, http.StatusNotFound)
+}
+
+func TestLoginThrottleService_LockoutMailInBackground(t *testing.T) {
+	users := newFakeUserClient()
+	ctx := context.Background()
+	registerTestUser(t, users, "slow@example.com", "password")
+	user, _ := users.GetUserByEmail(ctx, "slow@example.com")
+
+	sender := &fakeMailSender{hold: make(chan struct{})}
+	background := NewBackground()
+	cfg := config.Config{
+		LoginThrottle: config.LoginThrottleConfig{LoginLockoutThreshold: 1, LoginLockoutDuration: time.Minute},
+	}
+	throttle := NewLoginThrottleService(users, newFakeRedisCache(), sender, background, cfg)
+
+	done := make(chan struct{})
+	go func() {
+		throttle.Failure(ctx, "slow@example.com", "203.0.113.1", user.User)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Failure() waited for the lockout mail to be sent")
+	}
+
+	close(sender.hold)
+	background.Wait()
+	if len(sender.sent) != 1 || sender.sent[0].To != "slow@example.com" {
+		t.Errorf("sent %v, want the lockout notice to slow@example.com", sender.sent)
+	}
+}
+
+func TestLoginThrottleService_CurrentPassword(t *testing.T) {
+	passwords, auth, users, _ := newTestPasswordService(t, time.Hour)
+	ctx := context.Background()
+	registerTestUser(t, users, "session@example.com", "password")
+
+	session, err := auth.Login(ctx, "session@example.com", "password", SessionMeta{})
+	if err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+
+	// a stolen session guessing the current password locks the account like failed logins
+	for i := 0; i < 10; i++ {
+		err := passwords.ChangePassword(ctx, session.UserID, "wrong", "new-password", fmt.Sprintf("203.0.113.%d", i))
+		assertAppError(t, err, 400)
+	}
+
+	assertThrottled(t, passwords.ChangePassword(ctx, session.UserID, "password", "new-password", "198.51.100.7"))
+	_, err = auth.Login(ctx, "session@example.com", "password", SessionMeta{IP: "198.51.100.7"})
+	assertThrottled(t, err)
+}
+
+func TestLoginThrottleService_EmailSpellings(t *testing.T) {
+	auth, users, _, redisCache, _ := newTestAuthServiceWithPolicy(t, config.EmailVerificationBlock)
+	ctx := context.Background()
+	registerTestUser(t, users, "j.doe@gmail.com", "password")
+	user, _ := users.GetUserByEmail(ctx, "j.doe@gmail.com")
+
+	// user-service treats all of them as the account's address
+	spellings := []string{"j.doe@gmail.com", "JDoe@gmail.com", " j.d.o.e+x@gmail.com", "jdoe+news@Gmail.com"}
+	for i := 0; i < 10; i++ {
+		email := spellings[i%len(spellings)]
+		_, err := auth.Login(ctx, email, "wrong", SessionMeta{IP: fmt.Sprintf("203.0.113.%d", i)})
+		assertUnauthorized(t, err)
+	}
+	if len(redisCache.logins) != 1 || redisCache.logins["jdoe@gmail.com"] == nil {
+		t.Fatalf("failures counted under %v, want only jdoe@gmail.com", slices.Sorted(maps.Keys(redisCache.logins)))
+	}
+
+	for _, email := range spellings {
+		_, err := auth.Login(ctx, email, "password", SessionMeta{IP: "198.51.100.7"})
+		assertThrottled(t, err)
+	}
+
+	// the account's email is stored in another spelling than the key
+	if err := auth.UnlockLogin(ctx, user.User.Id); err != nil {
+		t.Fatalf("UnlockLogin() error: %v", err)
+	}
+	if _, err := auth.Login(ctx, "JDoe+x@gmail.com", "password", SessionMeta{IP: "198.51.100.7"}); err != nil {
+		t.Fatalf("Login() after unlock error: %v", err)
+	}
+}
+
+func TestLoginThrottleService_UnknownAccountsLookTheSame(t *testing.T) {
+	auth, users, _, _, sender := newTestAuthServiceWithPolicy(t, config.EmailVerificationBlock)
+	ctx := context.Background()
+	registerTestUser(t, users, "known@example.com", "password")
+
+	for i := 0; i < 11; i++ {
+		meta := SessionMeta{IP: fmt.Sprintf("203.0.113.%d", i)}
+		_, knownErr := auth.Login(ctx, "known@example.com", "wrong", meta)
+		_, unknownErr := auth.Login(ctx, "unknown@example.com", "wrong", meta)
+
+		var known, unknown *apperror.AppError
+		if !errors.As(knownErr, &known) || !errors.As(unknownErr, &unknown) ||
+			known.Code != unknown.Code || known.Message != unknown.Message {
+			t.Fatalf("attempt %d: known account got %v, unknown got %v, want the same", i+1, knownErr, unknownErr)
+		}
+	}
+
+	_, err := auth.Login(ctx, "unknown@example.com", "wrong", SessionMeta{IP: "198.51.100.7"})
+	assertThrottled(t, err)
+
+	// only the account that exists is notified
+	if len(sender.sent) != 1 || sender.sent[0].To != "known@example.com" {
+		t.Fatalf("sent %+v, want one lockout notice to the existing account", sender.sent)
+	}
+}
+
+func TestLoginThrottleService_SecondFactor(t *testing.T) {
+	mfa, _, auth, users := newTestMFAService(t)
+	ctx := context.Background()
+	registerTestUser(t, users, "second@example.com", "password")
+	_, _, codes := enableTestTOTP(t, mfa, "1")
+
+	for i := 0; i < 15; i++ {
+		_, err := auth.Login(ctx, "second@example.com", "wrong", SessionMeta{IP: fmt.Sprintf("203.0.113.%d", i)})
+		assertUnauthorized(t, err)
+	}
+
+	// the right password alone does not forget the failures, the second factor is still to come
+	result, err := auth.Login(ctx, "second@example.com", "password", SessionMeta{IP: "198.51.100.7"})
+	if err != nil || !result.MFARequired {
+		t.Fatalf("Login() = %+v, %v, want an mfa challenge", result, err)
+	}
+	for i := 0; i < maxMFAAttempts; i++ {
+		_, err := auth.VerifyMFA(ctx, result.MFAToken, "000000")
+		assertUnauthorized(t, err)
+	}
+
+	// the wrong codes count towards the lockout like wrong passwords
+	_, err = auth.Login(ctx, "second@example.com", "password", SessionMeta{IP: "198.51.100.8"})
+	assertThrottled(t, err)
+
+	// a completed login forgets them
+	revoked := auth.(*authService).redisCache.(*fakeRedisCache)
+	revoked.logins["second@example.com"].blocked[""] = time.Now()
+	result, err = auth.Login(ctx, "second@example.com", "password", SessionMeta{IP: "198.51.100.9"})
+	if err != nil || !result.MFARequired {
+		t.Fatalf("Login() after the lockout = %+v, %v, want an mfa challenge", result, err)
+	}
+	if _, ok := revoked.logins["second@example.com"]; !ok {
+		t.Fatal("Login() forgot the failures before the second factor")
+	}
+	if _, err := auth.VerifyMFA(ctx, result.MFAToken, codes[0]); err != nil {
+		t.Fatalf("VerifyMFA() error: %v", err)
+	}
+	if _, ok := revoked.logins["second@example.com"]; ok {
+		t.Error("VerifyMFA() kept the failed logins after the user signed in")
+	}
+}
+
+func TestLoginThrottleService_EmailCodes(t *testing.T) {
+	auth, users, _, _, _ := newTestAuthServiceWithPolicy(t, config.EmailVerificationBlock)
+	ctx := context.Background()
+	registerTestUser(t, users, "codes@example.com", "password")
+
+	// wrong codes of login emails count towards the lockout like wrong passwords
+	for i := 0; i < 2; i++ {
+		loginID, _ := auth.RequestEmailLogin(ctx, "codes@example.com")
+		for j := 0; j < maxEmailLoginAttempts; j++ {
+			_, err := auth.FinishEmailLoginCode(ctx, loginID, "wrong", SessionMeta{IP: fmt.Sprintf("203.0.113.%d", i*maxEmailLoginAttempts+j)})
+			assertUnauthorized(t, err)
+		}
+	}
+
+	_, err := auth.Login(ctx, "codes@example.com", "password", SessionMeta{IP: "198.51.100.7"})
+	assertThrottled(t, err)
+}
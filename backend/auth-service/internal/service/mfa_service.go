@@ -0,0 +1,510 @@
+package service
+
+import (
+	"auth-service/internal/apperror"
+	"auth-service/internal/cache"
+	grpcClient "auth-service/internal/client/grpc"
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"auth-service/internal/logger"
+	"auth-service/internal/repository"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Second factors a user can have, reported to the client when the login needs one.
+const (
+	MFAMethodTOTP     = "totp"
+	MFAMethodWebAuthn = "webauthn"
+)
+
+const (
+	recoveryCodeCount = 10
+	// maxMFAAttempts is how many codes can be tried against one login before it has to start over
+	maxMFAAttempts = 5
+	// maxMFAFailures is how many wrong second factors a user can get across logins before they
+	// have to wait, mfaLockoutBase at first and twice as long after every further one
+	maxMFAFailures = 10
+	mfaLockoutBase = time.Minute
+	mfaLockoutMax  = 24 * time.Hour
+	// mfaThrottlePrefix keeps the failures of the second factor apart from those of the password
+	mfaThrottlePrefix = "mfa:"
+)
+
+// TOTPEnrollment is what the user needs to add the account to an authenticator app.
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// MFAService manages the second factor: TOTP (RFC 6238) with single-use recovery codes, or any
+// registered passkey or security key.
+type MFAService interface {
+	// EnrollTOTP generates a new secret. The factor is not enabled until ConfirmTOTP.
+	EnrollTOTP(ctx context.Context, userID string) (*TOTPEnrollment, error)
+	// ConfirmTOTP enables the factor once the user proves their app produces valid codes and
+	// returns the recovery codes. They are shown only once.
+	ConfirmTOTP(ctx context.Context, userID, code string) ([]string, error)
+	// DisableTOTP removes the factor. It takes a TOTP or recovery code, so a stolen access token
+	// alone can not turn it off.
+	DisableTOTP(ctx context.Context, userID, code string) error
+	IsEnabled(ctx context.Context, userID string) (bool, error)
+	// Methods returns the second factors the user has, none means the password is enough.
+	Methods(ctx context.Context, userID string) ([]string, error)
+	// Reauthenticate confirms the user with their current password or, with TOTP enabled, a TOTP
+	// or recovery code. Changes to how the user signs in need it, so a stolen access token alone
+	// can not make them.
+	Reauthenticate(ctx context.Context, userID, password, code, ip string) error
+
+	// StartChallenge remembers a login that passed the password check and returns the token
+	// the second factor is submitted with.
+	StartChallenge(ctx context.Context, userID string, meta SessionMeta) (string, error)
+	// VerifyChallenge checks the code of a pending login and returns who it belongs to.
+	VerifyChallenge(ctx context.Context, token, code string) (string, SessionMeta, error)
+	// BeginWebAuthnChallenge asks for an assertion from one of the user's passkeys instead of a code.
+	BeginWebAuthnChallenge(ctx context.Context, token string) (*WebAuthnOptions, error)
+	VerifyWebAuthnChallenge(ctx context.Context, token, ceremonyID string, response []byte) (string, SessionMeta, error)
+}
+
+type mfaService struct {
+	grpcUserClient grpcClient.UserService
+	mfaRepo        repository.MFARepository
+	webAuthn       WebAuthnService
+	redisCache     cache.RedisCache
+	loginThrottle  LoginThrottleService
+	box            secretBox
+	cfg            config.Config
+}
+
+func NewMFAService(
+	grpcUserClient grpcClient.UserService,
+	mfaRepo repository.MFARepository,
+	webAuthn WebAuthnService,
+	redisCache cache.RedisCache,
+	loginThrottle LoginThrottleService,
+	cfg config.Config,
+) MFAService {
+	return &mfaService{
+		grpcUserClient: grpcUserClient,
+		mfaRepo:        mfaRepo,
+		webAuthn:       webAuthn,
+		redisCache:     redisCache,
+		loginThrottle:  loginThrottle,
+		box:            newSecretBox(cfg.MFA.MFAEncryptionKey),
+		cfg:            cfg,
+	}
+}
+
+func (s *mfaService) EnrollTOTP(ctx context.Context, userID string) (*TOTPEnrollment, error) {
+	enabled, err := s.IsEnabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, apperror.Conflict("two-factor authentication is already enabled")
+	}
+
+	userResp, err := s.grpcUserClient.GetUserByID(ctx, userID)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error gRPC get user by ID")
+		return nil, apperror.FromGRPC(err)
+	}
+
+	secret, err := generateTOTPSecret()
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error generating totp secret")
+		return nil, apperror.Internal(err)
+	}
+
+	sealed, err := s.box.seal(secret, totpAD(userID))
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error encrypting totp secret")
+		return nil, apperror.Internal(err)
+	}
+
+	if err := s.mfaRepo.SaveTOTP(ctx, userID, sealed); err != nil {
+		logger.Log.Error().Err(err).Msg("error saving totp factor")
+		return nil, apperror.Internal(err)
+	}
+
+	return &TOTPEnrollment{
+		Secret: totpEncoding.EncodeToString(secret),
+		URI:    totpURI(s.cfg.MFA.MFAIssuer, userResp.User.Email, secret),
+	}, nil
+}
+
+func (s *mfaService) ConfirmTOTP(ctx context.Context, userID, code string) ([]string, error) {
+	factor, secret, err := s.getTOTP(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if factor == nil {
+		return nil, apperror.BadRequest("two-factor authentication is not enrolled")
+	}
+	if factor.ConfirmedAt != nil {
+		return nil, apperror.Conflict("two-factor authentication is already enabled")
+	}
+
+	step, ok := matchTOTP(secret, code, time.Now())
+	if !ok {
+		return nil, apperror.BadRequest("invalid code")
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	for range recoveryCodeCount {
+		code, err := newRecoveryCode()
+		if err != nil {
+			logger.Log.Error().Err(err).Msg("error generating recovery code")
+			return nil, apperror.Internal(err)
+		}
+		codes = append(codes, code)
+	}
+
+	normalized := make([]string, 0, len(codes))
+	for _, code := range codes {
+		normalized = append(normalized, normalizeRecoveryCode(code))
+	}
+
+	confirmed, err := s.mfaRepo.ConfirmTOTP(ctx, userID, step, normalized)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error confirming totp factor")
+		return nil, apperror.Internal(err)
+	}
+	if !confirmed {
+		// confirmed by a concurrent request in the meantime
+		return nil, apperror.Conflict("two-factor authentication is already enabled")
+	}
+
+	logger.Log.Info().
+		Str("event", "mfa_enabled").
+		Str("user_id", userID).
+		Msg("two-factor authentication enabled")
+
+	return codes, nil
+}
+
+func (s *mfaService) DisableTOTP(ctx context.Context, userID, code string) error {
+	ok, err := s.checkCode(ctx, userID, code)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return apperror.BadRequest("invalid code")
+	}
+
+	if err := s.mfaRepo.DeleteTOTP(ctx, userID); err != nil {
+		logger.Log.Error().Err(err).Msg("error deleting totp factor")
+		return apperror.Internal(err)
+	}
+
+	logger.Log.Info().
+		Str("event", "mfa_disabled").
+		Str("user_id", userID).
+		Msg("two-factor authentication disabled")
+
+	return nil
+}
+
+func (s *mfaService) IsEnabled(ctx context.Context, userID string) (bool, error) {
+	factor, err := s.mfaRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrTOTPNotFound) {
+			return false, nil
+		}
+		logger.Log.Error().Err(err).Msg("error getting totp factor")
+		return false, apperror.Internal(err)
+	}
+
+	return factor.ConfirmedAt != nil, nil
+}
+
+func (s *mfaService) Methods(ctx context.Context, userID string) ([]string, error) {
+	var methods []string
+
+	totp, err := s.IsEnabled(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if totp {
+		methods = append(methods, MFAMethodTOTP)
+	}
+
+	passkeys, err := s.webAuthn.HasCredentials(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if passkeys {
+		methods = append(methods, MFAMethodWebAuthn)
+	}
+
+	return methods, nil
+}
+
+func (s *mfaService) Reauthenticate(ctx context.Context, userID, password, code, ip string) error {
+	if code != "" {
+		// counted like the codes of a login, or this would be a way around their limit
+		if err := s.checkThrottle(ctx, userID); err != nil {
+			return err
+		}
+		ok, err := s.checkCode(ctx, userID, code)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			s.recordFailure(ctx, userID, ip)
+			return apperror.BadRequest("invalid code")
+		}
+		return nil
+	}
+
+	if password == "" {
+		return apperror.BadRequest("current password or code is required")
+	}
+
+	userResp, err := s.grpcUserClient.GetUserByID(ctx, userID)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error gRPC get user by ID")
+		return apperror.FromGRPC(err)
+	}
+	if err := s.loginThrottle.VerifyPassword(ctx, userResp.User, password, ip); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *mfaService) StartChallenge(ctx context.Context, userID string, meta SessionMeta) (string, error) {
+	token, err := newResetToken()
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error generating mfa challenge token")
+		return "", apperror.Internal(err)
+	}
+
+	challenge := &entity.MFAChallenge{
+		UserID:      userID,
+		DeviceLabel: meta.DeviceLabel,
+		UserAgent:   meta.UserAgent,
+		IP:          meta.IP,
+		ExpiresAt:   time.Now().Add(s.cfg.MFA.MFAChallengeExp),
+	}
+	if err := s.mfaRepo.CreateChallenge(ctx, token, challenge); err != nil {
+		logger.Log.Error().Err(err).Msg("error saving mfa challenge")
+		return "", apperror.Internal(err)
+	}
+
+	return token, nil
+}
+
+func (s *mfaService) VerifyChallenge(ctx context.Context, token, code string) (string, SessionMeta, error) {
+	return s.completeChallenge(ctx, token, func(userID string) (bool, error) {
+		return s.checkCode(ctx, userID, code)
+	})
+}
+
+func (s *mfaService) BeginWebAuthnChallenge(ctx context.Context, token string) (*WebAuthnOptions, error) {
+	challenge, err := s.mfaRepo.GetChallenge(ctx, token, maxMFAAttempts)
+	if err != nil {
+		if errors.Is(err, repository.ErrMFAChallengeNotFound) {
+			return nil, apperror.Unauthorized("invalid or expired mfa token")
+		}
+		logger.Log.Error().Err(err).Msg("error getting mfa challenge")
+		return nil, apperror.Internal(err)
+	}
+
+	return s.webAuthn.BeginSecondFactor(ctx, challenge.UserID)
+}
+
+func (s *mfaService) VerifyWebAuthnChallenge(ctx context.Context, token, ceremonyID string, response []byte) (string, SessionMeta, error) {
+	return s.completeChallenge(ctx, token, func(userID string) (bool, error) {
+		return s.webAuthn.FinishSecondFactor(ctx, userID, ceremonyID, response)
+	})
+}
+
+// completeChallenge counts an attempt against the challenge, runs the check for its user and
+// consumes the challenge once the check passes. Failures are also counted against the user, so a
+// new password login does not bring new attempts.
+func (s *mfaService) completeChallenge(ctx context.Context, token string, check func(userID string) (bool, error)) (string, SessionMeta, error) {
+	challenge, err := s.mfaRepo.ClaimChallengeAttempt(ctx, token, maxMFAAttempts)
+	if err != nil {
+		if errors.Is(err, repository.ErrMFAChallengeNotFound) {
+			return "", SessionMeta{}, apperror.Unauthorized("invalid or expired mfa token")
+		}
+		logger.Log.Error().Err(err).Msg("error claiming mfa challenge")
+		return "", SessionMeta{}, apperror.Internal(err)
+	}
+
+	if err := s.checkThrottle(ctx, challenge.UserID); err != nil {
+		return "", SessionMeta{}, err
+	}
+
+	ok, err := check(challenge.UserID)
+	if err != nil {
+		return "", SessionMeta{}, err
+	}
+	if !ok {
+		logger.Log.Warn().
+			Str("event", "mfa_failed").
+			Str("user_id", challenge.UserID).
+			Int("attempt", challenge.Attempts).
+			Msg("security event: invalid second factor")
+		s.recordFailure(ctx, challenge.UserID, challenge.IP)
+		s.recordLoginFailure(ctx, challenge.UserID, challenge.IP)
+		return "", SessionMeta{}, apperror.Unauthorized("invalid code")
+	}
+
+	if err := s.redisCache.ResetLogin(ctx, mfaThrottlePrefix+challenge.UserID); err != nil {
+		logger.Log.Error().Err(err).Msg("error resetting mfa throttle")
+	}
+
+	consumed, err := s.mfaRepo.ConsumeChallenge(ctx, challenge.ID)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error consuming mfa challenge")
+		return "", SessionMeta{}, apperror.Internal(err)
+	}
+	if !consumed {
+		return "", SessionMeta{}, apperror.Unauthorized("invalid or expired mfa token")
+	}
+
+	return challenge.UserID, SessionMeta{
+		DeviceLabel: challenge.DeviceLabel,
+		UserAgent:   challenge.UserAgent,
+		IP:          challenge.IP,
+	}, nil
+}
+
+// checkThrottle refuses second factors of a user who got too many wrong.
+func (s *mfaService) checkThrottle(ctx context.Context, userID string) error {
+	until, err := s.redisCache.LoginBlockedUntil(ctx, mfaThrottlePrefix+userID, "")
+	if err != nil {
+		// the attempts per challenge still apply
+		logger.Log.Error().Err(err).Msg("error checking mfa throttle")
+		return nil
+	}
+
+	if wait := time.Until(until); wait > 0 {
+		return apperror.TooManyRequests("too many invalid codes, try again later", wait)
+	}
+	return nil
+}
+
+// recordFailure counts a wrong second factor of the user and blocks further ones once there
+// were maxMFAFailures.
+func (s *mfaService) recordFailure(ctx context.Context, userID, ip string) {
+	failures, _, err := s.redisCache.RecordLoginFailure(ctx, mfaThrottlePrefix+userID, ip, loginFailureWindow)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error recording mfa failure")
+		return
+	}
+
+	extra := failures - maxMFAFailures
+	if extra < 0 {
+		return
+	}
+	wait := mfaLockoutMax
+	if extra <= 30 {
+		wait = min(mfaLockoutBase<<extra, mfaLockoutMax)
+	}
+	if err := s.redisCache.BlockLogin(ctx, mfaThrottlePrefix+userID, "", time.Now().Add(wait)); err != nil {
+		logger.Log.Error().Err(err).Msg("error blocking mfa")
+		return
+	}
+
+	logger.Log.Warn().
+		Str("event", "mfa_locked").
+		Str("user_id", userID).
+		Int64("failures", failures).
+		Dur("wait", wait).
+		Msg("security event: second factor locked after invalid codes")
+}
+
+// checkCode accepts a current TOTP code or an unused recovery code of an enabled factor.
+// Either is used up by a successful check.
+func (s *mfaService) checkCode(ctx context.Context, userID, code string) (bool, error) {
+	factor, secret, err := s.getTOTP(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	if factor == nil || factor.ConfirmedAt == nil {
+		return false, apperror.BadRequest("two-factor authentication is not enabled")
+	}
+
+	if step, ok := matchTOTP(secret, code, time.Now()); ok {
+		used, err := s.mfaRepo.UseTOTPStep(ctx, userID, step)
+		if err != nil {
+			logger.Log.Error().Err(err).Msg("error updating totp factor")
+			return false, apperror.Internal(err)
+		}
+		return used, nil
+	}
+
+	used, err := s.mfaRepo.UseRecoveryCode(ctx, userID, normalizeRecoveryCode(code))
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error using recovery code")
+		return false, apperror.Internal(err)
+	}
+	if used {
+		logger.Log.Info().
+			Str("event", "mfa_recovery_code_used").
+			Str("user_id", userID).
+			Msg("recovery code used")
+	}
+
+	return used, nil
+}
+
+// getTOTP returns the user's factor with its decrypted secret, or nil if there is none.
+func (s *mfaService) getTOTP(ctx context.Context, userID string) (*entity.TOTPFactor, []byte, error) {
+	factor, err := s.mfaRepo.GetTOTP(ctx, userID)
+	if err != nil {
+		if errors.Is(err, repository.ErrTOTPNotFound) {
+			return nil, nil, nil
+		}
+		logger.Log.Error().Err(err).Msg("error getting totp factor")
+		return nil, nil, apperror.Internal(err)
+	}
+
+	secret, err := s.box.open(factor.Secret, totpAD(userID))
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error decrypting totp secret")
+		return nil, nil, apperror.Internal(fmt.Errorf("failed to decrypt totp secret: %w", err))
+	}
+
+	return factor, secret, nil
+}
+
+// totpAD binds a sealed secret to its user.
+func totpAD(userID string) []byte {
+	return []byte("totp/" + userID)
+}
+
+// newRecoveryCode returns a code such as "k3v9d-x2pqa", 50 random bits.
+func newRecoveryCode() (string, error) {
+	b := make([]byte, 7)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	code := strings.ToLower(totpEncoding.EncodeToString(b))[:10]
+	return code[:5] + "-" + code[5:], nil
+}
+
+// normalizeRecoveryCode accepts codes typed in upper case or without the dash.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
+
+// recordLoginFailure counts a wrong second factor in a login as a failed login, towards locking
+// the account like wrong passwords do.
+func (s *mfaService) recordLoginFailure(ctx context.Context, userID, ip string) {
+	userResp, err := s.grpcUserClient.GetUserByID(ctx, userID)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error gRPC get user by ID")
+		return
+	}
+	s.loginThrottle.Failure(ctx, userResp.User.Email, ip, userResp.User)
+}
@@ -0,0 +1,402 @@
+package service
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"auth-service/internal/passwordpolicy"
+	"auth-service/internal/repository"
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeMFARepository keeps factors, recovery codes and challenges in memory, keyed by the raw values.
+type fakeMFARepository struct {
+	mu            sync.Mutex
+	factors       map[string]*entity.TOTPFactor
+	recoveryCodes map[string]map[string]bool
+	challenges    map[string]*entity.MFAChallenge
+	nextID        int
+}
+
+func newFakeMFARepository() *fakeMFARepository {
+	return &fakeMFARepository{
+		factors:       map[string]*entity.TOTPFactor{},
+		recoveryCodes: map[string]map[string]bool{},
+		challenges:    map[string]*entity.MFAChallenge{},
+	}
+}
+
+func (r *fakeMFARepository) GetTOTP(_ context.Context, userID string) (*entity.TOTPFactor, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	factor, ok := r.factors[userID]
+	if !ok {
+		return nil, repository.ErrTOTPNotFound
+	}
+	copied := *factor
+	return &copied, nil
+}
+
+func (r *fakeMFARepository) SaveTOTP(_ context.Context, userID, secret string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if factor, ok := r.factors[userID]; ok && factor.ConfirmedAt != nil {
+		return nil
+	}
+	r.factors[userID] = &entity.TOTPFactor{UserID: userID, Secret: secret}
+	return nil
+}
+
+func (r *fakeMFARepository) ConfirmTOTP(_ context.Context, userID string, step int64, recoveryCodes []string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	factor, ok := r.factors[userID]
+	if !ok || factor.ConfirmedAt != nil {
+		return false, nil
+	}
+	now := time.Now()
+	factor.ConfirmedAt = &now
+	factor.LastUsedStep = step
+
+	r.recoveryCodes[userID] = map[string]bool{}
+	for _, code := range recoveryCodes {
+		r.recoveryCodes[userID][code] = false
+	}
+	return true, nil
+}
+
+func (r *fakeMFARepository) UseTOTPStep(_ context.Context, userID string, step int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	factor, ok := r.factors[userID]
+	if !ok || factor.ConfirmedAt == nil || factor.LastUsedStep >= step {
+		return false, nil
+	}
+	factor.LastUsedStep = step
+	return true, nil
+}
+
+func (r *fakeMFARepository) DeleteTOTP(_ context.Context, userID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.factors, userID)
+	delete(r.recoveryCodes, userID)
+	return nil
+}
+
+func (r *fakeMFARepository) UseRecoveryCode(_ context.Context, userID, code string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	used, ok := r.recoveryCodes[userID][code]
+	if !ok || used {
+		return false, nil
+	}
+	r.recoveryCodes[userID][code] = true
+	return true, nil
+}
+
+func (r *fakeMFARepository) CreateChallenge(_ context.Context, token string, challenge *entity.MFAChallenge) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nextID++
+	challenge.ID = r.nextID
+	r.challenges[token] = challenge
+	return nil
+}
+
+func (r *fakeMFARepository) GetChallenge(_ context.Context, token string, maxAttempts int) (*entity.MFAChallenge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	challenge, ok := r.challenges[token]
+	if !ok || challenge.UsedAt != nil || !time.Now().Before(challenge.ExpiresAt) || challenge.Attempts >= maxAttempts {
+		return nil, repository.ErrMFAChallengeNotFound
+	}
+	copied := *challenge
+	return &copied, nil
+}
+
+func (r *fakeMFARepository) ClaimChallengeAttempt(_ context.Context, token string, maxAttempts int) (*entity.MFAChallenge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	challenge, ok := r.challenges[token]
+	if !ok || challenge.UsedAt != nil || !time.Now().Before(challenge.ExpiresAt) || challenge.Attempts >= maxAttempts {
+		return nil, repository.ErrMFAChallengeNotFound
+	}
+	challenge.Attempts++
+	copied := *challenge
+	return &copied, nil
+}
+
+func (r *fakeMFARepository) ConsumeChallenge(_ context.Context, id int) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, challenge := range r.challenges {
+		if challenge.ID == id && challenge.UsedAt == nil {
+			now := time.Now()
+			challenge.UsedAt = &now
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func newTestMFAService(t *testing.T) (MFAService, WebAuthnService, AuthService, *fakeUserClient) {
+	t.Helper()
+
+	mgr, _ := newTestManager()
+	users := newFakeUserClient()
+	cfg := config.Config{
+		EmailVerification: config.EmailVerificationConfig{
+			EmailVerificationSecret: "verification-secret",
+			EmailVerificationPolicy: config.EmailVerificationRestrict,
+		},
+		MFA: config.MFAConfig{
+			MFAEncryptionKey: "mfa-secret",
+			MFAIssuer:        "go-jwt-auth",
+			MFAChallengeExp:  time.Minute,
+		},
+		// wrong second factors count as failed logins, the limits are above those of the codes
+		LoginThrottle: config.LoginThrottleConfig{
+			LoginBackoffAfter:     20,
+			LoginBackoffMax:       5 * time.Minute,
+			LoginLockoutThreshold: 20,
+			LoginLockoutDuration:  15 * time.Minute,
+		},
+		WebAuthn: testWebAuthnConfig(),
+	}
+
+	webAuthn := newTestWebAuthnService(t, users, cfg)
+	revoked := newFakeRedisCache()
+	throttle := newTestLoginThrottleService(users, revoked, &fakeMailSender{}, cfg)
+	mfa := NewMFAService(users, newFakeMFARepository(), webAuthn, revoked, throttle, cfg)
+	verification := NewEmailVerificationService(users, &fakeMailSender{}, throttle, cfg)
+	oidc := NewOIDCService(users, newFakeOIDCRepository(), cfg)
+	emailLogin := newTestEmailLoginService(users, &fakeMailSender{}, revoked, throttle, cfg)
+	auth := NewAuthService(users, newFakeTokenRepository(), revoked, mgr, verification, mfa, webAuthn, oidc, emailLogin, throttle, passwordpolicy.NewPolicy(cfg.Password, nil), cfg)
+
+	return mfa, webAuthn, auth, users
+}
+
+// enableTestTOTP enrolls and confirms TOTP for the user. It returns the secret, the time step of
+// the confirmation code and the recovery codes.
+func enableTestTOTP(t *testing.T, mfa MFAService, userID string) ([]byte, int64, []string) {
+	t.Helper()
+	ctx := context.Background()
+
+	enrollment, err := mfa.EnrollTOTP(ctx, userID)
+	if err != nil {
+		t.Fatalf("EnrollTOTP() error: %v", err)
+	}
+	secret, err := totpEncoding.DecodeString(enrollment.Secret)
+	if err != nil {
+		t.Fatalf("enrollment secret is not base32: %v", err)
+	}
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/") {
+		t.Errorf("URI = %s, want an otpauth URI", enrollment.URI)
+	}
+
+	step := totpStep(time.Now())
+	codes, err := mfa.ConfirmTOTP(ctx, userID, totpCode(secret, step))
+	if err != nil {
+		t.Fatalf("ConfirmTOTP() error: %v", err)
+	}
+	if len(codes) != recoveryCodeCount {
+		t.Fatalf("got %d recovery codes, want %d", len(codes), recoveryCodeCount)
+	}
+
+	return secret, step, codes
+}
+
+func TestMFAService_LoginRequiresSecondFactor(t *testing.T) {
+	mfa, _, auth, users := newTestMFAService(t)
+	ctx := context.Background()
+	registerTestUser(t, users, "mfa@example.com", "password")
+
+	// an unconfirmed enrollment does not change the login
+	if _, err := mfa.EnrollTOTP(ctx, "1"); err != nil {
+		t.Fatalf("EnrollTOTP() error: %v", err)
+	}
+	result, err := auth.Login(ctx, "mfa@example.com", "password", SessionMeta{})
+	if err != nil || result.MFARequired || result.AccessToken == "" {
+		t.Fatalf("Login() before confirmation = %+v, %v, want tokens", result, err)
+	}
+
+	secret, step, _ := enableTestTOTP(t, mfa, "1")
+
+	result, err = auth.Login(ctx, "mfa@example.com", "password", SessionMeta{DeviceLabel: "laptop"})
+	if err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+	if !result.MFARequired || result.MFAToken == "" || result.AccessToken != "" || result.RefreshToken != "" {
+		t.Fatalf("Login() = %+v, want an mfa challenge without tokens", result)
+	}
+
+	// the code used for the confirmation can not be replayed
+	_, err = auth.VerifyMFA(ctx, result.MFAToken, totpCode(secret, step))
+	assertUnauthorized(t, err)
+
+	session, err := auth.VerifyMFA(ctx, result.MFAToken, totpCode(secret, step+1))
+	if err != nil {
+		t.Fatalf("VerifyMFA() error: %v", err)
+	}
+	if session.AccessToken == "" || session.RefreshToken == "" || session.UserID != "1" {
+		t.Errorf("VerifyMFA() = %+v, want tokens for user 1", session)
+	}
+
+	// the challenge token is single use
+	_, err = auth.VerifyMFA(ctx, result.MFAToken, totpCode(secret, step+1))
+	assertUnauthorized(t, err)
+}
+
+func TestMFAService_RecoveryCodes(t *testing.T) {
+	mfa, _, auth, users := newTestMFAService(t)
+	ctx := context.Background()
+	registerTestUser(t, users, "recovery@example.com", "password")
+	_, _, codes := enableTestTOTP(t, mfa, "1")
+
+	login := func() string {
+		t.Helper()
+		result, err := auth.Login(ctx, "recovery@example.com", "password", SessionMeta{})
+		if err != nil || !result.MFARequired {
+			t.Fatalf("Login() = %+v, %v, want an mfa challenge", result, err)
+		}
+		return result.MFAToken
+	}
+
+	// codes are accepted regardless of case and dash
+	typed := strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))
+	if _, err := auth.VerifyMFA(ctx, login(), typed); err != nil {
+		t.Fatalf("VerifyMFA() with a recovery code error: %v", err)
+	}
+
+	_, err := auth.VerifyMFA(ctx, login(), codes[0])
+	assertUnauthorized(t, err)
+
+	if _, err := auth.VerifyMFA(ctx, login(), codes[1]); err != nil {
+		t.Errorf("VerifyMFA() with another recovery code error: %v", err)
+	}
+}
+
+func TestMFAService_ChallengeAttemptLimit(t *testing.T) {
+	mfa, _, auth, users := newTestMFAService(t)
+	ctx := context.Background()
+	registerTestUser(t, users, "limit@example.com", "password")
+	_, _, codes := enableTestTOTP(t, mfa, "1")
+
+	result, err := auth.Login(ctx, "limit@example.com", "password", SessionMeta{})
+	if err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+
+	for range maxMFAAttempts {
+		_, err := auth.VerifyMFA(ctx, result.MFAToken, "000000")
+		assertUnauthorized(t, err)
+	}
+
+	_, err = auth.VerifyMFA(ctx, result.MFAToken, codes[0])
+	assertUnauthorized(t, err)
+}
+
+func TestMFAService_UserFailureLimit(t *testing.T) {
+	mfa, _, auth, users := newTestMFAService(t)
+	ctx := context.Background()
+	registerTestUser(t, users, "guess@example.com", "password")
+	_, _, codes := enableTestTOTP(t, mfa, "1")
+
+	login := func() string {
+		t.Helper()
+		result, err := auth.Login(ctx, "guess@example.com", "password", SessionMeta{})
+		if err != nil || !result.MFARequired {
+			t.Fatalf("Login() = %+v, %v, want an mfa challenge", result, err)
+		}
+		return result.MFAToken
+	}
+
+	// a fresh password login does not bring fresh attempts
+	for failures := 0; failures < maxMFAFailures; {
+		token := login()
+		for range min(maxMFAAttempts, maxMFAFailures-failures) {
+			_, err := auth.VerifyMFA(ctx, token, "000000")
+			assertUnauthorized(t, err)
+			failures++
+		}
+	}
+
+	_, err := auth.VerifyMFA(ctx, login(), codes[0])
+	assertAppError(t, err, 429)
+
+	// the lockout ends after a while and a valid code starts the count over
+	revoked := auth.(*authService).redisCache.(*fakeRedisCache)
+	revoked.logins[mfaThrottlePrefix+"1"].blocked[""] = time.Now()
+	if _, err := auth.VerifyMFA(ctx, login(), codes[0]); err != nil {
+		t.Fatalf("VerifyMFA() after the lockout error: %v", err)
+	}
+	if _, ok := revoked.logins[mfaThrottlePrefix+"1"]; ok {
+		t.Error("VerifyMFA() kept the failures after a valid code")
+	}
+}
+
+func TestMFAService_DisableTOTP(t *testing.T) {
+	mfa, _, auth, users := newTestMFAService(t)
+	ctx := context.Background()
+	registerTestUser(t, users, "disable@example.com", "password")
+	secret, step, _ := enableTestTOTP(t, mfa, "1")
+
+	_, err := mfa.EnrollTOTP(ctx, "1")
+	assertAppError(t, err, 409)
+
+	err = mfa.DisableTOTP(ctx, "1", "000000")
+	assertAppError(t, err, 400)
+
+	if err := mfa.DisableTOTP(ctx, "1", totpCode(secret, step+1)); err != nil {
+		t.Fatalf("DisableTOTP() error: %v", err)
+	}
+
+	result, err := auth.Login(ctx, "disable@example.com", "password", SessionMeta{})
+	if err != nil || result.MFARequired || result.AccessToken == "" {
+		t.Errorf("Login() after disabling = %+v, %v, want tokens", result, err)
+	}
+}
+
+func TestMFAService_Reauthenticate(t *testing.T) {
+	mfa, _, _, users := newTestMFAService(t)
+	ctx := context.Background()
+	registerTestUser(t, users, "reauth@example.com", "password")
+
+	assertAppError(t, mfa.Reauthenticate(ctx, "1", "", "", ""), 400)
+	assertAppError(t, mfa.Reauthenticate(ctx, "1", "wrong-password", "", ""), 400)
+	if err := mfa.Reauthenticate(ctx, "1", "password", "", ""); err != nil {
+		t.Fatalf("Reauthenticate() with the password error: %v", err)
+	}
+
+	// a code only works once TOTP is enabled
+	assertAppError(t, mfa.Reauthenticate(ctx, "1", "", "123456", ""), 400)
+	secret, step, codes := enableTestTOTP(t, mfa, "1")
+
+	assertAppError(t, mfa.Reauthenticate(ctx, "1", "", "000000", ""), 400)
+	if err := mfa.Reauthenticate(ctx, "1", "", totpCode(secret, step+1), ""); err != nil {
+		t.Fatalf("Reauthenticate() with a TOTP code error: %v", err)
+	}
+	if err := mfa.Reauthenticate(ctx, "1", "", codes[0], ""); err != nil {
+		t.Fatalf("Reauthenticate() with a recovery code error: %v", err)
+	}
+
+	// wrong codes count towards the limit of the second factor
+	for range maxMFAFailures {
+		_ = mfa.Reauthenticate(ctx, "1", "", "000000", "")
+	}
+	assertAppError(t, mfa.Reauthenticate(ctx, "1", "", codes[1], ""), 429)
+}
@@ -0,0 +1,671 @@
+package service
+
+import (
+	"auth-service/internal/apperror"
+	"auth-service/internal/cache"
+	grpcClient "auth-service/internal/client/grpc"
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"auth-service/internal/logger"
+	"auth-service/internal/repository"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	OAuthScopeOpenID = "openid"
+	OAuthScopeEmail  = "email"
+)
+
+// OAuthScopes are the scopes a client can be registered for.
+var OAuthScopes = []string{OAuthScopeOpenID, OAuthScopeEmail}
+
+// OAuthAuthorizeRequest are the parameters a client sends the user to the authorization
+// endpoint with (RFC 6749 section 4.1.1, OpenID Connect Core section 3.1.2.1).
+type OAuthAuthorizeRequest struct {
+	ResponseType        string
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+// OAuthConsent is what the consent page shows about a pending authorization request.
+type OAuthConsent struct {
+	ClientID   string
+	ClientName string
+	Scopes     []string
+	ExpiresAt  time.Time
+}
+
+// OAuthTokenRequest is an authorization code grant (RFC 6749 section 4.1.3). ClientSecret is
+// empty for public clients.
+type OAuthTokenRequest struct {
+	GrantType    string
+	Code         string
+	RedirectURI  string
+	CodeVerifier string
+	ClientID     string
+	ClientSecret string
+}
+
+type OAuthTokens struct {
+	AccessToken string
+	IDToken     string
+	ExpiresIn   int
+	Scope       string
+}
+
+// OAuthUserInfo holds the claims of the userinfo endpoint, the email claims only when the
+// email scope was granted.
+type OAuthUserInfo struct {
+	Subject       string
+	Email         string
+	EmailVerified *bool
+}
+
+// OAuthError is an error response of the token endpoint (RFC 6749 section 5.2).
+type OAuthError struct {
+	Status      int
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+func invalidGrant(description string) *OAuthError {
+	return &OAuthError{Status: http.StatusBadRequest, Code: "invalid_grant", Description: description}
+}
+
+func invalidClient() *OAuthError {
+	return &OAuthError{Status: http.StatusUnauthorized, Code: "invalid_client", Description: "client authentication failed"}
+}
+
+// OAuthService makes auth-service an OpenID Connect provider for other apps. Clients use the
+// authorization code flow with PKCE: the user approves the client on the consent page, the
+// client redeems the code for an access token restricted to the client and an ID token.
+type OAuthService interface {
+	// Authorize validates an authorization request and returns where to send the browser: the
+	// consent page, or the client's redirect URI with an error. An unknown client or redirect
+	// URI is returned as an error, the browser must not be sent anywhere then.
+	Authorize(ctx context.Context, req OAuthAuthorizeRequest) (string, error)
+	GetConsent(ctx context.Context, requestID string) (*OAuthConsent, error)
+	// Approve issues an authorization code to the signed-in user and returns the client's
+	// redirect URI with the code.
+	Approve(ctx context.Context, requestID, userID, sessionID string) (string, error)
+	// Deny returns the client's redirect URI with the access_denied error. Like Approve it is
+	// only done by a signed-in user.
+	Deny(ctx context.Context, requestID, userID, sessionID string) (string, error)
+	// Token redeems an authorization code. Failures are returned as *OAuthError.
+	Token(ctx context.Context, req OAuthTokenRequest) (*OAuthTokens, error)
+	UserInfo(ctx context.Context, accessToken string) (*OAuthUserInfo, error)
+
+	ListClients(ctx context.Context) ([]*entity.OAuthClient, error)
+	// CreateClient registers a client and returns its secret, which is not stored and can not
+	// be shown again. Public clients get no secret.
+	CreateClient(ctx context.Context, name string, redirectURIs, scopes []string, public bool) (*entity.OAuthClient, string, error)
+	DeleteClient(ctx context.Context, clientID string) error
+}
+
+type oauthService struct {
+	grpcUserClient grpcClient.UserService
+	repo           repository.OAuthRepository
+	tokenRepo      repository.TokenRepository
+	redisCache     cache.RedisCache
+	tokenManager   TokenManager
+	cfg            config.Config
+}
+
+func NewOAuthService(
+	grpcUserClient grpcClient.UserService,
+	repo repository.OAuthRepository,
+	tokenRepo repository.TokenRepository,
+	redisCache cache.RedisCache,
+	tokenManager TokenManager,
+	cfg config.Config,
+) OAuthService {
+	return &oauthService{
+		grpcUserClient: grpcUserClient,
+		repo:           repo,
+		tokenRepo:      tokenRepo,
+		redisCache:     redisCache,
+		tokenManager:   tokenManager,
+		cfg:            cfg,
+	}
+}
+
+func (s *oauthService) Authorize(ctx context.Context, req OAuthAuthorizeRequest) (string, error) {
+	client, err := s.repo.GetClient(ctx, req.ClientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthClientNotFound) {
+			return "", apperror.BadRequest("unknown client")
+		}
+		logger.Log.Error().Err(err).Msg("error getting oauth client")
+		return "", apperror.Internal(err)
+	}
+
+	// redirect URIs are compared exactly, anything else could leak the code to another page
+	if req.RedirectURI == "" || !slices.Contains(strings.Fields(client.RedirectURIs), req.RedirectURI) {
+		return "", apperror.BadRequest("redirect_uri is not registered for the client")
+	}
+
+	if req.ResponseType != "code" {
+		return s.redirectURL(req.RedirectURI, url.Values{
+			"error":             {"unsupported_response_type"},
+			"error_description": {"only the authorization code flow is supported"},
+			"state":             {req.State},
+		}), nil
+	}
+	if req.CodeChallenge == "" || req.CodeChallengeMethod != "S256" {
+		return s.redirectURL(req.RedirectURI, url.Values{
+			"error":             {"invalid_request"},
+			"error_description": {"PKCE with the S256 method is required"},
+			"state":             {req.State},
+		}), nil
+	}
+
+	scopes, ok := grantableScopes(req.Scope, strings.Fields(client.Scopes))
+	if !ok {
+		return s.redirectURL(req.RedirectURI, url.Values{
+			"error":             {"invalid_scope"},
+			"error_description": {"the openid scope is required and every scope must be registered for the client"},
+			"state":             {req.State},
+		}), nil
+	}
+
+	requestID, err := newResetToken()
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error generating authorization request id")
+		return "", apperror.Internal(err)
+	}
+
+	err = s.repo.CreateAuthorization(ctx, requestID, &entity.OAuthAuthorization{
+		ClientID:      client.ID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         strings.Join(scopes, " "),
+		State:         req.State,
+		Nonce:         req.Nonce,
+		CodeChallenge: req.CodeChallenge,
+		ExpiresAt:     time.Now().Add(s.cfg.OAuth.OAuthConsentExp),
+	})
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error creating oauth authorization")
+		return "", apperror.Internal(err)
+	}
+
+	consentURL, err := url.Parse(s.cfg.OAuth.OAuthConsentURL)
+	if err != nil {
+		return "", apperror.Internal(err)
+	}
+	query := consentURL.Query()
+	query.Set("request_id", requestID)
+	consentURL.RawQuery = query.Encode()
+
+	return consentURL.String(), nil
+}
+
+func (s *oauthService) GetConsent(ctx context.Context, requestID string) (*OAuthConsent, error) {
+	authorization, err := s.repo.GetAuthorizationRequest(ctx, requestID)
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthRequestNotFound) {
+			return nil, apperror.NotFound("authorization request not found or expired")
+		}
+		logger.Log.Error().Err(err).Msg("error getting oauth authorization request")
+		return nil, apperror.Internal(err)
+	}
+
+	client, err := s.repo.GetClient(ctx, authorization.ClientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthClientNotFound) {
+			return nil, apperror.NotFound("authorization request not found or expired")
+		}
+		logger.Log.Error().Err(err).Msg("error getting oauth client")
+		return nil, apperror.Internal(err)
+	}
+
+	return &OAuthConsent{
+		ClientID:   client.ID,
+		ClientName: client.Name,
+		Scopes:     strings.Fields(authorization.Scope),
+		ExpiresAt:  authorization.ExpiresAt,
+	}, nil
+}
+
+func (s *oauthService) Approve(ctx context.Context, requestID, userID, sessionID string) (string, error) {
+	// the user signed in when their session was created, that is the auth_time of the ID token
+	session, err := s.userSession(ctx, userID, sessionID)
+	if err != nil {
+		return "", err
+	}
+
+	userResp, err := s.grpcUserClient.GetUserByID(ctx, userID)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error gRPC get user by ID")
+		return "", apperror.FromGRPC(err)
+	}
+	if !userResp.User.EmailVerified && s.cfg.EmailVerification.EmailVerificationPolicy == config.EmailVerificationBlock {
+		return "", apperror.Forbidden("email not verified")
+	}
+
+	code, err := newResetToken()
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error generating authorization code")
+		return "", apperror.Internal(err)
+	}
+
+	authorization, err := s.repo.ApproveAuthorization(ctx, requestID, userID, code, session.CreatedAt)
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthRequestNotFound) {
+			return "", apperror.NotFound("authorization request not found or expired")
+		}
+		logger.Log.Error().Err(err).Msg("error approving oauth authorization")
+		return "", apperror.Internal(err)
+	}
+
+	logger.Log.Info().
+		Str("event", "oauth_authorization_approved").
+		Str("client_id", authorization.ClientID).
+		Str("user_id", userID).
+		Str("scope", authorization.Scope).
+		Msg("oauth client authorized")
+
+	return s.redirectURL(authorization.RedirectURI, url.Values{
+		"code":  {code},
+		"state": {authorization.State},
+	}), nil
+}
+
+func (s *oauthService) Deny(ctx context.Context, requestID, userID, sessionID string) (string, error) {
+	if _, err := s.userSession(ctx, userID, sessionID); err != nil {
+		return "", err
+	}
+
+	request, err := s.repo.GetAuthorizationRequest(ctx, requestID)
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthRequestNotFound) {
+			return "", apperror.NotFound("authorization request not found or expired")
+		}
+		logger.Log.Error().Err(err).Msg("error getting oauth authorization request")
+		return "", apperror.Internal(err)
+	}
+	// a request approved by someone else is theirs to keep
+	if request.UserID != nil && *request.UserID != userID {
+		return "", apperror.NotFound("authorization request not found or expired")
+	}
+
+	authorization, err := s.repo.DenyAuthorization(ctx, requestID)
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthRequestNotFound) {
+			return "", apperror.NotFound("authorization request not found or expired")
+		}
+		logger.Log.Error().Err(err).Msg("error denying oauth authorization")
+		return "", apperror.Internal(err)
+	}
+
+	return s.redirectURL(authorization.RedirectURI, url.Values{
+		"error":             {"access_denied"},
+		"error_description": {"the user denied the request"},
+		"state":             {authorization.State},
+	}), nil
+}
+
+// userSession returns the session of the caller, checking it belongs to the user.
+func (s *oauthService) userSession(ctx context.Context, userID, sessionID string) (*entity.Session, error) {
+	session, err := s.tokenRepo.GetSession(ctx, sessionID)
+	if err != nil || session.UserID != userID {
+		if err == nil || errors.Is(err, repository.ErrSessionNotFound) {
+			return nil, apperror.Unauthorized("invalid or expired token")
+		}
+		logger.Log.Error().Err(err).Msg("error getting session")
+		return nil, apperror.Internal(err)
+	}
+	return session, nil
+}
+
+func (s *oauthService) Token(ctx context.Context, req OAuthTokenRequest) (*OAuthTokens, error) {
+	if req.GrantType != "authorization_code" {
+		return nil, &OAuthError{Status: http.StatusBadRequest, Code: "unsupported_grant_type", Description: "only the authorization_code grant is supported"}
+	}
+
+	client, err := s.authenticateClient(ctx, req.ClientID, req.ClientSecret)
+	if err != nil {
+		return nil, err
+	}
+
+	authorization, err := s.repo.ConsumeCode(ctx, req.Code)
+	if err != nil {
+		switch {
+		case errors.Is(err, repository.ErrOAuthCodeReused):
+			// the code leaked, whoever redeemed it first may be the attacker
+			logger.Log.Warn().
+				Str("event", "oauth_code_reuse").
+				Str("client_id", authorization.ClientID).
+				Int("authorization_id", authorization.ID).
+				Msg("security event: authorization code reuse detected, revoking its session")
+
+			if authorization.SessionID != nil {
+				if err := s.tokenRepo.RevokeTokenFamily(ctx, *authorization.SessionID); err != nil {
+					logger.Log.Error().Err(err).Msg("error revoking session")
+					return nil, apperror.Internal(err)
+				}
+				if err := s.redisCache.RevokeSessions(ctx, []string{*authorization.SessionID}, s.cfg.JWT.JWTAccessTokenExp); err != nil {
+					logger.Log.Error().Err(err).Msg("error adding session to the revocation list")
+				}
+			}
+			return nil, invalidGrant("invalid or expired authorization code")
+		case errors.Is(err, repository.ErrOAuthCodeNotFound):
+			return nil, invalidGrant("invalid or expired authorization code")
+		default:
+			logger.Log.Error().Err(err).Msg("error consuming authorization code")
+			return nil, apperror.Internal(err)
+		}
+	}
+
+	if authorization.ClientID != client.ID || authorization.UserID == nil {
+		return nil, invalidGrant("invalid or expired authorization code")
+	}
+	if authorization.RedirectURI != req.RedirectURI {
+		return nil, invalidGrant("redirect_uri does not match the authorization request")
+	}
+	if subtle.ConstantTimeCompare([]byte(pkceChallenge(req.CodeVerifier)), []byte(authorization.CodeChallenge)) != 1 {
+		return nil, invalidGrant("invalid code_verifier")
+	}
+
+	userResp, err := s.grpcUserClient.GetUserByID(ctx, *authorization.UserID)
+	if err != nil {
+		if st, ok := status.FromError(err); ok && st.Code() == codes.NotFound {
+			return nil, invalidGrant("invalid or expired authorization code")
+		}
+		logger.Log.Error().Err(err).Msg("error gRPC get user by ID")
+		return nil, apperror.FromGRPC(err)
+	}
+	user := userResp.User
+
+	session := &entity.Session{
+		UserID:      user.Id,
+		DeviceLabel: client.Name,
+	}
+	if err := s.tokenRepo.CreateSession(ctx, session); err != nil {
+		logger.Log.Error().Err(err).Msg("error creating session")
+		return nil, apperror.Internal(err)
+	}
+	if err := s.repo.SetAuthorizationSession(ctx, authorization.ID, session.ID); err != nil {
+		logger.Log.Error().Err(err).Msg("error setting oauth authorization session")
+		return nil, apperror.Internal(err)
+	}
+
+	accessToken, err := s.tokenManager.GenerateAccessToken(Principal{
+		UserID:    user.Id,
+		SessionID: session.ID,
+		ClientID:  client.ID,
+		Scope:     authorization.Scope,
+	})
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error generating access token")
+		return nil, apperror.Internal(err)
+	}
+
+	now := time.Now()
+	idClaims := IDTokenClaims{
+		Nonce:     authorization.Nonce,
+		SessionID: session.ID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Issuer:    s.cfg.OAuth.OAuthIssuer,
+			Subject:   user.Id,
+			Audience:  jwt.ClaimStrings{client.ID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(s.cfg.JWT.JWTAccessTokenExp)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+	if authorization.AuthTime != nil {
+		idClaims.AuthTime = jwt.NewNumericDate(*authorization.AuthTime)
+	}
+	if slices.Contains(strings.Fields(authorization.Scope), OAuthScopeEmail) {
+		idClaims.Email = user.Email
+		idClaims.EmailVerified = &user.EmailVerified
+	}
+
+	idToken, err := s.tokenManager.GenerateIDToken(idClaims)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error generating id token")
+		return nil, apperror.Internal(err)
+	}
+
+	return &OAuthTokens{
+		AccessToken: accessToken,
+		IDToken:     idToken,
+		ExpiresIn:   int(s.cfg.JWT.JWTAccessTokenExp.Seconds()),
+		Scope:       authorization.Scope,
+	}, nil
+}
+
+func (s *oauthService) UserInfo(ctx context.Context, accessToken string) (*OAuthUserInfo, error) {
+	claims, err := s.tokenManager.ValidateAccessToken(accessToken)
+	if err != nil || len(claims.Audience) == 0 {
+		return nil, apperror.Unauthorized("invalid or expired token")
+	}
+
+	scopes := strings.Fields(claims.Scope)
+	if !slices.Contains(scopes, OAuthScopeOpenID) {
+		return nil, apperror.Forbidden("the token was not granted the openid scope")
+	}
+
+	revoked, err := s.redisCache.IsRevoked(ctx, claims.ID, claims.SessionID)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error checking token revocation")
+		if !s.cfg.RevocationFailOpen {
+			return nil, apperror.Internal(err)
+		}
+	}
+	if revoked {
+		return nil, apperror.Unauthorized("invalid or expired token")
+	}
+
+	userResp, err := s.grpcUserClient.GetUserByID(ctx, claims.Subject)
+	if err != nil {
+		if st, ok := status.FromError(err); ok && st.Code() == codes.NotFound {
+			return nil, apperror.Unauthorized("invalid or expired token")
+		}
+		logger.Log.Error().Err(err).Msg("error gRPC get user by ID")
+		return nil, apperror.FromGRPC(err)
+	}
+
+	info := &OAuthUserInfo{Subject: userResp.User.Id}
+	if slices.Contains(scopes, OAuthScopeEmail) {
+		info.Email = userResp.User.Email
+		info.EmailVerified = &userResp.User.EmailVerified
+	}
+
+	return info, nil
+}
+
+func (s *oauthService) ListClients(ctx context.Context) ([]*entity.OAuthClient, error) {
+	clients, err := s.repo.ListClients(ctx)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error listing oauth clients")
+		return nil, apperror.Internal(err)
+	}
+
+	return clients, nil
+}
+
+func (s *oauthService) CreateClient(ctx context.Context, name string, redirectURIs, scopes []string, public bool) (*entity.OAuthClient, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", apperror.BadRequest("name is required")
+	}
+
+	if len(redirectURIs) == 0 {
+		return nil, "", apperror.BadRequest("at least one redirect uri is required")
+	}
+	for _, uri := range redirectURIs {
+		if !validRedirectURI(uri) {
+			return nil, "", apperror.BadRequest("redirect uris must be absolute https urls without a fragment, http is only allowed for localhost")
+		}
+	}
+
+	if len(scopes) == 0 {
+		scopes = OAuthScopes
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(OAuthScopes, scope) {
+			return nil, "", apperror.BadRequest("unsupported scope " + scope)
+		}
+	}
+	if !slices.Contains(scopes, OAuthScopeOpenID) {
+		return nil, "", apperror.BadRequest("the openid scope is required")
+	}
+
+	client := &entity.OAuthClient{
+		ID:           uuid.NewString(),
+		Name:         name,
+		RedirectURIs: strings.Join(redirectURIs, " "),
+		Scopes:       strings.Join(scopes, " "),
+	}
+
+	var secret string
+	if !public {
+		var err error
+		secret, err = newResetToken()
+		if err != nil {
+			logger.Log.Error().Err(err).Msg("error generating client secret")
+			return nil, "", apperror.Internal(err)
+		}
+
+		hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+		if err != nil {
+			logger.Log.Error().Err(err).Msg("error hashing client secret")
+			return nil, "", apperror.Internal(err)
+		}
+		client.SecretHash = string(hash)
+	}
+
+	if err := s.repo.CreateClient(ctx, client); err != nil {
+		logger.Log.Error().Err(err).Msg("error creating oauth client")
+		return nil, "", apperror.Internal(err)
+	}
+
+	logger.Log.Info().
+		Str("client_id", client.ID).
+		Str("name", client.Name).
+		Bool("public", public).
+		Msg("oauth client registered")
+
+	return client, secret, nil
+}
+
+func (s *oauthService) DeleteClient(ctx context.Context, clientID string) error {
+	if err := s.repo.DeleteClient(ctx, clientID); err != nil {
+		if errors.Is(err, repository.ErrOAuthClientNotFound) {
+			return apperror.NotFound("client not found")
+		}
+		logger.Log.Error().Err(err).Msg("error deleting oauth client")
+		return apperror.Internal(err)
+	}
+
+	return nil
+}
+
+// authenticateClient checks the client secret of a confidential client. Public clients must not
+// send one, PKCE is what binds their code to them.
+func (s *oauthService) authenticateClient(ctx context.Context, clientID, secret string) (*entity.OAuthClient, error) {
+	client, err := s.repo.GetClient(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrOAuthClientNotFound) {
+			return nil, invalidClient()
+		}
+		logger.Log.Error().Err(err).Msg("error getting oauth client")
+		return nil, apperror.Internal(err)
+	}
+
+	if client.SecretHash == "" {
+		if secret != "" {
+			return nil, invalidClient()
+		}
+		return client, nil
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(client.SecretHash), []byte(secret)) != nil {
+		logger.Log.Warn().
+			Str("event", "oauth_client_auth_failed").
+			Str("client_id", client.ID).
+			Msg("security event: oauth client authentication failed")
+		return nil, invalidClient()
+	}
+
+	return client, nil
+}
+
+// redirectURL adds the parameters to the client's redirect URI, along with the issuer so the
+// client can tell which provider responded (RFC 9207).
+func (s *oauthService) redirectURL(redirectURI string, params url.Values) string {
+	target, err := url.Parse(redirectURI)
+	if err != nil {
+		// registered redirect URIs are validated when the client is created
+		return redirectURI
+	}
+
+	query := target.Query()
+	for key, values := range params {
+		if len(values) > 0 && values[0] != "" {
+			query.Set(key, values[0])
+		}
+	}
+	query.Set("iss", s.cfg.OAuth.OAuthIssuer)
+	target.RawQuery = query.Encode()
+
+	return target.String()
+}
+
+// grantableScopes returns the requested scopes without duplicates, if openid is among them and
+// the client is registered for all of them.
+func grantableScopes(requested string, registered []string) ([]string, bool) {
+	var scopes []string
+	for _, scope := range strings.Fields(requested) {
+		if !slices.Contains(registered, scope) {
+			return nil, false
+		}
+		if !slices.Contains(scopes, scope) {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	return scopes, slices.Contains(scopes, OAuthScopeOpenID)
+}
+
+// validRedirectURI accepts absolute https URLs, and http URLs of the loopback interface for
+// apps in development.
+func validRedirectURI(uri string) bool {
+	target, err := url.Parse(uri)
+	if err != nil || target.Host == "" || target.Fragment != "" || strings.ContainsAny(uri, " \t\n") {
+		return false
+	}
+
+	switch target.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := target.Hostname()
+		return host == "localhost" || host == "127.0.0.1" || host == "::1"
+	default:
+		return false
+	}
+}
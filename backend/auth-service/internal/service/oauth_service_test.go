@@ -0,0 +1,575 @@
+package service
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"auth-service/internal/repository"
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// fakeOAuthRepository keeps clients and authorizations in memory, keyed by the raw request ids
+// and codes.
+type fakeOAuthRepository struct {
+	mu             sync.Mutex
+	clients        map[string]*entity.OAuthClient
+	authorizations []*oauthAuthorizationRecord
+}
+
+type oauthAuthorizationRecord struct {
+	requestID     string
+	code          string
+	authorization entity.OAuthAuthorization
+}
+
+func newFakeOAuthRepository() *fakeOAuthRepository {
+	return &fakeOAuthRepository{clients: map[string]*entity.OAuthClient{}}
+}
+
+func (r *fakeOAuthRepository) ListClients(context.Context) ([]*entity.OAuthClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	clients := []*entity.OAuthClient{}
+	for _, client := range r.clients {
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+func (r *fakeOAuthRepository) GetClient(_ context.Context, clientID string) (*entity.OAuthClient, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	client, ok := r.clients[clientID]
+	if !ok {
+		return nil, repository.ErrOAuthClientNotFound
+	}
+	copied := *client
+	return &copied, nil
+}
+
+func (r *fakeOAuthRepository) CreateClient(_ context.Context, client *entity.OAuthClient) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	client.CreatedAt = time.Now()
+	copied := *client
+	r.clients[client.ID] = &copied
+	return nil
+}
+
+func (r *fakeOAuthRepository) DeleteClient(_ context.Context, clientID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.clients[clientID]; !ok {
+		return repository.ErrOAuthClientNotFound
+	}
+	delete(r.clients, clientID)
+	return nil
+}
+
+func (r *fakeOAuthRepository) CreateAuthorization(_ context.Context, requestID string, authorization *entity.OAuthAuthorization) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	authorization.ID = len(r.authorizations) + 1
+	r.authorizations = append(r.authorizations, &oauthAuthorizationRecord{requestID: requestID, authorization: *authorization})
+	return nil
+}
+
+// pendingLocked returns the record of a request still waiting for the user.
+func (r *fakeOAuthRepository) pendingLocked(requestID string) (*oauthAuthorizationRecord, int) {
+	for i, record := range r.authorizations {
+		if record.requestID == requestID && record.authorization.UserID == nil && time.Now().Before(record.authorization.ExpiresAt) {
+			return record, i
+		}
+	}
+	return nil, -1
+}
+
+func (r *fakeOAuthRepository) GetAuthorizationRequest(_ context.Context, requestID string) (*entity.OAuthAuthorization, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, _ := r.pendingLocked(requestID)
+	if record == nil {
+		return nil, repository.ErrOAuthRequestNotFound
+	}
+	copied := record.authorization
+	return &copied, nil
+}
+
+func (r *fakeOAuthRepository) ApproveAuthorization(_ context.Context, requestID, userID, code string, authTime time.Time) (*entity.OAuthAuthorization, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, _ := r.pendingLocked(requestID)
+	if record == nil {
+		return nil, repository.ErrOAuthRequestNotFound
+	}
+	record.code = code
+	record.authorization.UserID = &userID
+	record.authorization.AuthTime = &authTime
+	record.authorization.ExpiresAt = time.Now().Add(time.Minute)
+	copied := record.authorization
+	return &copied, nil
+}
+
+func (r *fakeOAuthRepository) DenyAuthorization(_ context.Context, requestID string) (*entity.OAuthAuthorization, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	record, i := r.pendingLocked(requestID)
+	if record == nil {
+		return nil, repository.ErrOAuthRequestNotFound
+	}
+	r.authorizations = append(r.authorizations[:i], r.authorizations[i+1:]...)
+	return &record.authorization, nil
+}
+
+func (r *fakeOAuthRepository) ConsumeCode(_ context.Context, code string) (*entity.OAuthAuthorization, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, record := range r.authorizations {
+		if record.code == "" || record.code != code {
+			continue
+		}
+		if record.authorization.UsedAt != nil {
+			copied := record.authorization
+			return &copied, repository.ErrOAuthCodeReused
+		}
+		if !time.Now().Before(record.authorization.ExpiresAt) {
+			return nil, repository.ErrOAuthCodeNotFound
+		}
+		now := time.Now()
+		record.authorization.UsedAt = &now
+		copied := record.authorization
+		return &copied, nil
+	}
+	return nil, repository.ErrOAuthCodeNotFound
+}
+
+func (r *fakeOAuthRepository) SetAuthorizationSession(_ context.Context, id int, sessionID string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, record := range r.authorizations {
+		if record.authorization.ID == id {
+			record.authorization.SessionID = &sessionID
+		}
+	}
+	return nil
+}
+
+const (
+	testRedirectURI  = "https://app.example.com/callback"
+	testCodeVerifier = "test-code-verifier-with-enough-entropy-0123456789"
+)
+
+type oauthTestEnv struct {
+	svc     OAuthService
+	mgr     TokenManager
+	users   *fakeUserClient
+	tokens  *fakeTokenRepository
+	revoked *fakeRedisCache
+}
+
+func newTestOAuthService(t *testing.T) *oauthTestEnv {
+	t.Helper()
+
+	_, jwtCfg := newTestManager()
+	keys, mgr := newTestKeyService(t, &fakeKeyRepository{}, jwtCfg)
+	if err := keys.EnsureKey(context.Background(), KeyPurposeIDToken, "ES256"); err != nil {
+		t.Fatalf("EnsureKey() error: %v", err)
+	}
+
+	env := &oauthTestEnv{
+		mgr:     mgr,
+		users:   newFakeUserClient(),
+		tokens:  newFakeTokenRepository(),
+		revoked: newFakeRedisCache(),
+	}
+	cfg := config.Config{
+		JWT: jwtCfg,
+		OAuth: config.OAuthConfig{
+			OAuthIssuer:     "https://example.com/api/auth",
+			OAuthConsentURL: "https://example.com/oauth/consent",
+			OAuthConsentExp: 10 * time.Minute,
+			OAuthCodeExp:    time.Minute,
+		},
+	}
+	env.svc = NewOAuthService(env.users, newFakeOAuthRepository(), env.tokens, env.revoked, mgr, cfg)
+	return env
+}
+
+// signIn registers a user and opens a session on the provider, as the consent page would have.
+func (e *oauthTestEnv) signIn(t *testing.T, email string) *entity.Session {
+	t.Helper()
+
+	registerTestUser(t, e.users, email, "password")
+	userResp, err := e.users.GetUserByEmail(context.Background(), email)
+	if err != nil {
+		t.Fatalf("GetUserByEmail() error: %v", err)
+	}
+
+	session := &entity.Session{UserID: userResp.User.Id, CreatedAt: time.Now().Add(-time.Hour)}
+	if err := e.tokens.CreateSession(context.Background(), session); err != nil {
+		t.Fatalf("CreateSession() error: %v", err)
+	}
+	return session
+}
+
+// authorizeRequest returns a valid authorization request of the client.
+func authorizeRequest(clientID, scope string) OAuthAuthorizeRequest {
+	return OAuthAuthorizeRequest{
+		ResponseType:        "code",
+		ClientID:            clientID,
+		RedirectURI:         testRedirectURI,
+		Scope:               scope,
+		State:               "client-state",
+		Nonce:               "client-nonce",
+		CodeChallenge:       pkceChallenge(testCodeVerifier),
+		CodeChallengeMethod: "S256",
+	}
+}
+
+// approve runs the authorization request through the consent page and returns the code.
+func (e *oauthTestEnv) approve(t *testing.T, req OAuthAuthorizeRequest, session *entity.Session) string {
+	t.Helper()
+	ctx := context.Background()
+
+	location, err := e.svc.Authorize(ctx, req)
+	if err != nil {
+		t.Fatalf("Authorize() error: %v", err)
+	}
+	consentURL, _ := url.Parse(location)
+	if !strings.HasPrefix(location, "https://example.com/oauth/consent?") || consentURL.Query().Get("request_id") == "" {
+		t.Fatalf("Authorize() = %s, want the consent page", location)
+	}
+
+	location, err = e.svc.Approve(ctx, consentURL.Query().Get("request_id"), session.UserID, session.ID)
+	if err != nil {
+		t.Fatalf("Approve() error: %v", err)
+	}
+	redirect, _ := url.Parse(location)
+	query := redirect.Query()
+	if !strings.HasPrefix(location, testRedirectURI+"?") || query.Get("state") != req.State || query.Get("iss") != "https://example.com/api/auth" {
+		t.Fatalf("Approve() = %s, want the redirect uri with the state and issuer", location)
+	}
+	return query.Get("code")
+}
+
+func tokenRequest(clientID, secret, code string) OAuthTokenRequest {
+	return OAuthTokenRequest{
+		GrantType:    "authorization_code",
+		Code:         code,
+		RedirectURI:  testRedirectURI,
+		CodeVerifier: testCodeVerifier,
+		ClientID:     clientID,
+		ClientSecret: secret,
+	}
+}
+
+func assertOAuthError(t *testing.T, err error, code string) {
+	t.Helper()
+
+	var oauthErr *OAuthError
+	if !errors.As(err, &oauthErr) || oauthErr.Code != code {
+		t.Fatalf("expected %s oauth error, got %v", code, err)
+	}
+}
+
+func TestOAuthService_AuthorizationCodeFlow(t *testing.T) {
+	env := newTestOAuthService(t)
+	ctx := context.Background()
+	session := env.signIn(t, "oauth@example.com")
+
+	client, secret, err := env.svc.CreateClient(ctx, "Wiki", []string{testRedirectURI}, nil, false)
+	if err != nil {
+		t.Fatalf("CreateClient() error: %v", err)
+	}
+	if secret == "" || client.SecretHash == secret {
+		t.Fatal("CreateClient() should return a secret and store only its hash")
+	}
+
+	location, err := env.svc.Authorize(ctx, authorizeRequest(client.ID, "openid email openid"))
+	if err != nil {
+		t.Fatalf("Authorize() error: %v", err)
+	}
+	consentURL, _ := url.Parse(location)
+	requestID := consentURL.Query().Get("request_id")
+
+	consent, err := env.svc.GetConsent(ctx, requestID)
+	if err != nil {
+		t.Fatalf("GetConsent() error: %v", err)
+	}
+	if consent.ClientName != "Wiki" || strings.Join(consent.Scopes, " ") != "openid email" {
+		t.Fatalf("GetConsent() = %+v, want the client name and the deduplicated scopes", consent)
+	}
+
+	code := env.approve(t, authorizeRequest(client.ID, "openid email"), session)
+	tokens, err := env.svc.Token(ctx, tokenRequest(client.ID, secret, code))
+	if err != nil {
+		t.Fatalf("Token() error: %v", err)
+	}
+	if tokens.Scope != "openid email" || tokens.ExpiresIn != int((15*time.Minute).Seconds()) {
+		t.Errorf("Token() = %+v, want the granted scope and the access token lifetime", tokens)
+	}
+
+	// the ID token is signed with the id token keys, which the access token keys can not verify
+	var idClaims IDTokenClaims
+	_, err = jwt.ParseWithClaims(tokens.IDToken, &idClaims, func(token *jwt.Token) (any, error) {
+		key, ok := env.mgr.Keyring().Verifier(KeyPurposeIDToken, token.Header["kid"].(string))
+		if !ok {
+			return nil, errors.New("unknown id token key")
+		}
+		return key.VerifyKey, nil
+	}, jwt.WithIssuer("https://example.com/api/auth"), jwt.WithAudience(client.ID))
+	if err != nil {
+		t.Fatalf("ID token does not verify: %v", err)
+	}
+	if idClaims.Subject != session.UserID || idClaims.Nonce != "client-nonce" || idClaims.Email != "oauth@example.com" ||
+		idClaims.EmailVerified == nil || !*idClaims.EmailVerified || idClaims.AuthTime == nil {
+		t.Errorf("ID token claims = %+v, want the user, nonce, auth_time and email claims", idClaims)
+	}
+	if _, err := env.mgr.ValidateAccessToken(tokens.IDToken); err == nil {
+		t.Error("an ID token should not be accepted as an access token")
+	}
+
+	claims, err := env.mgr.ValidateAccessToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken() error: %v", err)
+	}
+	if len(claims.Audience) != 1 || claims.Audience[0] != client.ID || len(claims.Roles) != 0 {
+		t.Errorf("access token claims = %+v, want the client as audience and no roles", claims)
+	}
+
+	info, err := env.svc.UserInfo(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("UserInfo() error: %v", err)
+	}
+	if info.Subject != session.UserID || info.Email != "oauth@example.com" {
+		t.Errorf("UserInfo() = %+v, want the user and their email", info)
+	}
+
+	// a first party access token has no audience and is not accepted by the userinfo endpoint
+	firstParty, err := env.mgr.GenerateAccessToken(Principal{UserID: session.UserID, SessionID: session.ID})
+	if err != nil {
+		t.Fatalf("GenerateAccessToken() error: %v", err)
+	}
+	_, err = env.svc.UserInfo(ctx, firstParty)
+	assertUnauthorized(t, err)
+}
+
+func TestOAuthService_AuthorizeRejectsInvalidRequests(t *testing.T) {
+	env := newTestOAuthService(t)
+	ctx := context.Background()
+
+	client, _, err := env.svc.CreateClient(ctx, "Wiki", []string{testRedirectURI}, []string{"openid"}, false)
+	if err != nil {
+		t.Fatalf("CreateClient() error: %v", err)
+	}
+
+	// without a trusted redirect uri the error can only be shown to the user
+	unknownClient := authorizeRequest("unknown", "openid")
+	_, err = env.svc.Authorize(ctx, unknownClient)
+	assertAppError(t, err, 400)
+
+	otherRedirect := authorizeRequest(client.ID, "openid")
+	otherRedirect.RedirectURI = testRedirectURI + "/other"
+	_, err = env.svc.Authorize(ctx, otherRedirect)
+	assertAppError(t, err, 400)
+
+	withoutPKCE := authorizeRequest(client.ID, "openid")
+	withoutPKCE.CodeChallengeMethod = "plain"
+	implicit := authorizeRequest(client.ID, "openid")
+	implicit.ResponseType = "token"
+
+	testCases := []struct {
+		name      string
+		req       OAuthAuthorizeRequest
+		wantError string
+	}{
+		{name: "PKCE without S256", req: withoutPKCE, wantError: "invalid_request"},
+		{name: "Implicit flow", req: implicit, wantError: "unsupported_response_type"},
+		{name: "Missing openid scope", req: authorizeRequest(client.ID, "email"), wantError: "invalid_scope"},
+		{name: "Scope not registered for the client", req: authorizeRequest(client.ID, "openid email"), wantError: "invalid_scope"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			location, err := env.svc.Authorize(ctx, tc.req)
+			if err != nil {
+				t.Fatalf("Authorize() error: %v", err)
+			}
+			redirect, _ := url.Parse(location)
+			if !strings.HasPrefix(location, testRedirectURI+"?") ||
+				redirect.Query().Get("error") != tc.wantError || redirect.Query().Get("state") != "client-state" {
+				t.Errorf("Authorize() = %s, want the redirect uri with error %s", location, tc.wantError)
+			}
+		})
+	}
+
+	_, _, err = env.svc.CreateClient(ctx, "Insecure", []string{"http://app.example.com/callback"}, nil, false)
+	assertAppError(t, err, 400)
+	_, _, err = env.svc.CreateClient(ctx, "Fragment", []string{"https://app.example.com/callback#token"}, nil, false)
+	assertAppError(t, err, 400)
+	_, _, err = env.svc.CreateClient(ctx, "Loopback", []string{"http://127.0.0.1:8080/callback"}, nil, true)
+	if err != nil {
+		t.Errorf("CreateClient() with a loopback redirect uri error: %v", err)
+	}
+}
+
+func TestOAuthService_TokenRejectsInvalidGrants(t *testing.T) {
+	env := newTestOAuthService(t)
+	ctx := context.Background()
+	session := env.signIn(t, "grants@example.com")
+
+	client, secret, err := env.svc.CreateClient(ctx, "Wiki", []string{testRedirectURI}, nil, false)
+	if err != nil {
+		t.Fatalf("CreateClient() error: %v", err)
+	}
+	other, otherSecret, err := env.svc.CreateClient(ctx, "Other", []string{testRedirectURI}, nil, false)
+	if err != nil {
+		t.Fatalf("CreateClient() error: %v", err)
+	}
+
+	wrongVerifier := tokenRequest(client.ID, secret, env.approve(t, authorizeRequest(client.ID, "openid"), session))
+	wrongVerifier.CodeVerifier = "another-verifier"
+	_, err = env.svc.Token(ctx, wrongVerifier)
+	assertOAuthError(t, err, "invalid_grant")
+
+	wrongRedirect := tokenRequest(client.ID, secret, env.approve(t, authorizeRequest(client.ID, "openid"), session))
+	wrongRedirect.RedirectURI = "https://app.example.com/other"
+	_, err = env.svc.Token(ctx, wrongRedirect)
+	assertOAuthError(t, err, "invalid_grant")
+
+	// a code is bound to the client it was issued to
+	_, err = env.svc.Token(ctx, tokenRequest(other.ID, otherSecret, env.approve(t, authorizeRequest(client.ID, "openid"), session)))
+	assertOAuthError(t, err, "invalid_grant")
+
+	_, err = env.svc.Token(ctx, tokenRequest(client.ID, "wrong-secret", env.approve(t, authorizeRequest(client.ID, "openid"), session)))
+	assertOAuthError(t, err, "invalid_client")
+
+	refresh := tokenRequest(client.ID, secret, "")
+	refresh.GrantType = "refresh_token"
+	_, err = env.svc.Token(ctx, refresh)
+	assertOAuthError(t, err, "unsupported_grant_type")
+}
+
+func TestOAuthService_CodeReuseRevokesSession(t *testing.T) {
+	env := newTestOAuthService(t)
+	ctx := context.Background()
+	session := env.signIn(t, "reuse@example.com")
+
+	client, secret, err := env.svc.CreateClient(ctx, "Wiki", []string{testRedirectURI}, nil, false)
+	if err != nil {
+		t.Fatalf("CreateClient() error: %v", err)
+	}
+
+	code := env.approve(t, authorizeRequest(client.ID, "openid"), session)
+	tokens, err := env.svc.Token(ctx, tokenRequest(client.ID, secret, code))
+	if err != nil {
+		t.Fatalf("Token() error: %v", err)
+	}
+	claims, err := env.mgr.ValidateAccessToken(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken() error: %v", err)
+	}
+
+	_, err = env.svc.Token(ctx, tokenRequest(client.ID, secret, code))
+	assertOAuthError(t, err, "invalid_grant")
+
+	if _, err := env.tokens.GetSession(ctx, claims.SessionID); !errors.Is(err, repository.ErrSessionNotFound) {
+		t.Errorf("the session of a replayed code should be revoked, got %v", err)
+	}
+	_, err = env.svc.UserInfo(ctx, tokens.AccessToken)
+	assertUnauthorized(t, err)
+
+	// the user's own session is not affected
+	if _, err := env.tokens.GetSession(ctx, session.ID); err != nil {
+		t.Errorf("GetSession() error: %v", err)
+	}
+}
+
+func TestOAuthService_DenyAndPublicClients(t *testing.T) {
+	env := newTestOAuthService(t)
+	ctx := context.Background()
+	session := env.signIn(t, "public@example.com")
+
+	client, secret, err := env.svc.CreateClient(ctx, "Mobile", []string{testRedirectURI}, nil, true)
+	if err != nil {
+		t.Fatalf("CreateClient() error: %v", err)
+	}
+	if secret != "" || client.SecretHash != "" {
+		t.Fatal("a public client should not get a secret")
+	}
+
+	location, err := env.svc.Authorize(ctx, authorizeRequest(client.ID, "openid"))
+	if err != nil {
+		t.Fatalf("Authorize() error: %v", err)
+	}
+	consentURL, _ := url.Parse(location)
+	requestID := consentURL.Query().Get("request_id")
+
+	// only a signed-in user can deny, with a session of their own
+	other := env.signIn(t, "other@example.com")
+	_, err = env.svc.Deny(ctx, requestID, session.UserID, other.ID)
+	assertUnauthorized(t, err)
+	_, err = env.svc.Deny(ctx, requestID, session.UserID, "")
+	assertUnauthorized(t, err)
+
+	location, err = env.svc.Deny(ctx, requestID, session.UserID, session.ID)
+	if err != nil {
+		t.Fatalf("Deny() error: %v", err)
+	}
+	redirect, _ := url.Parse(location)
+	if redirect.Query().Get("error") != "access_denied" || redirect.Query().Get("state") != "client-state" {
+		t.Errorf("Deny() = %s, want the access_denied error", location)
+	}
+	_, err = env.svc.Approve(ctx, requestID, session.UserID, session.ID)
+	assertAppError(t, err, 404)
+	_, err = env.svc.Deny(ctx, requestID, session.UserID, session.ID)
+	assertAppError(t, err, 404)
+
+	// an approved request can not be denied afterwards
+	location, err = env.svc.Authorize(ctx, authorizeRequest(client.ID, "openid"))
+	if err != nil {
+		t.Fatalf("Authorize() error: %v", err)
+	}
+	consentURL, _ = url.Parse(location)
+	approvedID := consentURL.Query().Get("request_id")
+	if _, err := env.svc.Approve(ctx, approvedID, session.UserID, session.ID); err != nil {
+		t.Fatalf("Approve() error: %v", err)
+	}
+	_, err = env.svc.Deny(ctx, approvedID, other.UserID, other.ID)
+	assertAppError(t, err, 404)
+
+	// PKCE binds the code to a public client, a secret it can not have is refused
+	_, err = env.svc.Token(ctx, tokenRequest(client.ID, "guessed", env.approve(t, authorizeRequest(client.ID, "openid"), session)))
+	assertOAuthError(t, err, "invalid_client")
+
+	tokens, err := env.svc.Token(ctx, tokenRequest(client.ID, "", env.approve(t, authorizeRequest(client.ID, "openid"), session)))
+	if err != nil {
+		t.Fatalf("Token() error: %v", err)
+	}
+
+	// the email claims need the email scope
+	info, err := env.svc.UserInfo(ctx, tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("UserInfo() error: %v", err)
+	}
+	if info.Email != "" || info.EmailVerified != nil {
+		t.Errorf("UserInfo() = %+v, want no email claims without the email scope", info)
+	}
+}
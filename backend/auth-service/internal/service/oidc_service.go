@@ -0,0 +1,236 @@
+package service
+
+import (
+	"auth-service/internal/apperror"
+	grpcClient "auth-service/internal/client/grpc"
+	oidcClient "auth-service/internal/client/oidc"
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"auth-service/internal/logger"
+	"auth-service/internal/repository"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// OIDCAuthorization starts a login at a provider. The browser is redirected to URL, State is
+// bound to the browser so the callback can only be completed where the login started.
+type OIDCAuthorization struct {
+	URL   string
+	State string
+}
+
+// OIDCService signs users in through external OpenID Connect providers. An identity is linked to
+// the account with the same email if the provider verified the email, a new account is created
+// when there is none.
+type OIDCService interface {
+	// Providers returns the names of the configured providers.
+	Providers() []string
+	Begin(ctx context.Context, provider string) (*OIDCAuthorization, error)
+	// Finish redeems the authorization code returned to the callback and returns the user the
+	// identity belongs to.
+	Finish(ctx context.Context, provider, state, code string) (string, error)
+}
+
+type oidcService struct {
+	grpcUserClient grpcClient.UserService
+	repo           repository.OIDCRepository
+	providers      map[string]oidcClient.Provider
+	names          []string
+	cfg            config.Config
+}
+
+func NewOIDCService(grpcUserClient grpcClient.UserService, repo repository.OIDCRepository, cfg config.Config) OIDCService {
+	providers := make(map[string]oidcClient.Provider, len(cfg.OIDC.OIDCProviders))
+	names := make([]string, 0, len(cfg.OIDC.OIDCProviders))
+	for _, p := range cfg.OIDC.OIDCProviders {
+		providers[p.Name] = oidcClient.NewProvider(p, cfg.OIDC.OIDCCallbackBaseURL+"/"+p.Name+"/callback")
+		names = append(names, p.Name)
+	}
+
+	return &oidcService{
+		grpcUserClient: grpcUserClient,
+		repo:           repo,
+		providers:      providers,
+		names:          names,
+		cfg:            cfg,
+	}
+}
+
+func (s *oidcService) Providers() []string {
+	return s.names
+}
+
+func (s *oidcService) Begin(ctx context.Context, name string) (*OIDCAuthorization, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return nil, apperror.NotFound("unknown identity provider")
+	}
+
+	var secrets [3]string
+	for i := range secrets {
+		secret, err := newResetToken()
+		if err != nil {
+			logger.Log.Error().Err(err).Msg("error generating oidc state")
+			return nil, apperror.Internal(err)
+		}
+		secrets[i] = secret
+	}
+	state, nonce, codeVerifier := secrets[0], secrets[1], secrets[2]
+
+	authURL, err := provider.AuthCodeURL(ctx, state, nonce, pkceChallenge(codeVerifier))
+	if err != nil {
+		logger.Log.Error().Err(err).Str("provider", name).Msg("error building authorization url")
+		return nil, apperror.Internal(err)
+	}
+
+	err = s.repo.SaveState(ctx, state, &entity.OIDCState{
+		Provider:     name,
+		Nonce:        nonce,
+		CodeVerifier: codeVerifier,
+		ExpiresAt:    time.Now().Add(s.cfg.OIDC.OIDCStateExp),
+	})
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error saving oidc state")
+		return nil, apperror.Internal(err)
+	}
+
+	return &OIDCAuthorization{URL: authURL, State: state}, nil
+}
+
+func (s *oidcService) Finish(ctx context.Context, name, state, code string) (string, error) {
+	provider, ok := s.providers[name]
+	if !ok {
+		return "", apperror.NotFound("unknown identity provider")
+	}
+
+	oidcState, err := s.repo.ConsumeState(ctx, state, name)
+	if err != nil {
+		if errors.Is(err, repository.ErrOIDCStateNotFound) {
+			return "", apperror.BadRequest("invalid or expired login state")
+		}
+		logger.Log.Error().Err(err).Msg("error consuming oidc state")
+		return "", apperror.Internal(err)
+	}
+
+	claims, err := provider.Exchange(ctx, code, oidcState.CodeVerifier, oidcState.Nonce)
+	if err != nil {
+		if errors.Is(err, oidcClient.ErrInvalidIDToken) {
+			logger.Log.Warn().
+				Err(err).
+				Str("event", "oidc_invalid_id_token").
+				Str("provider", name).
+				Msg("security event: id token rejected")
+		} else {
+			logger.Log.Error().Err(err).Str("provider", name).Msg("error redeeming authorization code")
+		}
+		return "", apperror.Unauthorized("login with the identity provider failed")
+	}
+
+	return s.resolveUser(ctx, name, claims)
+}
+
+// resolveUser returns the user linked to the identity, linking or creating one on the first login.
+func (s *oidcService) resolveUser(ctx context.Context, provider string, claims *oidcClient.Claims) (string, error) {
+	identity, err := s.repo.GetIdentity(ctx, provider, claims.Subject)
+	if err == nil {
+		if err := s.repo.TouchIdentity(ctx, identity.ID, claims.Email); err != nil {
+			logger.Log.Error().Err(err).Msg("error touching identity")
+		}
+		return identity.UserID, nil
+	}
+	if !errors.Is(err, repository.ErrIdentityNotFound) {
+		logger.Log.Error().Err(err).Msg("error getting identity")
+		return "", apperror.Internal(err)
+	}
+
+	// only an address the provider vouches for may be matched to an account
+	if claims.Email == "" || !claims.EmailVerified {
+		return "", apperror.Forbidden("the identity provider did not confirm the email address")
+	}
+
+	userID, err := s.userForEmail(ctx, claims.Email, true)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	identity = &entity.Identity{
+		Provider:    provider,
+		Subject:     claims.Subject,
+		UserID:      userID,
+		Email:       claims.Email,
+		LastLoginAt: &now,
+	}
+	if err := s.repo.CreateIdentity(ctx, identity); err != nil {
+		if errors.Is(err, repository.ErrIdentityExists) {
+			// linked by a concurrent login in the meantime
+			return s.resolveUser(ctx, provider, claims)
+		}
+		logger.Log.Error().Err(err).Msg("error creating identity")
+		return "", apperror.Internal(err)
+	}
+
+	logger.Log.Info().
+		Str("event", "identity_linked").
+		Str("provider", provider).
+		Str("user_id", userID).
+		Msg("identity provider account linked")
+
+	return userID, nil
+}
+
+// userForEmail finds the account with the email, or creates one with a verified email and no
+// usable password. With retry it looks the account up again once if a concurrent sign in created
+// it meanwhile.
+func (s *oidcService) userForEmail(ctx context.Context, email string, retry bool) (string, error) {
+	userResp, err := s.grpcUserClient.GetUserByEmail(ctx, email)
+	if err == nil {
+		// whoever registered an unverified account may not own the address, linking would let
+		// them keep access to the account through its password
+		if !userResp.User.EmailVerified {
+			return "", apperror.Conflict("an account with this email already exists, verify its email before signing in with the identity provider")
+		}
+		return userResp.User.Id, nil
+	}
+	if st, ok := status.FromError(err); !ok || st.Code() != codes.NotFound {
+		logger.Log.Error().Err(err).Msg("error gRPC get user by email")
+		return "", apperror.FromGRPC(err)
+	}
+
+	// the password can be set later through the password reset
+	password, err := newResetToken()
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error generating password")
+		return "", apperror.Internal(err)
+	}
+	registered, err := s.grpcUserClient.RegisterUser(ctx, email, password, "")
+	if err != nil {
+		if st, ok := status.FromError(err); ok && st.Code() == codes.AlreadyExists && retry {
+			// a concurrent sign in created the account
+			return s.userForEmail(ctx, email, false)
+		}
+		logger.Log.Error().Err(err).Msg("error gRPC register user")
+		return "", apperror.FromGRPC(err)
+	}
+
+	if _, err := s.grpcUserClient.MarkEmailVerified(ctx, registered.Id, email); err != nil {
+		logger.Log.Error().Err(err).Msg("error gRPC mark email verified")
+		// an unverified account would block signing in with the identity provider for good
+		rollbackRegistration(ctx, s.grpcUserClient, registered.Id, "")
+		return "", apperror.FromGRPC(err)
+	}
+
+	return registered.Id, nil
+}
+
+// pkceChallenge is the S256 code challenge of the verifier (RFC 7636).
+func pkceChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,596 @@
+package service
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	userpb "auth-service/internal/genproto/user/v1"
+	"auth-service/internal/passwordpolicy"
+	"auth-service/internal/repository"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"maps"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fakeOIDCRepository keeps identities and login states in memory, states keyed by the raw value.
+type fakeOIDCRepository struct {
+	mu         sync.Mutex
+	identities []*entity.Identity
+	states     map[string]*entity.OIDCState
+	nextID     int
+}
+
+func newFakeOIDCRepository() *fakeOIDCRepository {
+	return &fakeOIDCRepository{states: map[string]*entity.OIDCState{}}
+}
+
+func (r *fakeOIDCRepository) GetIdentity(_ context.Context, provider, subject string) (*entity.Identity, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, identity := range r.identities {
+		if identity.Provider == provider && identity.Subject == subject {
+			copied := *identity
+			return &copied, nil
+		}
+	}
+	return nil, repository.ErrIdentityNotFound
+}
+
+func (r *fakeOIDCRepository) CreateIdentity(_ context.Context, identity *entity.Identity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.identities {
+		if existing.Provider == identity.Provider && existing.Subject == identity.Subject {
+			return repository.ErrIdentityExists
+		}
+	}
+	r.nextID++
+	identity.ID = r.nextID
+	copied := *identity
+	r.identities = append(r.identities, &copied)
+	return nil
+}
+
+func (r *fakeOIDCRepository) TouchIdentity(_ context.Context, id int, email string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, identity := range r.identities {
+		if identity.ID == id {
+			now := time.Now()
+			identity.Email = email
+			identity.LastLoginAt = &now
+		}
+	}
+	return nil
+}
+
+func (r *fakeOIDCRepository) SaveState(_ context.Context, state string, oidcState *entity.OIDCState) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.states[state] = oidcState
+	return nil
+}
+
+func (r *fakeOIDCRepository) ConsumeState(_ context.Context, state, provider string) (*entity.OIDCState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	oidcState, ok := r.states[state]
+	if !ok || oidcState.Provider != provider || !time.Now().Before(oidcState.ExpiresAt) {
+		return nil, repository.ErrOIDCStateNotFound
+	}
+	delete(r.states, state)
+	return oidcState, nil
+}
+
+// mockOIDCProvider is a minimal OpenID Connect issuer: discovery, JWKS and a token endpoint
+// that enforces PKCE. The authorization page is skipped, authorize hands out codes directly.
+// It also answers like GitHub at /user and /user/emails, for the plain OAuth 2.0 provider.
+type mockOIDCProvider struct {
+	server       *httptest.Server
+	key          *ecdsa.PrivateKey
+	clientID     string
+	clientSecret string
+
+	mu    sync.Mutex
+	codes map[string]mockAuthorization
+	// accessTokens maps the issued access tokens to the claims of the account
+	accessTokens map[string]jwt.MapClaims
+	// signingKey replaces the published key when set, tamper edits the claims of the ID tokens
+	signingKey *ecdsa.PrivateKey
+	tamper     func(jwt.MapClaims)
+}
+
+type mockAuthorization struct {
+	codeChallenge string
+	redirectURI   string
+	nonce         string
+	claims        jwt.MapClaims
+}
+
+func newMockOIDCProvider(t *testing.T) *mockOIDCProvider {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	m := &mockOIDCProvider{
+		key:          key,
+		clientID:     "test-client",
+		clientSecret: "test-secret",
+		codes:        map[string]mockAuthorization{},
+		accessTokens: map[string]jwt.MapClaims{},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, map[string]any{"keys": []map[string]string{{
+			"kty": "EC",
+			"crv": "P-256",
+			"kid": "mock-key",
+			"use": "sig",
+			"x":   base64.RawURLEncoding.EncodeToString(key.PublicKey.X.FillBytes(make([]byte, 32))),
+			"y":   base64.RawURLEncoding.EncodeToString(key.PublicKey.Y.FillBytes(make([]byte, 32))),
+		}}})
+	})
+	mux.HandleFunc("POST /token", m.token)
+	mux.HandleFunc("GET /user", m.userinfo("user"))
+	mux.HandleFunc("GET /user/emails", m.userinfo("emails"))
+
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+// authorize plays the provider's login page: it checks the request and returns the state and
+// a code for an account with the claims.
+func (m *mockOIDCProvider) authorize(t *testing.T, authURL string, claims jwt.MapClaims) (string, string) {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil || !strings.HasPrefix(authURL, m.server.URL+"/authorize?") {
+		t.Fatalf("authorization URL = %s, want the provider's authorization endpoint", authURL)
+	}
+	query := u.Query()
+	// only OpenID Connect logins send a nonce and need the openid scope
+	if query.Get("response_type") != "code" || query.Get("client_id") != m.clientID ||
+		query.Get("code_challenge_method") != "S256" ||
+		(query.Get("nonce") != "" && !strings.Contains(query.Get("scope"), "openid")) {
+		t.Fatalf("authorization request %v, want a code flow with PKCE", query)
+	}
+
+	code, err := newResetToken()
+	if err != nil {
+		t.Fatalf("failed to generate code: %v", err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.codes[code] = mockAuthorization{
+		codeChallenge: query.Get("code_challenge"),
+		redirectURI:   query.Get("redirect_uri"),
+		nonce:         query.Get("nonce"),
+		claims:        claims,
+	}
+	return query.Get("state"), code
+}
+
+func (m *mockOIDCProvider) token(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id, secret, _ := r.BasicAuth()
+	if id != m.clientID || secret != m.clientSecret {
+		http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+		return
+	}
+
+	code := r.PostFormValue("code")
+	authorization, ok := m.codes[code]
+	delete(m.codes, code)
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" ||
+		r.PostFormValue("redirect_uri") != authorization.redirectURI ||
+		pkceChallenge(r.PostFormValue("code_verifier")) != authorization.codeChallenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":   m.server.URL,
+		"aud":   m.clientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(5 * time.Minute).Unix(),
+		"nonce": authorization.nonce,
+	}
+	maps.Copy(claims, authorization.claims)
+	if m.tamper != nil {
+		m.tamper(claims)
+	}
+
+	key := m.key
+	if m.signingKey != nil {
+		key = m.signingKey
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, claims)
+	token.Header["kid"] = "mock-key"
+	idToken, err := token.SignedString(key)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	accessToken, err := newResetToken()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	m.accessTokens[accessToken] = authorization.claims
+
+	writeJSON(w, map[string]string{"access_token": accessToken, "token_type": "Bearer", "id_token": idToken})
+}
+
+// userinfo answers with the claim of the account the access token was issued for.
+func (m *mockOIDCProvider) userinfo(claim string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		claims, ok := m.accessTokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+		if !ok {
+			http.Error(w, `{"message":"Bad credentials"}`, http.StatusUnauthorized)
+			return
+		}
+		writeJSON(w, claims[claim])
+	}
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func newTestOIDCService(t *testing.T) (AuthService, MFAService, *mockOIDCProvider, *fakeUserClient) {
+	t.Helper()
+
+	mock := newMockOIDCProvider(t)
+	mgr, _ := newTestManager()
+	users := newFakeUserClient()
+	cfg := config.Config{
+		EmailVerification: config.EmailVerificationConfig{
+			EmailVerificationSecret: "verification-secret",
+			EmailVerificationPolicy: config.EmailVerificationBlock,
+		},
+		MFA: config.MFAConfig{
+			MFAEncryptionKey: "mfa-secret",
+			MFAChallengeExp:  time.Minute,
+		},
+		WebAuthn: testWebAuthnConfig(),
+		OIDC: config.OIDCConfig{
+			OIDCProviders: []config.OIDCProviderConfig{{
+				Name:         "mock",
+				Issuer:       mock.server.URL,
+				ClientID:     mock.clientID,
+				ClientSecret: mock.clientSecret,
+				Scopes:       []string{"email"},
+			}, {
+				Name:         "github",
+				Type:         config.OIDCProviderOAuth2,
+				ClientID:     mock.clientID,
+				ClientSecret: mock.clientSecret,
+				Scopes:       []string{"user:email"},
+				AuthURL:      mock.server.URL + "/authorize",
+				TokenURL:     mock.server.URL + "/token",
+				UserInfoURL:  mock.server.URL + "/user",
+				EmailsURL:    mock.server.URL + "/user/emails",
+			}},
+			OIDCCallbackBaseURL: "http://localhost/api/auth/oidc",
+			OIDCStateExp:        time.Minute,
+		},
+	}
+
+	webAuthn := newTestWebAuthnService(t, users, cfg)
+	revoked := newFakeRedisCache()
+	throttle := newTestLoginThrottleService(users, revoked, &fakeMailSender{}, cfg)
+	mfa := NewMFAService(users, newFakeMFARepository(), webAuthn, revoked, throttle, cfg)
+	verification := NewEmailVerificationService(users, &fakeMailSender{}, throttle, cfg)
+	oidc := NewOIDCService(users, newFakeOIDCRepository(), cfg)
+	emailLogin := newTestEmailLoginService(users, &fakeMailSender{}, revoked, throttle, cfg)
+	auth := NewAuthService(users, newFakeTokenRepository(), revoked, mgr, verification, mfa, webAuthn, oidc, emailLogin, throttle, passwordpolicy.NewPolicy(cfg.Password, nil), cfg)
+
+	return auth, mfa, mock, users
+}
+
+// loginWithMockProvider runs a login through the mock provider for an account with the claims.
+func loginWithMockProvider(t *testing.T, auth AuthService, mock *mockOIDCProvider, claims jwt.MapClaims) (*AuthResult, error) {
+	t.Helper()
+	return loginWithProvider(t, auth, mock, "mock", claims)
+}
+
+// loginWithProvider runs a login through the configured provider, served by the mock.
+func loginWithProvider(t *testing.T, auth AuthService, mock *mockOIDCProvider, provider string, claims jwt.MapClaims) (*AuthResult, error) {
+	t.Helper()
+	ctx := context.Background()
+
+	authorization, err := auth.BeginOIDCLogin(ctx, provider)
+	if err != nil {
+		t.Fatalf("BeginOIDCLogin() error: %v", err)
+	}
+
+	state, code := mock.authorize(t, authorization.URL, claims)
+	if state != authorization.State {
+		t.Fatalf("provider returned state %q, want %q", state, authorization.State)
+	}
+
+	return auth.FinishOIDCLogin(ctx, provider, state, code, SessionMeta{})
+}
+
+func TestOIDCService_CreatesAndReusesAccount(t *testing.T) {
+	auth, _, mock, users := newTestOIDCService(t)
+
+	if got := auth.OIDCProviders(); !slices.Equal(got, []string{"mock", "github"}) {
+		t.Errorf("OIDCProviders() = %v, want [mock github]", got)
+	}
+
+	claims := jwt.MapClaims{"sub": "alice-at-mock", "email": "alice@example.com", "email_verified": true}
+	first, err := loginWithMockProvider(t, auth, mock, claims)
+	if err != nil {
+		t.Fatalf("first login error: %v", err)
+	}
+	if first.AccessToken == "" || first.RefreshToken == "" || first.Email != "alice@example.com" {
+		t.Fatalf("first login = %+v, want tokens for alice", first)
+	}
+	// the provider verified the email, so the new account is verified as well
+	if !users.users[first.UserID].EmailVerified {
+		t.Error("account created through the provider is not verified")
+	}
+
+	second, err := loginWithMockProvider(t, auth, mock, claims)
+	if err != nil {
+		t.Fatalf("second login error: %v", err)
+	}
+	if second.UserID != first.UserID || len(users.users) != 1 {
+		t.Errorf("second login signed in user %s with %d accounts, want user %s and 1 account", second.UserID, len(users.users), first.UserID)
+	}
+}
+
+func TestOIDCService_LinksOnlyVerifiedEmails(t *testing.T) {
+	auth, _, mock, users := newTestOIDCService(t)
+	registerTestUser(t, users, "bob@example.com", "password")
+	registerTestUser(t, users, "carol@example.com", "password")
+	users.users["2"].EmailVerified = false
+
+	result, err := loginWithMockProvider(t, auth, mock, jwt.MapClaims{"sub": "bob", "email": "bob@example.com", "email_verified": true})
+	if err != nil {
+		t.Fatalf("login error: %v", err)
+	}
+	if result.UserID != "1" {
+		t.Errorf("login signed in user %s, want the existing account 1", result.UserID)
+	}
+
+	// the local account may have been registered by someone who does not own the address
+	_, err = loginWithMockProvider(t, auth, mock, jwt.MapClaims{"sub": "carol", "email": "carol@example.com", "email_verified": true})
+	assertAppError(t, err, 409)
+
+	// the provider does not vouch for the address, some send the flag as a string
+	_, err = loginWithMockProvider(t, auth, mock, jwt.MapClaims{"sub": "bob-2", "email": "bob@example.com", "email_verified": "false"})
+	assertAppError(t, err, 403)
+	_, err = loginWithMockProvider(t, auth, mock, jwt.MapClaims{"sub": "dave", "email": "dave@example.com"})
+	assertAppError(t, err, 403)
+	if len(users.users) != 2 {
+		t.Errorf("got %d accounts, want no account created for unverified emails", len(users.users))
+	}
+}
+
+func TestOIDCService_RejectsInvalidResponses(t *testing.T) {
+	ctx := context.Background()
+	claims := jwt.MapClaims{"sub": "eve", "email": "eve@example.com", "email_verified": true}
+
+	t.Run("state is single use", func(t *testing.T) {
+		auth, _, mock, _ := newTestOIDCService(t)
+
+		authorization, err := auth.BeginOIDCLogin(ctx, "mock")
+		if err != nil {
+			t.Fatalf("BeginOIDCLogin() error: %v", err)
+		}
+		state, code := mock.authorize(t, authorization.URL, claims)
+		if _, err := auth.FinishOIDCLogin(ctx, "mock", state, code, SessionMeta{}); err != nil {
+			t.Fatalf("FinishOIDCLogin() error: %v", err)
+		}
+
+		_, err = auth.FinishOIDCLogin(ctx, "mock", state, code, SessionMeta{})
+		assertAppError(t, err, 400)
+	})
+
+	t.Run("unknown provider", func(t *testing.T) {
+		auth, _, _, _ := newTestOIDCService(t)
+
+		_, err := auth.BeginOIDCLogin(ctx, "other")
+		assertAppError(t, err, 404)
+	})
+
+	t.Run("code of another login", func(t *testing.T) {
+		auth, _, mock, _ := newTestOIDCService(t)
+
+		first, _ := auth.BeginOIDCLogin(ctx, "mock")
+		second, _ := auth.BeginOIDCLogin(ctx, "mock")
+		state, _ := mock.authorize(t, first.URL, claims)
+		_, code := mock.authorize(t, second.URL, claims)
+
+		// the code is bound to the PKCE challenge of the other login
+		_, err := auth.FinishOIDCLogin(ctx, "mock", state, code, SessionMeta{})
+		assertUnauthorized(t, err)
+	})
+
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+
+	tampered := map[string]func(m *mockOIDCProvider){
+		"nonce mismatch": func(m *mockOIDCProvider) {
+			m.tamper = func(c jwt.MapClaims) { c["nonce"] = "replayed" }
+		},
+		"other audience": func(m *mockOIDCProvider) {
+			m.tamper = func(c jwt.MapClaims) { c["aud"] = "other-client" }
+		},
+		"other issuer": func(m *mockOIDCProvider) {
+			m.tamper = func(c jwt.MapClaims) { c["iss"] = "https://evil.example.com" }
+		},
+		"expired": func(m *mockOIDCProvider) {
+			m.tamper = func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }
+		},
+		"missing subject": func(m *mockOIDCProvider) {
+			m.tamper = func(c jwt.MapClaims) { delete(c, "sub") }
+		},
+		"unknown signing key": func(m *mockOIDCProvider) {
+			m.signingKey = otherKey
+		},
+	}
+	for name, tamper := range tampered {
+		t.Run(name, func(t *testing.T) {
+			auth, _, mock, users := newTestOIDCService(t)
+			tamper(mock)
+
+			_, err := loginWithMockProvider(t, auth, mock, claims)
+			assertUnauthorized(t, err)
+			if len(users.users) != 0 {
+				t.Error("an account was created from a rejected ID token")
+			}
+		})
+	}
+}
+
+func TestOIDCService_OAuth2Provider(t *testing.T) {
+	auth, _, mock, users := newTestOIDCService(t)
+	registerTestUser(t, users, "grace@example.com", "password")
+
+	// GitHub identifies users by a number and keeps the verification state in /user/emails
+	github := func(id int64, email string, verified bool) jwt.MapClaims {
+		return jwt.MapClaims{
+			"user": map[string]any{"id": id, "login": "grace", "email": email},
+			"emails": []map[string]any{
+				{"email": "grace@old.example.com", "primary": false, "verified": true},
+				{"email": email, "primary": true, "verified": verified},
+			},
+		}
+	}
+
+	result, err := loginWithProvider(t, auth, mock, "github", github(9007199254740993, "grace@example.com", true))
+	if err != nil {
+		t.Fatalf("login error: %v", err)
+	}
+	if result.UserID != "1" || result.AccessToken == "" {
+		t.Fatalf("login = %+v, want tokens for the existing account 1", result)
+	}
+
+	// the identity is found by the id, even after the primary address changed
+	again, err := loginWithProvider(t, auth, mock, "github", github(9007199254740993, "grace@new.example.com", true))
+	if err != nil {
+		t.Fatalf("second login error: %v", err)
+	}
+	if again.UserID != "1" || len(users.users) != 1 {
+		t.Errorf("second login signed in user %s with %d accounts, want user 1 and 1 account", again.UserID, len(users.users))
+	}
+
+	_, err = loginWithProvider(t, auth, mock, "github", github(42, "heidi@example.com", false))
+	assertAppError(t, err, 403)
+
+	// the userinfo has to identify the user
+	_, err = loginWithProvider(t, auth, mock, "github", jwt.MapClaims{"user": map[string]any{"login": "nobody"}})
+	assertUnauthorized(t, err)
+	if len(users.users) != 1 {
+		t.Errorf("got %d accounts, want none created for rejected logins", len(users.users))
+	}
+}
+
+func TestOIDCService_SecondFactorStillRequired(t *testing.T) {
+	auth, mfa, mock, users := newTestOIDCService(t)
+	registerTestUser(t, users, "frank@example.com", "password")
+	enableTestTOTP(t, mfa, "1")
+
+	result, err := loginWithMockProvider(t, auth, mock, jwt.MapClaims{"sub": "frank", "email": "frank@example.com", "email_verified": true})
+	if err != nil {
+		t.Fatalf("login error: %v", err)
+	}
+	if !result.MFARequired || result.MFAToken == "" || result.AccessToken != "" {
+		t.Errorf("login = %+v, want an mfa challenge without tokens", result)
+	}
+}
+
+// racingUserClient answers every registration with AlreadyExists. Unless taken is set, a
+// concurrent sign in created the account first. With taken, user-service refuses the email for
+// normalizing to the email of another account, which the lookup does not find.
+type racingUserClient struct {
+	*fakeUserClient
+	taken   bool
+	lookups int
+}
+
+func (f *racingUserClient) GetUserByEmail(ctx context.Context, email string) (*userpb.GetUserByEmailResponse, error) {
+	f.lookups++
+	return f.fakeUserClient.GetUserByEmail(ctx, email)
+}
+
+func (f *racingUserClient) RegisterUser(ctx context.Context, email, password, idempotencyKey string) (*userpb.RegisterUserResponse, error) {
+	if !f.taken {
+		registered, err := f.fakeUserClient.RegisterUser(ctx, email, password, idempotencyKey)
+		if err != nil {
+			return nil, err
+		}
+		f.users[registered.Id].EmailVerified = true
+	}
+	return nil, status.Error(codes.AlreadyExists, "user already exists")
+}
+
+func TestOIDCService_RegistrationRace(t *testing.T) {
+	ctx := context.Background()
+	users := &racingUserClient{fakeUserClient: newFakeUserClient()}
+	oidc := NewOIDCService(users, newFakeOIDCRepository(), config.Config{}).(*oidcService)
+
+	// the account is looked up again
+	id, err := oidc.userForEmail(ctx, "alice@example.com", true)
+	if err != nil {
+		t.Fatalf("userForEmail() error: %v", err)
+	}
+	if id != "1" || users.lookups != 2 {
+		t.Errorf("userForEmail() = %q after %d lookups, want account 1 after 2", id, users.lookups)
+	}
+
+	// the lookup is retried once and not for as long as the registration fails
+	users.taken, users.lookups = true, 0
+	_, err = oidc.userForEmail(ctx, "bob@example.com", true)
+	assertAppError(t, err, 409)
+	if users.lookups != 2 {
+		t.Errorf("userForEmail() looked the email up %d times, want 2", users.lookups)
+	}
+}
@@ -0,0 +1,232 @@
+package service
+
+import (
+	"auth-service/internal/apperror"
+	grpcClient "auth-service/internal/client/grpc"
+	"auth-service/internal/config"
+	"auth-service/internal/logger"
+	"auth-service/internal/mail"
+	"auth-service/internal/passwordpolicy"
+	"auth-service/internal/repository"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// PasswordService changes and resets passwords. A successful change or reset signs the user
+// out of every session, so a stolen password or session stops working.
+type PasswordService interface {
+	ChangePassword(ctx context.Context, userID, currentPassword, newPassword, ip string) error
+	// ForgotPassword mails a single-use reset link. It succeeds for unknown emails as well and
+	// sends the mail in the background, so neither its result nor its duration tells who has an
+	// account.
+	ForgotPassword(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+}
+
+type passwordService struct {
+	grpcUserClient grpcClient.UserService
+	resetRepo      repository.PasswordResetRepository
+	authService    AuthService
+	mailSender     mail.Sender
+	passwordPolicy passwordpolicy.Policy
+	loginThrottle  LoginThrottleService
+	background     *Background
+	cfg            config.Config
+}
+
+func NewPasswordService(
+	grpcUserClient grpcClient.UserService,
+	resetRepo repository.PasswordResetRepository,
+	authService AuthService,
+	mailSender mail.Sender,
+	passwordPolicy passwordpolicy.Policy,
+	loginThrottle LoginThrottleService,
+	background *Background,
+	cfg config.Config,
+) PasswordService {
+	return &passwordService{
+		grpcUserClient: grpcUserClient,
+		resetRepo:      resetRepo,
+		authService:    authService,
+		mailSender:     mailSender,
+		passwordPolicy: passwordPolicy,
+		loginThrottle:  loginThrottle,
+		background:     background,
+		cfg:            cfg,
+	}
+}
+
+func (s *passwordService) ChangePassword(ctx context.Context, userID, currentPassword, newPassword, ip string) error {
+	userResp, err := s.grpcUserClient.GetUserByID(ctx, userID)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error gRPC get user by ID")
+		return apperror.FromGRPC(err)
+	}
+	if err := s.loginThrottle.VerifyPassword(ctx, userResp.User, currentPassword, ip); err != nil {
+		return err
+	}
+
+	if fields := passwordFieldErrors(s.passwordPolicy, "new_password", newPassword, userResp.User.Email); len(fields) > 0 {
+		return apperror.Validation("new password does not meet the requirements", fields)
+	}
+
+	if err := s.setPassword(ctx, userID, newPassword); err != nil {
+		return err
+	}
+
+	logger.Log.Info().
+		Str("event", "password_changed").
+		Str("user_id", userID).
+		Msg("password changed, all sessions revoked")
+
+	return nil
+}
+
+func (s *passwordService) ForgotPassword(ctx context.Context, email string) error {
+	userResp, err := s.grpcUserClient.GetUserByEmail(ctx, email)
+	if err != nil {
+		if st, ok := status.FromError(err); ok && st.Code() == codes.NotFound {
+			return nil
+		}
+		logger.Log.Error().Err(err).Msg("error gRPC get user by email")
+		return apperror.FromGRPC(err)
+	}
+
+	// an unknown email returns right away, the work for a known one must not take longer
+	user := userResp.User
+	s.background.Go(ctx, func(ctx context.Context) {
+		s.sendResetLink(ctx, user.Id, user.Email)
+	})
+
+	return nil
+}
+
+// sendResetLink stores a reset token for the user and mails them its link. Failures are only
+// logged, the client got its answer already.
+func (s *passwordService) sendResetLink(ctx context.Context, userID, email string) {
+	token, err := newResetToken()
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error generating password reset token")
+		return
+	}
+
+	if err := s.resetRepo.CreateResetToken(ctx, userID, token, s.cfg.PasswordReset.PasswordResetTokenExp); err != nil {
+		logger.Log.Error().Err(err).Msg("error saving password reset token")
+		return
+	}
+
+	link, err := tokenLink(s.cfg.PasswordReset.PasswordResetURL, token)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error building password reset link")
+		return
+	}
+
+	err = s.mailSender.Send(ctx, mail.Message{
+		To:      email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Someone asked to reset the password of your account.\n\n"+
+			"Open this link within %s to choose a new password:\n%s\n\n"+
+			"If it was not you, ignore this email, your password stays the same.\n",
+			s.cfg.PasswordReset.PasswordResetTokenExp, link),
+	})
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error sending password reset email")
+	}
+}
+
+func (s *passwordService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	// the token is only used up by a password the policy accepts
+	userID, err := s.resetRepo.FindResetToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, repository.ErrPasswordResetTokenNotFound) {
+			return apperror.BadRequest("invalid or expired reset token")
+		}
+		logger.Log.Error().Err(err).Msg("error finding password reset token")
+		return apperror.Internal(err)
+	}
+
+	userResp, err := s.grpcUserClient.GetUserByID(ctx, userID)
+	if err != nil {
+		if st, ok := status.FromError(err); ok && st.Code() == codes.NotFound {
+			return apperror.BadRequest("invalid or expired reset token")
+		}
+		logger.Log.Error().Err(err).Msg("error gRPC get user by ID")
+		return apperror.FromGRPC(err)
+	}
+
+	if fields := passwordFieldErrors(s.passwordPolicy, "new_password", newPassword, userResp.User.Email); len(fields) > 0 {
+		return apperror.Validation("new password does not meet the requirements", fields)
+	}
+
+	userID, err = s.resetRepo.ConsumeResetToken(ctx, token)
+	if err != nil {
+		if errors.Is(err, repository.ErrPasswordResetTokenNotFound) {
+			return apperror.BadRequest("invalid or expired reset token")
+		}
+		logger.Log.Error().Err(err).Msg("error consuming password reset token")
+		return apperror.Internal(err)
+	}
+
+	if err := s.setPassword(ctx, userID, newPassword); err != nil {
+		return err
+	}
+
+	logger.Log.Info().
+		Str("event", "password_reset").
+		Str("user_id", userID).
+		Msg("password reset, all sessions revoked")
+
+	return nil
+}
+
+func (s *passwordService) setPassword(ctx context.Context, userID, password string) error {
+	if err := s.grpcUserClient.UpdatePassword(ctx, userID, password); err != nil {
+		logger.Log.Error().Err(err).Msg("error gRPC update password")
+		return apperror.FromGRPC(err)
+	}
+
+	return s.authService.RevokeAllSessions(ctx, userID)
+}
+
+// passwordFieldErrors checks a new password against the policy and reports each rule it breaks
+// as an error of the field.
+func passwordFieldErrors(policy passwordpolicy.Policy, field, password, email string) []apperror.FieldError {
+	fields := []apperror.FieldError{}
+	for _, violation := range policy.Validate(password, email) {
+		fields = append(fields, apperror.FieldError{
+			Field:   field,
+			Code:    violation.Code,
+			Message: violation.Message,
+		})
+	}
+	return fields
+}
+
+// tokenLink appends the token to the page a link in an email points to.
+func tokenLink(page, token string) (string, error) {
+	u, err := url.Parse(page)
+	if err != nil {
+		return "", err
+	}
+
+	query := u.Query()
+	query.Set("token", token)
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+func newResetToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
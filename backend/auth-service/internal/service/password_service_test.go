@@ -0,0 +1,293 @@
+package service
+
+import (
+	"auth-service/internal/apperror"
+	"auth-service/internal/config"
+	"auth-service/internal/mail"
+	"auth-service/internal/passwordpolicy"
+	"auth-service/internal/repository"
+	"context"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakePasswordResetRepository keeps reset tokens in memory, keyed by the raw token.
+type fakePasswordResetRepository struct {
+	mu     sync.Mutex
+	tokens map[string]*fakeResetToken
+}
+
+type fakeResetToken struct {
+	userID    string
+	expiresAt time.Time
+	used      bool
+}
+
+func (r *fakePasswordResetRepository) CreateResetToken(_ context.Context, userID, token string, ttl time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, t := range r.tokens {
+		if t.userID == userID {
+			t.used = true
+		}
+	}
+	r.tokens[token] = &fakeResetToken{userID: userID, expiresAt: time.Now().Add(ttl)}
+	return nil
+}
+
+func (r *fakePasswordResetRepository) FindResetToken(_ context.Context, token string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tokens[token]
+	if !ok || t.used || !time.Now().Before(t.expiresAt) {
+		return "", repository.ErrPasswordResetTokenNotFound
+	}
+	return t.userID, nil
+}
+
+func (r *fakePasswordResetRepository) ConsumeResetToken(_ context.Context, token string) (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tokens[token]
+	if !ok || t.used || !time.Now().Before(t.expiresAt) {
+		return "", repository.ErrPasswordResetTokenNotFound
+	}
+	t.used = true
+	return t.userID, nil
+}
+
+// fakeMailSender records the messages instead of sending them.
+type fakeMailSender struct {
+	mu   sync.Mutex
+	sent []mail.Message
+	// hold, when set, keeps Send from returning until it is closed
+	hold chan struct{}
+}
+
+func (f *fakeMailSender) Send(_ context.Context, msg mail.Message) error {
+	if f.hold != nil {
+		<-f.hold
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sent = append(f.sent, msg)
+	return nil
+}
+
+func newTestPasswordService(t *testing.T, resetTTL time.Duration) (PasswordService, AuthService, *fakeUserClient, *fakeMailSender) {
+	t.Helper()
+
+	auth, users, _, _ := newTestAuthService(t)
+	sender := &fakeMailSender{}
+	cfg := config.Config{
+		Password: config.PasswordConfig{
+			PasswordMinLength:   8,
+			PasswordMaxLength:   64,
+			PasswordMinClasses:  1,
+			PasswordBannedWords: []string{"letmein"},
+		},
+		PasswordReset: config.PasswordResetConfig{
+			PasswordResetURL:      "https://example.com/reset-password",
+			PasswordResetTokenExp: resetTTL,
+		},
+	}
+
+	resetRepo := &fakePasswordResetRepository{tokens: map[string]*fakeResetToken{}}
+	policy := passwordpolicy.NewPolicy(cfg.Password, nil)
+	background := NewBackground()
+	passwords := NewPasswordService(users, resetRepo, auth, sender, policy, auth.(*authService).loginThrottle, background, cfg)
+	return waitingPasswordService{passwords, background}, auth, users, sender
+}
+
+// waitingPasswordService returns from ForgotPassword once the mail is sent, so tests can read it.
+type waitingPasswordService struct {
+	PasswordService
+	background *Background
+}
+
+func (s waitingPasswordService) ForgotPassword(ctx context.Context, email string) error {
+	defer s.background.Wait()
+	return s.PasswordService.ForgotPassword(ctx, email)
+}
+
+// tokenFromMail extracts the token from the link in the last sent email.
+func tokenFromMail(t *testing.T, sender *fakeMailSender) string {
+	t.Helper()
+
+	if len(sender.sent) == 0 {
+		t.Fatal("no email was sent")
+	}
+	body := sender.sent[len(sender.sent)-1].Body
+
+	for _, field := range strings.Fields(body) {
+		if u, err := url.Parse(field); err == nil && u.Query().Get("token") != "" {
+			return u.Query().Get("token")
+		}
+	}
+
+	t.Fatalf("email has no link with a token: %q", body)
+	return ""
+}
+
+func TestPasswordService_ChangePassword(t *testing.T) {
+	passwords, auth, users, _ := newTestPasswordService(t, time.Hour)
+	ctx := context.Background()
+	registerTestUser(t, users, "change@example.com", "old-password")
+
+	session, err := auth.Login(ctx, "change@example.com", "old-password", SessionMeta{})
+	if err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+
+	err = passwords.ChangePassword(ctx, session.UserID, "wrong-password", "new-password", "")
+	assertAppError(t, err, 400)
+
+	if err := passwords.ChangePassword(ctx, session.UserID, "old-password", "new-password", ""); err != nil {
+		t.Fatalf("ChangePassword() error: %v", err)
+	}
+
+	_, err = auth.Refresh(ctx, session.RefreshToken)
+	assertUnauthorized(t, err)
+
+	_, err = auth.Login(ctx, "change@example.com", "old-password", SessionMeta{})
+	assertUnauthorized(t, err)
+	if _, err := auth.Login(ctx, "change@example.com", "new-password", SessionMeta{}); err != nil {
+		t.Fatalf("Login() with the new password error: %v", err)
+	}
+}
+
+func TestPasswordService_ResetPassword(t *testing.T) {
+	passwords, auth, users, sender := newTestPasswordService(t, time.Hour)
+	ctx := context.Background()
+	registerTestUser(t, users, "reset@example.com", "old-password")
+
+	session, err := auth.Login(ctx, "reset@example.com", "old-password", SessionMeta{})
+	if err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+
+	if err := passwords.ForgotPassword(ctx, "reset@example.com"); err != nil {
+		t.Fatalf("ForgotPassword() error: %v", err)
+	}
+	if to := sender.sent[0].To; to != "reset@example.com" {
+		t.Fatalf("ForgotPassword() mailed %q, want reset@example.com", to)
+	}
+	token := tokenFromMail(t, sender)
+
+	if err := passwords.ResetPassword(ctx, token, "new-password"); err != nil {
+		t.Fatalf("ResetPassword() error: %v", err)
+	}
+
+	_, err = auth.Refresh(ctx, session.RefreshToken)
+	assertUnauthorized(t, err)
+	if _, err := auth.Login(ctx, "reset@example.com", "new-password", SessionMeta{}); err != nil {
+		t.Fatalf("Login() with the new password error: %v", err)
+	}
+
+	// the token is single-use
+	err = passwords.ResetPassword(ctx, token, "another-password")
+	assertAppError(t, err, 400)
+}
+
+func TestPasswordService_PasswordPolicy(t *testing.T) {
+	passwords, auth, users, sender := newTestPasswordService(t, time.Hour)
+	ctx := context.Background()
+	registerTestUser(t, users, "policy@example.com", "old-password")
+
+	session, err := auth.Login(ctx, "policy@example.com", "old-password", SessionMeta{})
+	if err != nil {
+		t.Fatalf("Login() error: %v", err)
+	}
+
+	err = passwords.ChangePassword(ctx, session.UserID, "old-password", "LetMeIn-2024", "")
+	assertFieldErrors(t, err, apperror.FieldError{Field: "new_password", Code: "banned_word"})
+
+	if err := passwords.ForgotPassword(ctx, "policy@example.com"); err != nil {
+		t.Fatalf("ForgotPassword() error: %v", err)
+	}
+	token := tokenFromMail(t, sender)
+
+	err = passwords.ResetPassword(ctx, token, "")
+	assertFieldErrors(t, err, apperror.FieldError{Field: "new_password", Code: "required"})
+
+	// a rejected password does not use up the token
+	if err := passwords.ResetPassword(ctx, token, "new-password"); err != nil {
+		t.Fatalf("ResetPassword() after a rejected password error: %v", err)
+	}
+}
+
+func TestPasswordService_ResetTokenRules(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("unknown email sends nothing", func(t *testing.T) {
+		passwords, _, _, sender := newTestPasswordService(t, time.Hour)
+
+		if err := passwords.ForgotPassword(ctx, "nobody@example.com"); err != nil {
+			t.Fatalf("ForgotPassword() error: %v", err)
+		}
+		if len(sender.sent) != 0 {
+			t.Fatalf("ForgotPassword() sent %d emails for an unknown account", len(sender.sent))
+		}
+	})
+
+	t.Run("known email does not wait for the mail", func(t *testing.T) {
+		passwords, _, users, sender := newTestPasswordService(t, time.Hour)
+		registerTestUser(t, users, "slow@example.com", "password")
+		sender.hold = make(chan struct{})
+		background := passwords.(waitingPasswordService).background
+
+		done := make(chan error, 1)
+		go func() {
+			done <- passwords.(waitingPasswordService).PasswordService.ForgotPassword(ctx, "slow@example.com")
+		}()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatalf("ForgotPassword() error: %v", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("ForgotPassword() waited for the mail to be sent")
+		}
+
+		close(sender.hold)
+		background.Wait()
+		if len(sender.sent) != 1 || sender.sent[0].To != "slow@example.com" {
+			t.Fatalf("ForgotPassword() sent %+v in the background, want one mail to slow@example.com", sender.sent)
+		}
+	})
+
+	t.Run("expired token", func(t *testing.T) {
+		passwords, _, users, sender := newTestPasswordService(t, -time.Minute)
+		registerTestUser(t, users, "expired@example.com", "password")
+
+		if err := passwords.ForgotPassword(ctx, "expired@example.com"); err != nil {
+			t.Fatalf("ForgotPassword() error: %v", err)
+		}
+
+		err := passwords.ResetPassword(ctx, tokenFromMail(t, sender), "new-password")
+		assertAppError(t, err, 400)
+	})
+
+	t.Run("a new request invalidates the previous token", func(t *testing.T) {
+		passwords, _, users, sender := newTestPasswordService(t, time.Hour)
+		registerTestUser(t, users, "twice@example.com", "password")
+
+		_ = passwords.ForgotPassword(ctx, "twice@example.com")
+		first := tokenFromMail(t, sender)
+		_ = passwords.ForgotPassword(ctx, "twice@example.com")
+		second := tokenFromMail(t, sender)
+
+		assertAppError(t, passwords.ResetPassword(ctx, first, "new-password"), 400)
+		if err := passwords.ResetPassword(ctx, second, "new-password"); err != nil {
+			t.Fatalf("ResetPassword() with the latest token error: %v", err)
+		}
+	})
+}
@@ -0,0 +1,179 @@
+package service
+
+import (
+	"auth-service/internal/apperror"
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"auth-service/internal/logger"
+	"auth-service/internal/repository"
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ServiceToken is an access token issued with the client credentials grant. There is no
+// refresh token, the account asks for a new token when it expires.
+type ServiceToken struct {
+	AccessToken string
+	ExpiresIn   int
+	Scope       string
+}
+
+// ServiceAccountService lets batch jobs and internal services call the APIs on their own behalf.
+// A service account authenticates with its client id and secret (RFC 6749 section 4.4) and gets
+// an access token limited to the scopes it was registered with. Scopes are named like the
+// permissions of users, e.g. users:list, so the gateway can check both the same way.
+type ServiceAccountService interface {
+	// IssueToken handles a client credentials grant. An empty scope asks for every scope of the
+	// account. Failures are returned as *OAuthError.
+	IssueToken(ctx context.Context, grantType, clientID, secret, scope string) (*ServiceToken, error)
+
+	ListServiceAccounts(ctx context.Context) ([]*entity.ServiceAccount, error)
+	// CreateServiceAccount registers an account and returns its secret, which is not stored and
+	// can not be shown again.
+	CreateServiceAccount(ctx context.Context, name string, scopes []string) (*entity.ServiceAccount, string, error)
+	DeleteServiceAccount(ctx context.Context, id string) error
+}
+
+type serviceAccountService struct {
+	repo         repository.ServiceAccountRepository
+	tokenManager TokenManager
+	cfg          config.Config
+}
+
+func NewServiceAccountService(repo repository.ServiceAccountRepository, tokenManager TokenManager, cfg config.Config) ServiceAccountService {
+	return &serviceAccountService{
+		repo:         repo,
+		tokenManager: tokenManager,
+		cfg:          cfg,
+	}
+}
+
+func (s *serviceAccountService) IssueToken(ctx context.Context, grantType, clientID, secret, scope string) (*ServiceToken, error) {
+	if grantType != "client_credentials" {
+		return nil, &OAuthError{Status: http.StatusBadRequest, Code: "unsupported_grant_type", Description: "only the client_credentials grant is supported"}
+	}
+
+	account, err := s.repo.GetServiceAccount(ctx, clientID)
+	if err != nil {
+		if errors.Is(err, repository.ErrServiceAccountNotFound) {
+			return nil, invalidClient()
+		}
+		logger.Log.Error().Err(err).Msg("error getting service account")
+		return nil, apperror.Internal(err)
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(account.SecretHash), []byte(secret)) != nil {
+		logger.Log.Warn().
+			Str("event", "service_account_auth_failed").
+			Str("client_id", account.ID).
+			Msg("security event: service account authentication failed")
+		return nil, invalidClient()
+	}
+
+	granted := strings.Fields(account.Scopes)
+	if scope != "" {
+		requested := []string{}
+		for _, requestedScope := range strings.Fields(scope) {
+			if !slices.Contains(granted, requestedScope) {
+				return nil, &OAuthError{Status: http.StatusBadRequest, Code: "invalid_scope", Description: "the scope " + requestedScope + " is not granted to the service account"}
+			}
+			if !slices.Contains(requested, requestedScope) {
+				requested = append(requested, requestedScope)
+			}
+		}
+		granted = requested
+	}
+
+	accessToken, err := s.tokenManager.GenerateServiceToken(account.ID, strings.Join(granted, " "))
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error generating service token")
+		return nil, apperror.Internal(err)
+	}
+
+	if err := s.repo.TouchServiceAccount(ctx, account.ID); err != nil {
+		logger.Log.Error().Err(err).Msg("error touching service account")
+	}
+
+	return &ServiceToken{
+		AccessToken: accessToken,
+		ExpiresIn:   int(s.cfg.JWT.JWTAccessTokenExp.Seconds()),
+		Scope:       strings.Join(granted, " "),
+	}, nil
+}
+
+func (s *serviceAccountService) ListServiceAccounts(ctx context.Context) ([]*entity.ServiceAccount, error) {
+	accounts, err := s.repo.ListServiceAccounts(ctx)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error listing service accounts")
+		return nil, apperror.Internal(err)
+	}
+
+	return accounts, nil
+}
+
+func (s *serviceAccountService) CreateServiceAccount(ctx context.Context, name string, scopes []string) (*entity.ServiceAccount, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, "", apperror.BadRequest("name is required")
+	}
+
+	if len(scopes) == 0 {
+		return nil, "", apperror.BadRequest("at least one scope is required")
+	}
+	for _, scope := range scopes {
+		if scope == "" || strings.ContainsAny(scope, " \t\n,") {
+			return nil, "", apperror.BadRequest("invalid scope " + scope)
+		}
+	}
+
+	secret, err := newResetToken()
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error generating service account secret")
+		return nil, "", apperror.Internal(err)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error hashing service account secret")
+		return nil, "", apperror.Internal(err)
+	}
+
+	account := &entity.ServiceAccount{
+		ID:         uuid.NewString(),
+		Name:       name,
+		SecretHash: string(hash),
+		Scopes:     strings.Join(slices.Compact(slices.Sorted(slices.Values(scopes))), " "),
+	}
+	if err := s.repo.CreateServiceAccount(ctx, account); err != nil {
+		logger.Log.Error().Err(err).Msg("error creating service account")
+		return nil, "", apperror.Internal(err)
+	}
+
+	logger.Log.Info().
+		Str("client_id", account.ID).
+		Str("name", account.Name).
+		Str("scopes", account.Scopes).
+		Msg("service account registered")
+
+	return account, secret, nil
+}
+
+// DeleteServiceAccount stops the account from getting new tokens, the ones already issued stay
+// valid until they expire.
+func (s *serviceAccountService) DeleteServiceAccount(ctx context.Context, id string) error {
+	if err := s.repo.DeleteServiceAccount(ctx, id); err != nil {
+		if errors.Is(err, repository.ErrServiceAccountNotFound) {
+			return apperror.NotFound("service account not found")
+		}
+		logger.Log.Error().Err(err).Msg("error deleting service account")
+		return apperror.Internal(err)
+	}
+
+	return nil
+}
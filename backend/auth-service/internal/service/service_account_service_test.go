@@ -0,0 +1,176 @@
+package service
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"auth-service/internal/repository"
+	"context"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeServiceAccountRepository struct {
+	mu       sync.Mutex
+	accounts map[string]*entity.ServiceAccount
+}
+
+func newFakeServiceAccountRepository() *fakeServiceAccountRepository {
+	return &fakeServiceAccountRepository{accounts: map[string]*entity.ServiceAccount{}}
+}
+
+func (r *fakeServiceAccountRepository) ListServiceAccounts(context.Context) ([]*entity.ServiceAccount, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	accounts := []*entity.ServiceAccount{}
+	for _, account := range r.accounts {
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+func (r *fakeServiceAccountRepository) GetServiceAccount(_ context.Context, id string) (*entity.ServiceAccount, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	account, ok := r.accounts[id]
+	if !ok {
+		return nil, repository.ErrServiceAccountNotFound
+	}
+	copied := *account
+	return &copied, nil
+}
+
+func (r *fakeServiceAccountRepository) CreateServiceAccount(_ context.Context, account *entity.ServiceAccount) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	account.CreatedAt = time.Now()
+	copied := *account
+	r.accounts[account.ID] = &copied
+	return nil
+}
+
+func (r *fakeServiceAccountRepository) DeleteServiceAccount(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.accounts[id]; !ok {
+		return repository.ErrServiceAccountNotFound
+	}
+	delete(r.accounts, id)
+	return nil
+}
+
+func (r *fakeServiceAccountRepository) TouchServiceAccount(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if account, ok := r.accounts[id]; ok {
+		now := time.Now()
+		account.LastUsedAt = &now
+	}
+	return nil
+}
+
+func newTestServiceAccountService() (ServiceAccountService, TokenManager, *fakeServiceAccountRepository) {
+	mgr, jwtCfg := newTestManager()
+	repo := newFakeServiceAccountRepository()
+	return NewServiceAccountService(repo, mgr, config.Config{JWT: jwtCfg}), mgr, repo
+}
+
+func TestServiceAccountService_IssueToken(t *testing.T) {
+	svc, mgr, repo := newTestServiceAccountService()
+	ctx := context.Background()
+
+	account, secret, err := svc.CreateServiceAccount(ctx, "Nightly export", []string{"users:list", "roles:assign", "users:list"})
+	if err != nil {
+		t.Fatalf("CreateServiceAccount() error: %v", err)
+	}
+	if secret == "" || account.SecretHash == secret {
+		t.Fatal("CreateServiceAccount() should return a secret and store only its hash")
+	}
+	if account.Scopes != "roles:assign users:list" {
+		t.Errorf("CreateServiceAccount() scopes = %q, want them sorted and deduplicated", account.Scopes)
+	}
+
+	token, err := svc.IssueToken(ctx, "client_credentials", account.ID, secret, "")
+	if err != nil {
+		t.Fatalf("IssueToken() error: %v", err)
+	}
+	if token.Scope != "roles:assign users:list" || token.ExpiresIn != int((15*time.Minute).Seconds()) {
+		t.Errorf("IssueToken() = %+v, want every scope of the account and the access token lifetime", token)
+	}
+
+	claims, err := mgr.ValidateAccessToken(token.AccessToken)
+	if err != nil {
+		t.Fatalf("ValidateAccessToken() error: %v", err)
+	}
+	if claims.ClientID != account.ID || claims.Scope != token.Scope || claims.SessionID != "" || len(claims.Audience) != 0 {
+		t.Errorf("access token claims = %+v, want the client id and scopes without a session", claims)
+	}
+
+	if stored, _ := repo.GetServiceAccount(ctx, account.ID); stored.LastUsedAt == nil {
+		t.Error("IssueToken() should record when the account was last used")
+	}
+
+	narrowed, err := svc.IssueToken(ctx, "client_credentials", account.ID, secret, "users:list users:list")
+	if err != nil {
+		t.Fatalf("IssueToken() error: %v", err)
+	}
+	if narrowed.Scope != "users:list" {
+		t.Errorf("IssueToken() scope = %q, want only the requested scope", narrowed.Scope)
+	}
+}
+
+func TestServiceAccountService_IssueTokenRejectsInvalidRequests(t *testing.T) {
+	svc, _, _ := newTestServiceAccountService()
+	ctx := context.Background()
+
+	account, secret, err := svc.CreateServiceAccount(ctx, "Bot", []string{"users:list"})
+	if err != nil {
+		t.Fatalf("CreateServiceAccount() error: %v", err)
+	}
+
+	_, err = svc.IssueToken(ctx, "password", account.ID, secret, "")
+	assertOAuthError(t, err, "unsupported_grant_type")
+
+	_, err = svc.IssueToken(ctx, "client_credentials", account.ID, "wrong", "")
+	assertOAuthError(t, err, "invalid_client")
+
+	_, err = svc.IssueToken(ctx, "client_credentials", "unknown", secret, "")
+	assertOAuthError(t, err, "invalid_client")
+
+	_, err = svc.IssueToken(ctx, "client_credentials", account.ID, secret, "users:list roles:assign")
+	assertOAuthError(t, err, "invalid_scope")
+
+	if err := svc.DeleteServiceAccount(ctx, account.ID); err != nil {
+		t.Fatalf("DeleteServiceAccount() error: %v", err)
+	}
+	_, err = svc.IssueToken(ctx, "client_credentials", account.ID, secret, "")
+	assertOAuthError(t, err, "invalid_client")
+
+	err = svc.DeleteServiceAccount(ctx, account.ID)
+	assertAppError(t, err, http.StatusNotFound)
+}
+
+func TestServiceAccountService_CreateValidatesScopes(t *testing.T) {
+	svc, _, _ := newTestServiceAccountService()
+	ctx := context.Background()
+
+	for name, scopes := range map[string][]string{
+		"no scopes":        nil,
+		"empty scope":      {""},
+		"scope with space": {"users:list roles:assign"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, _, err := svc.CreateServiceAccount(ctx, "Bot", scopes)
+			assertAppError(t, err, http.StatusBadRequest)
+		})
+	}
+
+	_, _, err := svc.CreateServiceAccount(ctx, " ", []string{"users:list"})
+	assertAppError(t, err, http.StatusBadRequest)
+}
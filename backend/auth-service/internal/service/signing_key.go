@@ -0,0 +1,286 @@
+package service
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// supportedAlgs are the only algorithms a token may be signed with.
+var supportedAlgs = []string{"HS256", "RS256", "ES256", "EdDSA"}
+
+// SigningKey is a key used to sign and verify tokens.
+// For HMAC the sign and verify keys are the same shared secret and the key is never published.
+type SigningKey struct {
+	ID        string
+	Method    jwt.SigningMethod
+	SignKey   any
+	VerifyKey any
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Use string `json:"use,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+	K   string `json:"k,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// NewHMACSigningKey wraps a shared secret. Its id is derived from the secret so every
+// service configured with the same secret agrees on it.
+func NewHMACSigningKey(secret []byte) *SigningKey {
+	sum := sha256.Sum256(append([]byte("kid:"), secret...))
+
+	return &SigningKey{
+		ID:        "hs-" + base64.RawURLEncoding.EncodeToString(sum[:12]),
+		Method:    jwt.SigningMethodHS256,
+		SignKey:   secret,
+		VerifyKey: secret,
+	}
+}
+
+// GenerateSigningKey creates a fresh key for alg (HS256, RS256, ES256 or EdDSA).
+func GenerateSigningKey(alg string) (*SigningKey, error) {
+	switch alg {
+	case "HS256":
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		return NewHMACSigningKey(secret), nil
+	case "RS256":
+		key, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			return nil, err
+		}
+		return NewSigningKey(alg, key)
+	case "ES256":
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return NewSigningKey(alg, key)
+	case "EdDSA":
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		return NewSigningKey(alg, key)
+	default:
+		return nil, fmt.Errorf("unsupported signing algorithm %s", alg)
+	}
+}
+
+// MarshalSigningKey encodes the private part of the key: the raw secret for HMAC, PKCS#8 otherwise.
+func MarshalSigningKey(k *SigningKey) ([]byte, error) {
+	if secret, ok := k.SignKey.([]byte); ok {
+		return secret, nil
+	}
+	return x509.MarshalPKCS8PrivateKey(k.SignKey)
+}
+
+// UnmarshalSigningKey is the inverse of MarshalSigningKey.
+func UnmarshalSigningKey(alg string, data []byte) (*SigningKey, error) {
+	if alg == "HS256" {
+		return NewHMACSigningKey(data), nil
+	}
+
+	privateKey, err := x509.ParsePKCS8PrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+	return NewSigningKey(alg, privateKey)
+}
+
+// LoadSigningKeyFile reads a PEM encoded private key and prepares it for the given algorithm.
+func LoadSigningKeyFile(alg, path string) (*SigningKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read signing key: %w", err)
+	}
+
+	return ParseSigningKey(alg, data)
+}
+
+// ParseSigningKey parses a PEM encoded private key (PKCS#8, PKCS#1 or SEC 1)
+// and checks it matches alg (RS256, ES256 or EdDSA). The key id is the RFC 7638 thumbprint.
+func ParseSigningKey(alg string, pemData []byte) (*SigningKey, error) {
+	block, _ := pem.Decode(pemData)
+	if block == nil {
+		return nil, errors.New("signing key is not PEM encoded")
+	}
+
+	var privateKey any
+	var err error
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		privateKey, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		privateKey, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		privateKey, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse signing key: %w", err)
+	}
+
+	return NewSigningKey(alg, privateKey)
+}
+
+// NewSigningKey wraps an asymmetric private key for the given algorithm.
+func NewSigningKey(alg string, privateKey any) (*SigningKey, error) {
+	var method jwt.SigningMethod
+
+	switch key := privateKey.(type) {
+	case *rsa.PrivateKey:
+		if alg != "RS256" {
+			return nil, fmt.Errorf("RSA key cannot be used with %s", alg)
+		}
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PrivateKey:
+		if alg != "ES256" || key.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("ECDSA key on %s cannot be used with %s", key.Curve.Params().Name, alg)
+		}
+		method = jwt.SigningMethodES256
+	case ed25519.PrivateKey:
+		if alg != "EdDSA" {
+			return nil, fmt.Errorf("Ed25519 key cannot be used with %s", alg)
+		}
+		method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T", privateKey)
+	}
+
+	publicKey := privateKey.(crypto.Signer).Public()
+
+	jwk, err := publicJWK(publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	return &SigningKey{
+		ID:        thumbprint(jwk),
+		Method:    method,
+		SignKey:   privateKey,
+		VerifyKey: publicKey,
+	}, nil
+}
+
+// PublicJWK returns the public half of the key, or false for HMAC keys which must stay secret.
+func (k *SigningKey) PublicJWK() (JWK, bool) {
+	if _, ok := k.VerifyKey.([]byte); ok {
+		return JWK{}, false
+	}
+
+	jwk, err := publicJWK(k.VerifyKey)
+	if err != nil {
+		return JWK{}, false
+	}
+
+	jwk.Kid = k.ID
+	jwk.Use = "sig"
+	jwk.Alg = k.Method.Alg()
+	return jwk, true
+}
+
+// SecretJWK returns an HMAC key as a symmetric ("oct") JWK. It must only be handed
+// to trusted internal verifiers such as the gateway.
+func (k *SigningKey) SecretJWK() (JWK, bool) {
+	secret, ok := k.VerifyKey.([]byte)
+	if !ok {
+		return JWK{}, false
+	}
+
+	return JWK{
+		Kty: "oct",
+		Kid: k.ID,
+		Use: "sig",
+		Alg: k.Method.Alg(),
+		K:   base64.RawURLEncoding.EncodeToString(secret),
+	}, true
+}
+
+func publicJWK(publicKey any) (JWK, error) {
+	enc := base64.RawURLEncoding
+
+	switch key := publicKey.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   enc.EncodeToString(key.N.Bytes()),
+			E:   enc.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}, nil
+	case *ecdsa.PublicKey:
+		size := (key.Curve.Params().BitSize + 7) / 8
+		return JWK{
+			Kty: "EC",
+			Crv: key.Curve.Params().Name,
+			X:   enc.EncodeToString(key.X.FillBytes(make([]byte, size))),
+			Y:   enc.EncodeToString(key.Y.FillBytes(make([]byte, size))),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   enc.EncodeToString(key),
+		}, nil
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", publicKey)
+	}
+}
+
+// thumbprint computes the RFC 7638 JWK thumbprint, which only covers the required members
+// in lexicographic order.
+func thumbprint(jwk JWK) string {
+	var members any
+	switch jwk.Kty {
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	case "EC":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		}{jwk.Crv, jwk.Kty, jwk.X, jwk.Y}
+	default:
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	}
+
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
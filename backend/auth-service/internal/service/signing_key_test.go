@@ -0,0 +1,161 @@
+package service
+
+import (
+	"auth-service/internal/config"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func writeTestKey(t *testing.T, privateKey any) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		t.Fatalf("MarshalPKCS8PrivateKey() error: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "access.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatalf("WriteFile() error: %v", err)
+	}
+	return path
+}
+
+func TestManager_AsymmetricAccessTokens(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	_, edKey, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		alg string
+		key any
+		kty string
+	}{
+		{alg: "RS256", key: rsaKey, kty: "RSA"},
+		{alg: "ES256", key: ecKey, kty: "EC"},
+		{alg: "EdDSA", key: edKey, kty: "OKP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.alg, func(t *testing.T) {
+			mgr, err := NewTokenManager(config.JWTConfig{
+				JWTAccessTokenAlg:            tt.alg,
+				JWTAccessTokenPrivateKeyPath: writeTestKey(t, tt.key),
+				JWTRefreshTokenSecret:        "secret_refresh",
+				JWTAccessTokenExp:            15 * time.Minute,
+				JWTRefreshTokenExp:           24 * time.Hour,
+			})
+			if err != nil {
+				t.Fatalf("NewTokenManager() error: %v", err)
+			}
+
+			access, err := mgr.GenerateAccessToken(Principal{UserID: "user-1", SessionID: "session-1"})
+			if err != nil {
+				t.Fatalf("GenerateAccessToken() error: %v", err)
+			}
+
+			claims, err := mgr.ValidateAccessToken(access)
+			if err != nil {
+				t.Fatalf("ValidateAccessToken() error: %v", err)
+			}
+			if claims.Subject != "user-1" {
+				t.Errorf("ValidateAccessToken() subject = %v, want user-1", claims.Subject)
+			}
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(access, &jwt.RegisteredClaims{})
+			if err != nil {
+				t.Fatalf("ParseUnverified() error: %v", err)
+			}
+			if parsed.Header["alg"] != tt.alg {
+				t.Errorf("token alg = %v, want %v", parsed.Header["alg"], tt.alg)
+			}
+
+			jwks := mgr.JWKS()
+			if len(jwks.Keys) != 1 {
+				t.Fatalf("JWKS() returned %d keys, want 1", len(jwks.Keys))
+			}
+			if jwks.Keys[0].Kid != parsed.Header["kid"] {
+				t.Errorf("JWKS() kid = %v, token kid = %v", jwks.Keys[0].Kid, parsed.Header["kid"])
+			}
+			if jwks.Keys[0].Kty != tt.kty || jwks.Keys[0].Alg != tt.alg {
+				t.Errorf("JWKS() key = %+v, want kty %v alg %v", jwks.Keys[0], tt.kty, tt.alg)
+			}
+		})
+	}
+}
+
+func TestManager_InternalJWKS_AsymmetricHasNoSecrets(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	mgr, err := NewTokenManager(config.JWTConfig{
+		JWTAccessTokenAlg:            "ES256",
+		JWTAccessTokenPrivateKeyPath: writeTestKey(t, ecKey),
+		JWTAccessTokenExp:            15 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewTokenManager() error: %v", err)
+	}
+
+	// a key left over from HS256 still verifies in auth-service but is never handed out
+	ring := mgr.Keyring()
+	ring.Replace(append(ring.Keys(), &RingKey{
+		SigningKey: NewHMACSigningKey([]byte("old secret")),
+		Purpose:    KeyPurposeAccess,
+		State:      KeyStateVerifyOnly,
+	}))
+
+	for _, k := range mgr.InternalJWKS().Keys {
+		if k.Kty == "oct" || k.K != "" {
+			t.Errorf("InternalJWKS() published the secret of %s", k.Kid)
+		}
+	}
+}
+
+func TestManager_ValidateAccessToken_RejectsHMACWithPublicKey(t *testing.T) {
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	mgr, err := NewTokenManager(config.JWTConfig{
+		JWTAccessTokenAlg:            "ES256",
+		JWTAccessTokenPrivateKeyPath: writeTestKey(t, ecKey),
+		JWTAccessTokenExp:            15 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewTokenManager() error: %v", err)
+	}
+
+	// anyone knowing the public key could forge this if the algorithm were taken from the token
+	publicDER, _ := x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+	forged, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims("attacker", "", time.Hour)).SignedString(publicDER)
+
+	if _, err := mgr.ValidateAccessToken(forged); err == nil {
+		t.Error("ValidateAccessToken() accepted an HS256 token signed with the public key")
+	}
+}
+
+func TestManager_HMACHasNoPublicKeys(t *testing.T) {
+	mgr, _ := newTestManager()
+
+	if keys := mgr.JWKS().Keys; len(keys) != 0 {
+		t.Errorf("JWKS() published %d keys for HS256, want 0", len(keys))
+	}
+}
+
+func TestParseSigningKey_AlgorithmMismatch(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+
+	if _, err := NewSigningKey("ES256", rsaKey); err == nil {
+		t.Error("NewSigningKey() accepted an RSA key for ES256")
+	}
+	if _, err := ParseSigningKey("RS256", []byte("not a pem")); err == nil {
+		t.Error("ParseSigningKey() accepted invalid PEM")
+	}
+}
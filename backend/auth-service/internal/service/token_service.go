@@ -6,49 +6,141 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
 )
 
 type TokenManager interface {
-	GenerateToken(userID string, ttl time.Duration, secret []byte) (string, error)
-	GenerateAccessToken(userID string) (string, error)
-	GenerateRefreshToken(userID string) (string, error)
-	GenerateTokens(userID string) (string, string, error)
+	GenerateAccessToken(principal Principal) (string, error)
+	GenerateRefreshToken(userID, sessionID string) (string, error)
+	GenerateTokens(principal Principal) (string, string, error)
+	// GenerateServiceToken issues an access token to a service account. It carries the account
+	// as client_id and subject and the granted scope, and belongs to no session.
+	GenerateServiceToken(clientID, scope string) (string, error)
+	// GenerateIDToken signs an OpenID Connect ID token with the id token keys.
+	GenerateIDToken(claims IDTokenClaims) (string, error)
 
-	ValidateToken(tokenStr string, secret []byte) (*jwt.RegisteredClaims, error)
-	ValidateRefreshToken(tokenStr string) (*jwt.RegisteredClaims, error)
+	ValidateAccessToken(tokenStr string) (*Claims, error)
+	ValidateRefreshToken(tokenStr string) (*Claims, error)
+
+	// JWKS returns the public keys access tokens can be verified with.
+	JWKS() JWKS
+	// InternalJWKS also includes the shared HMAC access keys while access tokens are signed with
+	// HS256, and is only served to internal services.
+	InternalJWKS() JWKS
+	// IDTokenJWKS returns the public keys ID tokens can be verified with. They are published
+	// apart from the access keys so an ID token is never accepted as an access token.
+	IDTokenJWKS() JWKS
+	// Keyring exposes the keys so they can be reloaded at runtime.
+	Keyring() *Keyring
+}
+
+// Principal is who an access token is issued to.
+type Principal struct {
+	UserID      string
+	SessionID   string
+	Roles       []string
+	Permissions []string
+	// Unverified marks a user whose email is not verified yet
+	Unverified bool
+	// ClientID is set for tokens issued to an OAuth client, it becomes the audience and the
+	// token only grants Scope instead of the roles
+	ClientID string
+	Scope    string
+}
+
+// Claims are the claims of every token auth-service issues. The jti identifies a single token
+// and the sid its session, so both can be put on the revocation list. Access tokens also carry
+// the roles and permissions of the user at the time they were issued, and are restricted by
+// the unverified claim until the user verifies their email. Tokens issued to an OAuth client
+// carry the client as audience and the granted scope instead, and tokens of a service account
+// its client_id and scope.
+type Claims struct {
+	SessionID   string   `json:"sid,omitempty"`
+	Roles       []string `json:"roles,omitempty"`
+	Permissions []string `json:"perms,omitempty"`
+	Unverified  bool     `json:"unverified,omitempty"`
+	Scope       string   `json:"scope,omitempty"`
+	ClientID    string   `json:"client_id,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// IDTokenClaims are the claims of an OpenID Connect ID token. The email claims are only
+// included when the email scope was granted.
+type IDTokenClaims struct {
+	Nonce         string           `json:"nonce,omitempty"`
+	AuthTime      *jwt.NumericDate `json:"auth_time,omitempty"`
+	SessionID     string           `json:"sid,omitempty"`
+	Email         string           `json:"email,omitempty"`
+	EmailVerified *bool            `json:"email_verified,omitempty"`
+	jwt.RegisteredClaims
 }
 
 type manager struct {
-	accessSecret  []byte
-	refreshSecret []byte
-	accessTTL     time.Duration
-	refreshTTL    time.Duration
+	keyring    *Keyring
+	accessAlg  string
+	accessTTL  time.Duration
+	refreshTTL time.Duration
 }
 
-func NewTokenManager(JWT config.JWTConfig) TokenManager {
+// NewTokenManager seeds the keyring with the keys from the config: the private key configured
+// for JWTAccessTokenAlg (RS256, ES256 or EdDSA), or the shared access secret when the algorithm
+// is HS256, plus the refresh secret. Refresh tokens are only ever verified by auth-service.
+func NewTokenManager(JWT config.JWTConfig) (TokenManager, error) {
+	accessKey := NewHMACSigningKey([]byte(JWT.JWTAccessTokenSecret))
+
+	accessAlg := accessTokenAlg(JWT)
+	if accessAlg != "HS256" {
+		key, err := LoadSigningKeyFile(accessAlg, JWT.JWTAccessTokenPrivateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		accessKey = key
+	}
+
 	return &manager{
-		accessSecret:  []byte(JWT.JWTAccessTokenSecret),
-		refreshSecret: []byte(JWT.JWTRefreshTokenSecret),
-		accessTTL:     JWT.JWTAccessTokenExp,
-		refreshTTL:    JWT.JWTRefreshTokenExp,
+		keyring: NewKeyring(
+			&RingKey{SigningKey: accessKey, Purpose: KeyPurposeAccess, State: KeyStateActive},
+			&RingKey{SigningKey: NewHMACSigningKey([]byte(JWT.JWTRefreshTokenSecret)), Purpose: KeyPurposeRefresh, State: KeyStateActive},
+		),
+		accessAlg:  accessAlg,
+		accessTTL:  JWT.JWTAccessTokenExp,
+		refreshTTL: JWT.JWTRefreshTokenExp,
+	}, nil
+}
+
+// accessTokenAlg is the configured access token algorithm, HS256 when none is set.
+func accessTokenAlg(JWT config.JWTConfig) string {
+	if JWT.JWTAccessTokenAlg == "" {
+		return "HS256"
 	}
+	return JWT.JWTAccessTokenAlg
 }
 
-func (m *manager) GenerateAccessToken(userID string) (string, error) {
-	return m.GenerateToken(userID, m.accessTTL, m.accessSecret)
+func (m *manager) GenerateAccessToken(principal Principal) (string, error) {
+	claims := newClaims(principal.UserID, principal.SessionID, m.accessTTL)
+	claims.Roles = principal.Roles
+	claims.Permissions = principal.Permissions
+	claims.Unverified = principal.Unverified
+	if principal.ClientID != "" {
+		claims.Audience = jwt.ClaimStrings{principal.ClientID}
+		claims.Scope = principal.Scope
+	}
+
+	return m.sign(KeyPurposeAccess, claims)
 }
 
-func (m *manager) GenerateRefreshToken(userID string) (string, error) {
-	return m.GenerateToken(userID, m.refreshTTL, m.refreshSecret)
+func (m *manager) GenerateRefreshToken(userID, sessionID string) (string, error) {
+	return m.sign(KeyPurposeRefresh, newClaims(userID, sessionID, m.refreshTTL))
 }
 
-func (m *manager) GenerateTokens(userID string) (string, string, error) {
-	accessToken, err := m.GenerateAccessToken(userID)
+func (m *manager) GenerateTokens(principal Principal) (string, string, error) {
+	accessToken, err := m.GenerateAccessToken(principal)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to generate access token: %w", err)
 	}
 
-	refreshToken, err := m.GenerateRefreshToken(userID)
+	// roles are looked up again on refresh, so they are left out of the refresh token
+	refreshToken, err := m.GenerateRefreshToken(principal.UserID, principal.SessionID)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to generate refresh token: %w", err)
 	}
@@ -56,32 +148,139 @@ func (m *manager) GenerateTokens(userID string) (string, string, error) {
 	return accessToken, refreshToken, nil
 }
 
-func (m *manager) ValidateRefreshToken(tokenStr string) (*jwt.RegisteredClaims, error) {
-	return m.ValidateToken(tokenStr, m.refreshSecret)
+func (m *manager) GenerateServiceToken(clientID, scope string) (string, error) {
+	claims := newClaims(clientID, "", m.accessTTL)
+	claims.ClientID = clientID
+	claims.Scope = scope
+
+	return m.sign(KeyPurposeAccess, claims)
+}
+
+func (m *manager) GenerateIDToken(claims IDTokenClaims) (string, error) {
+	key, err := m.keyring.Signer(KeyPurposeIDToken, time.Now())
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.SignKey)
+}
+
+func (m *manager) ValidateAccessToken(tokenStr string) (*Claims, error) {
+	return m.verify(KeyPurposeAccess, tokenStr)
+}
+
+func (m *manager) ValidateRefreshToken(tokenStr string) (*Claims, error) {
+	return m.verify(KeyPurposeRefresh, tokenStr)
+}
+
+func (m *manager) JWKS() JWKS {
+	keys := []JWK{}
+	for _, k := range m.keyring.Verifiers(KeyPurposeAccess) {
+		if jwk, ok := k.PublicJWK(); ok {
+			keys = append(keys, jwk)
+		}
+	}
+
+	return JWKS{Keys: keys}
+}
+
+func (m *manager) InternalJWKS() JWKS {
+	keys := m.JWKS().Keys
+	// the secrets of keys left over from HS256 would let anyone who reads them mint tokens
+	if m.accessAlg != "HS256" {
+		return JWKS{Keys: keys}
+	}
+	for _, k := range m.keyring.Verifiers(KeyPurposeAccess) {
+		if jwk, ok := k.SecretJWK(); ok {
+			keys = append(keys, jwk)
+		}
+	}
+
+	return JWKS{Keys: keys}
+}
+
+func (m *manager) IDTokenJWKS() JWKS {
+	keys := []JWK{}
+	for _, k := range m.keyring.Verifiers(KeyPurposeIDToken) {
+		if jwk, ok := k.PublicJWK(); ok {
+			keys = append(keys, jwk)
+		}
+	}
+
+	return JWKS{Keys: keys}
+}
+
+func (m *manager) Keyring() *Keyring {
+	return m.keyring
 }
 
-func (m *manager) GenerateToken(userID string, ttl time.Duration, secret []byte) (string, error) {
-	claims := jwt.RegisteredClaims{
-		Subject:   userID,
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
+// sign uses the current signer of the purpose and records its id in the kid header.
+func (m *manager) sign(purpose KeyPurpose, claims Claims) (string, error) {
+	key, err := m.keyring.Signer(purpose, time.Now())
+	if err != nil {
+		return "", err
 	}
-	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(secret)
+
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.SignKey)
 }
 
-func (m *manager) ValidateToken(tokenStr string, secret []byte) (*jwt.RegisteredClaims, error) {
-	token, err := jwt.ParseWithClaims(tokenStr, &jwt.RegisteredClaims{}, func(token *jwt.Token) (any, error) {
-		return secret, nil
-	})
+// verify checks the token against the key named by its kid. Tokens issued before key ids
+// were introduced are tried against every verifier of the purpose. In both cases the
+// algorithm must match the key, so a token can never pick its own verification method.
+func (m *manager) verify(purpose KeyPurpose, tokenStr string) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(token *jwt.Token) (any, error) {
+		alg := token.Method.Alg()
+
+		if kid, _ := token.Header["kid"].(string); kid != "" {
+			key, ok := m.keyring.Verifier(purpose, kid)
+			if !ok {
+				return nil, fmt.Errorf("unknown signing key %s", kid)
+			}
+			if key.Method.Alg() != alg {
+				return nil, fmt.Errorf("key %s is not valid for %s", kid, alg)
+			}
+			return key.VerifyKey, nil
+		}
+
+		var keySet jwt.VerificationKeySet
+		for _, key := range m.keyring.Verifiers(purpose) {
+			if key.Method.Alg() == alg {
+				keySet.Keys = append(keySet.Keys, key.VerifyKey)
+			}
+		}
+		if len(keySet.Keys) == 0 {
+			return nil, fmt.Errorf("no %s key to verify the token with", alg)
+		}
+		return keySet, nil
+	}, jwt.WithValidMethods(supportedAlgs))
 
 	if err != nil || !token.Valid {
 		return nil, err
 	}
 
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
+	claims, ok := token.Claims.(*Claims)
 	if !ok {
 		return nil, fmt.Errorf("invalid claims")
 	}
 
 	return claims, nil
 }
+
+func newClaims(userID, sessionID string, ttl time.Duration) Claims {
+	return Claims{
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			// unique id keeps tokens issued in the same second for the same user distinct
+			ID:        uuid.NewString(),
+			Subject:   userID,
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+}
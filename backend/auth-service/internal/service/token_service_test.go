@@ -8,6 +8,22 @@ import (
 	"github.com/golang-jwt/jwt/v5"
 )
 
+// signHS256 signs a kid-less token like auth-service did before the keyring.
+func signHS256(userID string, ttl time.Duration, secret []byte) (string, error) {
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, newClaims(userID, "", ttl)).SignedString(secret)
+}
+
+// validateHS256 checks a token was signed with secret, independent of the keyring.
+func validateHS256(tokenStr string, secret []byte) (*Claims, error) {
+	token, err := jwt.ParseWithClaims(tokenStr, &Claims{}, func(*jwt.Token) (any, error) {
+		return secret, nil
+	}, jwt.WithValidMethods([]string{"HS256"}))
+	if err != nil {
+		return nil, err
+	}
+	return token.Claims.(*Claims), nil
+}
+
 func newTestManager() (TokenManager, config.JWTConfig) {
 	cfg := config.JWTConfig{
 		JWTAccessTokenSecret:  "secret_access",
@@ -15,14 +31,18 @@ func newTestManager() (TokenManager, config.JWTConfig) {
 		JWTAccessTokenExp:     15 * time.Minute,
 		JWTRefreshTokenExp:    24 * time.Hour,
 	}
-	return NewTokenManager(cfg), cfg
+	mgr, err := NewTokenManager(cfg)
+	if err != nil {
+		panic(err)
+	}
+	return mgr, cfg
 }
 
 func TestManager_GenerateTokens(t *testing.T) {
 	mgr, cfg := newTestManager()
 	userID := "user-123"
 
-	access, refresh, err := mgr.GenerateTokens(userID)
+	access, refresh, err := mgr.GenerateTokens(Principal{UserID: userID, SessionID: "session-1"})
 
 	if err != nil {
 		t.Fatalf("GenerateTokens() unexpected error: %v", err)
@@ -35,11 +55,11 @@ func TestManager_GenerateTokens(t *testing.T) {
 		t.Error("GenerateTokens() returned empty refresh token")
 	}
 
-	if _, err := mgr.ValidateToken(access, []byte(cfg.JWTAccessTokenSecret)); err != nil {
+	if _, err := validateHS256(access, []byte(cfg.JWTAccessTokenSecret)); err != nil {
 		t.Errorf("GenerateTokens() access token invalid signature: %v", err)
 	}
 
-	if _, err := mgr.ValidateToken(refresh, []byte(cfg.JWTRefreshTokenSecret)); err != nil {
+	if _, err := validateHS256(refresh, []byte(cfg.JWTRefreshTokenSecret)); err != nil {
 		t.Errorf("GenerateTokens() refresh token invalid signature: %v", err)
 	}
 }
@@ -48,12 +68,12 @@ func TestManager_GenerateAccessToken(t *testing.T) {
 	mgr, cfg := newTestManager()
 	userID := "user-access-only"
 
-	token, err := mgr.GenerateAccessToken(userID)
+	token, err := mgr.GenerateAccessToken(Principal{UserID: userID, SessionID: "session-1"})
 	if err != nil {
 		t.Fatalf("GenerateAccessToken() error: %v", err)
 	}
 
-	claims, err := mgr.ValidateToken(token, []byte(cfg.JWTAccessTokenSecret))
+	claims, err := validateHS256(token, []byte(cfg.JWTAccessTokenSecret))
 	if err != nil {
 		t.Fatalf("Generated access token is invalid: %v", err)
 	}
@@ -67,12 +87,12 @@ func TestManager_GenerateRefreshToken(t *testing.T) {
 	mgr, cfg := newTestManager()
 	userID := "user-refresh-only"
 
-	token, err := mgr.GenerateRefreshToken(userID)
+	token, err := mgr.GenerateRefreshToken(userID, "session-1")
 	if err != nil {
 		t.Fatalf("GenerateRefreshToken() error: %v", err)
 	}
 
-	claims, err := mgr.ValidateToken(token, []byte(cfg.JWTRefreshTokenSecret))
+	claims, err := validateHS256(token, []byte(cfg.JWTRefreshTokenSecret))
 	if err != nil {
 		t.Fatalf("Generated refresh token is invalid: %v", err)
 	}
@@ -86,8 +106,8 @@ func TestManager_ValidateRefreshToken(t *testing.T) {
 	mgr, cfg := newTestManager()
 	userID := "user-validate-refresh"
 
-	validRefresh, _ := mgr.GenerateToken(userID, time.Hour, []byte(cfg.JWTRefreshTokenSecret))
-	accessToken, _ := mgr.GenerateToken(userID, time.Hour, []byte(cfg.JWTAccessTokenSecret))
+	validRefresh, _ := signHS256(userID, time.Hour, []byte(cfg.JWTRefreshTokenSecret))
+	accessToken, _ := signHS256(userID, time.Hour, []byte(cfg.JWTAccessTokenSecret))
 
 	tests := []struct {
 		name    string
@@ -129,86 +149,56 @@ func TestManager_ValidateRefreshToken(t *testing.T) {
 	}
 }
 
-func TestManager_GenerateToken(t *testing.T) {
-	mgr, _ := newTestManager()
-	customSecret := []byte("custom-secret")
-	userID := "user-custom"
-
-	ttl := time.Second * 5
-	tokenStr, err := mgr.GenerateToken(userID, ttl, customSecret)
-	if err != nil {
-		t.Fatalf("GenerateToken() error: %v", err)
-	}
-
-	token, _ := jwt.ParseWithClaims(tokenStr, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
-		return customSecret, nil
-	})
-
-	if !token.Valid {
-		t.Error("GenerateToken() produced invalid token")
-	}
-
-	claims, ok := token.Claims.(*jwt.RegisteredClaims)
-	if !ok || claims.Subject != userID {
-		t.Errorf("GenerateToken() wrong subject: got %v, want %v", claims.Subject, userID)
-	}
-}
-
-func TestManager_ValidateToken(t *testing.T) {
-	mgr, _ := newTestManager()
-	secret := []byte("test-secret")
+func TestManager_ValidateAccessToken(t *testing.T) {
+	mgr, cfg := newTestManager()
+	secret := []byte(cfg.JWTAccessTokenSecret)
 	userID := "user-validate"
 
-	validToken, _ := mgr.GenerateToken(userID, time.Hour, secret)
+	validToken, _ := signHS256(userID, time.Hour, secret)
 
-	expiredToken, _ := mgr.GenerateToken(userID, -time.Minute, secret)
+	expiredToken, _ := signHS256(userID, -time.Minute, secret)
 
-	wrongSecretToken, _ := mgr.GenerateToken(userID, time.Hour, []byte("wrong-secret"))
+	wrongSecretToken, _ := signHS256(userID, time.Hour, []byte("wrong-secret"))
 
 	tests := []struct {
 		name       string
 		tokenInput string
-		secret     []byte
 		wantErr    bool
 	}{
 		{
 			name:       "Success: Valid Token",
 			tokenInput: validToken,
-			secret:     secret,
 			wantErr:    false,
 		},
 		{
 			name:       "Fail: Expired Token",
 			tokenInput: expiredToken,
-			secret:     secret,
 			wantErr:    true,
 		},
 		{
 			name:       "Fail: Wrong Secret",
 			tokenInput: wrongSecretToken,
-			secret:     secret,
 			wantErr:    true,
 		},
 		{
 			name:       "Fail: Malformed String",
 			tokenInput: "not.a.jwt",
-			secret:     secret,
 			wantErr:    true,
 		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			claims, err := mgr.ValidateToken(tt.tokenInput, tt.secret)
+			claims, err := mgr.ValidateAccessToken(tt.tokenInput)
 
 			if (err != nil) != tt.wantErr {
-				t.Errorf("ValidateToken() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("ValidateAccessToken() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 
 			if !tt.wantErr {
 				if claims.Subject != userID {
-					t.Errorf("ValidateToken() subject = %v, want %v", claims.Subject, userID)
+					t.Errorf("ValidateAccessToken() subject = %v, want %v", claims.Subject, userID)
 				}
 			}
 		})
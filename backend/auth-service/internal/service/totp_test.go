@@ -0,0 +1,75 @@
+package service
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode_RFC6238(t *testing.T) {
+	// the SHA1 test vectors of RFC 6238 appendix B, truncated to 6 digits
+	secret := []byte("12345678901234567890")
+
+	testCases := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+
+	for _, tc := range testCases {
+		if got := totpCode(secret, totpStep(time.Unix(tc.unix, 0))); got != tc.want {
+			t.Errorf("totpCode(T=%d) = %s, want %s", tc.unix, got, tc.want)
+		}
+	}
+}
+
+func TestMatchTOTP(t *testing.T) {
+	secret := []byte("12345678901234567890")
+	now := time.Unix(1111111111, 0)
+	current := totpStep(now)
+
+	testCases := []struct {
+		name     string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{name: "Current step", code: totpCode(secret, current), wantStep: current, wantOK: true},
+		{name: "Previous step", code: totpCode(secret, current-1), wantStep: current - 1, wantOK: true},
+		{name: "Next step", code: totpCode(secret, current+1), wantStep: current + 1, wantOK: true},
+		{name: "Outside the window", code: totpCode(secret, current-2)},
+		{name: "Wrong length", code: "12345"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			step, ok := matchTOTP(secret, tc.code, now)
+			if ok != tc.wantOK || step != tc.wantStep {
+				t.Errorf("matchTOTP() = %d, %v, want %d, %v", step, ok, tc.wantStep, tc.wantOK)
+			}
+		})
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri, err := url.Parse(totpURI("go-jwt-auth", "user@example.com", []byte("12345678901234567890")))
+	if err != nil {
+		t.Fatalf("totpURI() is not a valid URL: %v", err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" || uri.Path != "/go-jwt-auth:user@example.com" {
+		t.Errorf("unexpected otpauth URI %s", uri)
+	}
+	if got := uri.Query().Get("secret"); got != "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" {
+		t.Errorf("secret = %s, want the unpadded base32 secret", got)
+	}
+	if got := uri.Query().Get("issuer"); got != "go-jwt-auth" {
+		t.Errorf("issuer = %s, want go-jwt-auth", got)
+	}
+}
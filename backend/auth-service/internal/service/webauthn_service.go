@@ -0,0 +1,461 @@
+package service
+
+import (
+	"auth-service/internal/apperror"
+	grpcClient "auth-service/internal/client/grpc"
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"auth-service/internal/logger"
+	"auth-service/internal/repository"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+)
+
+// Ceremony purposes, a challenge issued for one can not be answered in another.
+const (
+	webAuthnRegistration = "registration"
+	webAuthnLogin        = "login"
+	webAuthnSecondFactor = "second_factor"
+)
+
+const maxPasskeyNameLength = 64
+
+// WebAuthnOptions starts a ceremony in the browser. Options is passed to
+// navigator.credentials.create() or .get(), CeremonyID is sent back with the result.
+type WebAuthnOptions struct {
+	CeremonyID string
+	Options    any
+}
+
+// WebAuthnService registers passkeys and security keys and verifies their assertions, either as
+// the only factor of a passwordless login or as the second factor after the password.
+type WebAuthnService interface {
+	BeginRegistration(ctx context.Context, userID string) (*WebAuthnOptions, error)
+	FinishRegistration(ctx context.Context, userID, ceremonyID, name string, response []byte) (*entity.WebAuthnCredential, error)
+	ListCredentials(ctx context.Context, userID string) ([]entity.WebAuthnCredential, error)
+	DeleteCredential(ctx context.Context, userID string, id int) error
+	HasCredentials(ctx context.Context, userID string) (bool, error)
+
+	// BeginLogin starts a passwordless login with a discoverable credential (passkey). The user
+	// is not known yet, the authenticator tells who it belongs to.
+	BeginLogin(ctx context.Context) (*WebAuthnOptions, error)
+	// FinishLogin verifies the assertion and returns the user it belongs to.
+	FinishLogin(ctx context.Context, ceremonyID string, response []byte) (string, error)
+
+	// BeginSecondFactor asks for an assertion from one of the user's credentials.
+	BeginSecondFactor(ctx context.Context, userID string) (*WebAuthnOptions, error)
+	// FinishSecondFactor reports whether the assertion is valid and belongs to the user.
+	FinishSecondFactor(ctx context.Context, userID, ceremonyID string, response []byte) (bool, error)
+}
+
+type webAuthnService struct {
+	grpcUserClient grpcClient.UserService
+	repo           repository.WebAuthnRepository
+	webAuthn       *webauthn.WebAuthn
+	cfg            config.Config
+}
+
+func NewWebAuthnService(grpcUserClient grpcClient.UserService, repo repository.WebAuthnRepository, cfg config.Config) (WebAuthnService, error) {
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          cfg.WebAuthn.WebAuthnRPID,
+		RPDisplayName: cfg.WebAuthn.WebAuthnRPDisplayName,
+		RPOrigins:     cfg.WebAuthn.WebAuthnRPOrigins,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("invalid webauthn configuration: %w", err)
+	}
+
+	return &webAuthnService{
+		grpcUserClient: grpcUserClient,
+		repo:           repo,
+		webAuthn:       w,
+		cfg:            cfg,
+	}, nil
+}
+
+// webAuthnUser adapts a user and their credentials to the library. The user handle is the user id.
+type webAuthnUser struct {
+	id          string
+	name        string
+	credentials []webauthn.Credential
+}
+
+func (u *webAuthnUser) WebAuthnID() []byte {
+	return []byte(u.id)
+}
+
+func (u *webAuthnUser) WebAuthnName() string {
+	return u.name
+}
+
+func (u *webAuthnUser) WebAuthnDisplayName() string {
+	return u.name
+}
+
+func (u *webAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	return u.credentials
+}
+
+func (s *webAuthnService) BeginRegistration(ctx context.Context, userID string) (*WebAuthnOptions, error) {
+	userResp, err := s.grpcUserClient.GetUserByID(ctx, userID)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error gRPC get user by ID")
+		return nil, apperror.FromGRPC(err)
+	}
+
+	user, _, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	user.name = userResp.User.Email
+
+	creation, session, err := s.webAuthn.BeginRegistration(user,
+		// discoverable credentials can also sign in without a password
+		webauthn.WithResidentKeyRequirement(protocol.ResidentKeyRequirementPreferred),
+		webauthn.WithExclusions(webauthn.Credentials(user.credentials).CredentialDescriptors()),
+	)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error beginning webauthn registration")
+		return nil, apperror.Internal(err)
+	}
+
+	return s.saveCeremony(ctx, webAuthnRegistration, session, creation)
+}
+
+func (s *webAuthnService) FinishRegistration(ctx context.Context, userID, ceremonyID, name string, response []byte) (*entity.WebAuthnCredential, error) {
+	session, err := s.consumeCeremony(ctx, ceremonyID, webAuthnRegistration)
+	if err != nil {
+		return nil, err
+	}
+
+	parsed, err := protocol.ParseCredentialCreationResponseBytes(response)
+	if err != nil {
+		return nil, apperror.BadRequest("invalid passkey registration")
+	}
+
+	user, _, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	credential, err := s.webAuthn.CreateCredential(user, *session, parsed)
+	if err != nil {
+		logger.Log.Warn().Err(err).Str("user_id", userID).Msg("webauthn registration rejected")
+		return nil, apperror.BadRequest("invalid passkey registration")
+	}
+
+	name = strings.TrimSpace(name)
+	if name == "" {
+		name = "Passkey"
+	}
+	if len([]rune(name)) > maxPasskeyNameLength {
+		name = string([]rune(name)[:maxPasskeyNameLength])
+	}
+
+	transports := make([]string, 0, len(credential.Transport))
+	for _, t := range credential.Transport {
+		transports = append(transports, string(t))
+	}
+
+	row := &entity.WebAuthnCredential{
+		UserID:          userID,
+		CredentialID:    base64.RawURLEncoding.EncodeToString(credential.ID),
+		PublicKey:       credential.PublicKey,
+		AttestationType: credential.AttestationType,
+		AAGUID:          credential.Authenticator.AAGUID,
+		SignCount:       int64(credential.Authenticator.SignCount),
+		Transports:      strings.Join(transports, ","),
+		UserVerified:    credential.Flags.UserVerified,
+		BackupEligible:  credential.Flags.BackupEligible,
+		BackupState:     credential.Flags.BackupState,
+		Name:            name,
+	}
+	if err := s.repo.CreateCredential(ctx, row); err != nil {
+		if errors.Is(err, repository.ErrWebAuthnCredentialExists) {
+			return nil, apperror.Conflict("passkey is already registered")
+		}
+		logger.Log.Error().Err(err).Msg("error saving webauthn credential")
+		return nil, apperror.Internal(err)
+	}
+
+	logger.Log.Info().
+		Str("event", "passkey_registered").
+		Str("user_id", userID).
+		Int("credential_id", row.ID).
+		Msg("passkey registered")
+
+	return row, nil
+}
+
+func (s *webAuthnService) ListCredentials(ctx context.Context, userID string) ([]entity.WebAuthnCredential, error) {
+	credentials, err := s.repo.ListCredentials(ctx, userID)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error listing webauthn credentials")
+		return nil, apperror.Internal(err)
+	}
+
+	return credentials, nil
+}
+
+func (s *webAuthnService) DeleteCredential(ctx context.Context, userID string, id int) error {
+	if err := s.repo.DeleteCredential(ctx, userID, id); err != nil {
+		if errors.Is(err, repository.ErrWebAuthnCredentialNotFound) {
+			return apperror.NotFound("passkey not found")
+		}
+		logger.Log.Error().Err(err).Msg("error deleting webauthn credential")
+		return apperror.Internal(err)
+	}
+
+	logger.Log.Info().
+		Str("event", "passkey_deleted").
+		Str("user_id", userID).
+		Int("credential_id", id).
+		Msg("passkey deleted")
+
+	return nil
+}
+
+func (s *webAuthnService) HasCredentials(ctx context.Context, userID string) (bool, error) {
+	credentials, err := s.ListCredentials(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	return len(credentials) > 0, nil
+}
+
+func (s *webAuthnService) BeginLogin(ctx context.Context) (*WebAuthnOptions, error) {
+	// without a password the authenticator has to verify the user (PIN or biometrics)
+	assertion, session, err := s.webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error beginning webauthn login")
+		return nil, apperror.Internal(err)
+	}
+
+	return s.saveCeremony(ctx, webAuthnLogin, session, assertion)
+}
+
+func (s *webAuthnService) FinishLogin(ctx context.Context, ceremonyID string, response []byte) (string, error) {
+	session, err := s.consumeCeremony(ctx, ceremonyID, webAuthnLogin)
+	if err != nil {
+		return "", err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return "", apperror.Unauthorized("invalid passkey")
+	}
+
+	var (
+		user *webAuthnUser
+		rows []entity.WebAuthnCredential
+	)
+	_, credential, err := s.webAuthn.ValidatePasskeyLogin(func(_, userHandle []byte) (webauthn.User, error) {
+		// the handle comes from the client, only look up what can be a user id
+		if _, err := strconv.Atoi(string(userHandle)); err != nil {
+			return nil, errors.New("malformed user handle")
+		}
+
+		var loadErr error
+		user, rows, loadErr = s.loadUser(ctx, string(userHandle))
+		return user, loadErr
+	}, *session, parsed)
+	if err != nil {
+		logger.Log.Warn().Err(err).Msg("webauthn login rejected")
+		return "", apperror.Unauthorized("invalid passkey")
+	}
+
+	ok, err := s.recordAssertion(ctx, user.id, rows, credential)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", apperror.Unauthorized("invalid passkey")
+	}
+
+	return user.id, nil
+}
+
+func (s *webAuthnService) BeginSecondFactor(ctx context.Context, userID string) (*WebAuthnOptions, error) {
+	user, _, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if len(user.credentials) == 0 {
+		return nil, apperror.BadRequest("no passkey registered")
+	}
+
+	assertion, session, err := s.webAuthn.BeginLogin(user)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error beginning webauthn assertion")
+		return nil, apperror.Internal(err)
+	}
+
+	return s.saveCeremony(ctx, webAuthnSecondFactor, session, assertion)
+}
+
+func (s *webAuthnService) FinishSecondFactor(ctx context.Context, userID, ceremonyID string, response []byte) (bool, error) {
+	session, err := s.consumeCeremony(ctx, ceremonyID, webAuthnSecondFactor)
+	if err != nil {
+		return false, err
+	}
+
+	parsed, err := protocol.ParseCredentialRequestResponseBytes(response)
+	if err != nil {
+		return false, nil
+	}
+
+	user, rows, err := s.loadUser(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	// also rejects a ceremony that was started for another user
+	credential, err := s.webAuthn.ValidateLogin(user, *session, parsed)
+	if err != nil {
+		logger.Log.Warn().Err(err).Str("user_id", userID).Msg("webauthn assertion rejected")
+		return false, nil
+	}
+
+	return s.recordAssertion(ctx, userID, rows, credential)
+}
+
+// recordAssertion stores the new sign counter. An assertion whose counter did not grow comes from
+// a cloned authenticator or is a replay and is rejected.
+func (s *webAuthnService) recordAssertion(ctx context.Context, userID string, rows []entity.WebAuthnCredential, credential *webauthn.Credential) (bool, error) {
+	credentialID := base64.RawURLEncoding.EncodeToString(credential.ID)
+
+	var row *entity.WebAuthnCredential
+	for i := range rows {
+		if rows[i].CredentialID == credentialID {
+			row = &rows[i]
+		}
+	}
+	if row == nil {
+		return false, nil
+	}
+
+	updated := false
+	if !credential.Authenticator.CloneWarning {
+		var err error
+		updated, err = s.repo.UpdateSignCount(ctx, row.ID, credential.Authenticator.SignCount, credential.Flags.BackupState)
+		if err != nil {
+			logger.Log.Error().Err(err).Msg("error updating webauthn sign count")
+			return false, apperror.Internal(err)
+		}
+	}
+
+	if !updated {
+		logger.Log.Warn().
+			Str("event", "passkey_clone_warning").
+			Str("user_id", userID).
+			Int("credential_id", row.ID).
+			Uint32("sign_count", credential.Authenticator.SignCount).
+			Msg("security event: passkey sign counter did not increase, authenticator may be cloned")
+	}
+
+	return updated, nil
+}
+
+// loadUser returns the user with their credentials, both as the library needs them and as stored.
+func (s *webAuthnService) loadUser(ctx context.Context, userID string) (*webAuthnUser, []entity.WebAuthnCredential, error) {
+	rows, err := s.ListCredentials(ctx, userID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user := &webAuthnUser{id: userID, credentials: make([]webauthn.Credential, 0, len(rows))}
+	for _, row := range rows {
+		credential, err := libraryCredential(row)
+		if err != nil {
+			logger.Log.Error().Err(err).Int("credential_id", row.ID).Msg("error decoding webauthn credential")
+			continue
+		}
+		user.credentials = append(user.credentials, credential)
+	}
+
+	return user, rows, nil
+}
+
+func libraryCredential(row entity.WebAuthnCredential) (webauthn.Credential, error) {
+	id, err := base64.RawURLEncoding.DecodeString(row.CredentialID)
+	if err != nil {
+		return webauthn.Credential{}, err
+	}
+
+	var transports []protocol.AuthenticatorTransport
+	if row.Transports != "" {
+		for _, t := range strings.Split(row.Transports, ",") {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+	}
+
+	return webauthn.Credential{
+		ID:              id,
+		PublicKey:       row.PublicKey,
+		AttestationType: row.AttestationType,
+		Transport:       transports,
+		Flags: webauthn.CredentialFlags{
+			UserPresent:    true,
+			UserVerified:   row.UserVerified,
+			BackupEligible: row.BackupEligible,
+			BackupState:    row.BackupState,
+		},
+		Authenticator: webauthn.Authenticator{
+			AAGUID:    row.AAGUID,
+			SignCount: uint32(row.SignCount),
+		},
+	}, nil
+}
+
+func (s *webAuthnService) saveCeremony(ctx context.Context, purpose string, session *webauthn.SessionData, options any) (*WebAuthnOptions, error) {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return nil, apperror.Internal(err)
+	}
+
+	token, err := newResetToken()
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error generating webauthn ceremony id")
+		return nil, apperror.Internal(err)
+	}
+
+	ceremony := &entity.WebAuthnCeremony{
+		Purpose:   purpose,
+		Data:      string(data),
+		ExpiresAt: time.Now().Add(s.cfg.WebAuthn.WebAuthnCeremonyExp),
+	}
+	if err := s.repo.SaveCeremony(ctx, token, ceremony); err != nil {
+		logger.Log.Error().Err(err).Msg("error saving webauthn ceremony")
+		return nil, apperror.Internal(err)
+	}
+
+	return &WebAuthnOptions{CeremonyID: token, Options: options}, nil
+}
+
+func (s *webAuthnService) consumeCeremony(ctx context.Context, ceremonyID, purpose string) (*webauthn.SessionData, error) {
+	ceremony, err := s.repo.ConsumeCeremony(ctx, ceremonyID, purpose)
+	if err != nil {
+		if errors.Is(err, repository.ErrWebAuthnCeremonyNotFound) {
+			return nil, apperror.BadRequest("invalid or expired ceremony")
+		}
+		logger.Log.Error().Err(err).Msg("error consuming webauthn ceremony")
+		return nil, apperror.Internal(err)
+	}
+
+	var session webauthn.SessionData
+	if err := json.Unmarshal([]byte(ceremony.Data), &session); err != nil {
+		return nil, apperror.Internal(fmt.Errorf("failed to decode webauthn session: %w", err))
+	}
+
+	return &session, nil
+}
@@ -0,0 +1,461 @@
+package service
+
+import (
+	"auth-service/internal/config"
+	"auth-service/internal/entity"
+	"auth-service/internal/repository"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+)
+
+// fakeWebAuthnRepository keeps credentials and ceremonies in memory, ceremonies keyed by the raw id.
+type fakeWebAuthnRepository struct {
+	mu          sync.Mutex
+	credentials []*entity.WebAuthnCredential
+	ceremonies  map[string]*entity.WebAuthnCeremony
+	nextID      int
+}
+
+func newFakeWebAuthnRepository() *fakeWebAuthnRepository {
+	return &fakeWebAuthnRepository{ceremonies: map[string]*entity.WebAuthnCeremony{}}
+}
+
+func (r *fakeWebAuthnRepository) ListCredentials(_ context.Context, userID string) ([]entity.WebAuthnCredential, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var credentials []entity.WebAuthnCredential
+	for _, c := range r.credentials {
+		if c.UserID == userID {
+			credentials = append(credentials, *c)
+		}
+	}
+	return credentials, nil
+}
+
+func (r *fakeWebAuthnRepository) CreateCredential(_ context.Context, credential *entity.WebAuthnCredential) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range r.credentials {
+		if c.CredentialID == credential.CredentialID {
+			return repository.ErrWebAuthnCredentialExists
+		}
+	}
+	r.nextID++
+	credential.ID = r.nextID
+	credential.CreatedAt = time.Now()
+	copied := *credential
+	r.credentials = append(r.credentials, &copied)
+	return nil
+}
+
+func (r *fakeWebAuthnRepository) UpdateSignCount(_ context.Context, id int, signCount uint32, backupState bool) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range r.credentials {
+		if c.ID == id && (c.SignCount < int64(signCount) || (c.SignCount == 0 && signCount == 0)) {
+			c.SignCount = int64(signCount)
+			c.BackupState = backupState
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *fakeWebAuthnRepository) DeleteCredential(_ context.Context, userID string, id int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, c := range r.credentials {
+		if c.ID == id && c.UserID == userID {
+			r.credentials = slices.Delete(r.credentials, i, i+1)
+			return nil
+		}
+	}
+	return repository.ErrWebAuthnCredentialNotFound
+}
+
+func (r *fakeWebAuthnRepository) SaveCeremony(_ context.Context, token string, ceremony *entity.WebAuthnCeremony) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.ceremonies[token] = ceremony
+	return nil
+}
+
+func (r *fakeWebAuthnRepository) ConsumeCeremony(_ context.Context, token, purpose string) (*entity.WebAuthnCeremony, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ceremony, ok := r.ceremonies[token]
+	if !ok || ceremony.Purpose != purpose || !time.Now().Before(ceremony.ExpiresAt) {
+		return nil, repository.ErrWebAuthnCeremonyNotFound
+	}
+	delete(r.ceremonies, token)
+	return ceremony, nil
+}
+
+// softAuthenticator is a platform authenticator in software: an ES256 key pair that answers
+// registration and login ceremonies the way a browser and authenticator would, with "none" attestation.
+type softAuthenticator struct {
+	origin       string
+	rpID         string
+	key          *ecdsa.PrivateKey
+	credentialID []byte
+	userHandle   []byte
+	signCount    uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	credentialID := make([]byte, 16)
+	if _, err := rand.Read(credentialID); err != nil {
+		t.Fatalf("failed to generate credential id: %v", err)
+	}
+
+	return &softAuthenticator{origin: "http://localhost", rpID: "localhost", key: key, credentialID: credentialID}
+}
+
+// create answers the options of navigator.credentials.create().
+func (a *softAuthenticator) create(t *testing.T, options any) []byte {
+	t.Helper()
+
+	creation, ok := options.(*protocol.CredentialCreation)
+	if !ok {
+		t.Fatalf("options are %T, want registration options", options)
+	}
+	a.userHandle = creation.Response.User.ID.(protocol.URLEncodedBase64)
+
+	publicKey, err := webauthncbor.Marshal(map[int]any{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.PublicKey.X.FillBytes(make([]byte, 32)),
+		-3: a.key.PublicKey.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		t.Fatalf("failed to encode public key: %v", err)
+	}
+
+	authData := a.authData(0x40) // attested credential data included
+	authData = append(authData, make([]byte, 16)...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, publicKey...)
+
+	attestationObject, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": authData,
+	})
+	if err != nil {
+		t.Fatalf("failed to encode attestation object: %v", err)
+	}
+
+	return a.credential(t, map[string]any{
+		"clientDataJSON":    a.clientData(t, "webauthn.create", creation.Response.Challenge),
+		"attestationObject": b64(attestationObject),
+		"transports":        []string{"internal"},
+	})
+}
+
+// get answers the options of navigator.credentials.get().
+func (a *softAuthenticator) get(t *testing.T, options any) []byte {
+	t.Helper()
+
+	assertion, ok := options.(*protocol.CredentialAssertion)
+	if !ok {
+		t.Fatalf("options are %T, want login options", options)
+	}
+
+	a.signCount++
+	authData := a.authData(0)
+	clientData := a.clientData(t, "webauthn.get", assertion.Response.Challenge)
+
+	clientDataJSON, _ := base64.RawURLEncoding.DecodeString(clientData)
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(authData, clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		t.Fatalf("failed to sign assertion: %v", err)
+	}
+
+	return a.credential(t, map[string]any{
+		"clientDataJSON":    clientData,
+		"authenticatorData": b64(authData),
+		"signature":         b64(signature),
+		"userHandle":        b64(a.userHandle),
+	})
+}
+
+// authData is the authenticator data with user presence and user verification set.
+func (a *softAuthenticator) authData(flags byte) []byte {
+	rpIDHash := sha256.Sum256([]byte(a.rpID))
+
+	data := append([]byte{}, rpIDHash[:]...)
+	data = append(data, 0x01|0x04|flags)
+	return binary.BigEndian.AppendUint32(data, a.signCount)
+}
+
+func (a *softAuthenticator) clientData(t *testing.T, typ string, challenge protocol.URLEncodedBase64) string {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]any{
+		"type":      typ,
+		"challenge": b64(challenge),
+		"origin":    a.origin,
+	})
+	if err != nil {
+		t.Fatalf("failed to encode client data: %v", err)
+	}
+	return b64(data)
+}
+
+func (a *softAuthenticator) credential(t *testing.T, response map[string]any) []byte {
+	t.Helper()
+
+	data, err := json.Marshal(map[string]any{
+		"id":       b64(a.credentialID),
+		"rawId":    b64(a.credentialID),
+		"type":     "public-key",
+		"response": response,
+	})
+	if err != nil {
+		t.Fatalf("failed to encode credential: %v", err)
+	}
+	return data
+}
+
+func b64(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func testWebAuthnConfig() config.WebAuthnConfig {
+	return config.WebAuthnConfig{
+		WebAuthnRPID:          "localhost",
+		WebAuthnRPDisplayName: "go-jwt-auth",
+		WebAuthnRPOrigins:     []string{"http://localhost"},
+		WebAuthnCeremonyExp:   time.Minute,
+	}
+}
+
+func newTestWebAuthnService(t *testing.T, users *fakeUserClient, cfg config.Config) WebAuthnService {
+	t.Helper()
+
+	svc, err := NewWebAuthnService(users, newFakeWebAuthnRepository(), cfg)
+	if err != nil {
+		t.Fatalf("NewWebAuthnService() error: %v", err)
+	}
+	return svc
+}
+
+// registerTestPasskey runs a registration ceremony for the user with the authenticator.
+func registerTestPasskey(t *testing.T, webAuthn WebAuthnService, userID string, authenticator *softAuthenticator) *entity.WebAuthnCredential {
+	t.Helper()
+	ctx := context.Background()
+
+	options, err := webAuthn.BeginRegistration(ctx, userID)
+	if err != nil {
+		t.Fatalf("BeginRegistration() error: %v", err)
+	}
+
+	credential, err := webAuthn.FinishRegistration(ctx, userID, options.CeremonyID, "Laptop", authenticator.create(t, options.Options))
+	if err != nil {
+		t.Fatalf("FinishRegistration() error: %v", err)
+	}
+	return credential
+}
+
+func TestWebAuthnService_Registration(t *testing.T) {
+	_, webAuthn, _, users := newTestMFAService(t)
+	ctx := context.Background()
+	registerTestUser(t, users, "passkey@example.com", "password")
+
+	authenticator := newSoftAuthenticator(t)
+	credential := registerTestPasskey(t, webAuthn, "1", authenticator)
+	if credential.Name != "Laptop" || credential.Transports != "internal" {
+		t.Errorf("FinishRegistration() = %+v, want the name and transports stored", credential)
+	}
+
+	// the same authenticator can not be registered twice
+	options, err := webAuthn.BeginRegistration(ctx, "1")
+	if err != nil {
+		t.Fatalf("BeginRegistration() error: %v", err)
+	}
+	if got := options.Options.(*protocol.CredentialCreation).Response.CredentialExcludeList; len(got) != 1 {
+		t.Errorf("exclude list has %d credentials, want 1", len(got))
+	}
+	_, err = webAuthn.FinishRegistration(ctx, "1", options.CeremonyID, "", authenticator.create(t, options.Options))
+	assertAppError(t, err, 409)
+
+	// a response from another origin is rejected
+	phishing := newSoftAuthenticator(t)
+	phishing.origin = "https://evil.example.com"
+	options, err = webAuthn.BeginRegistration(ctx, "1")
+	if err != nil {
+		t.Fatalf("BeginRegistration() error: %v", err)
+	}
+	_, err = webAuthn.FinishRegistration(ctx, "1", options.CeremonyID, "", phishing.create(t, options.Options))
+	assertAppError(t, err, 400)
+
+	// a ceremony of one user can not register a credential for another
+	registerTestUser(t, users, "other@example.com", "password")
+	options, err = webAuthn.BeginRegistration(ctx, "1")
+	if err != nil {
+		t.Fatalf("BeginRegistration() error: %v", err)
+	}
+	_, err = webAuthn.FinishRegistration(ctx, "2", options.CeremonyID, "", newSoftAuthenticator(t).create(t, options.Options))
+	assertAppError(t, err, 400)
+}
+
+func TestWebAuthnService_PasskeyLogin(t *testing.T) {
+	_, webAuthn, auth, users := newTestMFAService(t)
+	ctx := context.Background()
+	registerTestUser(t, users, "passkey@example.com", "password")
+
+	authenticator := newSoftAuthenticator(t)
+	registerTestPasskey(t, webAuthn, "1", authenticator)
+
+	options, err := auth.BeginPasskeyLogin(ctx)
+	if err != nil {
+		t.Fatalf("BeginPasskeyLogin() error: %v", err)
+	}
+	response := authenticator.get(t, options.Options)
+
+	result, err := auth.FinishPasskeyLogin(ctx, options.CeremonyID, response, SessionMeta{DeviceLabel: "phone"})
+	if err != nil {
+		t.Fatalf("FinishPasskeyLogin() error: %v", err)
+	}
+	if result.AccessToken == "" || result.RefreshToken == "" || result.UserID != "1" {
+		t.Errorf("FinishPasskeyLogin() = %+v, want tokens for user 1", result)
+	}
+
+	// the ceremony is single use
+	_, err = auth.FinishPasskeyLogin(ctx, options.CeremonyID, response, SessionMeta{})
+	assertAppError(t, err, 400)
+
+	// an unknown authenticator is rejected
+	options, err = auth.BeginPasskeyLogin(ctx)
+	if err != nil {
+		t.Fatalf("BeginPasskeyLogin() error: %v", err)
+	}
+	stranger := newSoftAuthenticator(t)
+	stranger.userHandle = []byte("1")
+	_, err = auth.FinishPasskeyLogin(ctx, options.CeremonyID, stranger.get(t, options.Options), SessionMeta{})
+	assertUnauthorized(t, err)
+}
+
+func TestWebAuthnService_RejectsClonedAuthenticator(t *testing.T) {
+	_, webAuthn, auth, users := newTestMFAService(t)
+	ctx := context.Background()
+	registerTestUser(t, users, "clone@example.com", "password")
+
+	authenticator := newSoftAuthenticator(t)
+	registerTestPasskey(t, webAuthn, "1", authenticator)
+
+	login := func() error {
+		options, err := auth.BeginPasskeyLogin(ctx)
+		if err != nil {
+			t.Fatalf("BeginPasskeyLogin() error: %v", err)
+		}
+		_, err = auth.FinishPasskeyLogin(ctx, options.CeremonyID, authenticator.get(t, options.Options), SessionMeta{})
+		return err
+	}
+
+	authenticator.signCount = 10
+	if err := login(); err != nil {
+		t.Fatalf("login error: %v", err)
+	}
+
+	// a copy of the key that is behind on the counter
+	authenticator.signCount = 5
+	assertUnauthorized(t, login())
+}
+
+func TestWebAuthnService_SecondFactor(t *testing.T) {
+	_, webAuthn, auth, users := newTestMFAService(t)
+	ctx := context.Background()
+	registerTestUser(t, users, "second@example.com", "password")
+
+	authenticator := newSoftAuthenticator(t)
+	registerTestPasskey(t, webAuthn, "1", authenticator)
+
+	login := func() string {
+		t.Helper()
+		result, err := auth.Login(ctx, "second@example.com", "password", SessionMeta{})
+		if err != nil {
+			t.Fatalf("Login() error: %v", err)
+		}
+		if !result.MFARequired || !slices.Equal(result.MFAMethods, []string{MFAMethodWebAuthn}) {
+			t.Fatalf("Login() = %+v, want an mfa challenge for webauthn", result)
+		}
+		return result.MFAToken
+	}
+
+	// an assertion from a key the user does not own
+	mfaToken := login()
+	options, err := auth.BeginMFAWebAuthn(ctx, mfaToken)
+	if err != nil {
+		t.Fatalf("BeginMFAWebAuthn() error: %v", err)
+	}
+	stranger := newSoftAuthenticator(t)
+	stranger.userHandle = []byte("1")
+	_, err = auth.VerifyMFAWebAuthn(ctx, mfaToken, options.CeremonyID, stranger.get(t, options.Options))
+	assertUnauthorized(t, err)
+
+	options, err = auth.BeginMFAWebAuthn(ctx, mfaToken)
+	if err != nil {
+		t.Fatalf("BeginMFAWebAuthn() error: %v", err)
+	}
+	result, err := auth.VerifyMFAWebAuthn(ctx, mfaToken, options.CeremonyID, authenticator.get(t, options.Options))
+	if err != nil {
+		t.Fatalf("VerifyMFAWebAuthn() error: %v", err)
+	}
+	if result.AccessToken == "" || result.UserID != "1" {
+		t.Errorf("VerifyMFAWebAuthn() = %+v, want tokens for user 1", result)
+	}
+
+	// the login is complete, the mfa token can not start another ceremony
+	_, err = auth.BeginMFAWebAuthn(ctx, mfaToken)
+	assertUnauthorized(t, err)
+}
+
+func TestWebAuthnService_DeleteCredential(t *testing.T) {
+	_, webAuthn, auth, users := newTestMFAService(t)
+	ctx := context.Background()
+	registerTestUser(t, users, "delete@example.com", "password")
+	registerTestUser(t, users, "other@example.com", "password")
+
+	credential := registerTestPasskey(t, webAuthn, "1", newSoftAuthenticator(t))
+
+	assertAppError(t, webAuthn.DeleteCredential(ctx, "2", credential.ID), 404)
+
+	if err := webAuthn.DeleteCredential(ctx, "1", credential.ID); err != nil {
+		t.Fatalf("DeleteCredential() error: %v", err)
+	}
+
+	result, err := auth.Login(ctx, "delete@example.com", "password", SessionMeta{})
+	if err != nil || result.MFARequired {
+		t.Errorf("Login() after deleting the passkey = %+v, %v, want tokens", result, err)
+	}
+}
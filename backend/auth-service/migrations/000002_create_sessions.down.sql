@@ -0,0 +1,12 @@
+DROP INDEX IF EXISTS idx_refresh_tokens_session_id;
+ALTER TABLE refresh_tokens DROP CONSTRAINT IF EXISTS fk_refresh_tokens_session;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS session_id;
+
+-- keep only the most recent refresh token per user before restoring the unique constraint
+DELETE FROM refresh_tokens a
+USING refresh_tokens b
+WHERE a.user_id = b.user_id AND a.id < b.id;
+
+ALTER TABLE refresh_tokens ADD CONSTRAINT refresh_tokens_user_id_key UNIQUE (user_id);
+
+DROP TABLE IF EXISTS sessions;
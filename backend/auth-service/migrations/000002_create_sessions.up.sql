@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS sessions (
+	id UUID PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	device_label TEXT,
+	user_agent TEXT,
+	ip TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_used_at TIMESTAMP NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	revoked_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_sessions_user_id ON sessions (user_id);
+
+-- a user may now hold many refresh tokens, one lineage per session
+ALTER TABLE refresh_tokens DROP CONSTRAINT IF EXISTS refresh_tokens_user_id_key;
+ALTER TABLE refresh_tokens ADD COLUMN session_id UUID;
+
+-- every pre-existing refresh token becomes its own session
+UPDATE refresh_tokens SET session_id = gen_random_uuid();
+
+INSERT INTO sessions (id, user_id, created_at, last_used_at, expires_at)
+SELECT session_id, user_id, COALESCE(created_at, CURRENT_TIMESTAMP), COALESCE(created_at, CURRENT_TIMESTAMP), expires_at
+FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens ALTER COLUMN session_id SET NOT NULL;
+ALTER TABLE refresh_tokens
+	ADD CONSTRAINT fk_refresh_tokens_session
+	FOREIGN KEY (session_id) REFERENCES sessions (id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_refresh_tokens_session_id ON refresh_tokens (session_id);
@@ -0,0 +1,3 @@
+DELETE FROM refresh_tokens WHERE used_at IS NOT NULL;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS used_at;
+ALTER TABLE refresh_tokens DROP COLUMN IF EXISTS parent_id;
@@ -0,0 +1,3 @@
+-- rotated tokens are kept (marked as used) so that a replay can be detected
+ALTER TABLE refresh_tokens ADD COLUMN parent_id INTEGER REFERENCES refresh_tokens (id) ON DELETE SET NULL;
+ALTER TABLE refresh_tokens ADD COLUMN used_at TIMESTAMP;
@@ -0,0 +1,5 @@
+-- hashes cannot be turned back into tokens
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens RENAME CONSTRAINT refresh_tokens_token_hash_key TO refresh_tokens_token_key;
+ALTER TABLE refresh_tokens RENAME COLUMN token_hash TO token;
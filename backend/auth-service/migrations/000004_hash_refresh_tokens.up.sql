@@ -0,0 +1,8 @@
+-- Refresh tokens are now stored as an HMAC-SHA256 hash keyed by REFRESH_TOKEN_HASH_KEY.
+-- Raw tokens cannot be rehashed here without the application key, so every stored token
+-- is invalidated and the affected sessions are revoked; users sign in again once.
+UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE revoked_at IS NULL;
+DELETE FROM refresh_tokens;
+
+ALTER TABLE refresh_tokens RENAME COLUMN token TO token_hash;
+ALTER TABLE refresh_tokens RENAME CONSTRAINT refresh_tokens_token_key TO refresh_tokens_token_hash_key;
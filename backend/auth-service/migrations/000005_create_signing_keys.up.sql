@@ -0,0 +1,12 @@
+-- key_material holds the private key sealed with JWT_KEYRING_ENCRYPTION_KEY
+CREATE TABLE IF NOT EXISTS signing_keys (
+	id TEXT NOT NULL,
+	purpose TEXT NOT NULL CHECK (purpose IN ('access', 'refresh')),
+	algorithm TEXT NOT NULL,
+	key_material TEXT NOT NULL,
+	state TEXT NOT NULL CHECK (state IN ('active', 'verify_only', 'retired')),
+	activates_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (purpose, id)
+);
@@ -0,0 +1,28 @@
+CREATE TABLE IF NOT EXISTS webauthn_credentials (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	credential_id TEXT UNIQUE NOT NULL,
+	public_key BYTEA NOT NULL,
+	attestation_type TEXT,
+	aaguid BYTEA,
+	sign_count BIGINT NOT NULL DEFAULT 0,
+	transports TEXT,
+	user_verified BOOLEAN NOT NULL DEFAULT FALSE,
+	backup_eligible BOOLEAN NOT NULL DEFAULT FALSE,
+	backup_state BOOLEAN NOT NULL DEFAULT FALSE,
+	name TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_used_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_webauthn_credentials_user_id ON webauthn_credentials (user_id);
+
+-- token_hash is keyed by REFRESH_TOKEN_HASH_KEY like the other single-use tokens
+CREATE TABLE IF NOT EXISTS webauthn_ceremonies (
+	id SERIAL PRIMARY KEY,
+	token_hash TEXT UNIQUE NOT NULL,
+	purpose TEXT NOT NULL,
+	data TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
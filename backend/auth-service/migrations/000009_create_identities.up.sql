@@ -0,0 +1,23 @@
+CREATE TABLE IF NOT EXISTS identities (
+	id SERIAL PRIMARY KEY,
+	provider TEXT NOT NULL,
+	subject TEXT NOT NULL,
+	user_id INTEGER NOT NULL,
+	email TEXT,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_login_at TIMESTAMP
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_identities_provider_subject ON identities (provider, subject);
+CREATE INDEX IF NOT EXISTS idx_identities_user_id ON identities (user_id);
+
+-- state_hash is keyed by REFRESH_TOKEN_HASH_KEY like the other single-use tokens
+CREATE TABLE IF NOT EXISTS oidc_states (
+	id SERIAL PRIMARY KEY,
+	state_hash TEXT UNIQUE NOT NULL,
+	provider TEXT NOT NULL,
+	nonce TEXT NOT NULL,
+	code_verifier TEXT NOT NULL,
+	expires_at TIMESTAMP NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS oauth_authorizations;
+DROP TABLE IF EXISTS oauth_clients;
+
+DELETE FROM signing_keys WHERE purpose = 'id_token';
+ALTER TABLE signing_keys DROP CONSTRAINT IF EXISTS signing_keys_purpose_check;
+ALTER TABLE signing_keys ADD CONSTRAINT signing_keys_purpose_check CHECK (purpose IN ('access', 'refresh'));
@@ -0,0 +1,30 @@
+ALTER TABLE signing_keys DROP CONSTRAINT IF EXISTS signing_keys_purpose_check;
+ALTER TABLE signing_keys ADD CONSTRAINT signing_keys_purpose_check CHECK (purpose IN ('access', 'refresh', 'id_token'));
+
+-- secret_hash is a bcrypt hash, empty for public clients
+CREATE TABLE IF NOT EXISTS oauth_clients (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	secret_hash TEXT,
+	redirect_uris TEXT NOT NULL,
+	scopes TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS oauth_authorizations (
+	id SERIAL PRIMARY KEY,
+	request_hash TEXT UNIQUE NOT NULL,
+	code_hash TEXT UNIQUE,
+	client_id TEXT NOT NULL REFERENCES oauth_clients (id) ON DELETE CASCADE,
+	redirect_uri TEXT NOT NULL,
+	scope TEXT NOT NULL,
+	state TEXT,
+	nonce TEXT,
+	code_challenge TEXT NOT NULL,
+	user_id INTEGER,
+	auth_time TIMESTAMP,
+	session_id UUID,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
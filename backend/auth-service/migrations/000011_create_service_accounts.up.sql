@@ -0,0 +1,9 @@
+-- secret_hash is a bcrypt hash, scopes are space separated permissions
+CREATE TABLE IF NOT EXISTS service_accounts (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	secret_hash TEXT NOT NULL,
+	scopes TEXT NOT NULL,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+	last_used_at TIMESTAMP
+);
@@ -0,0 +1,15 @@
+-- login_hash, link_hash and code_hash are HMAC-SHA256 digests keyed by REFRESH_TOKEN_HASH_KEY
+CREATE TABLE IF NOT EXISTS email_login_challenges (
+	id SERIAL PRIMARY KEY,
+	user_id INTEGER NOT NULL,
+	email TEXT NOT NULL,
+	login_hash TEXT UNIQUE NOT NULL,
+	link_hash TEXT UNIQUE NOT NULL,
+	code_hash TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	expires_at TIMESTAMP NOT NULL,
+	used_at TIMESTAMP,
+	created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_email_login_challenges_user_id ON email_login_challenges (user_id);
@@ -21,11 +21,20 @@ const (
 	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
 )
 
+// User is the public view of an account, password hashes never leave user-service.
 type User struct {
-	state         protoimpl.MessageState `protogen:"open.v1"`
-	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	Email         string                 `protobuf:"bytes,2,opt,name=email,proto3" json:"email,omitempty"`
-	Password      string                 `protobuf:"bytes,3,opt,name=password,proto3" json:"password,omitempty"`
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Email string                 `protobuf:"bytes,2,opt,name=email,proto3" json:"email,omitempty"`
+	// Deprecated: only set by GetUserByEmail with LEGACY_PASSWORD_HASHES, for auth-service
+	// releases that verify passwords themselves. Removed in the next release.
+	//
+	// Deprecated: Marked as deprecated in user/v1/user.proto.
+	PasswordHash string `protobuf:"bytes,3,opt,name=password_hash,json=passwordHash,proto3" json:"password_hash,omitempty"`
+	// roles and the permissions they grant, embedded in access tokens by auth-service
+	Roles         []string `protobuf:"bytes,4,rep,name=roles,proto3" json:"roles,omitempty"`
+	Permissions   []string `protobuf:"bytes,5,rep,name=permissions,proto3" json:"permissions,omitempty"`
+	EmailVerified bool     `protobuf:"varint,6,opt,name=email_verified,json=emailVerified,proto3" json:"email_verified,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
@@ -74,13 +83,35 @@ func (x *User) GetEmail() string {
 	return ""
 }
 
-func (x *User) GetPassword() string {
+// Deprecated: Marked as deprecated in user/v1/user.proto.
+func (x *User) GetPasswordHash() string {
 	if x != nil {
-		return x.Password
+		return x.PasswordHash
 	}
 	return ""
 }
 
+func (x *User) GetRoles() []string {
+	if x != nil {
+		return x.Roles
+	}
+	return nil
+}
+
+func (x *User) GetPermissions() []string {
+	if x != nil {
+		return x.Permissions
+	}
+	return nil
+}
+
+func (x *User) GetEmailVerified() bool {
+	if x != nil {
+		return x.EmailVerified
+	}
+	return false
+}
+
 type GetUserByEmailRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Email         string                 `protobuf:"bytes,1,opt,name=email,proto3" json:"email,omitempty"`
@@ -345,7 +376,98 @@ func (x *CheckUserExistsByEmailResponse) GetExists() bool {
 	return false
 }
 
-type RegisterUserRequest struct {
+// NormalizeEmail answers InvalidArgument for an email no account can have.
+type NormalizeEmailRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Email         string                 `protobuf:"bytes,1,opt,name=email,proto3" json:"email,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *NormalizeEmailRequest) Reset() {
+	*x = NormalizeEmailRequest{}
+	mi := &file_user_v1_user_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NormalizeEmailRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NormalizeEmailRequest) ProtoMessage() {}
+
+func (x *NormalizeEmailRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_user_v1_user_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NormalizeEmailRequest.ProtoReflect.Descriptor instead.
+func (*NormalizeEmailRequest) Descriptor() ([]byte, []int) {
+	return file_user_v1_user_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *NormalizeEmailRequest) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+type NormalizeEmailResponse struct {
+	state           protoimpl.MessageState `protogen:"open.v1"`
+	EmailNormalized string                 `protobuf:"bytes,1,opt,name=email_normalized,json=emailNormalized,proto3" json:"email_normalized,omitempty"`
+	unknownFields   protoimpl.UnknownFields
+	sizeCache       protoimpl.SizeCache
+}
+
+func (x *NormalizeEmailResponse) Reset() {
+	*x = NormalizeEmailResponse{}
+	mi := &file_user_v1_user_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *NormalizeEmailResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*NormalizeEmailResponse) ProtoMessage() {}
+
+func (x *NormalizeEmailResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_user_v1_user_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use NormalizeEmailResponse.ProtoReflect.Descriptor instead.
+func (*NormalizeEmailResponse) Descriptor() ([]byte, []int) {
+	return file_user_v1_user_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *NormalizeEmailResponse) GetEmailNormalized() string {
+	if x != nil {
+		return x.EmailNormalized
+	}
+	return ""
+}
+
+// Credentials are an email and a password as the user typed it. Only user-service hashes and
+// verifies passwords.
+type Credentials struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Email         string                 `protobuf:"bytes,1,opt,name=email,proto3" json:"email,omitempty"`
 	Password      string                 `protobuf:"bytes,2,opt,name=password,proto3" json:"password,omitempty"`
@@ -353,9 +475,72 @@ type RegisterUserRequest struct {
 	sizeCache     protoimpl.SizeCache
 }
 
+func (x *Credentials) Reset() {
+	*x = Credentials{}
+	mi := &file_user_v1_user_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Credentials) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Credentials) ProtoMessage() {}
+
+func (x *Credentials) ProtoReflect() protoreflect.Message {
+	mi := &file_user_v1_user_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Credentials.ProtoReflect.Descriptor instead.
+func (*Credentials) Descriptor() ([]byte, []int) {
+	return file_user_v1_user_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *Credentials) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *Credentials) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+// RegisterUser answers AlreadyExists for a registered email. A request repeated with the same
+// idempotency_key, email and password within a day gets the user the first one created, with
+// replayed set. The key answers InvalidArgument while it belongs to another registration.
+type RegisterUserRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Deprecated: use credentials. Together with password_hash this registers a password hashed by
+	// auth-service, for releases that hash passwords themselves. Removed in the next release.
+	//
+	// Deprecated: Marked as deprecated in user/v1/user.proto.
+	Email string `protobuf:"bytes,1,opt,name=email,proto3" json:"email,omitempty"`
+	// Deprecated: Marked as deprecated in user/v1/user.proto.
+	PasswordHash string       `protobuf:"bytes,2,opt,name=password_hash,json=passwordHash,proto3" json:"password_hash,omitempty"`
+	Credentials  *Credentials `protobuf:"bytes,3,opt,name=credentials,proto3" json:"credentials,omitempty"`
+	// optional, chosen by the client for each registration it may retry
+	IdempotencyKey string `protobuf:"bytes,4,opt,name=idempotency_key,json=idempotencyKey,proto3" json:"idempotency_key,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
 func (x *RegisterUserRequest) Reset() {
 	*x = RegisterUserRequest{}
-	mi := &file_user_v1_user_proto_msgTypes[7]
+	mi := &file_user_v1_user_proto_msgTypes[10]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -367,7 +552,7 @@ func (x *RegisterUserRequest) String() string {
 func (*RegisterUserRequest) ProtoMessage() {}
 
 func (x *RegisterUserRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_user_v1_user_proto_msgTypes[7]
+	mi := &file_user_v1_user_proto_msgTypes[10]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -380,9 +565,10 @@ func (x *RegisterUserRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use RegisterUserRequest.ProtoReflect.Descriptor instead.
 func (*RegisterUserRequest) Descriptor() ([]byte, []int) {
-	return file_user_v1_user_proto_rawDescGZIP(), []int{7}
+	return file_user_v1_user_proto_rawDescGZIP(), []int{10}
 }
 
+// Deprecated: Marked as deprecated in user/v1/user.proto.
 func (x *RegisterUserRequest) GetEmail() string {
 	if x != nil {
 		return x.Email
@@ -390,9 +576,24 @@ func (x *RegisterUserRequest) GetEmail() string {
 	return ""
 }
 
-func (x *RegisterUserRequest) GetPassword() string {
+// Deprecated: Marked as deprecated in user/v1/user.proto.
+func (x *RegisterUserRequest) GetPasswordHash() string {
 	if x != nil {
-		return x.Password
+		return x.PasswordHash
+	}
+	return ""
+}
+
+func (x *RegisterUserRequest) GetCredentials() *Credentials {
+	if x != nil {
+		return x.Credentials
+	}
+	return nil
+}
+
+func (x *RegisterUserRequest) GetIdempotencyKey() string {
+	if x != nil {
+		return x.IdempotencyKey
 	}
 	return ""
 }
@@ -400,13 +601,14 @@ func (x *RegisterUserRequest) GetPassword() string {
 type RegisterUserResponse struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Replayed      bool                   `protobuf:"varint,2,opt,name=replayed,proto3" json:"replayed,omitempty"`
 	unknownFields protoimpl.UnknownFields
 	sizeCache     protoimpl.SizeCache
 }
 
 func (x *RegisterUserResponse) Reset() {
 	*x = RegisterUserResponse{}
-	mi := &file_user_v1_user_proto_msgTypes[8]
+	mi := &file_user_v1_user_proto_msgTypes[11]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -418,7 +620,7 @@ func (x *RegisterUserResponse) String() string {
 func (*RegisterUserResponse) ProtoMessage() {}
 
 func (x *RegisterUserResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_user_v1_user_proto_msgTypes[8]
+	mi := &file_user_v1_user_proto_msgTypes[11]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -431,7 +633,7 @@ func (x *RegisterUserResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use RegisterUserResponse.ProtoReflect.Descriptor instead.
 func (*RegisterUserResponse) Descriptor() ([]byte, []int) {
-	return file_user_v1_user_proto_rawDescGZIP(), []int{8}
+	return file_user_v1_user_proto_rawDescGZIP(), []int{11}
 }
 
 func (x *RegisterUserResponse) GetId() string {
@@ -441,6 +643,500 @@ func (x *RegisterUserResponse) GetId() string {
 	return ""
 }
 
+func (x *RegisterUserResponse) GetReplayed() bool {
+	if x != nil {
+		return x.Replayed
+	}
+	return false
+}
+
+// DeleteUser rolls back a registration auth-service could not finish. It only removes an account
+// whose email is not verified yet and, if idempotency_key is set, that the registration with the
+// key created, and answers NotFound otherwise.
+type DeleteUserRequest struct {
+	state          protoimpl.MessageState `protogen:"open.v1"`
+	Id             string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	IdempotencyKey string                 `protobuf:"bytes,2,opt,name=idempotency_key,json=idempotencyKey,proto3" json:"idempotency_key,omitempty"`
+	unknownFields  protoimpl.UnknownFields
+	sizeCache      protoimpl.SizeCache
+}
+
+func (x *DeleteUserRequest) Reset() {
+	*x = DeleteUserRequest{}
+	mi := &file_user_v1_user_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteUserRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteUserRequest) ProtoMessage() {}
+
+func (x *DeleteUserRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_user_v1_user_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteUserRequest.ProtoReflect.Descriptor instead.
+func (*DeleteUserRequest) Descriptor() ([]byte, []int) {
+	return file_user_v1_user_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *DeleteUserRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *DeleteUserRequest) GetIdempotencyKey() string {
+	if x != nil {
+		return x.IdempotencyKey
+	}
+	return ""
+}
+
+type DeleteUserResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *DeleteUserResponse) Reset() {
+	*x = DeleteUserResponse{}
+	mi := &file_user_v1_user_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *DeleteUserResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*DeleteUserResponse) ProtoMessage() {}
+
+func (x *DeleteUserResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_user_v1_user_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use DeleteUserResponse.ProtoReflect.Descriptor instead.
+func (*DeleteUserResponse) Descriptor() ([]byte, []int) {
+	return file_user_v1_user_proto_rawDescGZIP(), []int{13}
+}
+
+// VerifyCredentials answers NotFound for emails without an account, after as long as a wrong
+// password takes.
+type VerifyCredentialsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Credentials   *Credentials           `protobuf:"bytes,1,opt,name=credentials,proto3" json:"credentials,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VerifyCredentialsRequest) Reset() {
+	*x = VerifyCredentialsRequest{}
+	mi := &file_user_v1_user_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VerifyCredentialsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VerifyCredentialsRequest) ProtoMessage() {}
+
+func (x *VerifyCredentialsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_user_v1_user_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VerifyCredentialsRequest.ProtoReflect.Descriptor instead.
+func (*VerifyCredentialsRequest) Descriptor() ([]byte, []int) {
+	return file_user_v1_user_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *VerifyCredentialsRequest) GetCredentials() *Credentials {
+	if x != nil {
+		return x.Credentials
+	}
+	return nil
+}
+
+type VerifyCredentialsResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// valid is false for a wrong password, the user is returned either way
+	Valid         bool  `protobuf:"varint,1,opt,name=valid,proto3" json:"valid,omitempty"`
+	User          *User `protobuf:"bytes,2,opt,name=user,proto3" json:"user,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *VerifyCredentialsResponse) Reset() {
+	*x = VerifyCredentialsResponse{}
+	mi := &file_user_v1_user_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *VerifyCredentialsResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*VerifyCredentialsResponse) ProtoMessage() {}
+
+func (x *VerifyCredentialsResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_user_v1_user_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use VerifyCredentialsResponse.ProtoReflect.Descriptor instead.
+func (*VerifyCredentialsResponse) Descriptor() ([]byte, []int) {
+	return file_user_v1_user_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *VerifyCredentialsResponse) GetValid() bool {
+	if x != nil {
+		return x.Valid
+	}
+	return false
+}
+
+func (x *VerifyCredentialsResponse) GetUser() *User {
+	if x != nil {
+		return x.User
+	}
+	return nil
+}
+
+type UpdatePasswordRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Deprecated: use password. A password hashed by auth-service, for releases that hash
+	// passwords themselves. Removed in the next release.
+	//
+	// Deprecated: Marked as deprecated in user/v1/user.proto.
+	PasswordHash string `protobuf:"bytes,2,opt,name=password_hash,json=passwordHash,proto3" json:"password_hash,omitempty"`
+	// the new password as the user typed it
+	Password      string `protobuf:"bytes,3,opt,name=password,proto3" json:"password,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdatePasswordRequest) Reset() {
+	*x = UpdatePasswordRequest{}
+	mi := &file_user_v1_user_proto_msgTypes[16]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdatePasswordRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdatePasswordRequest) ProtoMessage() {}
+
+func (x *UpdatePasswordRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_user_v1_user_proto_msgTypes[16]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdatePasswordRequest.ProtoReflect.Descriptor instead.
+func (*UpdatePasswordRequest) Descriptor() ([]byte, []int) {
+	return file_user_v1_user_proto_rawDescGZIP(), []int{16}
+}
+
+func (x *UpdatePasswordRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+// Deprecated: Marked as deprecated in user/v1/user.proto.
+func (x *UpdatePasswordRequest) GetPasswordHash() string {
+	if x != nil {
+		return x.PasswordHash
+	}
+	return ""
+}
+
+func (x *UpdatePasswordRequest) GetPassword() string {
+	if x != nil {
+		return x.Password
+	}
+	return ""
+}
+
+type UpdatePasswordResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UpdatePasswordResponse) Reset() {
+	*x = UpdatePasswordResponse{}
+	mi := &file_user_v1_user_proto_msgTypes[17]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdatePasswordResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdatePasswordResponse) ProtoMessage() {}
+
+func (x *UpdatePasswordResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_user_v1_user_proto_msgTypes[17]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdatePasswordResponse.ProtoReflect.Descriptor instead.
+func (*UpdatePasswordResponse) Descriptor() ([]byte, []int) {
+	return file_user_v1_user_proto_rawDescGZIP(), []int{17}
+}
+
+type MarkEmailVerifiedRequest struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	// the address that was verified: the user's email, or the one they asked to change to, which
+	// then replaces it. Ignored if it is neither anymore.
+	Email         string `protobuf:"bytes,2,opt,name=email,proto3" json:"email,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MarkEmailVerifiedRequest) Reset() {
+	*x = MarkEmailVerifiedRequest{}
+	mi := &file_user_v1_user_proto_msgTypes[18]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MarkEmailVerifiedRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MarkEmailVerifiedRequest) ProtoMessage() {}
+
+func (x *MarkEmailVerifiedRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_user_v1_user_proto_msgTypes[18]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MarkEmailVerifiedRequest.ProtoReflect.Descriptor instead.
+func (*MarkEmailVerifiedRequest) Descriptor() ([]byte, []int) {
+	return file_user_v1_user_proto_rawDescGZIP(), []int{18}
+}
+
+func (x *MarkEmailVerifiedRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *MarkEmailVerifiedRequest) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+type MarkEmailVerifiedResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Verified      bool                   `protobuf:"varint,1,opt,name=verified,proto3" json:"verified,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MarkEmailVerifiedResponse) Reset() {
+	*x = MarkEmailVerifiedResponse{}
+	mi := &file_user_v1_user_proto_msgTypes[19]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MarkEmailVerifiedResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MarkEmailVerifiedResponse) ProtoMessage() {}
+
+func (x *MarkEmailVerifiedResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_user_v1_user_proto_msgTypes[19]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MarkEmailVerifiedResponse.ProtoReflect.Descriptor instead.
+func (*MarkEmailVerifiedResponse) Descriptor() ([]byte, []int) {
+	return file_user_v1_user_proto_rawDescGZIP(), []int{19}
+}
+
+func (x *MarkEmailVerifiedResponse) GetVerified() bool {
+	if x != nil {
+		return x.Verified
+	}
+	return false
+}
+
+type RequestEmailChangeRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Id            string                 `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Email         string                 `protobuf:"bytes,2,opt,name=email,proto3" json:"email,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RequestEmailChangeRequest) Reset() {
+	*x = RequestEmailChangeRequest{}
+	mi := &file_user_v1_user_proto_msgTypes[20]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RequestEmailChangeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RequestEmailChangeRequest) ProtoMessage() {}
+
+func (x *RequestEmailChangeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_user_v1_user_proto_msgTypes[20]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RequestEmailChangeRequest.ProtoReflect.Descriptor instead.
+func (*RequestEmailChangeRequest) Descriptor() ([]byte, []int) {
+	return file_user_v1_user_proto_rawDescGZIP(), []int{20}
+}
+
+func (x *RequestEmailChangeRequest) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *RequestEmailChangeRequest) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+type RequestEmailChangeResponse struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// the new email as it will be stored, the verification link goes there
+	Email         string `protobuf:"bytes,1,opt,name=email,proto3" json:"email,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *RequestEmailChangeResponse) Reset() {
+	*x = RequestEmailChangeResponse{}
+	mi := &file_user_v1_user_proto_msgTypes[21]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RequestEmailChangeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RequestEmailChangeResponse) ProtoMessage() {}
+
+func (x *RequestEmailChangeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_user_v1_user_proto_msgTypes[21]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RequestEmailChangeResponse.ProtoReflect.Descriptor instead.
+func (*RequestEmailChangeResponse) Descriptor() ([]byte, []int) {
+	return file_user_v1_user_proto_rawDescGZIP(), []int{21}
+}
+
+func (x *RequestEmailChangeResponse) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
 type GetAllUsersRequest struct {
 	state         protoimpl.MessageState `protogen:"open.v1"`
 	unknownFields protoimpl.UnknownFields
@@ -449,7 +1145,7 @@ type GetAllUsersRequest struct {
 
 func (x *GetAllUsersRequest) Reset() {
 	*x = GetAllUsersRequest{}
-	mi := &file_user_v1_user_proto_msgTypes[9]
+	mi := &file_user_v1_user_proto_msgTypes[22]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -461,7 +1157,7 @@ func (x *GetAllUsersRequest) String() string {
 func (*GetAllUsersRequest) ProtoMessage() {}
 
 func (x *GetAllUsersRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_user_v1_user_proto_msgTypes[9]
+	mi := &file_user_v1_user_proto_msgTypes[22]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -474,7 +1170,7 @@ func (x *GetAllUsersRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetAllUsersRequest.ProtoReflect.Descriptor instead.
 func (*GetAllUsersRequest) Descriptor() ([]byte, []int) {
-	return file_user_v1_user_proto_rawDescGZIP(), []int{9}
+	return file_user_v1_user_proto_rawDescGZIP(), []int{22}
 }
 
 type GetAllUsersResponse struct {
@@ -486,7 +1182,7 @@ type GetAllUsersResponse struct {
 
 func (x *GetAllUsersResponse) Reset() {
 	*x = GetAllUsersResponse{}
-	mi := &file_user_v1_user_proto_msgTypes[10]
+	mi := &file_user_v1_user_proto_msgTypes[23]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -498,7 +1194,7 @@ func (x *GetAllUsersResponse) String() string {
 func (*GetAllUsersResponse) ProtoMessage() {}
 
 func (x *GetAllUsersResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_user_v1_user_proto_msgTypes[10]
+	mi := &file_user_v1_user_proto_msgTypes[23]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -511,7 +1207,7 @@ func (x *GetAllUsersResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetAllUsersResponse.ProtoReflect.Descriptor instead.
 func (*GetAllUsersResponse) Descriptor() ([]byte, []int) {
-	return file_user_v1_user_proto_rawDescGZIP(), []int{10}
+	return file_user_v1_user_proto_rawDescGZIP(), []int{23}
 }
 
 func (x *GetAllUsersResponse) GetUsers() []*User {
@@ -529,7 +1225,7 @@ type GetUsersCountRequest struct {
 
 func (x *GetUsersCountRequest) Reset() {
 	*x = GetUsersCountRequest{}
-	mi := &file_user_v1_user_proto_msgTypes[11]
+	mi := &file_user_v1_user_proto_msgTypes[24]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -541,7 +1237,7 @@ func (x *GetUsersCountRequest) String() string {
 func (*GetUsersCountRequest) ProtoMessage() {}
 
 func (x *GetUsersCountRequest) ProtoReflect() protoreflect.Message {
-	mi := &file_user_v1_user_proto_msgTypes[11]
+	mi := &file_user_v1_user_proto_msgTypes[24]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -554,7 +1250,7 @@ func (x *GetUsersCountRequest) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetUsersCountRequest.ProtoReflect.Descriptor instead.
 func (*GetUsersCountRequest) Descriptor() ([]byte, []int) {
-	return file_user_v1_user_proto_rawDescGZIP(), []int{11}
+	return file_user_v1_user_proto_rawDescGZIP(), []int{24}
 }
 
 type GetUsersCountResponse struct {
@@ -566,7 +1262,7 @@ type GetUsersCountResponse struct {
 
 func (x *GetUsersCountResponse) Reset() {
 	*x = GetUsersCountResponse{}
-	mi := &file_user_v1_user_proto_msgTypes[12]
+	mi := &file_user_v1_user_proto_msgTypes[25]
 	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 	ms.StoreMessageInfo(mi)
 }
@@ -578,7 +1274,7 @@ func (x *GetUsersCountResponse) String() string {
 func (*GetUsersCountResponse) ProtoMessage() {}
 
 func (x *GetUsersCountResponse) ProtoReflect() protoreflect.Message {
-	mi := &file_user_v1_user_proto_msgTypes[12]
+	mi := &file_user_v1_user_proto_msgTypes[25]
 	if x != nil {
 		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
 		if ms.LoadMessageInfo() == nil {
@@ -591,7 +1287,7 @@ func (x *GetUsersCountResponse) ProtoReflect() protoreflect.Message {
 
 // Deprecated: Use GetUsersCountResponse.ProtoReflect.Descriptor instead.
 func (*GetUsersCountResponse) Descriptor() ([]byte, []int) {
-	return file_user_v1_user_proto_rawDescGZIP(), []int{12}
+	return file_user_v1_user_proto_rawDescGZIP(), []int{25}
 }
 
 func (x *GetUsersCountResponse) GetCount() int32 {
@@ -605,11 +1301,14 @@ var File_user_v1_user_proto protoreflect.FileDescriptor
 
 const file_user_v1_user_proto_rawDesc = "" +
 	"\n" +
-	"\x12user/v1/user.proto\x12\auser.v1\"H\n" +
+	"\x12user/v1/user.proto\x12\auser.v1\"\xb4\x01\n" +
 	"\x04User\x12\x0e\n" +
 	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
-	"\x05email\x18\x02 \x01(\tR\x05email\x12\x1a\n" +
-	"\bpassword\x18\x03 \x01(\tR\bpassword\"-\n" +
+	"\x05email\x18\x02 \x01(\tR\x05email\x12'\n" +
+	"\rpassword_hash\x18\x03 \x01(\tB\x02\x18\x01R\fpasswordHash\x12\x14\n" +
+	"\x05roles\x18\x04 \x03(\tR\x05roles\x12 \n" +
+	"\vpermissions\x18\x05 \x03(\tR\vpermissions\x12%\n" +
+	"\x0eemail_verified\x18\x06 \x01(\bR\remailVerified\"-\n" +
 	"\x15GetUserByEmailRequest\x12\x14\n" +
 	"\x05email\x18\x01 \x01(\tR\x05email\";\n" +
 	"\x16GetUserByEmailResponse\x12!\n" +
@@ -621,23 +1320,64 @@ const file_user_v1_user_proto_rawDesc = "" +
 	"\x1dCheckUserExistsByEmailRequest\x12\x14\n" +
 	"\x05email\x18\x01 \x01(\tR\x05email\"8\n" +
 	"\x1eCheckUserExistsByEmailResponse\x12\x16\n" +
-	"\x06exists\x18\x01 \x01(\bR\x06exists\"G\n" +
-	"\x13RegisterUserRequest\x12\x14\n" +
+	"\x06exists\x18\x01 \x01(\bR\x06exists\"-\n" +
+	"\x15NormalizeEmailRequest\x12\x14\n" +
+	"\x05email\x18\x01 \x01(\tR\x05email\"C\n" +
+	"\x16NormalizeEmailResponse\x12)\n" +
+	"\x10email_normalized\x18\x01 \x01(\tR\x0femailNormalized\"?\n" +
+	"\vCredentials\x12\x14\n" +
 	"\x05email\x18\x01 \x01(\tR\x05email\x12\x1a\n" +
-	"\bpassword\x18\x02 \x01(\tR\bpassword\"&\n" +
+	"\bpassword\x18\x02 \x01(\tR\bpassword\"\xb9\x01\n" +
+	"\x13RegisterUserRequest\x12\x18\n" +
+	"\x05email\x18\x01 \x01(\tB\x02\x18\x01R\x05email\x12'\n" +
+	"\rpassword_hash\x18\x02 \x01(\tB\x02\x18\x01R\fpasswordHash\x126\n" +
+	"\vcredentials\x18\x03 \x01(\v2\x14.user.v1.CredentialsR\vcredentials\x12'\n" +
+	"\x0fidempotency_key\x18\x04 \x01(\tR\x0eidempotencyKey\"B\n" +
 	"\x14RegisterUserResponse\x12\x0e\n" +
-	"\x02id\x18\x01 \x01(\tR\x02id\"\x14\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x1a\n" +
+	"\breplayed\x18\x02 \x01(\bR\breplayed\"L\n" +
+	"\x11DeleteUserRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12'\n" +
+	"\x0fidempotency_key\x18\x02 \x01(\tR\x0eidempotencyKey\"\x14\n" +
+	"\x12DeleteUserResponse\"R\n" +
+	"\x18VerifyCredentialsRequest\x126\n" +
+	"\vcredentials\x18\x01 \x01(\v2\x14.user.v1.CredentialsR\vcredentials\"T\n" +
+	"\x19VerifyCredentialsResponse\x12\x14\n" +
+	"\x05valid\x18\x01 \x01(\bR\x05valid\x12!\n" +
+	"\x04user\x18\x02 \x01(\v2\r.user.v1.UserR\x04user\"l\n" +
+	"\x15UpdatePasswordRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12'\n" +
+	"\rpassword_hash\x18\x02 \x01(\tB\x02\x18\x01R\fpasswordHash\x12\x1a\n" +
+	"\bpassword\x18\x03 \x01(\tR\bpassword\"\x18\n" +
+	"\x16UpdatePasswordResponse\"@\n" +
+	"\x18MarkEmailVerifiedRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05email\x18\x02 \x01(\tR\x05email\"7\n" +
+	"\x19MarkEmailVerifiedResponse\x12\x1a\n" +
+	"\bverified\x18\x01 \x01(\bR\bverified\"A\n" +
+	"\x19RequestEmailChangeRequest\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\tR\x02id\x12\x14\n" +
+	"\x05email\x18\x02 \x01(\tR\x05email\"2\n" +
+	"\x1aRequestEmailChangeResponse\x12\x14\n" +
+	"\x05email\x18\x01 \x01(\tR\x05email\"\x14\n" +
 	"\x12GetAllUsersRequest\":\n" +
 	"\x13GetAllUsersResponse\x12#\n" +
 	"\x05users\x18\x01 \x03(\v2\r.user.v1.UserR\x05users\"\x16\n" +
 	"\x14GetUsersCountRequest\"-\n" +
 	"\x15GetUsersCountResponse\x12\x14\n" +
-	"\x05count\x18\x01 \x01(\x05R\x05count2\xfc\x03\n" +
+	"\x05count\x18\x01 \x01(\x05R\x05count2\x80\b\n" +
 	"\vUserService\x12Q\n" +
 	"\x0eGetUserByEmail\x12\x1e.user.v1.GetUserByEmailRequest\x1a\x1f.user.v1.GetUserByEmailResponse\x12H\n" +
 	"\vGetUserByID\x12\x1b.user.v1.GetUserByIDRequest\x1a\x1c.user.v1.GetUserByIDResponse\x12i\n" +
-	"\x16CheckUserExistsByEmail\x12&.user.v1.CheckUserExistsByEmailRequest\x1a'.user.v1.CheckUserExistsByEmailResponse\x12K\n" +
-	"\fRegisterUser\x12\x1c.user.v1.RegisterUserRequest\x1a\x1d.user.v1.RegisterUserResponse\x12H\n" +
+	"\x16CheckUserExistsByEmail\x12&.user.v1.CheckUserExistsByEmailRequest\x1a'.user.v1.CheckUserExistsByEmailResponse\x12Q\n" +
+	"\x0eNormalizeEmail\x12\x1e.user.v1.NormalizeEmailRequest\x1a\x1f.user.v1.NormalizeEmailResponse\x12K\n" +
+	"\fRegisterUser\x12\x1c.user.v1.RegisterUserRequest\x1a\x1d.user.v1.RegisterUserResponse\x12E\n" +
+	"\n" +
+	"DeleteUser\x12\x1a.user.v1.DeleteUserRequest\x1a\x1b.user.v1.DeleteUserResponse\x12Z\n" +
+	"\x11VerifyCredentials\x12!.user.v1.VerifyCredentialsRequest\x1a\".user.v1.VerifyCredentialsResponse\x12Q\n" +
+	"\x0eUpdatePassword\x12\x1e.user.v1.UpdatePasswordRequest\x1a\x1f.user.v1.UpdatePasswordResponse\x12Z\n" +
+	"\x11MarkEmailVerified\x12!.user.v1.MarkEmailVerifiedRequest\x1a\".user.v1.MarkEmailVerifiedResponse\x12]\n" +
+	"\x12RequestEmailChange\x12\".user.v1.RequestEmailChangeRequest\x1a#.user.v1.RequestEmailChangeResponse\x12H\n" +
 	"\vGetAllUsers\x12\x1b.user.v1.GetAllUsersRequest\x1a\x1c.user.v1.GetAllUsersResponse\x12N\n" +
 	"\rGetUsersCount\x12\x1d.user.v1.GetUsersCountRequest\x1a\x1e.user.v1.GetUsersCountResponseBu\n" +
 	"\vcom.user.v1B\tUserProtoP\x01Z\x1ego-jwt-auth/gen/user/v1;userv1\xa2\x02\x03UXX\xaa\x02\aUser.V1\xca\x02\aUser\\V1\xe2\x02\x13User\\V1\\GPBMetadata\xea\x02\bUser::V1b\x06proto3"
@@ -654,7 +1394,7 @@ func file_user_v1_user_proto_rawDescGZIP() []byte {
 	return file_user_v1_user_proto_rawDescData
 }
 
-var file_user_v1_user_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
+var file_user_v1_user_proto_msgTypes = make([]protoimpl.MessageInfo, 26)
 var file_user_v1_user_proto_goTypes = []any{
 	(*User)(nil),                           // 0: user.v1.User
 	(*GetUserByEmailRequest)(nil),          // 1: user.v1.GetUserByEmailRequest
@@ -663,34 +1403,62 @@ var file_user_v1_user_proto_goTypes = []any{
 	(*GetUserByIDResponse)(nil),            // 4: user.v1.GetUserByIDResponse
 	(*CheckUserExistsByEmailRequest)(nil),  // 5: user.v1.CheckUserExistsByEmailRequest
 	(*CheckUserExistsByEmailResponse)(nil), // 6: user.v1.CheckUserExistsByEmailResponse
-	(*RegisterUserRequest)(nil),            // 7: user.v1.RegisterUserRequest
-	(*RegisterUserResponse)(nil),           // 8: user.v1.RegisterUserResponse
-	(*GetAllUsersRequest)(nil),             // 9: user.v1.GetAllUsersRequest
-	(*GetAllUsersResponse)(nil),            // 10: user.v1.GetAllUsersResponse
-	(*GetUsersCountRequest)(nil),           // 11: user.v1.GetUsersCountRequest
-	(*GetUsersCountResponse)(nil),          // 12: user.v1.GetUsersCountResponse
+	(*NormalizeEmailRequest)(nil),          // 7: user.v1.NormalizeEmailRequest
+	(*NormalizeEmailResponse)(nil),         // 8: user.v1.NormalizeEmailResponse
+	(*Credentials)(nil),                    // 9: user.v1.Credentials
+	(*RegisterUserRequest)(nil),            // 10: user.v1.RegisterUserRequest
+	(*RegisterUserResponse)(nil),           // 11: user.v1.RegisterUserResponse
+	(*DeleteUserRequest)(nil),              // 12: user.v1.DeleteUserRequest
+	(*DeleteUserResponse)(nil),             // 13: user.v1.DeleteUserResponse
+	(*VerifyCredentialsRequest)(nil),       // 14: user.v1.VerifyCredentialsRequest
+	(*VerifyCredentialsResponse)(nil),      // 15: user.v1.VerifyCredentialsResponse
+	(*UpdatePasswordRequest)(nil),          // 16: user.v1.UpdatePasswordRequest
+	(*UpdatePasswordResponse)(nil),         // 17: user.v1.UpdatePasswordResponse
+	(*MarkEmailVerifiedRequest)(nil),       // 18: user.v1.MarkEmailVerifiedRequest
+	(*MarkEmailVerifiedResponse)(nil),      // 19: user.v1.MarkEmailVerifiedResponse
+	(*RequestEmailChangeRequest)(nil),      // 20: user.v1.RequestEmailChangeRequest
+	(*RequestEmailChangeResponse)(nil),     // 21: user.v1.RequestEmailChangeResponse
+	(*GetAllUsersRequest)(nil),             // 22: user.v1.GetAllUsersRequest
+	(*GetAllUsersResponse)(nil),            // 23: user.v1.GetAllUsersResponse
+	(*GetUsersCountRequest)(nil),           // 24: user.v1.GetUsersCountRequest
+	(*GetUsersCountResponse)(nil),          // 25: user.v1.GetUsersCountResponse
 }
 var file_user_v1_user_proto_depIdxs = []int32{
 	0,  // 0: user.v1.GetUserByEmailResponse.user:type_name -> user.v1.User
 	0,  // 1: user.v1.GetUserByIDResponse.user:type_name -> user.v1.User
-	0,  // 2: user.v1.GetAllUsersResponse.users:type_name -> user.v1.User
-	1,  // 3: user.v1.UserService.GetUserByEmail:input_type -> user.v1.GetUserByEmailRequest
-	3,  // 4: user.v1.UserService.GetUserByID:input_type -> user.v1.GetUserByIDRequest
-	5,  // 5: user.v1.UserService.CheckUserExistsByEmail:input_type -> user.v1.CheckUserExistsByEmailRequest
-	7,  // 6: user.v1.UserService.RegisterUser:input_type -> user.v1.RegisterUserRequest
-	9,  // 7: user.v1.UserService.GetAllUsers:input_type -> user.v1.GetAllUsersRequest
-	11, // 8: user.v1.UserService.GetUsersCount:input_type -> user.v1.GetUsersCountRequest
-	2,  // 9: user.v1.UserService.GetUserByEmail:output_type -> user.v1.GetUserByEmailResponse
-	4,  // 10: user.v1.UserService.GetUserByID:output_type -> user.v1.GetUserByIDResponse
-	6,  // 11: user.v1.UserService.CheckUserExistsByEmail:output_type -> user.v1.CheckUserExistsByEmailResponse
-	8,  // 12: user.v1.UserService.RegisterUser:output_type -> user.v1.RegisterUserResponse
-	10, // 13: user.v1.UserService.GetAllUsers:output_type -> user.v1.GetAllUsersResponse
-	12, // 14: user.v1.UserService.GetUsersCount:output_type -> user.v1.GetUsersCountResponse
-	9,  // [9:15] is the sub-list for method output_type
-	3,  // [3:9] is the sub-list for method input_type
-	3,  // [3:3] is the sub-list for extension type_name
-	3,  // [3:3] is the sub-list for extension extendee
-	0,  // [0:3] is the sub-list for field type_name
+	9,  // 2: user.v1.RegisterUserRequest.credentials:type_name -> user.v1.Credentials
+	9,  // 3: user.v1.VerifyCredentialsRequest.credentials:type_name -> user.v1.Credentials
+	0,  // 4: user.v1.VerifyCredentialsResponse.user:type_name -> user.v1.User
+	0,  // 5: user.v1.GetAllUsersResponse.users:type_name -> user.v1.User
+	1,  // 6: user.v1.UserService.GetUserByEmail:input_type -> user.v1.GetUserByEmailRequest
+	3,  // 7: user.v1.UserService.GetUserByID:input_type -> user.v1.GetUserByIDRequest
+	5,  // 8: user.v1.UserService.CheckUserExistsByEmail:input_type -> user.v1.CheckUserExistsByEmailRequest
+	7,  // 9: user.v1.UserService.NormalizeEmail:input_type -> user.v1.NormalizeEmailRequest
+	10, // 10: user.v1.UserService.RegisterUser:input_type -> user.v1.RegisterUserRequest
+	12, // 11: user.v1.UserService.DeleteUser:input_type -> user.v1.DeleteUserRequest
+	14, // 12: user.v1.UserService.VerifyCredentials:input_type -> user.v1.VerifyCredentialsRequest
+	16, // 13: user.v1.UserService.UpdatePassword:input_type -> user.v1.UpdatePasswordRequest
+	18, // 14: user.v1.UserService.MarkEmailVerified:input_type -> user.v1.MarkEmailVerifiedRequest
+	20, // 15: user.v1.UserService.RequestEmailChange:input_type -> user.v1.RequestEmailChangeRequest
+	22, // 16: user.v1.UserService.GetAllUsers:input_type -> user.v1.GetAllUsersRequest
+	24, // 17: user.v1.UserService.GetUsersCount:input_type -> user.v1.GetUsersCountRequest
+	2,  // 18: user.v1.UserService.GetUserByEmail:output_type -> user.v1.GetUserByEmailResponse
+	4,  // 19: user.v1.UserService.GetUserByID:output_type -> user.v1.GetUserByIDResponse
+	6,  // 20: user.v1.UserService.CheckUserExistsByEmail:output_type -> user.v1.CheckUserExistsByEmailResponse
+	8,  // 21: user.v1.UserService.NormalizeEmail:output_type -> user.v1.NormalizeEmailResponse
+	11, // 22: user.v1.UserService.RegisterUser:output_type -> user.v1.RegisterUserResponse
+	13, // 23: user.v1.UserService.DeleteUser:output_type -> user.v1.DeleteUserResponse
+	15, // 24: user.v1.UserService.VerifyCredentials:output_type -> user.v1.VerifyCredentialsResponse
+	17, // 25: user.v1.UserService.UpdatePassword:output_type -> user.v1.UpdatePasswordResponse
+	19, // 26: user.v1.UserService.MarkEmailVerified:output_type -> user.v1.MarkEmailVerifiedResponse
+	21, // 27: user.v1.UserService.RequestEmailChange:output_type -> user.v1.RequestEmailChangeResponse
+	23, // 28: user.v1.UserService.GetAllUsers:output_type -> user.v1.GetAllUsersResponse
+	25, // 29: user.v1.UserService.GetUsersCount:output_type -> user.v1.GetUsersCountResponse
+	18, // [18:30] is the sub-list for method output_type
+	6,  // [6:18] is the sub-list for method input_type
+	6,  // [6:6] is the sub-list for extension type_name
+	6,  // [6:6] is the sub-list for extension extendee
+	0,  // [0:6] is the sub-list for field type_name
 }
 
 func init() { file_user_v1_user_proto_init() }
@@ -704,7 +1472,7 @@ func file_user_v1_user_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: unsafe.Slice(unsafe.StringData(file_user_v1_user_proto_rawDesc), len(file_user_v1_user_proto_rawDesc)),
 			NumEnums:      0,
-			NumMessages:   13,
+			NumMessages:   26,
 			NumExtensions: 0,
 			NumServices:   1,
 		},
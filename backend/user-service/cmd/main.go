@@ -1,7 +1,18 @@
 package main
 
-import "user-service/internal/app"
+import (
+	"os"
+	"user-service/internal/app"
+)
 
 func main() {
+	// normalize-emails applies changed email normalization rules to the existing accounts
+	if len(os.Args) > 1 && os.Args[1] == "normalize-emails" {
+		if err := app.NormalizeEmails(); err != nil {
+			os.Exit(1)
+		}
+		return
+	}
+
 	app.Run()
 }
@@ -10,6 +10,7 @@ import (
 	grpcHandler "user-service/internal/handler/grpc"
 	httpHandler "user-service/internal/handler/http"
 	"user-service/internal/logger"
+	"user-service/internal/passwordhash"
 	"user-service/internal/repository"
 	"user-service/internal/router"
 	"user-service/internal/server"
@@ -19,6 +20,36 @@ import (
 	"github.com/gofiber/fiber/v2"
 )
 
+// NormalizeEmails runs service.UserService.NormalizeEmails once and exits, after the rules of the
+// email normalizer changed. It is a command and not part of Run, so replicas starting together do
+// not race on the same accounts.
+func NormalizeEmails() error {
+	cfg := config.GetConfig()
+	logger.Init(cfg.AppEnv)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	postgresGORM, err := storage.NewPostgresGORM(ctx, cfg.Postgres)
+	if err != nil {
+		logger.Log.Fatal().Err(err).Msg("Error occurred while initializing postgres")
+	}
+	defer postgresGORM.Close()
+
+	passwordHasher, err := passwordhash.NewHasher(cfg.PasswordHash)
+	if err != nil {
+		logger.Log.Fatal().Err(err).Msg("Error occurred while setting up password hashing")
+	}
+	userService := service.NewUserService(repository.NewUserGormRepository(postgresGORM.DB), repository.NewRoleGormRepository(postgresGORM.DB), passwordHasher, cfg)
+
+	if err := userService.NormalizeEmails(ctx); err != nil {
+		logger.Log.Error().Err(err).Msg("Error normalizing emails")
+		return err
+	}
+	logger.Log.Info().Msg("Emails normalized")
+	return nil
+}
+
 func Run() {
 	cfg := config.GetConfig()
 	logger.Init(cfg.AppEnv)
@@ -33,7 +64,16 @@ func Run() {
 	defer postgresGORM.Close()
 
 	userRepository := repository.NewUserGormRepository(postgresGORM.DB)
-	userService := service.NewUserService(userRepository)
+	roleRepository := repository.NewRoleGormRepository(postgresGORM.DB)
+	passwordHasher, err := passwordhash.NewHasher(cfg.PasswordHash)
+	if err != nil {
+		logger.Log.Fatal().Err(err).Msg("Error occurred while setting up password hashing")
+	}
+	userService := service.NewUserService(userRepository, roleRepository, passwordHasher, cfg)
+
+	if err := userService.BootstrapAdmin(ctx); err != nil {
+		logger.Log.Error().Err(err).Msg("Error granting the bootstrap admin role")
+	}
 
 	userHttpHandlers := httpHandler.NewUserHandler(userService)
 	userGrpcHandlers := grpcHandler.NewUserHandler(userService)
@@ -45,7 +85,7 @@ func Run() {
 		DisableStartupMessage: cfg.AppEnv == "production",
 	})
 
-	router.SetupRoutes(app, userHttpHandlers, postgresGORM.DB)
+	router.SetupRoutes(app, userHttpHandlers, userService, postgresGORM.DB, cfg)
 
 	grpcServer := &server.GRPCServer{}
 
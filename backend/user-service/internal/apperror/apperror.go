@@ -0,0 +1,83 @@
+package apperror
+
+import (
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/protoadapt"
+)
+
+// Domain is sent in the error details, so callers know which service a reason belongs to.
+const Domain = "user-service"
+
+// Kind is the class of an error the handlers map to a status. errors.Is(err, apperror.NotFound)
+// matches every error of the kind.
+type Kind string
+
+const (
+	NotFound        Kind = "not found"
+	AlreadyExists   Kind = "already exists"
+	InvalidArgument Kind = "invalid argument"
+)
+
+func (k Kind) Error() string {
+	return string(k)
+}
+
+// Error is an error callers of user-service can act on. Reason is stable for clients, Message
+// is for people and Field names the request field an InvalidArgument error is about.
+type Error struct {
+	Kind    Kind
+	Reason  string
+	Message string
+	Field   string
+}
+
+func New(kind Kind, reason, message string) *Error {
+	return &Error{Kind: kind, Reason: reason, Message: message}
+}
+
+// Invalid is an InvalidArgument error about one field of the request.
+func Invalid(field, reason, message string) *Error {
+	return &Error{Kind: InvalidArgument, Reason: reason, Message: message, Field: field}
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Is(target error) bool {
+	kind, ok := target.(Kind)
+	return ok && kind == e.Kind
+}
+
+// GRPCStatus carries the reason as ErrorInfo and the field as a BadRequest violation.
+func (e *Error) GRPCStatus() *status.Status {
+	code := codes.Internal
+	switch e.Kind {
+	case NotFound:
+		code = codes.NotFound
+	case AlreadyExists:
+		code = codes.AlreadyExists
+	case InvalidArgument:
+		code = codes.InvalidArgument
+	}
+
+	st := status.New(code, e.Message)
+	details := []protoadapt.MessageV1{&errdetails.ErrorInfo{Reason: e.Reason, Domain: Domain}}
+	if e.Field != "" {
+		details = append(details, &errdetails.BadRequest{
+			FieldViolations: []*errdetails.BadRequest_FieldViolation{{
+				Field:       e.Field,
+				Description: e.Message,
+				Reason:      e.Reason,
+			}},
+		})
+	}
+
+	withDetails, err := st.WithDetails(details...)
+	if err != nil {
+		return st
+	}
+	return withDetails
+}
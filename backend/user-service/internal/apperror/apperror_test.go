@@ -0,0 +1,68 @@
+package apperror
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+)
+
+func TestError_GRPCStatus(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       *Error
+		wantCode  codes.Code
+		wantField string
+	}{
+		{"not found", New(NotFound, "USER_NOT_FOUND", "user not found"), codes.NotFound, ""},
+		{"already exists", New(AlreadyExists, "EMAIL_TAKEN", "user already exists"), codes.AlreadyExists, ""},
+		{"invalid argument", New(InvalidArgument, "REQUIRED", "id is required"), codes.InvalidArgument, ""},
+		{"invalid field", Invalid("email", "INVALID", "email must be a valid address"), codes.InvalidArgument, "email"},
+		{"unknown kind", New("gone", "GONE", "gone"), codes.Internal, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			st := tc.err.GRPCStatus()
+			if st.Code() != tc.wantCode || st.Message() != tc.err.Message {
+				t.Errorf("GRPCStatus() = %v %q, want %v %q", st.Code(), st.Message(), tc.wantCode, tc.err.Message)
+			}
+
+			var info *errdetails.ErrorInfo
+			var violations []*errdetails.BadRequest_FieldViolation
+			for _, detail := range st.Details() {
+				switch detail := detail.(type) {
+				case *errdetails.ErrorInfo:
+					info = detail
+				case *errdetails.BadRequest:
+					violations = append(violations, detail.FieldViolations...)
+				}
+			}
+			if info == nil || info.Reason != tc.err.Reason || info.Domain != Domain {
+				t.Errorf("ErrorInfo = %v, want reason %s in %s", info, tc.err.Reason, Domain)
+			}
+
+			if tc.wantField == "" {
+				if len(violations) != 0 {
+					t.Errorf("field violations = %v, want none", violations)
+				}
+				return
+			}
+			if len(violations) != 1 || violations[0].Field != tc.wantField || violations[0].Reason != tc.err.Reason {
+				t.Errorf("field violations = %v, want one for %s with reason %s", violations, tc.wantField, tc.err.Reason)
+			}
+		})
+	}
+}
+
+func TestError_Is(t *testing.T) {
+	err := fmt.Errorf("registering user: %w", Invalid("email", "INVALID", "email must be a valid address"))
+
+	if !errors.Is(err, InvalidArgument) {
+		t.Error("errors.Is() does not match the kind of a wrapped error")
+	}
+	if errors.Is(err, NotFound) {
+		t.Error("errors.Is() matches another kind")
+	}
+}
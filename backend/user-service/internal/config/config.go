@@ -1,7 +1,11 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"os"
+	"strconv"
 	"sync"
 )
 
@@ -14,11 +18,42 @@ type PostgresConfig struct {
 	PostgresSSLMode  string
 }
 
+const (
+	// PasswordHashArgon2id hashes new passwords with argon2id.
+	PasswordHashArgon2id = "argon2id"
+	// PasswordHashBcrypt hashes new passwords with bcrypt.
+	PasswordHashBcrypt = "bcrypt"
+)
+
+type PasswordHashConfig struct {
+	// PasswordHashAlgorithm hashes new passwords. Hashes of the other algorithm are still
+	// verified, and replaced on the next login, as are hashes with other parameters
+	PasswordHashAlgorithm string
+	PasswordBcryptCost    int
+	// PasswordArgon2Memory is in KiB
+	PasswordArgon2Memory      uint32
+	PasswordArgon2Iterations  uint32
+	PasswordArgon2Parallelism uint8
+	// LegacyPasswordHashes sends password hashes to auth-service in GetUserByEmail, for
+	// auth-service releases that verify passwords themselves. They only know bcrypt, so new
+	// passwords are hashed with it and existing hashes are not replaced. Removed in the next
+	// release
+	LegacyPasswordHashes bool
+}
+
 type Config struct {
 	AppEnv                      string
 	ApiUserServiceInternalPort  string
 	GRPCUserServiceInternalPort string
 	Postgres                    PostgresConfig
+	PasswordHash                PasswordHashConfig
+	// IdentitySigningKey verifies the identity headers signed by the gateway
+	IdentitySigningKey string
+	// BootstrapAdminEmail is granted the admin role, so a fresh deployment has someone to assign roles
+	BootstrapAdminEmail string
+	// EmailProviderRules treats addresses the listed providers deliver to one mailbox, like
+	// j.doe+news@gmail.com and jdoe@gmail.com, as one account
+	EmailProviderRules bool
 }
 
 var (
@@ -26,7 +61,56 @@ var (
 	once sync.Once
 )
 
-func LoadConfigFromEnv() Config {
+func LoadConfigFromEnv() (Config, error) {
+	passwordHashAlgorithm := os.Getenv("PASSWORD_HASH_ALGORITHM")
+	switch passwordHashAlgorithm {
+	case "":
+		passwordHashAlgorithm = PasswordHashArgon2id
+	case PasswordHashArgon2id, PasswordHashBcrypt:
+	default:
+		return Config{}, fmt.Errorf("PASSWORD_HASH_ALGORITHM must be %s or %s", PasswordHashArgon2id, PasswordHashBcrypt)
+	}
+	legacyPasswordHashes := os.Getenv("LEGACY_PASSWORD_HASHES") == "true"
+	if legacyPasswordHashes {
+		passwordHashAlgorithm = PasswordHashBcrypt
+	}
+
+	var err error
+	passwordBcryptCost := 10
+	if v := os.Getenv("PASSWORD_BCRYPT_COST"); v != "" {
+		passwordBcryptCost, err = strconv.Atoi(v)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse PASSWORD_BCRYPT_COST: %w", err)
+		}
+	}
+
+	// the OWASP recommendation for argon2id
+	var passwordArgon2Memory, passwordArgon2Iterations, passwordArgon2Parallelism uint64 = 19 * 1024, 2, 1
+	if v := os.Getenv("PASSWORD_ARGON2_MEMORY"); v != "" {
+		passwordArgon2Memory, err = strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse PASSWORD_ARGON2_MEMORY: %w", err)
+		}
+	}
+	if v := os.Getenv("PASSWORD_ARGON2_ITERATIONS"); v != "" {
+		passwordArgon2Iterations, err = strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse PASSWORD_ARGON2_ITERATIONS: %w", err)
+		}
+	}
+	if v := os.Getenv("PASSWORD_ARGON2_PARALLELISM"); v != "" {
+		passwordArgon2Parallelism, err = strconv.ParseUint(v, 10, 8)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to parse PASSWORD_ARGON2_PARALLELISM: %w", err)
+		}
+	}
+
+	// without it anyone who reaches user-service could claim to be any user
+	identitySigningKey := os.Getenv("IDENTITY_SIGNING_KEY")
+	if identitySigningKey == "" {
+		return Config{}, errors.New("IDENTITY_SIGNING_KEY is required")
+	}
+
 	return Config{
 		AppEnv:                      os.Getenv("APP_ENV"),
 		ApiUserServiceInternalPort:  os.Getenv("API_USER_SERVICE_INTERNAL_PORT"),
@@ -39,12 +123,27 @@ func LoadConfigFromEnv() Config {
 			PostgresDB:       os.Getenv("DB_USER_POSTGRES_DB"),
 			PostgresSSLMode:  os.Getenv("DB_USER_POSTGRES_SSLMODE"),
 		},
-	}
+		PasswordHash: PasswordHashConfig{
+			PasswordHashAlgorithm:     passwordHashAlgorithm,
+			PasswordBcryptCost:        passwordBcryptCost,
+			PasswordArgon2Memory:      uint32(passwordArgon2Memory),
+			PasswordArgon2Iterations:  uint32(passwordArgon2Iterations),
+			PasswordArgon2Parallelism: uint8(passwordArgon2Parallelism),
+			LegacyPasswordHashes:      legacyPasswordHashes,
+		},
+		IdentitySigningKey:  identitySigningKey,
+		BootstrapAdminEmail: os.Getenv("BOOTSTRAP_ADMIN_EMAIL"),
+		EmailProviderRules:  os.Getenv("EMAIL_PROVIDER_RULES") == "true",
+	}, nil
 }
 
 func GetConfig() Config {
 	once.Do(func() {
-		cfg = LoadConfigFromEnv()
+		var err error
+		cfg, err = LoadConfigFromEnv()
+		if err != nil {
+			log.Fatal(err)
+		}
 	})
 
 	return cfg
@@ -0,0 +1,101 @@
+package emailaddr
+
+import (
+	"errors"
+	"strings"
+
+	"golang.org/x/net/idna"
+)
+
+// ErrInvalid is returned for a string that is not an email address.
+var ErrInvalid = errors.New("invalid email address")
+
+// provider describes how a mail provider treats the local part of its addresses.
+type provider struct {
+	// domain replaces the domain, for providers with more than one
+	domain string
+	// ignoresDots drops the dots, j.doe and jdoe are one mailbox
+	ignoresDots bool
+	// ignoresTag drops everything from the first +, jdoe+news is jdoe
+	ignoresTag bool
+}
+
+var providers = map[string]provider{
+	"gmail.com":      {domain: "gmail.com", ignoresDots: true, ignoresTag: true},
+	"googlemail.com": {domain: "gmail.com", ignoresDots: true, ignoresTag: true},
+	"outlook.com":    {ignoresTag: true},
+	"hotmail.com":    {ignoresTag: true},
+	"live.com":       {ignoresTag: true},
+	"icloud.com":     {ignoresTag: true},
+	"me.com":         {ignoresTag: true},
+	"mac.com":        {ignoresTag: true},
+	"fastmail.com":   {ignoresTag: true},
+	"proton.me":      {ignoresTag: true},
+	"protonmail.com": {ignoresTag: true},
+}
+
+// Normalizer maps every spelling of a mailbox to one form, which accounts are unique by.
+type Normalizer interface {
+	Normalize(email string) (string, error)
+}
+
+type normalizer struct {
+	providerRules bool
+}
+
+// NewNormalizer returns a Normalizer that canonicalizes emails, and with providerRules also applies
+// the dot and plus rules of the providers in the list.
+func NewNormalizer(providerRules bool) Normalizer {
+	return &normalizer{providerRules: providerRules}
+}
+
+func (n *normalizer) Normalize(email string) (string, error) {
+	canonical, err := Canonical(email)
+	if err != nil || !n.providerRules {
+		return canonical, err
+	}
+
+	at := strings.LastIndexByte(canonical, '@')
+	local, domain := canonical[:at], canonical[at+1:]
+
+	p, ok := providers[domain]
+	if !ok {
+		return canonical, nil
+	}
+	if p.ignoresTag {
+		local, _, _ = strings.Cut(local, "+")
+	}
+	if p.ignoresDots {
+		local = strings.ReplaceAll(local, ".", "")
+	}
+	if p.domain != "" {
+		domain = p.domain
+	}
+	if local == "" {
+		return "", ErrInvalid
+	}
+
+	return local + "@" + domain, nil
+}
+
+// Canonical trims and lowercases the email and converts an internationalized domain to punycode.
+// Unlike Normalize the result still reaches the mailbox exactly as given.
+func Canonical(email string) (string, error) {
+	email = strings.TrimSpace(email)
+
+	at := strings.LastIndexByte(email, '@')
+	if at <= 0 || at == len(email)-1 {
+		return "", ErrInvalid
+	}
+	local, domain := email[:at], strings.TrimSuffix(email[at+1:], ".")
+	if strings.ContainsAny(local, " \t\r\n") {
+		return "", ErrInvalid
+	}
+
+	domain, err := idna.Lookup.ToASCII(domain)
+	if err != nil || domain == "" {
+		return "", ErrInvalid
+	}
+
+	return strings.ToLower(local) + "@" + strings.ToLower(domain), nil
+}
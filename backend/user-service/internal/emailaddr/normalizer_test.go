@@ -0,0 +1,39 @@
+package emailaddr
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizer_Normalize(t *testing.T) {
+	tests := []struct {
+		name          string
+		email         string
+		providerRules bool
+		want          string
+	}{
+		{"lowercase", "Alice@Example.COM", false, "alice@example.com"},
+		{"surrounding space", "  alice@example.com\n", false, "alice@example.com"},
+		{"trailing dot of the domain", "alice@example.com.", false, "alice@example.com"},
+		{"internationalized domain", "alice@Bücher.example", false, "alice@xn--bcher-kva.example"},
+		{"provider rules off", "J.Doe+news@gmail.com", false, "j.doe+news@gmail.com"},
+		{"gmail dots and tag", "J.Doe+news@gmail.com", true, "jdoe@gmail.com"},
+		{"googlemail", "j.doe@GoogleMail.com", true, "jdoe@gmail.com"},
+		{"tag only", "j.doe+news@outlook.com", true, "j.doe@outlook.com"},
+		{"other domains keep their rules", "j.doe+news@example.com", true, "j.doe+news@example.com"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := NewNormalizer(tc.providerRules).Normalize(tc.email)
+			if err != nil || got != tc.want {
+				t.Errorf("Normalize(%q) = %q, %v, want %q", tc.email, got, err, tc.want)
+			}
+		})
+	}
+
+	for _, email := range []string{"", "alice", "@example.com", "alice@", "al ice@example.com", "alice@exa mple.com", "+news@gmail.com"} {
+		if _, err := NewNormalizer(true).Normalize(email); !errors.Is(err, ErrInvalid) {
+			t.Errorf("Normalize(%q) error = %v, want ErrInvalid", email, err)
+		}
+	}
+}
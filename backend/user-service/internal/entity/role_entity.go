@@ -0,0 +1,28 @@
+package entity
+
+type Role struct {
+	Name        string `gorm:"type:text;primaryKey" json:"name"`
+	Description string `gorm:"type:text" json:"description"`
+}
+
+func (Role) TableName() string {
+	return "roles"
+}
+
+type RolePermission struct {
+	Role       string `gorm:"type:text;primaryKey" json:"role"`
+	Permission string `gorm:"type:text;primaryKey" json:"permission"`
+}
+
+func (RolePermission) TableName() string {
+	return "role_permissions"
+}
+
+type UserRole struct {
+	UserID string `gorm:"type:integer;primaryKey" json:"user_id"`
+	Role   string `gorm:"type:text;primaryKey" json:"role"`
+}
+
+func (UserRole) TableName() string {
+	return "user_roles"
+}
@@ -1,11 +1,47 @@
 package entity
 
+import "time"
+
 type User struct {
-	ID       string `gorm:"type:serial;primaryKey;autoIncrement" json:"id"`
-	Email    string `gorm:"type:text;unique;not null" json:"email"`
-	Password string `gorm:"type:text;not null" json:"password"`
+	ID          string `gorm:"type:serial;primaryKey;autoIncrement" json:"id"`
+	Email       string `gorm:"type:text;unique;not null" json:"email"`
+	Password    string `gorm:"type:text;not null" json:"password"`
+	DisplayName string `gorm:"type:text;not null;default:''" json:"display_name"`
+	AvatarURL   string `gorm:"type:text;not null;default:''" json:"avatar_url"`
+	Locale      string `gorm:"type:text;not null;default:''" json:"locale"`
+	Timezone    string `gorm:"type:text;not null;default:''" json:"timezone"`
+	// EmailVerifiedAt is nil until the user proves they own Email
+	EmailVerifiedAt *time.Time `gorm:"type:timestamp" json:"email_verified_at"`
+	// EmailNormalized identifies the account, nil while Email collides with another account's
+	EmailNormalized *string `gorm:"type:text;uniqueIndex:users_email_normalized_key" json:"-"`
+	// PendingEmail is the email the user asked to change to, it replaces Email once verified
+	PendingEmail *string `gorm:"type:text" json:"-"`
 }
 
 func (User) TableName() string {
 	return "users"
 }
+
+// RegistrationKey is the idempotency key of a registration and the user it created.
+type RegistrationKey struct {
+	Key       string    `gorm:"type:text;primaryKey" json:"key"`
+	UserID    string    `gorm:"type:integer;not null" json:"user_id"`
+	CreatedAt time.Time `gorm:"type:timestamp;not null" json:"created_at"`
+}
+
+func (RegistrationKey) TableName() string {
+	return "registration_keys"
+}
+
+// EmailCollision is an account whose email normalizes to the email of another account. It keeps
+// its email but can not sign in with it until someone resolves the collision.
+type EmailCollision struct {
+	UserID          string    `gorm:"type:integer;primaryKey" json:"user_id"`
+	EmailNormalized string    `gorm:"type:text;not null" json:"email_normalized"`
+	KeptUserID      *string   `gorm:"type:integer" json:"kept_user_id"`
+	FoundAt         time.Time `gorm:"type:timestamp;not null" json:"found_at"`
+}
+
+func (EmailCollision) TableName() string {
+	return "email_collisions"
+}
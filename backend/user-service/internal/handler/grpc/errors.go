@@ -0,0 +1,39 @@
+package grpcHandler
+
+import (
+	"context"
+	"errors"
+	"user-service/internal/apperror"
+	"user-service/internal/logger"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorInterceptor turns the errors the handlers return into gRPC statuses. An apperror.Error
+// keeps its kind, reason and field, anything else is logged and reported as Internal without
+// the details of the failure.
+func ErrorInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	resp, err := handler(ctx, req)
+	if err != nil {
+		return resp, statusError(info.FullMethod, err)
+	}
+	return resp, nil
+}
+
+func statusError(method string, err error) error {
+	var appErr *apperror.Error
+	if errors.As(err, &appErr) {
+		return appErr.GRPCStatus().Err()
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return status.FromContextError(err).Err()
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	logger.Log.Error().Err(err).Str("method", method).Msg("error handling gRPC request")
+	return status.Error(codes.Internal, "internal error")
+}
@@ -0,0 +1,72 @@
+package grpcHandler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"user-service/internal/service"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestErrorInterceptor(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantCode   codes.Code
+		wantReason string
+		wantField  string
+	}{
+		{"user not found", service.ErrUserNotFound, codes.NotFound, "USER_NOT_FOUND", ""},
+		{"email taken", service.ErrEmailTaken, codes.AlreadyExists, "EMAIL_TAKEN", ""},
+		{"registration key in use", service.ErrRegistrationKeyInUse, codes.InvalidArgument, "IDEMPOTENCY_KEY_IN_USE", "idempotency_key"},
+		{"invalid email", service.ErrInvalidEmail, codes.InvalidArgument, "INVALID", "email"},
+		{"unknown role", service.ErrUnknownRole, codes.InvalidArgument, "UNKNOWN_ROLE", "roles"},
+		{"wrapped", fmt.Errorf("changing email: %w", service.ErrEmailTaken), codes.AlreadyExists, "EMAIL_TAKEN", ""},
+		{"canceled", context.Canceled, codes.Canceled, "", ""},
+		{"status", status.Error(codes.Unavailable, "try again"), codes.Unavailable, "", ""},
+		{"unknown", errors.New("pq: connection refused"), codes.Internal, "", ""},
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: "/user.v1.UserService/GetUserByID"}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := ErrorInterceptor(context.Background(), nil, info, func(context.Context, any) (any, error) {
+				return nil, tc.err
+			})
+
+			st, ok := status.FromError(err)
+			if !ok || st.Code() != tc.wantCode {
+				t.Fatalf("ErrorInterceptor() error = %v, want code %v", err, tc.wantCode)
+			}
+
+			var reason, field string
+			for _, detail := range st.Details() {
+				switch detail := detail.(type) {
+				case *errdetails.ErrorInfo:
+					reason = detail.Reason
+				case *errdetails.BadRequest:
+					for _, violation := range detail.FieldViolations {
+						field = violation.Field
+					}
+				}
+			}
+			if reason != tc.wantReason || field != tc.wantField {
+				t.Errorf("details = reason %q, field %q, want %q, %q", reason, field, tc.wantReason, tc.wantField)
+			}
+			if tc.wantCode == codes.Internal && (st.Message() != "internal error" || len(st.Details()) != 0) {
+				t.Errorf("Internal status = %q with %d details, want the cause hidden", st.Message(), len(st.Details()))
+			}
+		})
+	}
+
+	resp, err := ErrorInterceptor(context.Background(), nil, info, func(context.Context, any) (any, error) {
+		return "ok", nil
+	})
+	if resp != "ok" || err != nil {
+		t.Errorf("ErrorInterceptor() = %v, %v, want the handler's response", resp, err)
+	}
+}
@@ -2,11 +2,9 @@ package grpcHandler
 
 import (
 	"context"
+	"user-service/internal/apperror"
 	userpb "user-service/internal/genproto/user/v1"
 	"user-service/internal/service"
-
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
 type UserHandler struct {
@@ -42,7 +40,7 @@ func NewUserHandler(s service.UserService) *UserHandler {
 func (h *UserHandler) GetUsersCount(ctx context.Context, req *userpb.GetUsersCountRequest) (*userpb.GetUsersCountResponse, error) {
 	count, err := h.userService.GetUsersCount(ctx)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "error getting users count: %v", err)
+		return nil, err
 	}
 
 	return &userpb.GetUsersCountResponse{
@@ -52,70 +50,172 @@ func (h *UserHandler) GetUsersCount(ctx context.Context, req *userpb.GetUsersCou
 
 func (h *UserHandler) GetUserByEmail(ctx context.Context, req *userpb.GetUserByEmailRequest) (*userpb.GetUserByEmailResponse, error) {
 	if req.Email == "" {
-		return nil, status.Error(codes.InvalidArgument, "email is required")
+		return nil, apperror.Invalid("email", "REQUIRED", "email is required")
 	}
 
 	user, err := h.userService.GetUserByEmail(ctx, req.Email)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to get user by email: %v", err)
-	}
-	if user == nil {
-		return nil, status.Error(codes.NotFound, "user not found")
+		return nil, err
 	}
 
 	return &userpb.GetUserByEmailResponse{
 		User: &userpb.User{
-			Id:       user.ID,
-			Email:    user.Email,
-			Password: user.Password,
+			Id:            user.ID,
+			Email:         user.Email,
+			PasswordHash:  user.PasswordHash,
+			Roles:         user.Roles,
+			Permissions:   user.Permissions,
+			EmailVerified: user.EmailVerified,
 		},
 	}, nil
 }
 
 func (h *UserHandler) GetUserByID(ctx context.Context, req *userpb.GetUserByIDRequest) (*userpb.GetUserByIDResponse, error) {
 	if req.Id == "" {
-		return nil, status.Error(codes.InvalidArgument, "id is required")
+		return nil, apperror.Invalid("id", "REQUIRED", "id is required")
 	}
 
 	user, err := h.userService.GetUserByID(ctx, req.Id)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to get user by id: %v", err)
-	}
-	if user == nil {
-		return nil, status.Error(codes.NotFound, "user not found")
+		return nil, err
 	}
 
 	return &userpb.GetUserByIDResponse{
 		User: &userpb.User{
-			Id:    user.ID,
-			Email: user.Email,
+			Id:            user.ID,
+			Email:         user.Email,
+			Roles:         user.Roles,
+			Permissions:   user.Permissions,
+			EmailVerified: user.EmailVerified,
 		},
 	}, nil
 }
 
 func (h *UserHandler) CheckUserExistsByEmail(ctx context.Context, req *userpb.CheckUserExistsByEmailRequest) (*userpb.CheckUserExistsByEmailResponse, error) {
 	if req.Email == "" {
-		return nil, status.Error(codes.InvalidArgument, "email is required")
+		return nil, apperror.Invalid("email", "REQUIRED", "email is required")
 	}
 
 	exists, err := h.userService.CheckUserExistsByEmail(ctx, req.Email)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to check user existence: %v", err)
+		return nil, err
 	}
 	return &userpb.CheckUserExistsByEmailResponse{Exists: exists}, nil
 }
 
-func (h *UserHandler) RegisterUser(ctx context.Context, req *userpb.RegisterUserRequest) (*userpb.RegisterUserResponse, error) {
-	if req.Email == "" || req.Password == "" {
-		return nil, status.Error(codes.InvalidArgument, "email and password are required")
+func (h *UserHandler) NormalizeEmail(ctx context.Context, req *userpb.NormalizeEmailRequest) (*userpb.NormalizeEmailResponse, error) {
+	if req.Email == "" {
+		return nil, apperror.Invalid("email", "REQUIRED", "email is required")
 	}
 
-	userID, err := h.userService.RegisterUser(ctx, req.Email, []byte(req.Password))
+	normalized, err := h.userService.NormalizeEmail(ctx, req.Email)
 	if err != nil {
-		return nil, status.Errorf(codes.Internal, "failed to register user: %v", err)
+		return nil, err
+	}
+	return &userpb.NormalizeEmailResponse{EmailNormalized: normalized}, nil
+}
+
+func (h *UserHandler) RegisterUser(ctx context.Context, req *userpb.RegisterUserRequest) (*userpb.RegisterUserResponse, error) {
+	var userID string
+	var replayed bool
+	var err error
+	switch {
+	case req.Credentials != nil:
+		if req.Credentials.Email == "" || req.Credentials.Password == "" {
+			return nil, apperror.New(apperror.InvalidArgument, "REQUIRED", "email and password are required")
+		}
+		userID, replayed, err = h.userService.RegisterUser(ctx, req.Credentials.Email, req.Credentials.Password, req.IdempotencyKey)
+	case req.Email != "" && req.PasswordHash != "":
+		// an auth-service release that still hashes passwords itself
+		userID, err = h.userService.RegisterUserWithHash(ctx, req.Email, []byte(req.PasswordHash))
+	default:
+		return nil, apperror.New(apperror.InvalidArgument, "REQUIRED", "credentials are required")
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	return &userpb.RegisterUserResponse{
-		Id: userID,
+		Id:       userID,
+		Replayed: replayed,
+	}, nil
+}
+
+func (h *UserHandler) DeleteUser(ctx context.Context, req *userpb.DeleteUserRequest) (*userpb.DeleteUserResponse, error) {
+	if req.Id == "" {
+		return nil, apperror.Invalid("id", "REQUIRED", "id is required")
+	}
+
+	if err := h.userService.DeleteUser(ctx, req.Id, req.IdempotencyKey); err != nil {
+		return nil, err
+	}
+
+	return &userpb.DeleteUserResponse{}, nil
+}
+
+func (h *UserHandler) VerifyCredentials(ctx context.Context, req *userpb.VerifyCredentialsRequest) (*userpb.VerifyCredentialsResponse, error) {
+	if req.Credentials.GetEmail() == "" || req.Credentials.GetPassword() == "" {
+		return nil, apperror.New(apperror.InvalidArgument, "REQUIRED", "email and password are required")
+	}
+
+	user, valid, err := h.userService.VerifyCredentials(ctx, req.Credentials.Email, req.Credentials.Password)
+	if err != nil {
+		return nil, err
+	}
+
+	return &userpb.VerifyCredentialsResponse{
+		Valid: valid,
+		User: &userpb.User{
+			Id:            user.ID,
+			Email:         user.Email,
+			Roles:         user.Roles,
+			Permissions:   user.Permissions,
+			EmailVerified: user.EmailVerified,
+		},
 	}, nil
 }
+
+func (h *UserHandler) UpdatePassword(ctx context.Context, req *userpb.UpdatePasswordRequest) (*userpb.UpdatePasswordResponse, error) {
+	if req.Id == "" || (req.Password == "" && req.PasswordHash == "") {
+		return nil, apperror.New(apperror.InvalidArgument, "REQUIRED", "id and password are required")
+	}
+
+	var err error
+	if req.Password != "" {
+		err = h.userService.UpdatePassword(ctx, req.Id, req.Password)
+	} else {
+		// an auth-service release that still hashes passwords itself
+		err = h.userService.UpdatePasswordHash(ctx, req.Id, []byte(req.PasswordHash))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &userpb.UpdatePasswordResponse{}, nil
+}
+
+func (h *UserHandler) MarkEmailVerified(ctx context.Context, req *userpb.MarkEmailVerifiedRequest) (*userpb.MarkEmailVerifiedResponse, error) {
+	if req.Id == "" || req.Email == "" {
+		return nil, apperror.New(apperror.InvalidArgument, "REQUIRED", "id and email are required")
+	}
+
+	verified, err := h.userService.MarkEmailVerified(ctx, req.Id, req.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	return &userpb.MarkEmailVerifiedResponse{Verified: verified}, nil
+}
+
+func (h *UserHandler) RequestEmailChange(ctx context.Context, req *userpb.RequestEmailChangeRequest) (*userpb.RequestEmailChangeResponse, error) {
+	if req.Id == "" || req.Email == "" {
+		return nil, apperror.New(apperror.InvalidArgument, "REQUIRED", "id and email are required")
+	}
+
+	email, err := h.userService.RequestEmailChange(ctx, req.Id, req.Email)
+	if err != nil {
+		return nil, err
+	}
+
+	return &userpb.RequestEmailChangeResponse{Email: email}, nil
+}
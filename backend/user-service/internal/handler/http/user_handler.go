@@ -1,6 +1,9 @@
 package httpHandler
 
 import (
+	"errors"
+	"user-service/internal/apperror"
+	"user-service/internal/identity"
 	"user-service/internal/logger"
 	"user-service/internal/service"
 
@@ -9,6 +12,23 @@ import (
 
 type Handlers interface {
 	GetAllUsers(c *fiber.Ctx) error
+	SetUserRoles(c *fiber.Ctx) error
+
+	GetMe(c *fiber.Ctx) error
+	UpdateMe(c *fiber.Ctx) error
+}
+
+type setUserRolesRequest struct {
+	Roles []string `json:"roles"`
+}
+
+type updateProfileRequest struct {
+	DisplayName *string `json:"display_name"`
+	AvatarURL   *string `json:"avatar_url"`
+	Locale      *string `json:"locale"`
+	Timezone    *string `json:"timezone"`
+	// Email is only read to reject it, see service.UserService.RequestEmailChange
+	Email *string `json:"email"`
 }
 
 type userHandler struct {
@@ -32,3 +52,94 @@ func (h *userHandler) GetAllUsers(c *fiber.Ctx) error {
 
 	return c.JSON(users)
 }
+
+func (h *userHandler) SetUserRoles(c *fiber.Ctx) error {
+	var req setUserRolesRequest
+
+	if err := c.BodyParser(&req); err != nil {
+		logger.Log.Error().Err(err).Msg("failed to parse request body")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	roles, err := h.service.SetUserRoles(c.Context(), c.Params("id"), req.Roles)
+	if err != nil {
+		return errorResponse(c, err, "Error setting user roles")
+	}
+
+	return c.JSON(fiber.Map{
+		"id":    c.Params("id"),
+		"roles": roles,
+	})
+}
+
+func (h *userHandler) GetMe(c *fiber.Ctx) error {
+	id, _ := identity.FromContext(c)
+
+	profile, err := h.service.GetProfile(c.Context(), id.UserID)
+	if err != nil {
+		return errorResponse(c, err, "Error handling user profile")
+	}
+
+	return c.JSON(profile)
+}
+
+func (h *userHandler) UpdateMe(c *fiber.Ctx) error {
+	id, _ := identity.FromContext(c)
+
+	var req updateProfileRequest
+	if err := c.BodyParser(&req); err != nil {
+		logger.Log.Error().Err(err).Msg("failed to parse request body")
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "invalid request body",
+		})
+	}
+
+	if req.Email != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"error": "email is changed through POST /api/auth/email/change, which verifies the new address",
+			"field": "email",
+		})
+	}
+
+	profile, err := h.service.UpdateProfile(c.Context(), id.UserID, service.ProfileUpdate{
+		DisplayName: req.DisplayName,
+		AvatarURL:   req.AvatarURL,
+		Locale:      req.Locale,
+		Timezone:    req.Timezone,
+	})
+	if err != nil {
+		return errorResponse(c, err, "Error handling user profile")
+	}
+
+	return c.JSON(profile)
+}
+
+// errorResponse answers an apperror.Error with the status of its kind and the field it is about.
+// Anything else is logged with msg and hidden behind a 500.
+func errorResponse(c *fiber.Ctx, err error, msg string) error {
+	var appErr *apperror.Error
+	if !errors.As(err, &appErr) {
+		logger.Log.Error().Err(err).Msg(msg)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"error": "internal server error",
+		})
+	}
+
+	code := fiber.StatusInternalServerError
+	switch appErr.Kind {
+	case apperror.NotFound:
+		code = fiber.StatusNotFound
+	case apperror.AlreadyExists:
+		code = fiber.StatusConflict
+	case apperror.InvalidArgument:
+		code = fiber.StatusBadRequest
+	}
+
+	body := fiber.Map{"error": appErr.Message}
+	if appErr.Field != "" {
+		body["field"] = appErr.Field
+	}
+	return c.Status(code).JSON(body)
+}
@@ -0,0 +1,194 @@
+package httpHandler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"user-service/internal/apperror"
+	"user-service/internal/identity"
+	"user-service/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakeProfiles keeps profiles in memory, the rest of service.UserService is unused.
+type fakeProfiles struct {
+	service.UserService
+	profiles map[string]*service.Profile
+	// updateErr is returned by UpdateProfile, the way the service reports invalid fields
+	updateErr error
+}
+
+func (f *fakeProfiles) GetProfile(_ context.Context, id string) (*service.Profile, error) {
+	profile, ok := f.profiles[id]
+	if !ok {
+		return nil, service.ErrUserNotFound
+	}
+	return profile, nil
+}
+
+func (f *fakeProfiles) UpdateProfile(ctx context.Context, id string, update service.ProfileUpdate) (*service.Profile, error) {
+	if f.updateErr != nil {
+		return nil, f.updateErr
+	}
+	profile, err := f.GetProfile(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if update.DisplayName != nil {
+		profile.DisplayName = *update.DisplayName
+	}
+	if update.Timezone != nil {
+		profile.Timezone = *update.Timezone
+	}
+	return profile, nil
+}
+
+func newProfileTestApp(profiles service.UserService) *fiber.App {
+	h := NewUserHandler(profiles)
+
+	app := fiber.New()
+	// the identity middleware is tested on its own, the caller comes from a header here
+	app.Use(func(c *fiber.Ctx) error {
+		identity.Store(c, identity.Identity{UserID: c.Get("X-Test-User")})
+		return c.Next()
+	})
+	app.Get("/api/user/me", h.GetMe)
+	app.Patch("/api/user/me", h.UpdateMe)
+	return app
+}
+
+func doProfileRequest(t *testing.T, app *fiber.App, method, userID, body string) (int, map[string]any) {
+	t.Helper()
+
+	req := httptest.NewRequest(method, "/api/user/me", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Test-User", userID)
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test() error: %v", err)
+	}
+	defer resp.Body.Close()
+
+	raw, _ := io.ReadAll(resp.Body)
+	var decoded map[string]any
+	if err := json.Unmarshal(raw, &decoded); err != nil {
+		t.Fatalf("response %q is not a JSON object: %v", raw, err)
+	}
+	return resp.StatusCode, decoded
+}
+
+func TestUserHandler_GetMe(t *testing.T) {
+	app := newProfileTestApp(&fakeProfiles{profiles: map[string]*service.Profile{
+		"1": {ID: "1", Email: "alice@example.com", PendingEmail: "new@example.com", Roles: []string{"user"}},
+	}})
+
+	status, body := doProfileRequest(t, app, http.MethodGet, "1", "")
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+	}
+	if body["email"] != "alice@example.com" || body["pending_email"] != "new@example.com" {
+		t.Errorf("GetMe() = %v, want the email and the pending email", body)
+	}
+
+	// the account was deleted after the token was issued
+	if status, _ := doProfileRequest(t, app, http.MethodGet, "2", ""); status != fiber.StatusNotFound {
+		t.Errorf("status for a deleted user = %d, want %d", status, fiber.StatusNotFound)
+	}
+}
+
+func TestUserHandler_UpdateMe(t *testing.T) {
+	profiles := &fakeProfiles{profiles: map[string]*service.Profile{
+		"1": {ID: "1", Email: "alice@example.com"},
+	}}
+	app := newProfileTestApp(profiles)
+
+	status, body := doProfileRequest(t, app, http.MethodPatch, "1", `{"display_name":"Alice","timezone":"Europe/Berlin"}`)
+	if status != fiber.StatusOK {
+		t.Fatalf("status = %d, want %d", status, fiber.StatusOK)
+	}
+	if body["display_name"] != "Alice" || body["timezone"] != "Europe/Berlin" {
+		t.Errorf("UpdateMe() = %v, want the updated fields", body)
+	}
+
+	tests := []struct {
+		name       string
+		body       string
+		updateErr  error
+		wantStatus int
+		wantField  string
+	}{
+		{"invalid JSON", `{"display_name":`, nil, fiber.StatusBadRequest, ""},
+		{"email", `{"email":"new@example.com"}`, nil, fiber.StatusBadRequest, "email"},
+		{"invalid field", `{"timezone":"Mars/Olympus"}`, apperror.Invalid("timezone", "INVALID_TIMEZONE", "timezone must be an IANA time zone"), fiber.StatusBadRequest, "timezone"},
+		{"internal error", `{"display_name":"Alice"}`, errors.New("connection refused"), fiber.StatusInternalServerError, ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			profiles.updateErr = tc.updateErr
+			defer func() { profiles.updateErr = nil }()
+
+			status, body := doProfileRequest(t, app, http.MethodPatch, "1", tc.body)
+			if status != tc.wantStatus {
+				t.Errorf("status = %d, want %d", status, tc.wantStatus)
+			}
+			if field, _ := body["field"].(string); field != tc.wantField {
+				t.Errorf("field = %q, want %q", field, tc.wantField)
+			}
+			if tc.wantStatus == fiber.StatusInternalServerError && body["error"] != "internal server error" {
+				t.Errorf("error = %v, want the cause hidden", body["error"])
+			}
+		})
+	}
+
+	if profiles.profiles["1"].Email != "alice@example.com" {
+		t.Error("UpdateMe() changed the email")
+	}
+}
+
+func TestErrorResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+		wantError  string
+		wantField  string
+	}{
+		{"user not found", service.ErrUserNotFound, fiber.StatusNotFound, "user not found", ""},
+		{"email taken", service.ErrEmailTaken, fiber.StatusConflict, "user already exists", ""},
+		{"unknown role", service.ErrUnknownRole, fiber.StatusBadRequest, "unknown role", "roles"},
+		{"wrapped", fmt.Errorf("setting roles: %w", service.ErrInvalidEmail), fiber.StatusBadRequest, "email must be a valid address", "email"},
+		{"unknown kind", apperror.New("gone", "GONE", "gone"), fiber.StatusInternalServerError, "gone", ""},
+		{"unknown", errors.New("pq: connection refused"), fiber.StatusInternalServerError, "internal server error", ""},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Get("/", func(c *fiber.Ctx) error {
+				return errorResponse(c, tc.err, "Error handling request")
+			})
+
+			resp, err := app.Test(httptest.NewRequest(http.MethodGet, "/", nil))
+			if err != nil {
+				t.Fatalf("app.Test() error: %v", err)
+			}
+			defer resp.Body.Close()
+
+			var body map[string]any
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatalf("response is not a JSON object: %v", err)
+			}
+			field, _ := body["field"].(string)
+			if resp.StatusCode != tc.wantStatus || body["error"] != tc.wantError || field != tc.wantField {
+				t.Errorf("errorResponse() = %d %v, want %d with error %q and field %q", resp.StatusCode, body, tc.wantStatus, tc.wantError, tc.wantField)
+			}
+		})
+	}
+}
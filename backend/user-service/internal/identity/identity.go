@@ -0,0 +1,90 @@
+package identity
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Headers the gateway sets for authenticated requests.
+const (
+	HeaderUserID    = "X-User-ID"
+	HeaderRoles     = "X-User-Roles"
+	HeaderSessionID = "X-Session-ID"
+	HeaderTokenID   = "X-Token-ID"
+	HeaderClientID  = "X-Client-ID"
+	HeaderScopes    = "X-Client-Scopes"
+	HeaderAPIKey    = "X-User-API-Key"
+	HeaderTimestamp = "X-Identity-Timestamp"
+	HeaderSignature = "X-Identity-Signature"
+)
+
+const localsKey = "identity"
+
+// Identity is the authenticated caller of a request, a user or a service account.
+type Identity struct {
+	UserID    string
+	Roles     []string
+	SessionID string
+	TokenID   string
+	ClientID  string
+	Scopes    []string
+	// APIKey is set when the user calls with a personal API key, which limits them to Scopes
+	APIKey bool
+}
+
+func (i Identity) HasRole(role string) bool {
+	return slices.Contains(i.Roles, role)
+}
+
+// IsService reports whether the caller is a service account, which has no user ID and is
+// limited to its scopes.
+func (i Identity) IsService() bool {
+	return i.ClientID != ""
+}
+
+func (i Identity) HasScope(scope string) bool {
+	return slices.Contains(i.Scopes, scope)
+}
+
+// FromContext returns the caller stored by the identity middleware.
+func FromContext(c *fiber.Ctx) (Identity, bool) {
+	id, ok := c.Locals(localsKey).(Identity)
+	return id, ok
+}
+
+func Store(c *fiber.Ctx, id Identity) {
+	c.Locals(localsKey, id)
+}
+
+// Sign computes the signature the gateway attaches to the identity headers.
+// The format must match the api-gateway.
+func Sign(key []byte, id Identity, timestamp time.Time, method, path string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(strings.Join([]string{
+		"v3",
+		id.UserID,
+		strings.Join(id.Roles, ","),
+		id.SessionID,
+		id.TokenID,
+		id.ClientID,
+		strings.Join(id.Scopes, ","),
+		strconv.FormatBool(id.APIKey),
+		strconv.FormatInt(timestamp.Unix(), 10),
+		method,
+		path,
+	}, "\n")))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func Verify(key []byte, id Identity, timestamp time.Time, method, path, signature string) bool {
+	expected := Sign(key, id, timestamp, method, path)
+	return hmac.Equal([]byte(expected), []byte(signature))
+}
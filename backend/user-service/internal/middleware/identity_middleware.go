@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"strconv"
+	"strings"
+	"time"
+	"user-service/internal/config"
+	"user-service/internal/identity"
+	"user-service/internal/logger"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// maxIdentityAge bounds how long a signed set of identity headers can be replayed.
+const maxIdentityAge = 30 * time.Second
+
+// Identity reads the caller from the headers set by the gateway and makes it available to the
+// handlers through identity.FromContext. The caller is a user, or a service account identified
+// by its client ID. Requests without an identity, or whose headers do not carry a valid, recent
+// gateway signature, are rejected.
+func Identity(cfg config.Config) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		id := identity.Identity{
+			UserID:    c.Get(identity.HeaderUserID),
+			SessionID: c.Get(identity.HeaderSessionID),
+			TokenID:   c.Get(identity.HeaderTokenID),
+			ClientID:  c.Get(identity.HeaderClientID),
+			APIKey:    c.Get(identity.HeaderAPIKey) == "true",
+		}
+		if roles := c.Get(identity.HeaderRoles); roles != "" {
+			id.Roles = strings.Split(roles, ",")
+		}
+		if scopes := c.Get(identity.HeaderScopes); scopes != "" {
+			id.Scopes = strings.Split(scopes, ",")
+		}
+
+		if (id.UserID == "") == (id.ClientID == "") {
+			logger.Log.Warn().
+				Str("path", c.Path()).
+				Msg("request without caller identity")
+
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "unauthorized",
+			})
+		}
+
+		if !verifySignature(c, cfg, id) {
+			logger.Log.Warn().
+				Str("path", c.Path()).
+				Str("user_id", id.UserID).
+				Str("client_id", id.ClientID).
+				Msg("invalid identity signature")
+
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"error": "unauthorized",
+			})
+		}
+
+		identity.Store(c, id)
+		return c.Next()
+	}
+}
+
+// RequireUser rejects service accounts on routes that act on the signed-in user. It runs after
+// Identity.
+func RequireUser() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if id, ok := identity.FromContext(c); !ok || id.IsService() {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+				"error": "forbidden",
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+func verifySignature(c *fiber.Ctx, cfg config.Config, id identity.Identity) bool {
+	unix, err := strconv.ParseInt(c.Get(identity.HeaderTimestamp), 10, 64)
+	if err != nil {
+		return false
+	}
+
+	timestamp := time.Unix(unix, 0)
+	if age := time.Since(timestamp); age > maxIdentityAge || age < -maxIdentityAge {
+		return false
+	}
+
+	return identity.Verify([]byte(cfg.IdentitySigningKey), id, timestamp, c.Method(), c.OriginalURL(), c.Get(identity.HeaderSignature))
+}
@@ -0,0 +1,125 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+	"user-service/internal/config"
+	"user-service/internal/identity"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+var testConfig = config.Config{IdentitySigningKey: "identity"}
+
+// newIdentityRequest sets the identity headers the way the gateway does, signed at signedAt
+// with key, or unsigned when key is empty.
+func newIdentityRequest(method, target string, id identity.Identity, key string, signedAt time.Time) *http.Request {
+	req := httptest.NewRequest(method, target, nil)
+	req.Header.Set(identity.HeaderUserID, id.UserID)
+	req.Header.Set(identity.HeaderRoles, strings.Join(id.Roles, ","))
+	req.Header.Set(identity.HeaderSessionID, id.SessionID)
+	req.Header.Set(identity.HeaderTokenID, id.TokenID)
+	req.Header.Set(identity.HeaderClientID, id.ClientID)
+	req.Header.Set(identity.HeaderScopes, strings.Join(id.Scopes, ","))
+	req.Header.Set(identity.HeaderAPIKey, strconv.FormatBool(id.APIKey))
+
+	if key != "" {
+		req.Header.Set(identity.HeaderTimestamp, strconv.FormatInt(signedAt.Unix(), 10))
+		req.Header.Set(identity.HeaderSignature, identity.Sign([]byte(key), id, signedAt, method, target))
+	}
+
+	return req
+}
+
+func doRequest(t *testing.T, app *fiber.App, req *http.Request) int {
+	t.Helper()
+
+	resp, err := app.Test(req)
+	if err != nil {
+		t.Fatalf("app.Test() error: %v", err)
+	}
+	return resp.StatusCode
+}
+
+func TestIdentity(t *testing.T) {
+	app := fiber.New()
+	app.Use(Identity(testConfig))
+	app.Get("/api/user/me", func(c *fiber.Ctx) error {
+		id, _ := identity.FromContext(c)
+		return c.SendString(id.UserID + id.ClientID)
+	})
+
+	user := identity.Identity{UserID: "42", Roles: []string{"user"}, SessionID: "session-1", TokenID: "token-1"}
+	service := identity.Identity{TokenID: "token-2", ClientID: "reports", Scopes: []string{"users:read"}}
+	now := time.Now()
+
+	tampered := newIdentityRequest(http.MethodGet, "/api/user/me", user, "identity", now)
+	tampered.Header.Set(identity.HeaderRoles, "user,admin")
+	// a client ID added to a user's request would turn it into a service account
+	addedClient := newIdentityRequest(http.MethodGet, "/api/user/me", user, "identity", now)
+	addedClient.Header.Set(identity.HeaderClientID, "reports")
+	tamperedScopes := newIdentityRequest(http.MethodGet, "/api/user/me", service, "identity", now)
+	tamperedScopes.Header.Set(identity.HeaderScopes, "users:read,roles:assign")
+
+	tests := []struct {
+		name       string
+		req        *http.Request
+		wantStatus int
+	}{
+		{"signed user", newIdentityRequest(http.MethodGet, "/api/user/me", user, "identity", now), fiber.StatusOK},
+		{"signed service account", newIdentityRequest(http.MethodGet, "/api/user/me", service, "identity", now), fiber.StatusOK},
+		{"unsigned", newIdentityRequest(http.MethodGet, "/api/user/me", user, "", now), fiber.StatusUnauthorized},
+		{"signed with another key", newIdentityRequest(http.MethodGet, "/api/user/me", user, "other", now), fiber.StatusUnauthorized},
+		{"tampered roles", tampered, fiber.StatusUnauthorized},
+		{"added client ID", addedClient, fiber.StatusUnauthorized},
+		{"tampered scopes", tamperedScopes, fiber.StatusUnauthorized},
+		{"stale signature", newIdentityRequest(http.MethodGet, "/api/user/me", user, "identity", now.Add(-time.Minute)), fiber.StatusUnauthorized},
+		{"no caller", newIdentityRequest(http.MethodGet, "/api/user/me", identity.Identity{}, "identity", now), fiber.StatusUnauthorized},
+		{"user and client", newIdentityRequest(http.MethodGet, "/api/user/me", identity.Identity{UserID: "42", ClientID: "reports"}, "identity", now), fiber.StatusUnauthorized},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := doRequest(t, app, tc.req); got != tc.wantStatus {
+				t.Errorf("status = %d, want %d", got, tc.wantStatus)
+			}
+		})
+	}
+}
+
+func TestRequireUser(t *testing.T) {
+	app := fiber.New()
+	app.Use(Identity(testConfig))
+	app.Get("/api/user/me", RequireUser(), func(c *fiber.Ctx) error {
+		return c.SendString("OK")
+	})
+
+	now := time.Now()
+	user := newIdentityRequest(http.MethodGet, "/api/user/me", identity.Identity{UserID: "42"}, "identity", now)
+	if got := doRequest(t, app, user); got != fiber.StatusOK {
+		t.Errorf("user status = %d, want %d", got, fiber.StatusOK)
+	}
+
+	service := newIdentityRequest(http.MethodGet, "/api/user/me", identity.Identity{ClientID: "reports"}, "identity", now)
+	if got := doRequest(t, app, service); got != fiber.StatusForbidden {
+		t.Errorf("service account status = %d, want %d", got, fiber.StatusForbidden)
+	}
+
+	// a service account with every scope is still not a user
+	scoped := newIdentityRequest(http.MethodGet, "/api/user/me", identity.Identity{ClientID: "reports", Scopes: []string{"users:read", "roles:assign"}}, "identity", now)
+	if got := doRequest(t, app, scoped); got != fiber.StatusForbidden {
+		t.Errorf("scoped service account status = %d, want %d", got, fiber.StatusForbidden)
+	}
+
+	// without the identity middleware nobody is let through
+	bare := fiber.New()
+	bare.Get("/api/user/me", RequireUser(), func(c *fiber.Ctx) error {
+		return c.SendString("OK")
+	})
+	if got := doRequest(t, bare, user); got != fiber.StatusForbidden {
+		t.Errorf("status without an identity = %d, want %d", got, fiber.StatusForbidden)
+	}
+}
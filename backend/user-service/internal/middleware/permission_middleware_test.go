@@ -0,0 +1,94 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+	"user-service/internal/identity"
+	"user-service/internal/service"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// fakePermissions answers HasPermission from a map, the rest of service.UserService is unused.
+type fakePermissions struct {
+	service.UserService
+	permissions map[string][]string
+	err         error
+}
+
+func (f *fakePermissions) HasPermission(_ context.Context, id, permission string) (bool, error) {
+	return slices.Contains(f.permissions[id], permission), f.err
+}
+
+func newPermissionTestApp(users service.UserService) *fiber.App {
+	app := fiber.New()
+	app.Use(Identity(testConfig))
+	app.Put("/api/user/:id/roles", RequirePermission(users, service.PermissionAssignRoles), func(c *fiber.Ctx) error {
+		return c.SendString("OK")
+	})
+	return app
+}
+
+func TestRequirePermission(t *testing.T) {
+	users := &fakePermissions{permissions: map[string][]string{
+		"1": {service.PermissionAssignRoles},
+		"2": {service.PermissionListUsers},
+	}}
+	app := newPermissionTestApp(users)
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		id         identity.Identity
+		wantStatus int
+	}{
+		{"user with the permission", identity.Identity{UserID: "1"}, fiber.StatusOK},
+		{"user with another permission", identity.Identity{UserID: "2"}, fiber.StatusForbidden},
+		// the roles in the headers are those of the token, the database decides
+		{"admin role in the token only", identity.Identity{UserID: "2", Roles: []string{"admin"}}, fiber.StatusForbidden},
+		// service accounts are limited to the scopes of their token
+		{"service account with the scope", identity.Identity{ClientID: "reports", Scopes: []string{service.PermissionListUsers, service.PermissionAssignRoles}}, fiber.StatusOK},
+		{"service account with another scope", identity.Identity{ClientID: "reports", Scopes: []string{service.PermissionListUsers}}, fiber.StatusForbidden},
+		{"service account without scopes", identity.Identity{ClientID: "reports"}, fiber.StatusForbidden},
+		// an API key grants the permissions among its scopes the user still has
+		{"api key with the scope", identity.Identity{UserID: "1", TokenID: "key-1", Scopes: []string{service.PermissionAssignRoles}, APIKey: true}, fiber.StatusOK},
+		{"api key without the scope", identity.Identity{UserID: "1", TokenID: "key-1", Scopes: []string{service.PermissionListUsers}, APIKey: true}, fiber.StatusForbidden},
+		{"api key without scopes", identity.Identity{UserID: "1", TokenID: "key-1", APIKey: true}, fiber.StatusForbidden},
+		{"api key scope the user lost", identity.Identity{UserID: "2", TokenID: "key-2", Scopes: []string{service.PermissionAssignRoles}, APIKey: true}, fiber.StatusForbidden},
+		// the client ID is not a user ID, its permissions are not looked up
+		{"service account named like a user", identity.Identity{ClientID: "1"}, fiber.StatusForbidden},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := newIdentityRequest(http.MethodPut, "/api/user/42/roles", tc.id, "identity", now)
+			if got := doRequest(t, app, req); got != tc.wantStatus {
+				t.Errorf("status = %d, want %d", got, tc.wantStatus)
+			}
+		})
+	}
+
+	failing := newPermissionTestApp(&fakePermissions{err: errors.New("database is down")})
+	req := newIdentityRequest(http.MethodPut, "/api/user/42/roles", identity.Identity{UserID: "1"}, "identity", now)
+	if got := doRequest(t, failing, req); got != fiber.StatusInternalServerError {
+		t.Errorf("status when the permissions can not be loaded = %d, want %d", got, fiber.StatusInternalServerError)
+	}
+
+	// scopes are checked without the database
+	req = newIdentityRequest(http.MethodPut, "/api/user/42/roles", identity.Identity{ClientID: "reports", Scopes: []string{service.PermissionAssignRoles}}, "identity", now)
+	if got := doRequest(t, failing, req); got != fiber.StatusOK {
+		t.Errorf("service account status when the permissions can not be loaded = %d, want %d", got, fiber.StatusOK)
+	}
+
+	// without the identity middleware nobody is let through
+	bare := fiber.New()
+	bare.Put("/api/user/:id/roles", RequirePermission(users, service.PermissionAssignRoles), func(c *fiber.Ctx) error {
+		return c.SendString("OK")
+	})
+	if got := doRequest(t, bare, newIdentityRequest(http.MethodPut, "/api/user/42/roles", identity.Identity{UserID: "1"}, "identity", now)); got != fiber.StatusUnauthorized {
+		t.Errorf("status without an identity = %d, want %d", got, fiber.StatusUnauthorized)
+	}
+}
@@ -0,0 +1,154 @@
+package passwordhash
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"user-service/internal/config"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+)
+
+// ErrUnknownFormat is returned for hashes that are not in a format the hasher can verify.
+var ErrUnknownFormat = errors.New("unknown password hash format")
+
+// Hasher hashes new passwords with the configured algorithm and verifies passwords against
+// hashes of every supported one. Hashes carry their algorithm, version and parameters, bcrypt
+// in its own format and argon2id in the PHC string format:
+//
+//	$argon2id$v=19$m=19456,t=2,p=1$<salt>$<key>
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Verify reports whether the password matches the hash, and if so whether the hash should
+	// be replaced because it was made with another algorithm or other parameters than new ones.
+	Verify(hash, password string) (match, rehash bool, err error)
+}
+
+type argon2Params struct {
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+}
+
+type hasher struct {
+	algorithm  string
+	bcryptCost int
+	argon2     argon2Params
+}
+
+// NewHasher returns the hasher of the config, or an error when its parameters are out of range.
+func NewHasher(cfg config.PasswordHashConfig) (Hasher, error) {
+	switch cfg.PasswordHashAlgorithm {
+	case config.PasswordHashBcrypt:
+		if cfg.PasswordBcryptCost < bcrypt.MinCost || cfg.PasswordBcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case config.PasswordHashArgon2id:
+		if cfg.PasswordArgon2Memory < 8*uint32(cfg.PasswordArgon2Parallelism) ||
+			cfg.PasswordArgon2Iterations < 1 || cfg.PasswordArgon2Parallelism < 1 {
+			return nil, errors.New("argon2id needs at least one iteration and thread, and 8 KiB of memory per thread")
+		}
+	default:
+		return nil, fmt.Errorf("unknown password hash algorithm %q", cfg.PasswordHashAlgorithm)
+	}
+
+	return &hasher{
+		algorithm:  cfg.PasswordHashAlgorithm,
+		bcryptCost: cfg.PasswordBcryptCost,
+		argon2: argon2Params{
+			memory:      cfg.PasswordArgon2Memory,
+			iterations:  cfg.PasswordArgon2Iterations,
+			parallelism: cfg.PasswordArgon2Parallelism,
+		},
+	}, nil
+}
+
+func (h *hasher) Hash(password string) (string, error) {
+	if h.algorithm == config.PasswordHashBcrypt {
+		hash, err := bcrypt.GenerateFromPassword([]byte(password), h.bcryptCost)
+		if err != nil {
+			return "", fmt.Errorf("failed to hash password: %w", err)
+		}
+		return string(hash), nil
+	}
+
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.argon2.iterations, h.argon2.memory, h.argon2.parallelism, argon2KeyLength)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, h.argon2.memory, h.argon2.iterations, h.argon2.parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+func (h *hasher) Verify(hash, password string) (bool, bool, error) {
+	if strings.HasPrefix(hash, "$argon2id$") {
+		return h.verifyArgon2id(hash, password)
+	}
+	return h.verifyBcrypt(hash, password)
+}
+
+func (h *hasher) verifyBcrypt(hash, password string) (bool, bool, error) {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return false, false, fmt.Errorf("%w: %v", ErrUnknownFormat, err)
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, fmt.Errorf("failed to verify password: %w", err)
+	}
+
+	return true, h.algorithm != config.PasswordHashBcrypt || cost != h.bcryptCost, nil
+}
+
+func (h *hasher) verifyArgon2id(hash, password string) (bool, bool, error) {
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return false, false, ErrUnknownFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return false, false, fmt.Errorf("%w: unsupported argon2 version %s", ErrUnknownFormat, parts[2])
+	}
+
+	var params argon2Params
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.memory, &params.iterations, &params.parallelism); err != nil ||
+		params.iterations < 1 || params.parallelism < 1 {
+		return false, false, fmt.Errorf("%w: invalid argon2 parameters %s", ErrUnknownFormat, parts[3])
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return false, false, fmt.Errorf("%w: invalid argon2 salt", ErrUnknownFormat)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return false, false, fmt.Errorf("%w: invalid argon2 key", ErrUnknownFormat)
+	}
+
+	candidate := argon2.IDKey([]byte(password), salt, params.iterations, params.memory, params.parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(candidate, key) != 1 {
+		return false, false, nil
+	}
+
+	outdated := h.algorithm != config.PasswordHashArgon2id || params != h.argon2 ||
+		len(salt) != argon2SaltLength || len(key) != argon2KeyLength
+	return true, outdated, nil
+}
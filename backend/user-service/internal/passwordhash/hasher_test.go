@@ -0,0 +1,161 @@
+package passwordhash
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"user-service/internal/config"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newArgon2Hasher(t testing.TB, memory, iterations uint32, parallelism uint8) Hasher {
+	t.Helper()
+
+	hasher, err := NewHasher(config.PasswordHashConfig{
+		PasswordHashAlgorithm:     config.PasswordHashArgon2id,
+		PasswordArgon2Memory:      memory,
+		PasswordArgon2Iterations:  iterations,
+		PasswordArgon2Parallelism: parallelism,
+	})
+	if err != nil {
+		t.Fatalf("NewHasher() error: %v", err)
+	}
+	return hasher
+}
+
+func newBcryptHasher(t testing.TB, cost int) Hasher {
+	t.Helper()
+
+	hasher, err := NewHasher(config.PasswordHashConfig{
+		PasswordHashAlgorithm: config.PasswordHashBcrypt,
+		PasswordBcryptCost:    cost,
+	})
+	if err != nil {
+		t.Fatalf("NewHasher() error: %v", err)
+	}
+	return hasher
+}
+
+func mustHash(t *testing.T, hasher Hasher, password string) string {
+	t.Helper()
+
+	hash, err := hasher.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash() error: %v", err)
+	}
+	return hash
+}
+
+func TestHasher_Verify(t *testing.T) {
+	argon2Hasher := newArgon2Hasher(t, 64, 1, 1)
+	bcryptHasher := newBcryptHasher(t, bcrypt.MinCost)
+
+	argon2Hash := mustHash(t, argon2Hasher, "password")
+	if !strings.HasPrefix(argon2Hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Fatalf("Hash() = %q, want an argon2id hash with its parameters", argon2Hash)
+	}
+	if mustHash(t, argon2Hasher, "password") == argon2Hash {
+		t.Fatal("Hash() returned the same hash twice, want a new salt every time")
+	}
+	bcryptHash := mustHash(t, bcryptHasher, "password")
+
+	tests := []struct {
+		name       string
+		hasher     Hasher
+		hash       string
+		password   string
+		wantMatch  bool
+		wantRehash bool
+	}{
+		{"argon2id", argon2Hasher, argon2Hash, "password", true, false},
+		{"argon2id wrong password", argon2Hasher, argon2Hash, "Password", false, false},
+		{"argon2id with other parameters", newArgon2Hasher(t, 128, 1, 1), argon2Hash, "password", true, true},
+		{"argon2id under bcrypt", bcryptHasher, argon2Hash, "password", true, true},
+		{"bcrypt", bcryptHasher, bcryptHash, "password", true, false},
+		{"bcrypt wrong password", bcryptHasher, bcryptHash, "Password", false, false},
+		{"bcrypt with another cost", newBcryptHasher(t, bcrypt.MinCost+1), bcryptHash, "password", true, true},
+		{"bcrypt under argon2id", argon2Hasher, bcryptHash, "password", true, true},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			match, rehash, err := tc.hasher.Verify(tc.hash, tc.password)
+			if err != nil {
+				t.Fatalf("Verify() error: %v", err)
+			}
+			if match != tc.wantMatch || rehash != tc.wantRehash {
+				t.Fatalf("Verify() = %v, %v, want %v, %v", match, rehash, tc.wantMatch, tc.wantRehash)
+			}
+		})
+	}
+}
+
+func TestHasher_VerifyInvalidHashes(t *testing.T) {
+	hasher := newArgon2Hasher(t, 64, 1, 1)
+
+	for _, hash := range []string{
+		"",
+		"plaintext",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA",
+		"$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHQ$a2V5",
+		"$argon2id$v=19$m=64,t=0,p=1$c2FsdHNhbHQ$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$not base64!$a2V5",
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdHNhbHQ$",
+	} {
+		match, _, err := hasher.Verify(hash, "password")
+		if match || !errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("Verify(%q) = %v, %v, want ErrUnknownFormat", hash, match, err)
+		}
+	}
+}
+
+func TestNewHasher_RejectsInvalidConfig(t *testing.T) {
+	for name, cfg := range map[string]config.PasswordHashConfig{
+		"unknown algorithm":  {PasswordHashAlgorithm: "md5"},
+		"bcrypt cost":        {PasswordHashAlgorithm: config.PasswordHashBcrypt, PasswordBcryptCost: bcrypt.MaxCost + 1},
+		"argon2 iterations":  {PasswordHashAlgorithm: config.PasswordHashArgon2id, PasswordArgon2Memory: 64, PasswordArgon2Parallelism: 1},
+		"argon2 parallelism": {PasswordHashAlgorithm: config.PasswordHashArgon2id, PasswordArgon2Memory: 64, PasswordArgon2Iterations: 1},
+		"argon2 memory":      {PasswordHashAlgorithm: config.PasswordHashArgon2id, PasswordArgon2Memory: 8, PasswordArgon2Iterations: 1, PasswordArgon2Parallelism: 2},
+	} {
+		if _, err := NewHasher(cfg); err == nil {
+			t.Errorf("NewHasher() accepted an invalid config: %s", name)
+		}
+	}
+}
+
+// BenchmarkHash times one hash with candidate parameters. A login hashes once, so pick the
+// strongest parameters whose time per operation the servers can afford at peak login rate:
+//
+//	go test -run '^$' -bench Hash -benchmem ./internal/passwordhash
+func BenchmarkHash(b *testing.B) {
+	for _, params := range []struct {
+		memory      uint32
+		iterations  uint32
+		parallelism uint8
+	}{
+		{19 * 1024, 2, 1},
+		{46 * 1024, 1, 1},
+		{64 * 1024, 3, 1},
+		{64 * 1024, 3, 4},
+	} {
+		b.Run(fmt.Sprintf("argon2id/m=%d,t=%d,p=%d", params.memory, params.iterations, params.parallelism), func(b *testing.B) {
+			benchmarkHash(b, newArgon2Hasher(b, params.memory, params.iterations, params.parallelism))
+		})
+	}
+
+	for _, cost := range []int{10, 11, 12} {
+		b.Run(fmt.Sprintf("bcrypt/cost=%d", cost), func(b *testing.B) {
+			benchmarkHash(b, newBcryptHasher(b, cost))
+		})
+	}
+}
+
+func benchmarkHash(b *testing.B, hasher Hasher) {
+	b.ReportAllocs()
+	for b.Loop() {
+		if _, err := hasher.Hash("correct horse battery staple"); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"user-service/internal/entity"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type RoleGormRepository interface {
+	ListRoles(ctx context.Context) ([]*entity.Role, error)
+	GetUserRoles(ctx context.Context, userID string) ([]string, error)
+	// GetUserPermissions returns the permissions granted by any of the user's roles.
+	GetUserPermissions(ctx context.Context, userID string) ([]string, error)
+	AddUserRole(ctx context.Context, userID, role string) error
+	// SetUserRoles replaces every role of the user.
+	SetUserRoles(ctx context.Context, userID string, roles []string) error
+}
+
+type roleGormRepository struct {
+	db *gorm.DB
+}
+
+func NewRoleGormRepository(db *gorm.DB) RoleGormRepository {
+	return &roleGormRepository{db: db}
+}
+
+func (r *roleGormRepository) ListRoles(ctx context.Context) ([]*entity.Role, error) {
+	roles := []*entity.Role{}
+	result := r.db.WithContext(ctx).Order("name").Find(&roles)
+	if result.Error != nil {
+		return nil, fmt.Errorf("error listing roles: %w", result.Error)
+	}
+	return roles, nil
+}
+
+func (r *roleGormRepository) GetUserRoles(ctx context.Context, userID string) ([]string, error) {
+	roles := []string{}
+	result := r.db.WithContext(ctx).
+		Model(&entity.UserRole{}).
+		Where("user_id = ?", userID).
+		Order("role").
+		Pluck("role", &roles)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("error getting user roles: %w", result.Error)
+	}
+	return roles, nil
+}
+
+func (r *roleGormRepository) GetUserPermissions(ctx context.Context, userID string) ([]string, error) {
+	permissions := []string{}
+	result := r.db.WithContext(ctx).
+		Model(&entity.RolePermission{}).
+		Distinct("role_permissions.permission").
+		Joins("JOIN user_roles ON user_roles.role = role_permissions.role").
+		Where("user_roles.user_id = ?", userID).
+		Order("role_permissions.permission").
+		Pluck("role_permissions.permission", &permissions)
+
+	if result.Error != nil {
+		return nil, fmt.Errorf("error getting user permissions: %w", result.Error)
+	}
+	return permissions, nil
+}
+
+func (r *roleGormRepository) AddUserRole(ctx context.Context, userID, role string) error {
+	result := r.db.WithContext(ctx).
+		Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&entity.UserRole{UserID: userID, Role: role})
+
+	if result.Error != nil {
+		return fmt.Errorf("error adding user role: %w", result.Error)
+	}
+	return nil
+}
+
+func (r *roleGormRepository) SetUserRoles(ctx context.Context, userID string, roles []string) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&entity.UserRole{}).Error; err != nil {
+			return fmt.Errorf("error removing user roles: %w", err)
+		}
+
+		if len(roles) == 0 {
+			return nil
+		}
+
+		rows := make([]*entity.UserRole, 0, len(roles))
+		for _, role := range roles {
+			rows = append(rows, &entity.UserRole{UserID: userID, Role: role})
+		}
+
+		if err := tx.Create(&rows).Error; err != nil {
+			return fmt.Errorf("error setting user roles: %w", err)
+		}
+		return nil
+	})
+}
@@ -4,18 +4,70 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
+	"user-service/internal/apperror"
 	"user-service/internal/entity"
 
+	"github.com/jackc/pgx/v5/pgconn"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+var (
+	// ErrUserNotFound is returned for ids and emails without a user.
+	ErrUserNotFound = apperror.New(apperror.NotFound, "USER_NOT_FOUND", "user not found")
+	// ErrEmailTaken is returned for registering an email that has an account.
+	ErrEmailTaken = apperror.New(apperror.AlreadyExists, "EMAIL_TAKEN", "user already exists")
+	// ErrRegistrationKeyInUse is returned for an idempotency key another registration still holds.
+	ErrRegistrationKeyInUse = apperror.Invalid("idempotency_key", "IDEMPOTENCY_KEY_IN_USE", "idempotency key belongs to another registration")
+)
+
+// The email arguments named normalizedEmail are looked up in email_normalized, see emailaddr.
 type UserGormRepository interface {
-	GetUserByEmail(ctx context.Context, email string) (*entity.User, error)
+	GetUserByEmail(ctx context.Context, normalizedEmail string) (*entity.User, error)
 	GetUserByID(ctx context.Context, id string) (*entity.User, error)
-	CheckUserExistsByEmail(ctx context.Context, email string) (bool, error)
-	RegisterUser(ctx context.Context, email string, hashedPassword []byte) (string, error)
+	CheckUserExistsByEmail(ctx context.Context, normalizedEmail string) (bool, error)
+	// RegisterUser creates the user together with its initial roles, returns ErrEmailTaken if the
+	// email has an account. A non-empty idempotency key is stored with the user and held for keyTTL,
+	// ErrRegistrationKeyInUse is returned while another registration holds it.
+	RegisterUser(ctx context.Context, email, normalizedEmail string, hashedPassword []byte, roles []string, idempotencyKey string, keyTTL time.Duration) (string, error)
+	// GetUserByRegistrationKey returns the user a registration with the idempotency key created
+	// within keyTTL, or ErrUserNotFound.
+	GetUserByRegistrationKey(ctx context.Context, idempotencyKey string, keyTTL time.Duration) (*entity.User, error)
+	// DeleteUser removes a user whose email is not verified yet together with their roles. With an
+	// idempotency key it only removes the user the registration with the key created. Returns
+	// ErrUserNotFound for any other id.
+	DeleteUser(ctx context.Context, id, idempotencyKey string) error
 	GetAllUsers(ctx context.Context) ([]*entity.User, error)
 	GetUsersCount(ctx context.Context) (int32, error)
+	// UpdatePassword stores a new password hash, returns ErrUserNotFound for an unknown id.
+	UpdatePassword(ctx context.Context, id string, hashedPassword []byte) error
+	// RehashPassword replaces the password hash only while it is still currentHash and reports
+	// whether it did.
+	RehashPassword(ctx context.Context, id string, currentHash, hashedPassword []byte) (bool, error)
+	// MarkEmailVerified marks the email as verified if it is still the user's email and reports
+	// whether it is verified now.
+	MarkEmailVerified(ctx context.Context, id, normalizedEmail string) (bool, error)
+	// SetPendingEmail stores the email the user asked to change to, returns ErrUserNotFound for
+	// an unknown id.
+	SetPendingEmail(ctx context.Context, id, email string) error
+	// ChangeEmail replaces the email with the pending one if it is still email, marks it verified
+	// and reports whether it did. Returns ErrEmailTaken if another account has it by now.
+	ChangeEmail(ctx context.Context, id, email, normalizedEmail string) (bool, error)
+	// ListUserEmails returns the id, email and normalized email of up to limit users with an id
+	// after afterID, ordered by id.
+	ListUserEmails(ctx context.Context, afterID string, limit int) ([]*entity.User, error)
+	// SetEmailNormalized replaces the normalized email and forgets a collision of the user, returns
+	// ErrEmailTaken if another account has it.
+	SetEmailNormalized(ctx context.Context, id, normalizedEmail string) error
+	// RecordEmailCollision notes that the user's email normalizes to the email of another account.
+	RecordEmailCollision(ctx context.Context, id, normalizedEmail string) error
+	// MoveEmailNormalized gives the normalized email of the account fromID to the user and records
+	// fromID as colliding with them, it keeps its email but none is normalized. Returns
+	// ErrEmailTaken if a third account has the normalized email.
+	MoveEmailNormalized(ctx context.Context, id, fromID, normalizedEmail string) error
+	// UpdateUserProfile sets the given profile columns, returns ErrUserNotFound for an unknown id.
+	UpdateUserProfile(ctx context.Context, id string, updates map[string]any) error
 }
 
 type userGormRepository struct {
@@ -35,12 +87,12 @@ func (u *userGormRepository) GetUsersCount(ctx context.Context) (int32, error) {
 	return int32(count), nil
 }
 
-func (u *userGormRepository) GetUserByEmail(ctx context.Context, email string) (*entity.User, error) {
+func (u *userGormRepository) GetUserByEmail(ctx context.Context, normalizedEmail string) (*entity.User, error) {
 	user := &entity.User{}
-	result := u.db.WithContext(ctx).Where("email = ?", email).First(user)
+	result := u.db.WithContext(ctx).Where("email_normalized = ?", normalizedEmail).First(user)
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("user not found: %w", result.Error)
+			return nil, ErrUserNotFound
 		}
 		return nil, fmt.Errorf("error getting user by email: %w", result.Error)
 	}
@@ -49,20 +101,20 @@ func (u *userGormRepository) GetUserByEmail(ctx context.Context, email string) (
 
 func (u *userGormRepository) GetUserByID(ctx context.Context, id string) (*entity.User, error) {
 	user := &entity.User{}
-	result := u.db.WithContext(ctx).Select("id, email").Where("id = ?", id).First(user)
+	result := u.db.WithContext(ctx).Select("id, email, display_name, avatar_url, locale, timezone, email_verified_at, email_normalized, pending_email").Where("id = ?", id).First(user)
 
 	if result.Error != nil {
 		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
-			return nil, fmt.Errorf("user not found: %w", result.Error)
+			return nil, ErrUserNotFound
 		}
 		return nil, fmt.Errorf("error getting user by id: %w", result.Error)
 	}
 	return user, nil
 }
 
-func (u *userGormRepository) CheckUserExistsByEmail(ctx context.Context, email string) (bool, error) {
+func (u *userGormRepository) CheckUserExistsByEmail(ctx context.Context, normalizedEmail string) (bool, error) {
 	var count int64
-	result := u.db.WithContext(ctx).Model(&entity.User{}).Where("email = ?", email).Count(&count)
+	result := u.db.WithContext(ctx).Model(&entity.User{}).Where("email_normalized = ?", normalizedEmail).Count(&count)
 
 	if result.Error != nil {
 		return false, fmt.Errorf("check user exists by email error: %w", result.Error)
@@ -71,20 +123,86 @@ func (u *userGormRepository) CheckUserExistsByEmail(ctx context.Context, email s
 	return count > 0, nil
 }
 
-func (u *userGormRepository) RegisterUser(ctx context.Context, email string, hashedPassword []byte) (string, error) {
+func (u *userGormRepository) RegisterUser(ctx context.Context, email, normalizedEmail string, hashedPassword []byte, roles []string, idempotencyKey string, keyTTL time.Duration) (string, error) {
 	user := &entity.User{
-		Email:    email,
-		Password: string(hashedPassword),
+		Email:           email,
+		EmailNormalized: &normalizedEmail,
+		Password:        string(hashedPassword),
 	}
 
-	result := u.db.WithContext(ctx).Create(user)
-	if result.Error != nil {
-		return "", fmt.Errorf("error registering user: %w", result.Error)
+	err := u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// the unique indexes decide concurrent registrations of the same email
+		if err := tx.Create(user).Error; err != nil {
+			if isUniqueViolation(err) {
+				return ErrEmailTaken
+			}
+			return err
+		}
+
+		for _, role := range roles {
+			if err := tx.Create(&entity.UserRole{UserID: user.ID, Role: role}).Error; err != nil {
+				return err
+			}
+		}
+
+		if idempotencyKey == "" {
+			return nil
+		}
+
+		// an expired key is taken over, a held one leaves the insert without effect
+		now := time.Now()
+		result := tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "key"}},
+			DoUpdates: clause.AssignmentColumns([]string{"user_id", "created_at"}),
+			Where: clause.Where{Exprs: []clause.Expression{
+				gorm.Expr("registration_keys.created_at < ?", now.Add(-keyTTL)),
+			}},
+		}).Create(&entity.RegistrationKey{Key: idempotencyKey, UserID: user.ID, CreatedAt: now})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRegistrationKeyInUse
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("error registering user: %w", err)
 	}
 
 	return user.ID, nil
 }
 
+func (u *userGormRepository) GetUserByRegistrationKey(ctx context.Context, idempotencyKey string, keyTTL time.Duration) (*entity.User, error) {
+	user := &entity.User{}
+	result := u.db.WithContext(ctx).
+		Where("id = (SELECT user_id FROM registration_keys WHERE key = ? AND created_at >= ?)", idempotencyKey, time.Now().Add(-keyTTL)).
+		First(user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, fmt.Errorf("error getting user by registration key: %w", result.Error)
+	}
+	return user, nil
+}
+
+func (u *userGormRepository) DeleteUser(ctx context.Context, id, idempotencyKey string) error {
+	// a verified account or one another registration created is not a failed registration
+	query := u.db.WithContext(ctx).Where("id = ? AND email_verified_at IS NULL", id)
+	if idempotencyKey != "" {
+		query = query.Where("id IN (SELECT user_id FROM registration_keys WHERE key = ?)", idempotencyKey)
+	}
+	result := query.Delete(&entity.User{})
+	if result.Error != nil {
+		return fmt.Errorf("error deleting user: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
 func (u *userGormRepository) GetAllUsers(ctx context.Context) ([]*entity.User, error) {
 	users := []*entity.User{}
 	result := u.db.WithContext(ctx).Select("id, email").Find(&users)
@@ -94,3 +212,206 @@ func (u *userGormRepository) GetAllUsers(ctx context.Context) ([]*entity.User, e
 	}
 	return users, nil
 }
+
+func (u *userGormRepository) UpdateUserProfile(ctx context.Context, id string, updates map[string]any) error {
+	result := u.db.WithContext(ctx).Model(&entity.User{}).Where("id = ?", id).Updates(updates)
+	if result.Error != nil {
+		return fmt.Errorf("error updating user profile: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (u *userGormRepository) UpdatePassword(ctx context.Context, id string, hashedPassword []byte) error {
+	result := u.db.WithContext(ctx).Model(&entity.User{}).Where("id = ?", id).Update("password", string(hashedPassword))
+	if result.Error != nil {
+		return fmt.Errorf("error updating password: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (u *userGormRepository) RehashPassword(ctx context.Context, id string, currentHash, hashedPassword []byte) (bool, error) {
+	// the hash condition keeps a password changed in the meantime from being overwritten
+	result := u.db.WithContext(ctx).
+		Model(&entity.User{}).
+		Where("id = ? AND password = ?", id, string(currentHash)).
+		Update("password", string(hashedPassword))
+	if result.Error != nil {
+		return false, fmt.Errorf("error rehashing password: %w", result.Error)
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+func (u *userGormRepository) MarkEmailVerified(ctx context.Context, id, normalizedEmail string) (bool, error) {
+	user := &entity.User{}
+	result := u.db.WithContext(ctx).Select("id, email_normalized, email_verified_at").Where("id = ?", id).First(user)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return false, ErrUserNotFound
+		}
+		return false, fmt.Errorf("error getting user by id: %w", result.Error)
+	}
+
+	if user.EmailNormalized == nil || *user.EmailNormalized != normalizedEmail {
+		return false, nil
+	}
+	if user.EmailVerifiedAt != nil {
+		return true, nil
+	}
+
+	// the email condition keeps a concurrent email change from being verified by the old link
+	result = u.db.WithContext(ctx).
+		Model(&entity.User{}).
+		Where("id = ? AND email_normalized = ?", id, normalizedEmail).
+		Update("email_verified_at", time.Now())
+	if result.Error != nil {
+		return false, fmt.Errorf("error marking email verified: %w", result.Error)
+	}
+
+	return result.RowsAffected > 0, nil
+}
+
+func (u *userGormRepository) SetPendingEmail(ctx context.Context, id, email string) error {
+	result := u.db.WithContext(ctx).Model(&entity.User{}).Where("id = ?", id).Update("pending_email", email)
+	if result.Error != nil {
+		return fmt.Errorf("error setting pending email: %w", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (u *userGormRepository) ChangeEmail(ctx context.Context, id, email, normalizedEmail string) (bool, error) {
+	var changed bool
+	err := u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		// the pending email condition keeps a link for an address asked for earlier from applying
+		result := tx.Model(&entity.User{}).
+			Where("id = ? AND pending_email = ?", id, email).
+			Updates(map[string]any{
+				"email":             email,
+				"email_normalized":  normalizedEmail,
+				"email_verified_at": time.Now(),
+				"pending_email":     nil,
+			})
+		if result.Error != nil {
+			if isUniqueViolation(result.Error) {
+				return ErrEmailTaken
+			}
+			return result.Error
+		}
+		changed = result.RowsAffected > 0
+		if !changed {
+			return nil
+		}
+
+		// a collision of the old email is resolved by the new one
+		return tx.Where("user_id = ?", id).Delete(&entity.EmailCollision{}).Error
+	})
+	if err != nil {
+		return false, fmt.Errorf("error changing email: %w", err)
+	}
+	return changed, nil
+}
+
+func (u *userGormRepository) ListUserEmails(ctx context.Context, afterID string, limit int) ([]*entity.User, error) {
+	users := []*entity.User{}
+	result := u.db.WithContext(ctx).
+		Select("id, email, email_normalized").
+		Where("id > ?", afterID).
+		Order("id").
+		Limit(limit).
+		Find(&users)
+	if result.Error != nil {
+		return nil, fmt.Errorf("error listing user emails: %w", result.Error)
+	}
+	return users, nil
+}
+
+func (u *userGormRepository) SetEmailNormalized(ctx context.Context, id, normalizedEmail string) error {
+	err := u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		err := tx.Model(&entity.User{}).Where("id = ?", id).Update("email_normalized", normalizedEmail).Error
+		if err != nil {
+			if isUniqueViolation(err) {
+				return ErrEmailTaken
+			}
+			return err
+		}
+
+		return tx.Where("user_id = ?", id).Delete(&entity.EmailCollision{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("error setting normalized email: %w", err)
+	}
+	return nil
+}
+
+func (u *userGormRepository) RecordEmailCollision(ctx context.Context, id, normalizedEmail string) error {
+	collision := &entity.EmailCollision{UserID: id, EmailNormalized: normalizedEmail, FoundAt: time.Now()}
+
+	var kept entity.User
+	result := u.db.WithContext(ctx).Select("id").Where("email_normalized = ?", normalizedEmail).Limit(1).Find(&kept)
+	if result.Error != nil {
+		return fmt.Errorf("error finding the account with the email: %w", result.Error)
+	}
+	if result.RowsAffected > 0 {
+		collision.KeptUserID = &kept.ID
+	}
+
+	result = u.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"email_normalized", "kept_user_id", "found_at"}),
+	}).Create(collision)
+	if result.Error != nil {
+		return fmt.Errorf("error recording email collision: %w", result.Error)
+	}
+	return nil
+}
+
+func (u *userGormRepository) MoveEmailNormalized(ctx context.Context, id, fromID, normalizedEmail string) error {
+	err := u.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&entity.User{}).
+			Where("id = ? AND email_normalized = ?", fromID, normalizedEmail).
+			Update("email_normalized", nil)
+		if result.Error != nil {
+			return result.Error
+		}
+		// fromID may have changed its email meanwhile, then it does not collide
+		if result.RowsAffected > 0 {
+			collision := &entity.EmailCollision{UserID: fromID, EmailNormalized: normalizedEmail, KeptUserID: &id, FoundAt: time.Now()}
+			err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}},
+				DoUpdates: clause.AssignmentColumns([]string{"email_normalized", "kept_user_id", "found_at"}),
+			}).Create(collision).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		err := tx.Model(&entity.User{}).Where("id = ?", id).Update("email_normalized", normalizedEmail).Error
+		if err != nil {
+			if isUniqueViolation(err) {
+				return ErrEmailTaken
+			}
+			return err
+		}
+
+		return tx.Where("user_id = ?", id).Delete(&entity.EmailCollision{}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("error moving normalized email: %w", err)
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether err is a Postgres unique_violation.
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
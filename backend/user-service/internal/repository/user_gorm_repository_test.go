@@ -0,0 +1,279 @@
+package repository
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func newTestUserRepository(t *testing.T) (UserGormRepository, sqlmock.Sqlmock) {
+	t.Helper()
+
+	sqlDB, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("sqlmock.New() error: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+
+	// statements outside of RegisterUser run on their own, as with the default transactions
+	db, err := gorm.Open(postgres.New(postgres.Config{Conn: sqlDB}), &gorm.Config{SkipDefaultTransaction: true})
+	if err != nil {
+		t.Fatalf("gorm.Open() error: %v", err)
+	}
+	return NewUserGormRepository(db), mock
+}
+
+// timeBefore matches a timestamp within a second before the wanted age.
+type timeBefore time.Duration
+
+func (age timeBefore) Match(v driver.Value) bool {
+	at, ok := v.(time.Time)
+	want := time.Now().Add(-time.Duration(age))
+	return ok && !at.After(want) && want.Sub(at) < time.Second
+}
+
+const (
+	insertUserQuery = `INSERT INTO "users" ("email","password","display_name","avatar_url","locale","timezone","email_verified_at","email_normalized","pending_email") VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9) RETURNING "id"`
+	insertRoleQuery = `INSERT INTO "user_roles" ("user_id","role") VALUES ($1,$2)`
+	// an expired key is taken over, a held one is left alone
+	insertKeyQuery = `INSERT INTO "registration_keys" ("key","user_id","created_at") VALUES ($1,$2,$3) ON CONFLICT ("key") DO UPDATE SET "user_id"="excluded"."user_id","created_at"="excluded"."created_at" WHERE registration_keys.created_at < $4`
+)
+
+func expectInsertUser(mock sqlmock.Sqlmock) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta(insertUserQuery)).
+		WithArgs("alice@example.com", "hash", "", "", "", "", nil, "alice@example.com", nil).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("7"))
+	mock.ExpectExec(regexp.QuoteMeta(insertRoleQuery)).
+		WithArgs("7", "user").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func TestUserGormRepository_RegisterUser(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("without a key", func(t *testing.T) {
+		repo, mock := newTestUserRepository(t)
+		expectInsertUser(mock)
+		mock.ExpectCommit()
+
+		id, err := repo.RegisterUser(ctx, "alice@example.com", "alice@example.com", []byte("hash"), []string{"user"}, "", time.Hour)
+		if err != nil || id != "7" {
+			t.Errorf("RegisterUser() = %q, %v, want user 7", id, err)
+		}
+	})
+
+	t.Run("free or expired key", func(t *testing.T) {
+		repo, mock := newTestUserRepository(t)
+		expectInsertUser(mock)
+		mock.ExpectExec(regexp.QuoteMeta(insertKeyQuery)).
+			WithArgs("key-1", "7", timeBefore(0), timeBefore(time.Hour)).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		id, err := repo.RegisterUser(ctx, "alice@example.com", "alice@example.com", []byte("hash"), []string{"user"}, "key-1", time.Hour)
+		if err != nil || id != "7" {
+			t.Errorf("RegisterUser() = %q, %v, want user 7", id, err)
+		}
+	})
+
+	t.Run("held key", func(t *testing.T) {
+		repo, mock := newTestUserRepository(t)
+		expectInsertUser(mock)
+		// the conflict condition did not hold, nothing was written
+		mock.ExpectExec(regexp.QuoteMeta(insertKeyQuery)).
+			WithArgs("key-1", "7", timeBefore(0), timeBefore(time.Hour)).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		_, err := repo.RegisterUser(ctx, "alice@example.com", "alice@example.com", []byte("hash"), []string{"user"}, "key-1", time.Hour)
+		if !errors.Is(err, ErrRegistrationKeyInUse) {
+			t.Errorf("RegisterUser() error = %v, want ErrRegistrationKeyInUse", err)
+		}
+	})
+
+	t.Run("email taken", func(t *testing.T) {
+		repo, mock := newTestUserRepository(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserQuery)).
+			WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "users_email_normalized_key"})
+		mock.ExpectRollback()
+
+		_, err := repo.RegisterUser(ctx, "alice@example.com", "alice@example.com", []byte("hash"), []string{"user"}, "key-1", time.Hour)
+		if !errors.Is(err, ErrEmailTaken) {
+			t.Errorf("RegisterUser() error = %v, want ErrEmailTaken", err)
+		}
+	})
+
+	t.Run("other error", func(t *testing.T) {
+		repo, mock := newTestUserRepository(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery(regexp.QuoteMeta(insertUserQuery)).
+			WillReturnError(&pgconn.PgError{Code: "23502", ColumnName: "password"})
+		mock.ExpectRollback()
+
+		_, err := repo.RegisterUser(ctx, "alice@example.com", "alice@example.com", []byte("hash"), []string{"user"}, "", time.Hour)
+		if err == nil || errors.Is(err, ErrEmailTaken) {
+			t.Errorf("RegisterUser() error = %v, want the database error", err)
+		}
+	})
+}
+
+func TestUserGormRepository_DeleteUser(t *testing.T) {
+	ctx := context.Background()
+	const (
+		deleteQuery      = `DELETE FROM "users" WHERE id = $1 AND email_verified_at IS NULL`
+		deleteByKeyQuery = `DELETE FROM "users" WHERE (id = $1 AND email_verified_at IS NULL) AND id IN (SELECT user_id FROM registration_keys WHERE key = $2)`
+	)
+
+	t.Run("unverified", func(t *testing.T) {
+		repo, mock := newTestUserRepository(t)
+		mock.ExpectExec(regexp.QuoteMeta(deleteQuery)).WithArgs("7").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		if err := repo.DeleteUser(ctx, "7", ""); err != nil {
+			t.Errorf("DeleteUser() error: %v", err)
+		}
+	})
+
+	t.Run("created with the key", func(t *testing.T) {
+		repo, mock := newTestUserRepository(t)
+		mock.ExpectExec(regexp.QuoteMeta(deleteByKeyQuery)).WithArgs("7", "key-1").WillReturnResult(sqlmock.NewResult(0, 1))
+
+		if err := repo.DeleteUser(ctx, "7", "key-1"); err != nil {
+			t.Errorf("DeleteUser() error: %v", err)
+		}
+	})
+
+	// verified, created by another registration or deleted already
+	t.Run("other user", func(t *testing.T) {
+		repo, mock := newTestUserRepository(t)
+		mock.ExpectExec(regexp.QuoteMeta(deleteByKeyQuery)).WithArgs("7", "key-1").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		if err := repo.DeleteUser(ctx, "7", "key-1"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("DeleteUser() error = %v, want ErrUserNotFound", err)
+		}
+	})
+}
+
+func TestUserGormRepository_LooksUpNormalizedEmail(t *testing.T) {
+	ctx := context.Background()
+	repo, mock := newTestUserRepository(t)
+
+	// the lookups never compare the email as given
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE email_normalized = $1 ORDER BY "users"."id" LIMIT $2`)).
+		WithArgs("jdoe@gmail.com", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "email_normalized"}).AddRow("7", "J.Doe@gmail.com", "jdoe@gmail.com"))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT * FROM "users" WHERE email_normalized = $1 ORDER BY "users"."id" LIMIT $2`)).
+		WithArgs("nobody@gmail.com", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}))
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT count(*) FROM "users" WHERE email_normalized = $1`)).
+		WithArgs("jdoe@gmail.com").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(1))
+
+	user, err := repo.GetUserByEmail(ctx, "jdoe@gmail.com")
+	if err != nil || user.ID != "7" || user.Email != "J.Doe@gmail.com" {
+		t.Errorf("GetUserByEmail() = %+v, %v, want user 7 with the email as given", user, err)
+	}
+	if _, err := repo.GetUserByEmail(ctx, "nobody@gmail.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUserByEmail() of an unknown email error = %v, want ErrUserNotFound", err)
+	}
+	if exists, err := repo.CheckUserExistsByEmail(ctx, "jdoe@gmail.com"); err != nil || !exists {
+		t.Errorf("CheckUserExistsByEmail() = %v, %v, want true", exists, err)
+	}
+}
+
+const (
+	setNormalizedQuery   = `UPDATE "users" SET "email_normalized"=$1 WHERE id = $2`
+	deleteCollisionQuery = `DELETE FROM "email_collisions" WHERE user_id = $1`
+	upsertCollisionQuery = `INSERT INTO "email_collisions" ("user_id","email_normalized","kept_user_id","found_at") VALUES ($1,$2,$3,$4) ON CONFLICT ("user_id") DO UPDATE SET "email_normalized"="excluded"."email_normalized","kept_user_id"="excluded"."kept_user_id","found_at"="excluded"."found_at"`
+	clearNormalizedQuery = `UPDATE "users" SET "email_normalized"=$1 WHERE id = $2 AND email_normalized = $3`
+)
+
+func TestUserGormRepository_SetEmailNormalized(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("free", func(t *testing.T) {
+		repo, mock := newTestUserRepository(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(setNormalizedQuery)).WithArgs("jdoe@gmail.com", "7").WillReturnResult(sqlmock.NewResult(0, 1))
+		// a resolved collision is forgotten
+		mock.ExpectExec(regexp.QuoteMeta(deleteCollisionQuery)).WithArgs("7").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		if err := repo.SetEmailNormalized(ctx, "7", "jdoe@gmail.com"); err != nil {
+			t.Errorf("SetEmailNormalized() error: %v", err)
+		}
+	})
+
+	t.Run("taken", func(t *testing.T) {
+		repo, mock := newTestUserRepository(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(setNormalizedQuery)).
+			WithArgs("jdoe@gmail.com", "7").
+			WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "users_email_normalized_key"})
+		mock.ExpectRollback()
+
+		if err := repo.SetEmailNormalized(ctx, "7", "jdoe@gmail.com"); !errors.Is(err, ErrEmailTaken) {
+			t.Errorf("SetEmailNormalized() error = %v, want ErrEmailTaken", err)
+		}
+	})
+}
+
+func TestUserGormRepository_RecordEmailCollision(t *testing.T) {
+	repo, mock := newTestUserRepository(t)
+	mock.ExpectQuery(regexp.QuoteMeta(`SELECT "id" FROM "users" WHERE email_normalized = $1 LIMIT $2`)).
+		WithArgs("jdoe@gmail.com", 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow("3"))
+	mock.ExpectExec(regexp.QuoteMeta(upsertCollisionQuery)).
+		WithArgs("7", "jdoe@gmail.com", "3", timeBefore(0)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := repo.RecordEmailCollision(context.Background(), "7", "jdoe@gmail.com"); err != nil {
+		t.Errorf("RecordEmailCollision() error: %v", err)
+	}
+}
+
+func TestUserGormRepository_MoveEmailNormalized(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("held by the newer account", func(t *testing.T) {
+		repo, mock := newTestUserRepository(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(clearNormalizedQuery)).WithArgs(nil, "9", "jdoe@gmail.com").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(upsertCollisionQuery)).WithArgs("9", "jdoe@gmail.com", "7", timeBefore(0)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(setNormalizedQuery)).WithArgs("jdoe@gmail.com", "7").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(regexp.QuoteMeta(deleteCollisionQuery)).WithArgs("7").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+
+		if err := repo.MoveEmailNormalized(ctx, "7", "9", "jdoe@gmail.com"); err != nil {
+			t.Errorf("MoveEmailNormalized() error: %v", err)
+		}
+	})
+
+	// the newer account changed its email meanwhile and does not collide, a third one took it
+	t.Run("taken meanwhile", func(t *testing.T) {
+		repo, mock := newTestUserRepository(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(regexp.QuoteMeta(clearNormalizedQuery)).WithArgs(nil, "9", "jdoe@gmail.com").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(regexp.QuoteMeta(setNormalizedQuery)).
+			WithArgs("jdoe@gmail.com", "7").
+			WillReturnError(&pgconn.PgError{Code: "23505", ConstraintName: "users_email_normalized_key"})
+		mock.ExpectRollback()
+
+		if err := repo.MoveEmailNormalized(ctx, "7", "9", "jdoe@gmail.com"); !errors.Is(err, ErrEmailTaken) {
+			t.Errorf("MoveEmailNormalized() error = %v, want ErrEmailTaken", err)
+		}
+	})
+}
@@ -7,11 +7,14 @@ import (
 	"gorm.io/gorm"
 
 	"time"
+	"user-service/internal/config"
 	httpHandler "user-service/internal/handler/http"
 	"user-service/internal/logger"
+	"user-service/internal/middleware"
+	"user-service/internal/service"
 )
 
-func SetupRoutes(app *fiber.App, handlers httpHandler.Handlers, db *gorm.DB) {
+func SetupRoutes(app *fiber.App, handlers httpHandler.Handlers, userService service.UserService, db *gorm.DB, cfg config.Config) {
 	app.Get("/health", func(c *fiber.Ctx) error {
 		logger.Log.Info().Msg("Health check passed")
 		return c.SendString("OK")
@@ -38,7 +41,11 @@ func SetupRoutes(app *fiber.App, handlers httpHandler.Handlers, db *gorm.DB) {
 	})
 
 	api := app.Group("/api")
-	user := api.Group("/user")
+	user := api.Group("/user", middleware.Identity(cfg))
 
-	user.Get("/get-all", handlers.GetAllUsers)
+	user.Get("/me", middleware.RequireUser(), handlers.GetMe)
+	user.Patch("/me", middleware.RequireUser(), handlers.UpdateMe)
+
+	user.Get("/get-all", middleware.RequirePermission(userService, service.PermissionListUsers), handlers.GetAllUsers)
+	user.Put("/:id/roles", middleware.RequirePermission(userService, service.PermissionAssignRoles), handlers.SetUserRoles)
 }
@@ -19,7 +19,7 @@ func (s *GRPCServer) Run(port string, handlers *grpcHandler.UserHandler) error {
 		return err
 	}
 
-	s.GRPCServer = grpc.NewServer()
+	s.GRPCServer = grpc.NewServer(grpc.UnaryInterceptor(grpcHandler.ErrorInterceptor))
 	userpb.RegisterUserServiceServer(s.GRPCServer, handlers)
 	return s.GRPCServer.Serve(lis)
 }
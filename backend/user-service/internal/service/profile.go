@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf8"
+	"user-service/internal/apperror"
+	"user-service/internal/logger"
+
+	// the runtime image has no zoneinfo, embed it so time zones can be validated
+	_ "time/tzdata"
+
+	"golang.org/x/text/language"
+)
+
+const (
+	maxDisplayNameLength = 100
+	maxAvatarURLLength   = 2048
+)
+
+// Profile is what a user sees and edits about themselves. PendingEmail replaces Email once the
+// user follows the link sent to it.
+type Profile struct {
+	ID            string   `json:"id"`
+	Email         string   `json:"email"`
+	EmailVerified bool     `json:"email_verified"`
+	PendingEmail  string   `json:"pending_email,omitempty"`
+	DisplayName   string   `json:"display_name"`
+	AvatarURL     string   `json:"avatar_url"`
+	Locale        string   `json:"locale"`
+	Timezone      string   `json:"timezone"`
+	Roles         []string `json:"roles"`
+}
+
+// ProfileUpdate holds the fields to change, nil leaves a field as is and an empty string clears it.
+// The email is not part of the profile, see UserService.RequestEmailChange.
+type ProfileUpdate struct {
+	DisplayName *string
+	AvatarURL   *string
+	Locale      *string
+	Timezone    *string
+}
+
+func (s *userService) GetProfile(ctx context.Context, id string) (*Profile, error) {
+	user, err := s.repo.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := s.roleRepo.GetUserRoles(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	profile := &Profile{
+		ID:            user.ID,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		DisplayName:   user.DisplayName,
+		AvatarURL:     user.AvatarURL,
+		Locale:        user.Locale,
+		Timezone:      user.Timezone,
+		Roles:         roles,
+	}
+	if user.PendingEmail != nil {
+		profile.PendingEmail = *user.PendingEmail
+	}
+
+	return profile, nil
+}
+
+func (s *userService) UpdateProfile(ctx context.Context, id string, update ProfileUpdate) (*Profile, error) {
+	updates, err := profileUpdates(update)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(updates) > 0 {
+		if err := s.repo.UpdateUserProfile(ctx, id, updates); err != nil {
+			return nil, err
+		}
+
+		logger.Log.Info().
+			Str("user_id", id).
+			Msg("user profile updated")
+	}
+
+	return s.GetProfile(ctx, id)
+}
+
+// profileUpdates validates and normalizes the update into the columns to set.
+func profileUpdates(update ProfileUpdate) (map[string]any, error) {
+	updates := map[string]any{}
+
+	if update.DisplayName != nil {
+		name := strings.TrimSpace(*update.DisplayName)
+		if utf8.RuneCountInString(name) > maxDisplayNameLength {
+			return nil, apperror.Invalid("display_name", "TOO_LONG", fmt.Sprintf("display_name must be at most %d characters", maxDisplayNameLength))
+		}
+		updates["display_name"] = name
+	}
+
+	if update.AvatarURL != nil {
+		avatar := strings.TrimSpace(*update.AvatarURL)
+		if avatar != "" {
+			u, err := url.Parse(avatar)
+			if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" || len(avatar) > maxAvatarURLLength {
+				return nil, apperror.Invalid("avatar_url", "INVALID_URL", "avatar_url must be an http or https URL")
+			}
+		}
+		updates["avatar_url"] = avatar
+	}
+
+	if update.Locale != nil {
+		locale := strings.TrimSpace(*update.Locale)
+		if locale != "" {
+			tag, err := language.Parse(locale)
+			if err != nil {
+				return nil, apperror.Invalid("locale", "INVALID_LOCALE", "locale must be a BCP 47 language tag")
+			}
+			locale = tag.String()
+		}
+		updates["locale"] = locale
+	}
+
+	if update.Timezone != nil {
+		timezone := strings.TrimSpace(*update.Timezone)
+		// LoadLocation also accepts "Local", which means nothing to other clients
+		if timezone != "" {
+			if _, err := time.LoadLocation(timezone); err != nil || timezone == "Local" {
+				return nil, apperror.Invalid("timezone", "INVALID_TIMEZONE", "timezone must be an IANA time zone")
+			}
+		}
+		updates["timezone"] = timezone
+	}
+
+	return updates, nil
+}
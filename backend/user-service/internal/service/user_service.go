@@ -2,35 +2,145 @@ package service
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+	"user-service/internal/apperror"
+	"user-service/internal/config"
+	"user-service/internal/emailaddr"
+	"user-service/internal/entity"
+	"user-service/internal/logger"
+	"user-service/internal/passwordhash"
 	"user-service/internal/repository"
 )
 
+// Roles every deployment starts with, see migrations/000002_create_roles.
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
+const (
+	// registrationKeyTTL is how long a retried registration gets the user of the first one.
+	registrationKeyTTL = 24 * time.Hour
+	// normalizeEmailsBatchSize is the number of users NormalizeEmails loads at once.
+	normalizeEmailsBatchSize = 500
+)
+
+// Permissions checked by the gateway and the user-service handlers.
+const (
+	PermissionListUsers   = "users:list"
+	PermissionAssignRoles = "roles:assign"
+)
+
+var (
+	ErrUserNotFound         = repository.ErrUserNotFound
+	ErrEmailTaken           = repository.ErrEmailTaken
+	ErrRegistrationKeyInUse = repository.ErrRegistrationKeyInUse
+	ErrInvalidEmail         = apperror.Invalid("email", "INVALID", "email must be a valid address")
+	ErrUnknownRole          = apperror.Invalid("roles", "UNKNOWN_ROLE", "unknown role")
+	ErrEmailUnchanged       = apperror.Invalid("email", "UNCHANGED", "email is already the email of the account")
+)
+
 type User struct {
-	ID       string `json:"id"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	ID    string `json:"id"`
+	Email string `json:"email"`
+	// PasswordHash is only set with LegacyPasswordHashes
+	PasswordHash string   `json:"-"`
+	Roles        []string `json:"roles"`
+	Permissions  []string `json:"permissions"`
+	// EmailVerified is false until the user follows the verification link
+	EmailVerified bool `json:"email_verified"`
 }
 
 type UserWithoutPassword struct {
-	ID    string `json:"id"`
-	Email string `json:"email"`
+	ID            string   `json:"id"`
+	Email         string   `json:"email"`
+	Roles         []string `json:"roles,omitempty"`
+	Permissions   []string `json:"permissions,omitempty"`
+	EmailVerified bool     `json:"email_verified"`
 }
 
+// UserService finds accounts by their normalized email, so every spelling of an address the
+// emailaddr.Normalizer maps to one form finds the same account.
 type UserService interface {
 	GetUserByEmail(ctx context.Context, email string) (*User, error)
 	GetUserByID(ctx context.Context, id string) (*UserWithoutPassword, error)
 	CheckUserExistsByEmail(ctx context.Context, email string) (bool, error)
-	RegisterUser(ctx context.Context, email string, hashedPassword []byte) (string, error)
+	// NormalizeEmail returns the form accounts are unique by, ErrInvalidEmail for an email no
+	// account can have.
+	NormalizeEmail(ctx context.Context, email string) (string, error)
+	// VerifyCredentials reports whether the password is the one of the account with the email,
+	// and replaces an outdated hash of a matching password. Emails without an account get
+	// ErrUserNotFound after as long as a wrong password takes.
+	VerifyCredentials(ctx context.Context, email, password string) (*UserWithoutPassword, bool, error)
+	// RegisterUser hashes the password and creates the user, ErrEmailTaken if the email has an
+	// account. A retry with the same idempotency key, email and password gets the user the first
+	// request created and replayed set, other requests with the key get ErrRegistrationKeyInUse.
+	RegisterUser(ctx context.Context, email, password, idempotencyKey string) (id string, replayed bool, err error)
+	// DeleteUser rolls back a registration auth-service could not finish. It only removes a user
+	// whose email is not verified yet and, with an idempotency key, that the registration with the
+	// key created. Returns ErrUserNotFound for any other user.
+	DeleteUser(ctx context.Context, id, idempotencyKey string) error
+	// UpdatePassword hashes the new password and stores it.
+	UpdatePassword(ctx context.Context, id, password string) error
+
+	// RegisterUserWithHash registers a password hashed by an older auth-service release.
+	// Deprecated: removed together with the password_hash field of RegisterUserRequest.
+	RegisterUserWithHash(ctx context.Context, email string, hashedPassword []byte) (string, error)
+	// UpdatePasswordHash stores a password hashed by an older auth-service release.
+	// Deprecated: removed together with the password_hash field of UpdatePasswordRequest.
+	UpdatePasswordHash(ctx context.Context, id string, hashedPassword []byte) error
+	// MarkEmailVerified verifies email for the user, or makes it their email if it is the one they
+	// asked to change to, and reports false if it is neither.
+	MarkEmailVerified(ctx context.Context, id, email string) (bool, error)
+	// RequestEmailChange stores email as the pending email of the user and returns it cleaned up.
+	// It replaces the current email once verified through MarkEmailVerified, ErrEmailTaken if
+	// another account has it.
+	RequestEmailChange(ctx context.Context, id, email string) (string, error)
 	GetAllUsers(ctx context.Context) ([]*UserWithoutPassword, error)
 	GetUsersCount(ctx context.Context) (int32, error)
+
+	GetProfile(ctx context.Context, id string) (*Profile, error)
+	UpdateProfile(ctx context.Context, id string, update ProfileUpdate) (*Profile, error)
+
+	// SetUserRoles replaces the roles of the user. They show up in access tokens issued afterwards.
+	SetUserRoles(ctx context.Context, id string, roles []string) ([]string, error)
+	HasPermission(ctx context.Context, id, permission string) (bool, error)
+	// BootstrapAdmin grants the admin role to the configured bootstrap account if it exists.
+	BootstrapAdmin(ctx context.Context) error
+	// NormalizeEmails brings the normalized emails of all accounts up to date with the
+	// normalizer, which SQL migrations can not apply. Of two accounts with the same normalized
+	// email the older one keeps it, the newer one is recorded in email_collisions.
+	NormalizeEmails(ctx context.Context) error
 }
 
 type userService struct {
-	repo repository.UserGormRepository
+	repo     repository.UserGormRepository
+	roleRepo repository.RoleGormRepository
+	hasher   passwordhash.Hasher
+	emails   emailaddr.Normalizer
+	// dummyPasswordHash is checked for emails without an account, so they take as long as a
+	// wrong password
+	dummyPasswordHash func() string
+	cfg               config.Config
 }
 
-func NewUserService(repo repository.UserGormRepository) UserService {
-	return &userService{repo}
+func NewUserService(repo repository.UserGormRepository, roleRepo repository.RoleGormRepository, hasher passwordhash.Hasher, cfg config.Config) UserService {
+	return &userService{
+		repo:     repo,
+		roleRepo: roleRepo,
+		hasher:   hasher,
+		emails:   emailaddr.NewNormalizer(cfg.EmailProviderRules),
+		dummyPasswordHash: sync.OnceValue(func() string {
+			hash, _ := hasher.Hash("not a password")
+			return hash
+		}),
+		cfg: cfg,
+	}
 }
 
 func (s *userService) GetUsersCount(ctx context.Context) (int32, error) {
@@ -38,16 +148,93 @@ func (s *userService) GetUsersCount(ctx context.Context) (int32, error) {
 }
 
 func (s *userService) GetUserByEmail(ctx context.Context, email string) (*User, error) {
-	result, err := s.repo.GetUserByEmail(ctx, email)
+	result, err := s.userByEmail(ctx, email)
 	if err != nil {
 		return nil, err
 	}
 
-	return &User{
-		ID:       result.ID,
-		Email:    result.Email,
-		Password: result.Password,
-	}, nil
+	roles, permissions, err := s.access(ctx, result.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	user := &User{
+		ID:            result.ID,
+		Email:         result.Email,
+		Roles:         roles,
+		Permissions:   permissions,
+		EmailVerified: result.EmailVerifiedAt != nil,
+	}
+	if s.cfg.PasswordHash.LegacyPasswordHashes {
+		user.PasswordHash = result.Password
+	}
+
+	return user, nil
+}
+
+// userByEmail finds the account of the email, ErrUserNotFound for an email no account can have.
+func (s *userService) userByEmail(ctx context.Context, email string) (*entity.User, error) {
+	normalized, err := s.emails.Normalize(email)
+	if err != nil {
+		return nil, ErrUserNotFound
+	}
+
+	return s.repo.GetUserByEmail(ctx, normalized)
+}
+
+func (s *userService) VerifyCredentials(ctx context.Context, email, password string) (*UserWithoutPassword, bool, error) {
+	result, err := s.userByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			_, _, _ = s.hasher.Verify(s.dummyPasswordHash(), password)
+			return nil, false, ErrUserNotFound
+		}
+		return nil, false, err
+	}
+
+	match, rehash, err := s.hasher.Verify(result.Password, password)
+	if err != nil {
+		logger.Log.Error().Err(err).Str("user_id", result.ID).Msg("error verifying password")
+	}
+	// the auth-service releases that still read the hashes only verify bcrypt
+	if match && rehash && !s.cfg.PasswordHash.LegacyPasswordHashes {
+		s.rehashPassword(ctx, result, password)
+	}
+
+	roles, permissions, err := s.access(ctx, result.ID)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &UserWithoutPassword{
+		ID:            result.ID,
+		Email:         result.Email,
+		Roles:         roles,
+		Permissions:   permissions,
+		EmailVerified: result.EmailVerifiedAt != nil,
+	}, match, nil
+}
+
+// rehashPassword replaces the user's password hash with one made with the current algorithm and
+// parameters. It only logs failures, the old hash keeps working.
+func (s *userService) rehashPassword(ctx context.Context, user *entity.User, password string) {
+	hashedPassword, err := s.hasher.Hash(password)
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error hashing password")
+		return
+	}
+
+	updated, err := s.repo.RehashPassword(ctx, user.ID, []byte(user.Password), []byte(hashedPassword))
+	if err != nil {
+		logger.Log.Error().Err(err).Msg("error rehashing password")
+		return
+	}
+
+	if updated {
+		logger.Log.Info().
+			Str("user_id", user.ID).
+			Msg("password rehashed")
+	}
 }
 
 func (s *userService) GetUserByID(ctx context.Context, id string) (*UserWithoutPassword, error) {
@@ -56,18 +243,224 @@ func (s *userService) GetUserByID(ctx context.Context, id string) (*UserWithoutP
 		return nil, err
 	}
 
+	roles, permissions, err := s.access(ctx, result.ID)
+	if err != nil {
+		return nil, err
+	}
+
 	return &UserWithoutPassword{
-		ID:    result.ID,
-		Email: result.Email,
+		ID:            result.ID,
+		Email:         result.Email,
+		Roles:         roles,
+		Permissions:   permissions,
+		EmailVerified: result.EmailVerifiedAt != nil,
 	}, nil
 }
 
+func (s *userService) NormalizeEmail(_ context.Context, email string) (string, error) {
+	normalized, err := s.emails.Normalize(email)
+	if err != nil {
+		return "", ErrInvalidEmail
+	}
+	return normalized, nil
+}
+
 func (s *userService) CheckUserExistsByEmail(ctx context.Context, email string) (bool, error) {
-	return s.repo.CheckUserExistsByEmail(ctx, email)
+	normalized, err := s.emails.Normalize(email)
+	if err != nil {
+		return false, nil
+	}
+
+	return s.repo.CheckUserExistsByEmail(ctx, normalized)
+}
+
+func (s *userService) RegisterUser(ctx context.Context, email, password, idempotencyKey string) (string, bool, error) {
+	normalized, err := s.emails.Normalize(email)
+	if err != nil {
+		return "", false, ErrInvalidEmail
+	}
+
+	if idempotencyKey != "" {
+		id, err := s.replayRegistration(ctx, normalized, password, idempotencyKey)
+		if err != nil || id != "" {
+			return id, id != "", err
+		}
+	}
+
+	hashedPassword, err := s.hasher.Hash(password)
+	if err != nil {
+		return "", false, err
+	}
+
+	id, err := s.registerUser(ctx, email, []byte(hashedPassword), idempotencyKey)
+	if errors.Is(err, ErrEmailTaken) && idempotencyKey != "" {
+		// a concurrent retry of the same registration may have won
+		replayedID, replayErr := s.replayRegistration(ctx, normalized, password, idempotencyKey)
+		if replayErr != nil || replayedID != "" {
+			return replayedID, replayedID != "", replayErr
+		}
+	}
+	if err != nil {
+		return "", false, err
+	}
+
+	return id, false, nil
+}
+
+// replayRegistration returns the user an earlier registration with the idempotency key created,
+// or "" if there is none. The key only stands in for the same email and password.
+func (s *userService) replayRegistration(ctx context.Context, normalizedEmail, password, idempotencyKey string) (string, error) {
+	user, err := s.repo.GetUserByRegistrationKey(ctx, idempotencyKey, registrationKeyTTL)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	if user.EmailNormalized == nil || *user.EmailNormalized != normalizedEmail {
+		return "", ErrRegistrationKeyInUse
+	}
+	match, _, err := s.hasher.Verify(user.Password, password)
+	if err != nil {
+		logger.Log.Error().Err(err).Str("user_id", user.ID).Msg("error verifying password")
+	}
+	if !match {
+		return "", ErrRegistrationKeyInUse
+	}
+
+	return user.ID, nil
+}
+
+func (s *userService) RegisterUserWithHash(ctx context.Context, email string, hashedPassword []byte) (string, error) {
+	return s.registerUser(ctx, email, hashedPassword, "")
+}
+
+func (s *userService) registerUser(ctx context.Context, email string, hashedPassword []byte, idempotencyKey string) (string, error) {
+	// the account keeps the address as given, only cleaned up, mail goes there
+	canonical, err := emailaddr.Canonical(email)
+	if err != nil {
+		return "", ErrInvalidEmail
+	}
+	normalized, err := s.emails.Normalize(email)
+	if err != nil {
+		return "", ErrInvalidEmail
+	}
+
+	roles := []string{RoleUser}
+	if s.isBootstrapAdmin(normalized) {
+		roles = append(roles, RoleAdmin)
+	}
+
+	return s.repo.RegisterUser(ctx, canonical, normalized, hashedPassword, roles, idempotencyKey, registrationKeyTTL)
+}
+
+func (s *userService) DeleteUser(ctx context.Context, id, idempotencyKey string) error {
+	if err := s.repo.DeleteUser(ctx, id, idempotencyKey); err != nil {
+		return err
+	}
+
+	logger.Log.Info().
+		Str("user_id", id).
+		Msg("user deleted")
+
+	return nil
+}
+
+func (s *userService) UpdatePassword(ctx context.Context, id, password string) error {
+	hashedPassword, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	return s.UpdatePasswordHash(ctx, id, []byte(hashedPassword))
+}
+
+func (s *userService) UpdatePasswordHash(ctx context.Context, id string, hashedPassword []byte) error {
+	return s.repo.UpdatePassword(ctx, id, hashedPassword)
+}
+
+func (s *userService) MarkEmailVerified(ctx context.Context, id, email string) (bool, error) {
+	normalized, err := s.emails.Normalize(email)
+	if err != nil {
+		return false, nil
+	}
+
+	user, err := s.repo.GetUserByID(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	if user.PendingEmail != nil && (user.EmailNormalized == nil || *user.EmailNormalized != normalized) {
+		if pending, err := s.emails.Normalize(*user.PendingEmail); err == nil && pending == normalized {
+			return s.changeEmail(ctx, id, *user.PendingEmail, normalized)
+		}
+	}
+
+	verified, err := s.repo.MarkEmailVerified(ctx, id, normalized)
+	if err != nil {
+		return false, err
+	}
+
+	if verified {
+		logger.Log.Info().
+			Str("user_id", id).
+			Msg("email verified")
+	}
+
+	return verified, nil
+}
+
+func (s *userService) changeEmail(ctx context.Context, id, email, normalizedEmail string) (bool, error) {
+	changed, err := s.repo.ChangeEmail(ctx, id, email, normalizedEmail)
+	if err != nil {
+		return false, err
+	}
+
+	if changed {
+		logger.Log.Info().
+			Str("user_id", id).
+			Msg("email changed")
+	}
+
+	return changed, nil
 }
 
-func (s *userService) RegisterUser(ctx context.Context, email string, hashedPassword []byte) (string, error) {
-	return s.repo.RegisterUser(ctx, email, hashedPassword)
+func (s *userService) RequestEmailChange(ctx context.Context, id, email string) (string, error) {
+	canonical, err := emailaddr.Canonical(email)
+	if err != nil {
+		return "", ErrInvalidEmail
+	}
+	normalized, err := s.emails.Normalize(email)
+	if err != nil {
+		return "", ErrInvalidEmail
+	}
+
+	user, err := s.repo.GetUserByID(ctx, id)
+	if err != nil {
+		return "", err
+	}
+	if user.EmailNormalized != nil && *user.EmailNormalized == normalized {
+		return "", ErrEmailUnchanged
+	}
+
+	// checked again when the change is verified, another account may register it meanwhile
+	taken, err := s.repo.CheckUserExistsByEmail(ctx, normalized)
+	if err != nil {
+		return "", err
+	}
+	if taken {
+		return "", ErrEmailTaken
+	}
+
+	if err := s.repo.SetPendingEmail(ctx, id, canonical); err != nil {
+		return "", err
+	}
+
+	logger.Log.Info().
+		Str("user_id", id).
+		Msg("email change requested")
+
+	return canonical, nil
 }
 
 func (s *userService) GetAllUsers(ctx context.Context) ([]*UserWithoutPassword, error) {
@@ -86,3 +479,164 @@ func (s *userService) GetAllUsers(ctx context.Context) ([]*UserWithoutPassword,
 
 	return users, nil
 }
+
+func (s *userService) SetUserRoles(ctx context.Context, id string, roles []string) ([]string, error) {
+	if _, err := s.repo.GetUserByID(ctx, id); err != nil {
+		return nil, err
+	}
+
+	known, err := s.roleRepo.ListRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	roles = slices.Compact(slices.Sorted(slices.Values(roles)))
+	for _, role := range roles {
+		if !slices.ContainsFunc(known, func(r *entity.Role) bool { return r.Name == role }) {
+			return nil, ErrUnknownRole
+		}
+	}
+
+	if err := s.roleRepo.SetUserRoles(ctx, id, roles); err != nil {
+		return nil, err
+	}
+
+	logger.Log.Info().
+		Str("user_id", id).
+		Strs("roles", roles).
+		Msg("user roles changed")
+
+	return roles, nil
+}
+
+func (s *userService) HasPermission(ctx context.Context, id, permission string) (bool, error) {
+	permissions, err := s.roleRepo.GetUserPermissions(ctx, id)
+	if err != nil {
+		return false, err
+	}
+
+	return slices.Contains(permissions, permission), nil
+}
+
+func (s *userService) BootstrapAdmin(ctx context.Context) error {
+	if s.cfg.BootstrapAdminEmail == "" {
+		return nil
+	}
+
+	user, err := s.userByEmail(ctx, s.cfg.BootstrapAdminEmail)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			// the role is granted on registration instead
+			return nil
+		}
+		return err
+	}
+
+	return s.roleRepo.AddUserRole(ctx, user.ID, RoleAdmin)
+}
+
+func (s *userService) isBootstrapAdmin(normalizedEmail string) bool {
+	if s.cfg.BootstrapAdminEmail == "" {
+		return false
+	}
+
+	admin, err := s.emails.Normalize(s.cfg.BootstrapAdminEmail)
+	return err == nil && admin == normalizedEmail
+}
+
+func (s *userService) NormalizeEmails(ctx context.Context) error {
+	updated, collisions := 0, 0
+
+	afterID := "0"
+	for {
+		users, err := s.repo.ListUserEmails(ctx, afterID, normalizeEmailsBatchSize)
+		if err != nil {
+			return err
+		}
+
+		for _, user := range users {
+			afterID = user.ID
+
+			normalized, err := s.emails.Normalize(user.Email)
+			if err != nil {
+				logger.Log.Warn().Str("user_id", user.ID).Msg("email of the user is not a valid address, it is not normalized")
+				continue
+			}
+			if user.EmailNormalized != nil && *user.EmailNormalized == normalized {
+				continue
+			}
+
+			err = s.repo.SetEmailNormalized(ctx, user.ID, normalized)
+			switch {
+			case errors.Is(err, ErrEmailTaken):
+				collided, err := s.emailCollision(ctx, user.ID, normalized)
+				if err != nil {
+					return err
+				}
+				collisions++
+				logger.Log.Warn().
+					Str("user_id", collided).
+					Msg("email of the user belongs to another account, it can not sign in with it until the collision is resolved, see email_collisions")
+			case err != nil:
+				return err
+			default:
+				updated++
+			}
+		}
+
+		if len(users) < normalizeEmailsBatchSize {
+			break
+		}
+	}
+
+	if updated > 0 || collisions > 0 {
+		logger.Log.Info().
+			Int("updated", updated).
+			Int("collisions", collisions).
+			Msg("emails normalized")
+	}
+
+	return nil
+}
+
+// emailCollision settles which of the account and the one that has its normalized email keeps
+// it. The older account does, even if the newer one got the email first under other rules, and
+// the other one is recorded as the collision and returned.
+func (s *userService) emailCollision(ctx context.Context, id, normalizedEmail string) (string, error) {
+	holder, err := s.repo.GetUserByEmail(ctx, normalizedEmail)
+	if err != nil {
+		return "", err
+	}
+
+	// ids are serial, the lower one is older
+	userID, err := strconv.Atoi(id)
+	if err != nil {
+		return "", fmt.Errorf("error parsing user id: %w", err)
+	}
+	holderID, err := strconv.Atoi(holder.ID)
+	if err != nil {
+		return "", fmt.Errorf("error parsing user id: %w", err)
+	}
+	if holderID < userID {
+		return id, s.repo.RecordEmailCollision(ctx, id, normalizedEmail)
+	}
+
+	if err := s.repo.MoveEmailNormalized(ctx, id, holder.ID, normalizedEmail); err != nil {
+		return "", err
+	}
+	return holder.ID, nil
+}
+
+func (s *userService) access(ctx context.Context, id string) ([]string, []string, error) {
+	roles, err := s.roleRepo.GetUserRoles(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	permissions, err := s.roleRepo.GetUserPermissions(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return roles, permissions, nil
+}
@@ -0,0 +1,834 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+	"user-service/internal/config"
+	"user-service/internal/emailaddr"
+	"user-service/internal/entity"
+	"user-service/internal/passwordhash"
+)
+
+// fakeUserRepository keeps users in memory with the uniqueness rules of the users table.
+type fakeUserRepository struct {
+	users      map[string]*entity.User
+	keys       map[string]fakeRegistrationKey
+	collisions map[string]string
+	roles      *fakeRoleRepository
+	nextID     int
+	// rehashed counts the hashes replaced through RehashPassword
+	rehashed int
+	// beforeRegister runs once at the start of the next RegisterUser, for a concurrent request
+	beforeRegister func()
+}
+
+type fakeRegistrationKey struct {
+	userID    string
+	createdAt time.Time
+}
+
+func newFakeUserRepository(roles *fakeRoleRepository) *fakeUserRepository {
+	return &fakeUserRepository{
+		users:      map[string]*entity.User{},
+		keys:       map[string]fakeRegistrationKey{},
+		collisions: map[string]string{},
+		roles:      roles,
+	}
+}
+
+// addUser stores a user as an older release or the migration would have left it.
+func (f *fakeUserRepository) addUser(email string, normalized *string, passwordHash string) *entity.User {
+	f.nextID++
+	user := &entity.User{ID: strconv.Itoa(f.nextID), Email: email, EmailNormalized: normalized, Password: passwordHash}
+	f.users[user.ID] = user
+	f.roles.userRoles[user.ID] = []string{RoleUser}
+	return user
+}
+
+func (f *fakeUserRepository) byNormalizedEmail(normalizedEmail string) *entity.User {
+	for _, user := range f.users {
+		if user.EmailNormalized != nil && *user.EmailNormalized == normalizedEmail {
+			return user
+		}
+	}
+	return nil
+}
+
+func (f *fakeUserRepository) GetUserByEmail(_ context.Context, normalizedEmail string) (*entity.User, error) {
+	if user := f.byNormalizedEmail(normalizedEmail); user != nil {
+		copied := *user
+		return &copied, nil
+	}
+	return nil, ErrUserNotFound
+}
+
+func (f *fakeUserRepository) GetUserByID(_ context.Context, id string) (*entity.User, error) {
+	if user, ok := f.users[id]; ok {
+		copied := *user
+		return &copied, nil
+	}
+	return nil, ErrUserNotFound
+}
+
+func (f *fakeUserRepository) CheckUserExistsByEmail(_ context.Context, normalizedEmail string) (bool, error) {
+	return f.byNormalizedEmail(normalizedEmail) != nil, nil
+}
+
+func (f *fakeUserRepository) RegisterUser(_ context.Context, email, normalizedEmail string, hashedPassword []byte, roles []string, idempotencyKey string, keyTTL time.Duration) (string, error) {
+	if before := f.beforeRegister; before != nil {
+		f.beforeRegister = nil
+		before()
+	}
+	for _, user := range f.users {
+		if user.Email == email || (user.EmailNormalized != nil && *user.EmailNormalized == normalizedEmail) {
+			return "", ErrEmailTaken
+		}
+	}
+	if key, ok := f.keys[idempotencyKey]; ok && time.Since(key.createdAt) < keyTTL {
+		return "", ErrRegistrationKeyInUse
+	}
+
+	user := f.addUser(email, &normalizedEmail, string(hashedPassword))
+	f.roles.userRoles[user.ID] = roles
+	if idempotencyKey != "" {
+		f.keys[idempotencyKey] = fakeRegistrationKey{userID: user.ID, createdAt: time.Now()}
+	}
+
+	return user.ID, nil
+}
+
+func (f *fakeUserRepository) GetUserByRegistrationKey(ctx context.Context, idempotencyKey string, keyTTL time.Duration) (*entity.User, error) {
+	key, ok := f.keys[idempotencyKey]
+	if !ok || time.Since(key.createdAt) >= keyTTL {
+		return nil, ErrUserNotFound
+	}
+	return f.GetUserByID(ctx, key.userID)
+}
+
+func (f *fakeUserRepository) DeleteUser(_ context.Context, id, idempotencyKey string) error {
+	user, ok := f.users[id]
+	if !ok || user.EmailVerifiedAt != nil {
+		return ErrUserNotFound
+	}
+	if key, ok := f.keys[idempotencyKey]; idempotencyKey != "" && (!ok || key.userID != id) {
+		return ErrUserNotFound
+	}
+	delete(f.users, id)
+	delete(f.roles.userRoles, id)
+	for key, registration := range f.keys {
+		if registration.userID == id {
+			delete(f.keys, key)
+		}
+	}
+	return nil
+}
+
+func (f *fakeUserRepository) GetAllUsers(context.Context) ([]*entity.User, error) {
+	users := make([]*entity.User, 0, len(f.users))
+	for _, user := range f.users {
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (f *fakeUserRepository) GetUsersCount(context.Context) (int32, error) {
+	return int32(len(f.users)), nil
+}
+
+func (f *fakeUserRepository) UpdatePassword(_ context.Context, id string, hashedPassword []byte) error {
+	user, ok := f.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.Password = string(hashedPassword)
+	return nil
+}
+
+func (f *fakeUserRepository) RehashPassword(_ context.Context, id string, currentHash, hashedPassword []byte) (bool, error) {
+	user, ok := f.users[id]
+	if !ok || user.Password != string(currentHash) {
+		return false, nil
+	}
+	user.Password = string(hashedPassword)
+	f.rehashed++
+	return true, nil
+}
+
+func (f *fakeUserRepository) MarkEmailVerified(_ context.Context, id, normalizedEmail string) (bool, error) {
+	user, ok := f.users[id]
+	if !ok || user.EmailNormalized == nil || *user.EmailNormalized != normalizedEmail {
+		return false, nil
+	}
+	now := time.Now()
+	user.EmailVerifiedAt = &now
+	return true, nil
+}
+
+func (f *fakeUserRepository) SetPendingEmail(_ context.Context, id, email string) error {
+	user, ok := f.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	user.PendingEmail = &email
+	return nil
+}
+
+func (f *fakeUserRepository) ChangeEmail(_ context.Context, id, email, normalizedEmail string) (bool, error) {
+	user, ok := f.users[id]
+	if !ok || user.PendingEmail == nil || *user.PendingEmail != email {
+		return false, nil
+	}
+	if other := f.byNormalizedEmail(normalizedEmail); other != nil && other.ID != id {
+		return false, ErrEmailTaken
+	}
+	now := time.Now()
+	user.Email, user.EmailNormalized, user.EmailVerifiedAt, user.PendingEmail = email, &normalizedEmail, &now, nil
+	delete(f.collisions, id)
+	return true, nil
+}
+
+func (f *fakeUserRepository) ListUserEmails(_ context.Context, afterID string, limit int) ([]*entity.User, error) {
+	after, _ := strconv.Atoi(afterID)
+
+	var users []*entity.User
+	for id := after + 1; id <= f.nextID && len(users) < limit; id++ {
+		if user, ok := f.users[strconv.Itoa(id)]; ok {
+			copied := *user
+			users = append(users, &copied)
+		}
+	}
+	return users, nil
+}
+
+func (f *fakeUserRepository) SetEmailNormalized(_ context.Context, id, normalizedEmail string) error {
+	if other := f.byNormalizedEmail(normalizedEmail); other != nil && other.ID != id {
+		return ErrEmailTaken
+	}
+	f.users[id].EmailNormalized = &normalizedEmail
+	delete(f.collisions, id)
+	return nil
+}
+
+func (f *fakeUserRepository) RecordEmailCollision(_ context.Context, id, normalizedEmail string) error {
+	f.collisions[id] = normalizedEmail
+	return nil
+}
+
+func (f *fakeUserRepository) MoveEmailNormalized(_ context.Context, id, fromID, normalizedEmail string) error {
+	if from := f.users[fromID]; from.EmailNormalized != nil && *from.EmailNormalized == normalizedEmail {
+		from.EmailNormalized = nil
+		f.collisions[fromID] = normalizedEmail
+	}
+	if other := f.byNormalizedEmail(normalizedEmail); other != nil {
+		return ErrEmailTaken
+	}
+	f.users[id].EmailNormalized = &normalizedEmail
+	delete(f.collisions, id)
+	return nil
+}
+
+func (f *fakeUserRepository) UpdateUserProfile(_ context.Context, id string, updates map[string]any) error {
+	user, ok := f.users[id]
+	if !ok {
+		return ErrUserNotFound
+	}
+	for column, value := range updates {
+		switch column {
+		case "display_name":
+			user.DisplayName = value.(string)
+		case "avatar_url":
+			user.AvatarURL = value.(string)
+		case "locale":
+			user.Locale = value.(string)
+		case "timezone":
+			user.Timezone = value.(string)
+		}
+	}
+	return nil
+}
+
+// fakeRoleRepository has the roles and permissions of migrations/000002_create_roles.
+type fakeRoleRepository struct {
+	userRoles map[string][]string
+}
+
+var fakeRolePermissions = map[string][]string{
+	RoleUser:  nil,
+	RoleAdmin: {PermissionAssignRoles, PermissionListUsers},
+}
+
+func newFakeRoleRepository() *fakeRoleRepository {
+	return &fakeRoleRepository{userRoles: map[string][]string{}}
+}
+
+func (f *fakeRoleRepository) ListRoles(context.Context) ([]*entity.Role, error) {
+	return []*entity.Role{{Name: RoleAdmin}, {Name: RoleUser}}, nil
+}
+
+func (f *fakeRoleRepository) GetUserRoles(_ context.Context, userID string) ([]string, error) {
+	return slices.Sorted(slices.Values(f.userRoles[userID])), nil
+}
+
+func (f *fakeRoleRepository) GetUserPermissions(_ context.Context, userID string) ([]string, error) {
+	var permissions []string
+	for _, role := range f.userRoles[userID] {
+		permissions = append(permissions, fakeRolePermissions[role]...)
+	}
+	return slices.Compact(slices.Sorted(slices.Values(permissions))), nil
+}
+
+func (f *fakeRoleRepository) AddUserRole(_ context.Context, userID, role string) error {
+	if !slices.Contains(f.userRoles[userID], role) {
+		f.userRoles[userID] = append(f.userRoles[userID], role)
+	}
+	return nil
+}
+
+func (f *fakeRoleRepository) SetUserRoles(_ context.Context, userID string, roles []string) error {
+	f.userRoles[userID] = roles
+	return nil
+}
+
+// testPasswordHashConfig hashes with the cheapest bcrypt cost, so tests stay fast.
+var testPasswordHashConfig = config.PasswordHashConfig{
+	PasswordHashAlgorithm: config.PasswordHashBcrypt,
+	PasswordBcryptCost:    4,
+}
+
+func newTestUserService(t *testing.T, cfg config.Config) (UserService, *fakeUserRepository, *fakeRoleRepository) {
+	t.Helper()
+
+	if cfg.PasswordHash.PasswordHashAlgorithm == "" {
+		cfg.PasswordHash = testPasswordHashConfig
+	}
+	hasher, err := passwordhash.NewHasher(cfg.PasswordHash)
+	if err != nil {
+		t.Fatalf("NewHasher() error: %v", err)
+	}
+
+	roles := newFakeRoleRepository()
+	users := newFakeUserRepository(roles)
+	return NewUserService(users, roles, hasher, cfg), users, roles
+}
+
+func mustRegister(t *testing.T, svc UserService, email, password string) string {
+	t.Helper()
+
+	id, _, err := svc.RegisterUser(context.Background(), email, password, "")
+	if err != nil {
+		t.Fatalf("RegisterUser(%q) error: %v", email, err)
+	}
+	return id
+}
+
+func TestUserService_SetUserRoles(t *testing.T) {
+	ctx := context.Background()
+	svc, _, roles := newTestUserService(t, config.Config{})
+	id := mustRegister(t, svc, "alice@example.com", "password")
+
+	got, err := svc.SetUserRoles(ctx, id, []string{"user", "admin", "user"})
+	if err != nil {
+		t.Fatalf("SetUserRoles() error: %v", err)
+	}
+	if want := []string{RoleAdmin, RoleUser}; !slices.Equal(got, want) || !slices.Equal(roles.userRoles[id], want) {
+		t.Errorf("SetUserRoles() = %v, stored %v, want %v", got, roles.userRoles[id], want)
+	}
+
+	if _, err := svc.SetUserRoles(ctx, id, []string{"user", "owner"}); !errors.Is(err, ErrUnknownRole) {
+		t.Errorf("SetUserRoles() with an unknown role error = %v, want ErrUnknownRole", err)
+	}
+	if !slices.Equal(roles.userRoles[id], []string{RoleAdmin, RoleUser}) {
+		t.Errorf("SetUserRoles() with an unknown role changed the roles to %v", roles.userRoles[id])
+	}
+
+	if _, err := svc.SetUserRoles(ctx, "missing", []string{"user"}); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("SetUserRoles() for an unknown user error = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestUserService_HasPermission(t *testing.T) {
+	ctx := context.Background()
+	svc, _, _ := newTestUserService(t, config.Config{})
+	id := mustRegister(t, svc, "alice@example.com", "password")
+
+	if allowed, _ := svc.HasPermission(ctx, id, PermissionAssignRoles); allowed {
+		t.Error("HasPermission() granted roles:assign to a user")
+	}
+
+	// a role change applies right away
+	if _, err := svc.SetUserRoles(ctx, id, []string{RoleUser, RoleAdmin}); err != nil {
+		t.Fatalf("SetUserRoles() error: %v", err)
+	}
+	if allowed, _ := svc.HasPermission(ctx, id, PermissionAssignRoles); !allowed {
+		t.Error("HasPermission() denied roles:assign to an admin")
+	}
+}
+
+func TestUserService_BootstrapAdmin(t *testing.T) {
+	ctx := context.Background()
+	svc, _, roles := newTestUserService(t, config.Config{BootstrapAdminEmail: "Admin@Example.com"})
+
+	// nobody registered the account yet
+	if err := svc.BootstrapAdmin(ctx); err != nil {
+		t.Fatalf("BootstrapAdmin() without the account error: %v", err)
+	}
+
+	// the account gets the role when it registers
+	admin := mustRegister(t, svc, "admin@example.com", "password")
+	if !slices.Contains(roles.userRoles[admin], RoleAdmin) {
+		t.Errorf("bootstrap account registered with roles %v, want admin", roles.userRoles[admin])
+	}
+	other := mustRegister(t, svc, "other@example.com", "password")
+	if slices.Contains(roles.userRoles[other], RoleAdmin) {
+		t.Error("another account registered as admin")
+	}
+
+	// or on startup, if it lost the role
+	roles.userRoles[admin] = []string{RoleUser}
+	if err := svc.BootstrapAdmin(ctx); err != nil {
+		t.Fatalf("BootstrapAdmin() error: %v", err)
+	}
+	if !slices.Contains(roles.userRoles[admin], RoleAdmin) {
+		t.Errorf("BootstrapAdmin() left roles %v, want admin", roles.userRoles[admin])
+	}
+}
+
+func TestUserService_RequestEmailChange(t *testing.T) {
+	ctx := context.Background()
+	svc, users, _ := newTestUserService(t, config.Config{})
+	id := mustRegister(t, svc, "alice@example.com", "password")
+	mustRegister(t, svc, "bob@example.com", "password")
+
+	tests := []struct {
+		name  string
+		email string
+		want  error
+	}{
+		{"invalid", "not-an-email", ErrInvalidEmail},
+		{"current email in another spelling", " Alice@Example.com", ErrEmailUnchanged},
+		{"email of another account", "BOB@example.com", ErrEmailTaken},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if _, err := svc.RequestEmailChange(ctx, id, tc.email); !errors.Is(err, tc.want) {
+				t.Errorf("RequestEmailChange(%q) error = %v, want %v", tc.email, err, tc.want)
+			}
+		})
+	}
+	if users.users[id].PendingEmail != nil {
+		t.Fatal("a rejected RequestEmailChange() stored a pending email")
+	}
+
+	email, err := svc.RequestEmailChange(ctx, id, " Alice.New@Example.com ")
+	if err != nil {
+		t.Fatalf("RequestEmailChange() error: %v", err)
+	}
+	if email != "alice.new@example.com" {
+		t.Errorf("RequestEmailChange() = %q, want the cleaned up address", email)
+	}
+	profile, _ := svc.GetProfile(ctx, id)
+	if profile.Email != "alice@example.com" || profile.PendingEmail != email {
+		t.Errorf("GetProfile() = %q pending %q, want the old email until verified", profile.Email, profile.PendingEmail)
+	}
+
+	// a link for another address changes nothing
+	if changed, err := svc.MarkEmailVerified(ctx, id, "mallory@example.com"); err != nil || changed {
+		t.Errorf("MarkEmailVerified() with another address = %v, %v, want false", changed, err)
+	}
+
+	if changed, err := svc.MarkEmailVerified(ctx, id, email); err != nil || !changed {
+		t.Fatalf("MarkEmailVerified() with the pending email = %v, %v, want true", changed, err)
+	}
+	profile, _ = svc.GetProfile(ctx, id)
+	if profile.Email != email || !profile.EmailVerified || profile.PendingEmail != "" {
+		t.Errorf("GetProfile() after the change = %+v, want the new email verified", profile)
+	}
+	if _, err := svc.GetUserByEmail(ctx, "alice.new@example.com"); err != nil {
+		t.Errorf("GetUserByEmail() with the new email error: %v", err)
+	}
+	if _, err := svc.GetUserByEmail(ctx, "alice@example.com"); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("GetUserByEmail() with the old email error = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestUserService_EmailChangeTakenMeanwhile(t *testing.T) {
+	ctx := context.Background()
+	svc, _, _ := newTestUserService(t, config.Config{})
+	id := mustRegister(t, svc, "alice@example.com", "password")
+
+	if _, err := svc.RequestEmailChange(ctx, id, "new@example.com"); err != nil {
+		t.Fatalf("RequestEmailChange() error: %v", err)
+	}
+	mustRegister(t, svc, "new@example.com", "password")
+
+	if _, err := svc.MarkEmailVerified(ctx, id, "new@example.com"); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("MarkEmailVerified() for an address registered meanwhile error = %v, want ErrEmailTaken", err)
+	}
+}
+
+// countingHasher counts the hashes it verifies.
+type countingHasher struct {
+	passwordhash.Hasher
+	verified int
+}
+
+func (h *countingHasher) Verify(hash, password string) (bool, bool, error) {
+	h.verified++
+	return h.Hasher.Verify(hash, password)
+}
+
+func TestUserService_VerifyCredentialsUnknownEmail(t *testing.T) {
+	hasher, err := passwordhash.NewHasher(testPasswordHashConfig)
+	if err != nil {
+		t.Fatalf("NewHasher() error: %v", err)
+	}
+	counting := &countingHasher{Hasher: hasher}
+	roles := newFakeRoleRepository()
+	svc := NewUserService(newFakeUserRepository(roles), roles, counting, config.Config{})
+
+	for _, email := range []string{"nobody@example.com", "not-an-email"} {
+		counting.verified = 0
+		if _, _, err := svc.VerifyCredentials(context.Background(), email, "password"); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("VerifyCredentials(%q) error = %v, want ErrUserNotFound", email, err)
+		}
+		// a password is still checked, so the answer takes as long as for a wrong password
+		if counting.verified != 1 {
+			t.Errorf("VerifyCredentials(%q) verified %d hashes, want 1", email, counting.verified)
+		}
+	}
+}
+
+func TestUserService_VerifyCredentialsRehashesPassword(t *testing.T) {
+	ctx := context.Background()
+	argon2 := config.PasswordHashConfig{
+		PasswordHashAlgorithm:     config.PasswordHashArgon2id,
+		PasswordArgon2Memory:      64,
+		PasswordArgon2Iterations:  1,
+		PasswordArgon2Parallelism: 1,
+	}
+	svc, users, _ := newTestUserService(t, config.Config{PasswordHash: argon2})
+
+	// a hash from before the switch to argon2id
+	bcryptHasher, err := passwordhash.NewHasher(testPasswordHashConfig)
+	if err != nil {
+		t.Fatalf("NewHasher() error: %v", err)
+	}
+	oldHash, err := bcryptHasher.Hash("password")
+	if err != nil {
+		t.Fatalf("Hash() error: %v", err)
+	}
+	normalized := "alice@example.com"
+	user := users.addUser("alice@example.com", &normalized, oldHash)
+
+	if _, match, err := svc.VerifyCredentials(ctx, "alice@example.com", "wrong"); err != nil || match {
+		t.Fatalf("VerifyCredentials() with a wrong password = %v, %v, want no match", match, err)
+	}
+	if users.rehashed != 0 {
+		t.Fatal("VerifyCredentials() rehashed a wrong password")
+	}
+
+	if _, match, err := svc.VerifyCredentials(ctx, "alice@example.com", "password"); err != nil || !match {
+		t.Fatalf("VerifyCredentials() = %v, %v, want a match", match, err)
+	}
+	if users.rehashed != 1 || users.users[user.ID].Password == oldHash {
+		t.Fatalf("VerifyCredentials() rehashed %d times, want the bcrypt hash replaced", users.rehashed)
+	}
+
+	// the new hash verifies and is not replaced again
+	if _, match, err := svc.VerifyCredentials(ctx, "alice@example.com", "password"); err != nil || !match {
+		t.Fatalf("VerifyCredentials() with the new hash = %v, %v, want a match", match, err)
+	}
+	if users.rehashed != 1 {
+		t.Errorf("VerifyCredentials() rehashed a current hash")
+	}
+}
+
+func TestUserService_LegacyPasswordHashes(t *testing.T) {
+	ctx := context.Background()
+	legacy := testPasswordHashConfig
+	legacy.PasswordBcryptCost = 5
+	legacy.LegacyPasswordHashes = true
+	svc, users, _ := newTestUserService(t, config.Config{PasswordHash: legacy})
+	id := mustRegister(t, svc, "alice@example.com", "password")
+	hash := users.users[id].Password
+
+	user, err := svc.GetUserByEmail(ctx, "Alice@Example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail() error: %v", err)
+	}
+	if user.PasswordHash != hash {
+		t.Errorf("GetUserByEmail() password hash = %q, want the stored hash", user.PasswordHash)
+	}
+
+	// a hash with other parameters is kept, old auth-service releases read the stored one
+	users.users[id].Password = mustBcrypt(t, "password")
+	if _, match, err := svc.VerifyCredentials(ctx, "alice@example.com", "password"); err != nil || !match {
+		t.Fatalf("VerifyCredentials() = %v, %v, want a match", match, err)
+	}
+	if users.rehashed != 0 {
+		t.Error("VerifyCredentials() rehashed a password in legacy mode")
+	}
+
+	svc, _, _ = newTestUserService(t, config.Config{})
+	mustRegister(t, svc, "alice@example.com", "password")
+	if user, err := svc.GetUserByEmail(ctx, "alice@example.com"); err != nil || user.PasswordHash != "" {
+		t.Errorf("GetUserByEmail() = %+v, %v, want no password hash", user, err)
+	}
+}
+
+func mustBcrypt(t *testing.T, password string) string {
+	t.Helper()
+
+	hasher, err := passwordhash.NewHasher(testPasswordHashConfig)
+	if err != nil {
+		t.Fatalf("NewHasher() error: %v", err)
+	}
+	hash, err := hasher.Hash(password)
+	if err != nil {
+		t.Fatalf("Hash() error: %v", err)
+	}
+	return hash
+}
+
+func TestUserService_PasswordHashes(t *testing.T) {
+	ctx := context.Background()
+	svc, users, _ := newTestUserService(t, config.Config{})
+
+	// auth-service releases that hash passwords themselves register with the hash
+	hash := mustBcrypt(t, "password")
+	id, err := svc.RegisterUserWithHash(ctx, " Alice@Example.com", []byte(hash))
+	if err != nil {
+		t.Fatalf("RegisterUserWithHash() error: %v", err)
+	}
+	if got := users.users[id]; got.Password != hash || got.Email != "alice@example.com" {
+		t.Errorf("RegisterUserWithHash() stored %q with hash %q, want the given hash", got.Email, got.Password)
+	}
+	if _, err := svc.RegisterUserWithHash(ctx, "alice@example.com", []byte(hash)); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("RegisterUserWithHash() for a taken email error = %v, want ErrEmailTaken", err)
+	}
+
+	newHash := mustBcrypt(t, "new password")
+	if err := svc.UpdatePasswordHash(ctx, id, []byte(newHash)); err != nil {
+		t.Fatalf("UpdatePasswordHash() error: %v", err)
+	}
+	if users.users[id].Password != newHash {
+		t.Error("UpdatePasswordHash() did not store the hash")
+	}
+	if _, match, err := svc.VerifyCredentials(ctx, "alice@example.com", "new password"); err != nil || !match {
+		t.Errorf("VerifyCredentials() after UpdatePasswordHash() = %v, %v, want a match", match, err)
+	}
+	if err := svc.UpdatePasswordHash(ctx, "missing", []byte(newHash)); !errors.Is(err, ErrUserNotFound) {
+		t.Errorf("UpdatePasswordHash() for an unknown user error = %v, want ErrUserNotFound", err)
+	}
+}
+
+func TestUserService_RegisterUserIdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+	svc, users, _ := newTestUserService(t, config.Config{})
+
+	first, replayed, err := svc.RegisterUser(ctx, "alice@example.com", "password", "key-1")
+	if err != nil || replayed {
+		t.Fatalf("RegisterUser() = %q, %v, %v, want a new user", first, replayed, err)
+	}
+
+	// the response got lost, the client sends the same request again
+	retry, replayed, err := svc.RegisterUser(ctx, "Alice@Example.com", "password", "key-1")
+	if err != nil || !replayed || retry != first {
+		t.Errorf("RegisterUser() retry = %q, %v, %v, want user %q replayed", retry, replayed, err, first)
+	}
+
+	// the key does not stand in for the password or the email
+	if _, _, err := svc.RegisterUser(ctx, "alice@example.com", "other password", "key-1"); !errors.Is(err, ErrRegistrationKeyInUse) {
+		t.Errorf("RegisterUser() with another password error = %v, want ErrRegistrationKeyInUse", err)
+	}
+	if _, _, err := svc.RegisterUser(ctx, "bob@example.com", "password", "key-1"); !errors.Is(err, ErrRegistrationKeyInUse) {
+		t.Errorf("RegisterUser() with another email error = %v, want ErrRegistrationKeyInUse", err)
+	}
+	if _, _, err := svc.RegisterUser(ctx, "alice@example.com", "password", "key-2"); !errors.Is(err, ErrEmailTaken) {
+		t.Errorf("RegisterUser() with another key error = %v, want ErrEmailTaken", err)
+	}
+	if len(users.users) != 1 {
+		t.Errorf("got %d users, want 1", len(users.users))
+	}
+}
+
+func TestUserService_RegisterUserLosesRace(t *testing.T) {
+	ctx := context.Background()
+
+	// a retry of the same registration inserts the user between the replay check and the insert
+	tests := []struct {
+		name         string
+		key          string
+		password     string
+		wantReplayed bool
+		wantErr      error
+	}{
+		{"same registration", "key-1", "password", true, nil},
+		{"other password", "key-1", "other password", false, ErrRegistrationKeyInUse},
+		{"other key", "key-2", "password", false, ErrEmailTaken},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			svc, users, _ := newTestUserService(t, config.Config{})
+			email := "alice@example.com"
+			var winner string
+			users.beforeRegister = func() {
+				winner, _, _ = svc.RegisterUser(ctx, email, "password", "key-1")
+			}
+
+			id, replayed, err := svc.RegisterUser(ctx, email, tc.password, tc.key)
+			if !errors.Is(err, tc.wantErr) || replayed != tc.wantReplayed {
+				t.Fatalf("RegisterUser() = %q, %v, %v, want replayed %v and error %v", id, replayed, err, tc.wantReplayed, tc.wantErr)
+			}
+			if tc.wantReplayed && id != winner {
+				t.Errorf("RegisterUser() = %q, want the user %q the winner created", id, winner)
+			}
+			if len(users.users) != 1 {
+				t.Errorf("got %d users, want 1", len(users.users))
+			}
+		})
+	}
+}
+
+func TestUserService_DeleteUser(t *testing.T) {
+	ctx := context.Background()
+	svc, users, _ := newTestUserService(t, config.Config{})
+
+	keyed, _, err := svc.RegisterUser(ctx, "alice@example.com", "password", "key-1")
+	if err != nil {
+		t.Fatalf("RegisterUser() error: %v", err)
+	}
+	other := mustRegister(t, svc, "bob@example.com", "password")
+	verified := mustRegister(t, svc, "carol@example.com", "password")
+	if _, err := svc.MarkEmailVerified(ctx, verified, "carol@example.com"); err != nil {
+		t.Fatalf("MarkEmailVerified() error: %v", err)
+	}
+
+	// a rollback only removes the unverified account its registration created
+	tests := []struct {
+		name string
+		id   string
+		key  string
+	}{
+		{"created under another key", other, "key-1"},
+		{"other user of the key", keyed, "key-2"},
+		{"verified", verified, ""},
+		{"unknown", "missing", ""},
+	}
+	for _, tc := range tests {
+		if err := svc.DeleteUser(ctx, tc.id, tc.key); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("DeleteUser() %s error = %v, want ErrUserNotFound", tc.name, err)
+		}
+	}
+	if len(users.users) != 3 {
+		t.Fatalf("DeleteUser() left %d of 3 users", len(users.users))
+	}
+
+	if err := svc.DeleteUser(ctx, keyed, "key-1"); err != nil {
+		t.Errorf("DeleteUser() with the key error: %v", err)
+	}
+	if err := svc.DeleteUser(ctx, other, ""); err != nil {
+		t.Errorf("DeleteUser() without a key error: %v", err)
+	}
+	if _, ok := users.users[verified]; !ok || len(users.users) != 1 {
+		t.Errorf("DeleteUser() left %d users, want only the verified one", len(users.users))
+	}
+
+	// the key can be used again after the rollback
+	if _, replayed, err := svc.RegisterUser(ctx, "alice@example.com", "password", "key-1"); err != nil || replayed {
+		t.Errorf("RegisterUser() after the rollback = %v, %v, want a new user", replayed, err)
+	}
+}
+
+func TestUserService_EmailSpellings(t *testing.T) {
+	ctx := context.Background()
+	svc, _, _ := newTestUserService(t, config.Config{EmailProviderRules: true})
+	alice := mustRegister(t, svc, "Alice@Example.com", "password")
+	jdoe := mustRegister(t, svc, "j.doe@gmail.com", "password")
+
+	tests := []struct {
+		email string
+		want  string
+	}{
+		{" alice@EXAMPLE.com", alice},
+		{"ALICE@example.com.", alice},
+		{"JDoe+news@googlemail.com", jdoe},
+		{"j.d.o.e@Gmail.com", jdoe},
+	}
+	for _, tc := range tests {
+		t.Run(tc.email, func(t *testing.T) {
+			user, match, err := svc.VerifyCredentials(ctx, tc.email, "password")
+			if err != nil || !match || user.ID != tc.want {
+				t.Errorf("VerifyCredentials(%q) = %+v, %v, %v, want user %s", tc.email, user, match, err, tc.want)
+			}
+			if _, _, err := svc.RegisterUser(ctx, tc.email, "password", ""); !errors.Is(err, ErrEmailTaken) {
+				t.Errorf("RegisterUser(%q) error = %v, want ErrEmailTaken", tc.email, err)
+			}
+		})
+	}
+
+	// auth-service counts failed logins under the normalized email
+	for _, email := range []string{"JDoe+news@googlemail.com", "nobody+x@gmail.com"} {
+		normalized, err := svc.NormalizeEmail(ctx, email)
+		if want, _ := emailaddr.NewNormalizer(true).Normalize(email); err != nil || normalized != want {
+			t.Errorf("NormalizeEmail(%q) = %q, %v, want %q", email, normalized, err, want)
+		}
+	}
+	if _, err := svc.NormalizeEmail(ctx, "not-an-email"); !errors.Is(err, ErrInvalidEmail) {
+		t.Errorf("NormalizeEmail() of an invalid email error = %v, want ErrInvalidEmail", err)
+	}
+}
+
+func TestUserService_NormalizeEmails(t *testing.T) {
+	ctx := context.Background()
+	svc, users, _ := newTestUserService(t, config.Config{EmailProviderRules: true})
+
+	// as migration 000006 left them, only lowercased
+	normalized := func(email string) *string { return &email }
+	older := users.addUser("j.doe@gmail.com", normalized("j.doe@gmail.com"), "hash")
+	newer := users.addUser("jdoe@gmail.com", normalized("jdoe@gmail.com"), "hash")
+	tagged := users.addUser("jdoe+news@gmail.com", normalized("jdoe+news@gmail.com"), "hash")
+	other := users.addUser("bob@Bücher.example", normalized("bob@bücher.example"), "hash")
+	users.addUser("alice@example.com", normalized("alice@example.com"), "hash")
+	collided := users.addUser("Alice@example.com", nil, "hash")
+	users.collisions[collided.ID] = "alice@example.com"
+
+	for run := 0; run < 2; run++ {
+		if err := svc.NormalizeEmails(ctx); err != nil {
+			t.Fatalf("NormalizeEmails() error: %v", err)
+		}
+
+		// the oldest account keeps the email, even though a newer one had it before
+		if got := users.users[older.ID].EmailNormalized; got == nil || *got != "jdoe@gmail.com" {
+			t.Errorf("older account normalized to %v, want jdoe@gmail.com", got)
+		}
+		if got := users.users[newer.ID].EmailNormalized; got != nil {
+			t.Errorf("newer account kept normalized email %q", *got)
+		}
+		if got := *users.users[other.ID].EmailNormalized; got != "bob@xn--bcher-kva.example" {
+			t.Errorf("internationalized email normalized to %q", got)
+		}
+		// collisions of the case rules the migration found stay
+		want := map[string]string{newer.ID: "jdoe@gmail.com", tagged.ID: "jdoe@gmail.com", collided.ID: "alice@example.com"}
+		if !maps.Equal(users.collisions, want) {
+			t.Errorf("run %d: collisions = %v, want %v", run+1, users.collisions, want)
+		}
+	}
+
+	// the collision is resolved by changing the email
+	users.users[tagged.ID].Email = "jdoe@example.com"
+	if err := svc.NormalizeEmails(ctx); err != nil {
+		t.Fatalf("NormalizeEmails() error: %v", err)
+	}
+	if _, ok := users.collisions[tagged.ID]; ok {
+		t.Error("NormalizeEmails() kept the collision of an account with a new email")
+	}
+	if got := users.users[tagged.ID].EmailNormalized; got == nil || *got != "jdoe@example.com" {
+		t.Errorf("account with a new email normalized to %v, want jdoe@example.com", got)
+	}
+}
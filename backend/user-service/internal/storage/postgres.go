@@ -3,6 +3,9 @@ package storage
 import (
 	"context"
 	"fmt"
+	"log"
+	"os"
+	"time"
 	"user-service/internal/config"
 	"user-service/internal/logger"
 
@@ -27,7 +30,13 @@ func NewPostgresGORM(ctx context.Context, cfg config.PostgresConfig) (*PostgresG
 	)
 
 	db, err := gorm.Open(postgres.Open(postgresURI), &gorm.Config{
-		Logger: gormlogger.Default.LogMode(gormlogger.Info),
+		Logger: gormlogger.New(log.New(os.Stdout, "\r\n", log.LstdFlags), gormlogger.Config{
+			SlowThreshold: 200 * time.Millisecond,
+			LogLevel:      gormlogger.Info,
+			Colorful:      true,
+			// logs queries without their values, which include password hashes
+			ParameterizedQueries: true,
+		}),
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database with GORM: %w", err)
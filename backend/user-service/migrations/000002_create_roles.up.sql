@@ -0,0 +1,31 @@
+CREATE TABLE IF NOT EXISTS roles (
+	name TEXT PRIMARY KEY,
+	description TEXT
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+	role TEXT NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+	permission TEXT NOT NULL,
+	PRIMARY KEY (role, permission)
+);
+
+CREATE TABLE IF NOT EXISTS user_roles (
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	role TEXT NOT NULL REFERENCES roles (name) ON DELETE CASCADE,
+	PRIMARY KEY (user_id, role)
+);
+
+INSERT INTO roles (name, description) VALUES
+	('user', 'Regular account'),
+	('admin', 'Manages users and roles')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role, permission) VALUES
+	('admin', 'users:list'),
+	('admin', 'roles:assign')
+ON CONFLICT DO NOTHING;
+
+-- every existing account is a regular user, admins are granted explicitly
+INSERT INTO user_roles (user_id, role)
+SELECT id, 'user' FROM users
+ON CONFLICT DO NOTHING;
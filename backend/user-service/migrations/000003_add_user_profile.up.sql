@@ -0,0 +1,5 @@
+ALTER TABLE users
+	ADD COLUMN IF NOT EXISTS display_name TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS avatar_url TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS locale TEXT NOT NULL DEFAULT '',
+	ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT '';
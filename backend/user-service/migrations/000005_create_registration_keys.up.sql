@@ -0,0 +1,6 @@
+-- the user a registration with an idempotency key created, so a retry gets the same user
+CREATE TABLE IF NOT EXISTS registration_keys (
+	key TEXT PRIMARY KEY,
+	user_id INTEGER NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+	created_at TIMESTAMP NOT NULL
+);
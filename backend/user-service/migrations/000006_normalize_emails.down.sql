@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS users_email_normalized_key;
+DROP TABLE IF EXISTS email_collisions;
+ALTER TABLE users DROP COLUMN IF EXISTS email_normalized;
@@ -0,0 +1,39 @@
+-- the form accounts are unique by, the normalize-emails command of user-service applies the rules
+-- SQL can not
+ALTER TABLE users ADD COLUMN IF NOT EXISTS email_normalized TEXT;
+
+-- accounts whose email only differs from an older account's in case or surrounding spaces. The
+-- older account keeps the address, these can not sign in with it until the accounts are merged
+-- or one email is changed
+CREATE TABLE IF NOT EXISTS email_collisions (
+	user_id INTEGER PRIMARY KEY REFERENCES users (id) ON DELETE CASCADE,
+	email_normalized TEXT NOT NULL,
+	kept_user_id INTEGER REFERENCES users (id) ON DELETE CASCADE,
+	found_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+INSERT INTO email_collisions (user_id, email_normalized, kept_user_id)
+SELECT id, normalized, kept_user_id FROM (
+	SELECT
+		id,
+		lower(btrim(email)) AS normalized,
+		first_value(id) OVER (PARTITION BY lower(btrim(email)) ORDER BY id) AS kept_user_id
+	FROM users
+) AS candidates
+WHERE id <> kept_user_id
+ON CONFLICT DO NOTHING;
+
+UPDATE users SET email_normalized = lower(btrim(email))
+WHERE id NOT IN (SELECT user_id FROM email_collisions);
+
+DO $$
+DECLARE
+	collision RECORD;
+BEGIN
+	FOR collision IN SELECT * FROM email_collisions ORDER BY email_normalized, user_id LOOP
+		RAISE WARNING 'user % collides with user % on email %, see email_collisions',
+			collision.user_id, collision.kept_user_id, collision.email_normalized;
+	END LOOP;
+END $$;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_normalized_key ON users (email_normalized);
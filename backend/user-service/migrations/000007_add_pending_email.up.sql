@@ -0,0 +1,2 @@
+-- the address a user asked to change their email to, it replaces the email once verified
+ALTER TABLE users ADD COLUMN IF NOT EXISTS pending_email TEXT;